@@ -7,6 +7,7 @@ import (
 	"github.com/cenkalti/backoff/v4"
 	"github.com/despondency/notifications-service/internal/messaging"
 	"github.com/despondency/notifications-service/internal/notification"
+	"github.com/despondency/notifications-service/internal/notificationpb"
 	"github.com/golang-migrate/migrate/v4"
 	_ "github.com/golang-migrate/migrate/v4/database/cockroachdb"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
@@ -14,9 +15,13 @@ import (
 	"github.com/julienschmidt/httprouter"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"reflect"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -24,14 +29,159 @@ import (
 type Config struct {
 	KafkaConfig
 	DBConfig
-	Port                   int `env:"PORT" envDefault:"8090"`
-	MaxOutstandingRoutines int `env:"MAX_OUTSTANDING_ROUTINES" envDefault:"100"`
+	SchedulerConfig
+	AuthConfig
+	RateLimitConfig
+	FrequencyCapConfig
+	CallbackConfig
+	RetentionConfig
+	BreakerConfig
+	ProviderChainConfig
+	SMTPConfig
+	// ListFollowerReads lists notifications from a snapshot a few seconds old that any replica can serve
+	ListFollowerReads bool `env:"LIST_FOLLOWER_READS" envDefault:"false"`
+	// TenantProvidersPath is a JSON file of the provider configuration of every tenant
+	TenantProvidersPath    string `env:"TENANT_PROVIDERS_PATH"`
+	Port                   int    `env:"PORT" envDefault:"8090"`
+	GRPCPort               int    `env:"GRPC_PORT" envDefault:"9090"`
+	MaxOutstandingRoutines int    `env:"MAX_OUTSTANDING_ROUTINES" envDefault:"100"`
+	// ShutdownTimeout is how long open requests get to finish on an interrupt
+	ShutdownTimeout time.Duration `env:"SHUTDOWN_TIMEOUT" envDefault:"30s"`
+}
+
+type FrequencyCapConfig struct {
+	// FrequencyCaps are rules like SMS:5/1h, at most that many notifications of a destination per recipient per window
+	FrequencyCaps                []string `env:"FREQUENCY_CAPS"`
+	FrequencyCapExemptPriorities []string `env:"FREQUENCY_CAP_EXEMPT_PRIORITIES" envDefault:"critical"`
+}
+
+type CallbackConfig struct {
+	// CallbackSigningSecrets is the secret every tenant's callbacks are signed with, like default:s3cr3t
+	CallbackSigningSecrets map[string]string `env:"CALLBACK_SIGNING_SECRETS"`
+	CallbackTimeout        time.Duration     `env:"CALLBACK_TIMEOUT" envDefault:"10s"`
+	CallbackMaxAttempts    int               `env:"CALLBACK_MAX_ATTEMPTS" envDefault:"10"`
+	CallbackMinBackoff     time.Duration     `env:"CALLBACK_MIN_BACKOFF" envDefault:"5s"`
+	CallbackMaxBackoff     time.Duration     `env:"CALLBACK_MAX_BACKOFF" envDefault:"1h"`
+	CallbackInterval       time.Duration     `env:"CALLBACK_INTERVAL" envDefault:"1s"`
+	CallbackBatchSize      int               `env:"CALLBACK_BATCH_SIZE" envDefault:"100"`
+	CallbackLease          time.Duration     `env:"CALLBACK_LEASE" envDefault:"1m"`
+	CallbackMaxRoutines    int               `env:"CALLBACK_MAX_ROUTINES" envDefault:"16"`
+	// CallbackAllowPrivate lets callbacks reach loopback and private addresses, only meant for local setups
+	CallbackAllowPrivate bool `env:"CALLBACK_ALLOW_PRIVATE_ADDRESSES" envDefault:"false"`
+}
+
+type RetentionConfig struct {
+	// RetentionPeriod is how long notifications are kept once final, 0 keeps them forever
+	RetentionPeriod time.Duration `env:"RETENTION_PERIOD" envDefault:"0"`
+	// RetentionPeriods overrides it per destination, like SMS:720h,EMAIL:0s
+	RetentionPeriods map[string]time.Duration `env:"RETENTION_PERIODS"`
+	// DedupWindow is how long a retried uuid must still be recognized, no retention period may be shorter
+	DedupWindow         time.Duration `env:"DEDUP_WINDOW" envDefault:"168h"`
+	RetentionInterval   time.Duration `env:"RETENTION_INTERVAL" envDefault:"1m"`
+	RetentionBatchSize  int           `env:"RETENTION_BATCH_SIZE" envDefault:"500"`
+	RetentionBatchPause time.Duration `env:"RETENTION_BATCH_PAUSE" envDefault:"200ms"`
+	// RetentionArchiveDir is where purged notifications are archived as gzipped JSONL, they aren't archived without one
+	RetentionArchiveDir string `env:"RETENTION_ARCHIVE_DIR"`
+}
+
+type BreakerConfig struct {
+	BreakerEnabled bool `env:"BREAKER_ENABLED" envDefault:"true"`
+	// BreakerWindowSize is how many of the last calls of a notificator its failure and slow call rates are taken over
+	BreakerWindowSize   int           `env:"BREAKER_WINDOW_SIZE" envDefault:"20"`
+	BreakerMinCalls     int           `env:"BREAKER_MIN_CALLS" envDefault:"10"`
+	BreakerFailureRate  float64       `env:"BREAKER_FAILURE_RATE" envDefault:"0.5"`
+	BreakerSlowCall     time.Duration `env:"BREAKER_SLOW_CALL" envDefault:"5s"`
+	BreakerSlowCallRate float64       `env:"BREAKER_SLOW_CALL_RATE" envDefault:"0.8"`
+	BreakerOpenFor      time.Duration `env:"BREAKER_OPEN_FOR" envDefault:"30s"`
+	BreakerProbes       int           `env:"BREAKER_PROBES" envDefault:"3"`
+}
+
+type ProviderChainConfig struct {
+	// SMSProviders is the failover chain of SMS providers, like primary,backup, or weighted like vendor-a:3,vendor-b:1
+	SMSProviders   []string `env:"SMS_PROVIDERS" envDefault:"sms"`
+	EmailProviders []string `env:"EMAIL_PROVIDERS" envDefault:"email"`
+	SlackProviders []string `env:"SLACK_PROVIDERS" envDefault:"slack"`
+	// SMSSenderIDs is who the SMS of every SMS provider appear to come from, like vendor-a:SHOP,vendor-b:SHOP-B
+	SMSSenderIDs map[string]string `env:"SMS_SENDER_IDS"`
+	// SlackWorkspaces and SlackTokens are the workspace and bot token of every Slack provider
+	SlackWorkspaces map[string]string `env:"SLACK_WORKSPACES"`
+	SlackTokens     map[string]string `env:"SLACK_TOKENS"`
+	// ProviderHealthDecay is how much of a provider's health score its latest call makes up
+	ProviderHealthDecay float64       `env:"PROVIDER_HEALTH_DECAY" envDefault:"0.2"`
+	ProviderDemoteBelow float64       `env:"PROVIDER_DEMOTE_BELOW" envDefault:"0.5"`
+	ProviderDemoteFor   time.Duration `env:"PROVIDER_DEMOTE_FOR" envDefault:"1m"`
+}
+
+type SMTPConfig struct {
+	// EmailFrom is the sender address of the default email providers, EmailReplyTo where replies to them go
+	EmailFrom    string `env:"EMAIL_FROM"`
+	EmailReplyTo string `env:"EMAIL_REPLY_TO"`
+	// SMTPRelays is the host:port of the relay of every email provider, a provider without one only logs its emails
+	SMTPRelays map[string]string `env:"SMTP_RELAYS"`
+	// SMTPSecurity is starttls, tls or none
+	SMTPSecurity string `env:"SMTP_SECURITY" envDefault:"starttls"`
+	// SMTPAuth is plain or login, the relays without a username aren't authenticated
+	SMTPAuth        string            `env:"SMTP_AUTH" envDefault:"plain"`
+	SMTPUsernames   map[string]string `env:"SMTP_USERNAMES"`
+	SMTPPasswords   map[string]string `env:"SMTP_PASSWORDS"`
+	SMTPMaxConns    int               `env:"SMTP_MAX_CONNS" envDefault:"4"`
+	SMTPIdleTimeout time.Duration     `env:"SMTP_IDLE_TIMEOUT" envDefault:"30s"`
+	SMTPTimeout     time.Duration     `env:"SMTP_TIMEOUT" envDefault:"10s"`
+}
+
+type SchedulerConfig struct {
+	SchedulerInterval  time.Duration `env:"SCHEDULER_INTERVAL" envDefault:"1s"`
+	SchedulerBatchSize int           `env:"SCHEDULER_BATCH_SIZE" envDefault:"100"`
+	// SchedulerLease is how long a released notification has to be delivered before another scheduler releases it again
+	SchedulerLease time.Duration `env:"SCHEDULER_LEASE" envDefault:"5m"`
+}
+
+type AuthConfig struct {
+	AuthEnabled  bool          `env:"AUTH_ENABLED" envDefault:"true"`
+	AdminAPIKey  string        `env:"ADMIN_API_KEY"`
+	AuthCacheTTL time.Duration `env:"AUTH_CACHE_TTL" envDefault:"30s"`
+}
+
+type RateLimitConfig struct {
+	// CallerRateLimit is how many notifications per second a caller may send, 0 disables it
+	CallerRateLimit float64 `env:"CALLER_RATE_LIMIT" envDefault:"100"`
+	CallerBurst     float64 `env:"CALLER_BURST" envDefault:"200"`
+	// DestinationRateLimits is how many notifications per second all callers together may send to a destination
+	DestinationRateLimits map[string]float64 `env:"DESTINATION_RATE_LIMITS"`
+	// DestinationRateLimitShards is how many buckets the limit of a destination is split over
+	DestinationRateLimitShards int `env:"DESTINATION_RATE_LIMIT_SHARDS" envDefault:"8"`
+	// BucketIdleAfter is how long a bucket nothing was taken from is kept, 0 keeps it forever
+	BucketIdleAfter time.Duration `env:"RATE_LIMIT_BUCKET_IDLE_AFTER" envDefault:"1h"`
+	BucketCleanup   time.Duration `env:"RATE_LIMIT_BUCKET_CLEANUP_INTERVAL" envDefault:"10m"`
 }
 
 type KafkaConfig struct {
 	BootstrapServers   string `env:"KAFKA_BOOTSTRAP_SERVERS"`
 	OutstandingGroupID string `env:"OUTSTANDING_GROUP_ID"`
 	OutstandingTopic   string `env:"OUTSTANDING_TOPIC"`
+	// LaneWeights is how many messages are polled from each priority lane per round
+	LaneWeights       map[string]int `env:"LANE_WEIGHTS" envDefault:"critical:8,high:4,normal:2,bulk:1"`
+	LagReportInterval time.Duration  `env:"LAG_REPORT_INTERVAL" envDefault:"30s"`
+	// StatusEventsTopic is where every state transition is published for the status event streams
+	StatusEventsTopic   string        `env:"STATUS_EVENTS_TOPIC" envDefault:"notification-status-events"`
+	StatusRelayInterval time.Duration `env:"STATUS_RELAY_INTERVAL" envDefault:"500ms"`
+	StatusRelayBatch    int           `env:"STATUS_RELAY_BATCH_SIZE" envDefault:"500"`
+	// StatusRelayLease is how long a relay holds a batch while publishing it, before another relay may claim it again
+	StatusRelayLease time.Duration `env:"STATUS_RELAY_LEASE" envDefault:"30s"`
+	// StatusStreamsMax caps the status event streams of an instance, each has a consumer of its own, 0 is no cap
+	StatusStreamsMax       int `env:"STATUS_STREAMS_MAX" envDefault:"200"`
+	StatusStreamsPerTenant int `env:"STATUS_STREAMS_PER_TENANT" envDefault:"10"`
+	// DeadLetterTopic gets the outstanding messages that failed DeadLetterMaxAttempts times in a row
+	DeadLetterTopic        string        `env:"DEAD_LETTER_TOPIC" envDefault:"notifications-dead-letter"`
+	DeadLetterMaxAttempts  int           `env:"DEAD_LETTER_MAX_ATTEMPTS" envDefault:"5"`
+	DeadLetterRetryBackoff time.Duration `env:"DEAD_LETTER_RETRY_BACKOFF" envDefault:"1s"`
+	// RetryTiers are the delays notifications refused for now wait before they are dispatched again, one topic each
+	RetryTiers       []time.Duration `env:"RETRY_TIERS" envDefault:"10s,1m,10m,1h"`
+	RetryMaxAttempts int             `env:"RETRY_MAX_ATTEMPTS" envDefault:"5"`
+	// RetryMaxCircuitOpen is how many times a notification is parked while its breakers are open, 0 never parks it
+	RetryMaxCircuitOpen int `env:"RETRY_MAX_CIRCUIT_OPEN" envDefault:"120"`
+	// ExpireAfter is how long past due a notification is still dispatched, 0 never expires it
+	ExpireAfter time.Duration `env:"EXPIRE_AFTER" envDefault:"24h"`
 }
 
 type DBConfig struct {
@@ -42,7 +192,7 @@ type DBConfig struct {
 func main() {
 	ctx := context.Background()
 	cfg := Config{}
-	if err := env.Parse(&cfg); err != nil {
+	if err := env.ParseWithFuncs(&cfg, mapParsers); err != nil {
 		panic(err)
 	}
 
@@ -67,38 +217,262 @@ func main() {
 
 	pers := notification.NewCRDBPersistence(connPool)
 
-	outstandingKafkaProducer, err :=
-		messaging.NewKafkaProducer(cfg.BootstrapServers, cfg.OutstandingTopic, "notifications-notifications", "all")
+	lanes, err := notification.NewLanes(cfg.OutstandingTopic, cfg.LaneWeights)
 	if err != nil {
-		log.Panic().Err(err).Msg("cannot create kafka internal producer")
+		log.Panic().Err(err).Msg("cannot create priority lanes")
 	}
 
-	is, err := notification.NewInternalService(outstandingKafkaProducer, pers)
+	outstandingKafkaProducers := make(map[notification.Priority]*messaging.KafkaProducer, len(lanes))
+	for _, lane := range lanes {
+		outstandingKafkaProducers[lane.Priority], err =
+			messaging.NewKafkaProducer(cfg.BootstrapServers, lane.Topic, "notifications-notifications", "all")
+		if err != nil {
+			log.Panic().Err(err).Msg("cannot create kafka internal producer")
+		}
+	}
+
+	is, err := notification.NewInternalService(outstandingKafkaProducers, pers, cfg.ListFollowerReads)
 	if err != nil {
 		log.Panic().Err(err).Msg("cannot create internal service")
 	}
 
-	notifiers := &notification.DelegatingNotificator{
-		Notificators: []notification.Notificator{&notification.SMSNotificator{}, &notification.EmailNotificator{}, &notification.SlackNotificator{}},
+	providerConfigs, err := notification.LoadProviderConfigs(cfg.TenantProvidersPath)
+	if err != nil {
+		log.Panic().Err(err).Msg("cannot load tenant provider configs")
+	}
+
+	var breakerConfig *notification.BreakerConfig
+	if cfg.BreakerEnabled {
+		breakerConfig = &notification.BreakerConfig{
+			WindowSize:   cfg.BreakerWindowSize,
+			MinCalls:     cfg.BreakerMinCalls,
+			FailureRate:  cfg.BreakerFailureRate,
+			SlowCall:     cfg.BreakerSlowCall,
+			SlowCallRate: cfg.BreakerSlowCallRate,
+			OpenFor:      cfg.BreakerOpenFor,
+			Probes:       cfg.BreakerProbes,
+		}
+	}
+	if len(cfg.SMTPRelays) > 0 && cfg.EmailFrom == "" {
+		log.Panic().Msg("SMTP_RELAYS needs an EMAIL_FROM to send from")
+	}
+	smtpPools := make(map[string]*notification.SMTPPool, len(cfg.SMTPRelays))
+	for name, addr := range cfg.SMTPRelays {
+		smtpPools[name], err = notification.NewSMTPPool(&notification.SMTPConfig{
+			Addr:        addr,
+			Security:    notification.SMTPSecurity(cfg.SMTPSecurity),
+			Auth:        notification.SMTPAuthMechanism(cfg.SMTPAuth),
+			Username:    cfg.SMTPUsernames[name],
+			Password:    cfg.SMTPPasswords[name],
+			MaxConns:    cfg.SMTPMaxConns,
+			IdleTimeout: cfg.SMTPIdleTimeout,
+			Timeout:     cfg.SMTPTimeout,
+		})
+		if err != nil {
+			log.Panic().Err(err).Str("provider", name).Msg("cannot create smtp relay")
+		}
+	}
+
+	providers := make([]*notification.Provider, 0)
+	for _, chain := range []struct {
+		entries        []string
+		newNotificator func(name string) notification.Notificator
+	}{
+		{cfg.SMSProviders, func(name string) notification.Notificator {
+			return &notification.SMSNotificator{SenderID: cfg.SMSSenderIDs[name]}
+		}},
+		{cfg.EmailProviders, func(name string) notification.Notificator {
+			return &notification.EmailNotificator{From: cfg.EmailFrom, ReplyTo: cfg.EmailReplyTo, SMTP: smtpPools[name]}
+		}},
+		{cfg.SlackProviders, func(name string) notification.Notificator {
+			return &notification.SlackNotificator{Workspace: cfg.SlackWorkspaces[name], Token: cfg.SlackTokens[name]}
+		}},
+	} {
+		chainProviders, errParse := notification.ParseProviders(chain.entries, chain.newNotificator)
+		if errParse != nil {
+			log.Panic().Err(errParse).Msg("cannot parse providers")
+		}
+		providers = append(providers, chainProviders...)
+	}
+	// tenant email providers without a relay of their own send through the relay of the first email provider
+	var tenantSMTP *notification.SMTPPool
+	providerNames := make(map[notification.Destination]map[string]struct{}, 3)
+	for _, p := range providers {
+		dest := p.Notificator.Destination()
+		if providerNames[dest] == nil {
+			providerNames[dest] = make(map[string]struct{})
+			if dest == notification.Email {
+				tenantSMTP = smtpPools[p.Name]
+			}
+		}
+		providerNames[dest][p.Name] = struct{}{}
+	}
+	for _, perName := range []struct {
+		dest   notification.Destination
+		config string
+		names  map[string]struct{}
+	}{
+		{notification.Email, "SMTP_RELAYS", mapKeys(smtpPools)},
+		{notification.SMS, "SMS_SENDER_IDS", mapKeys(cfg.SMSSenderIDs)},
+		{notification.Slack, "SLACK_WORKSPACES", mapKeys(cfg.SlackWorkspaces)},
+		{notification.Slack, "SLACK_TOKENS", mapKeys(cfg.SlackTokens)},
+	} {
+		for name := range perName.names {
+			if _, ok := providerNames[perName.dest][name]; !ok {
+				log.Panic().Str("provider", name).Msgf("%s of an unknown %s provider", perName.config, perName.dest)
+			}
+		}
+	}
+	notifiers, err := notification.NewDelegatingNotificator(providers,
+		notification.NewTenantNotificators(providerConfigs,
+			&notification.EmailConfig{From: cfg.EmailFrom, ReplyTo: cfg.EmailReplyTo}, smtpPools, tenantSMTP),
+		breakerConfig, &notification.HealthConfig{
+			Decay:       cfg.ProviderHealthDecay,
+			DemoteBelow: cfg.ProviderDemoteBelow,
+			DemoteFor:   cfg.ProviderDemoteFor,
+		})
+	if err != nil {
+		log.Panic().Err(err).Msg("cannot create notificators")
+	}
+
+	frequencyCaps, err := notification.ParseFrequencyCaps(cfg.FrequencyCaps)
+	if err != nil {
+		log.Panic().Err(err).Msg("cannot parse frequency caps")
+	}
+	exemptPriorities, err := notification.ParseExemptPriorities(cfg.FrequencyCapExemptPriorities)
+	if err != nil {
+		log.Panic().Err(err).Msg("cannot parse frequency cap exempt priorities")
+	}
+	capper := notification.NewFrequencyCapper(pers, frequencyCaps, exemptPriorities)
+
+	deadLetterProducer, err := messaging.NewKafkaProducer(cfg.BootstrapServers, cfg.DeadLetterTopic, "notifications-dead-letter", "all")
+	if err != nil {
+		log.Panic().Err(err).Msg("cannot create kafka dead letter producer")
+	}
+
+	retryTiers, err := notification.NewRetryTiers(cfg.OutstandingTopic, cfg.RetryTiers)
+	if err != nil {
+		log.Panic().Err(err).Msg("cannot create retry tiers")
+	}
+	retryProducers := make(map[string]*messaging.KafkaProducer, len(retryTiers))
+	for _, tier := range retryTiers {
+		retryProducers[tier.Topic], err =
+			messaging.NewKafkaProducer(cfg.BootstrapServers, tier.Topic, "notifications-retries", "all")
+		if err != nil {
+			log.Panic().Err(err).Msg("cannot create kafka retry producer")
+		}
 	}
 
 	ous, err := notification.NewOutstandingService(cfg.BootstrapServers, cfg.OutstandingGroupID, "earliest",
-		"false", cfg.OutstandingTopic, pers, notifiers, cfg.MaxOutstandingRoutines)
+		"false", lanes, pers, notifiers, capper, &notification.DeadLetterQueue{
+			Producer:     deadLetterProducer,
+			MaxAttempts:  cfg.DeadLetterMaxAttempts,
+			RetryBackoff: cfg.DeadLetterRetryBackoff,
+		}, &notification.RetryQueue{
+			Tiers:          retryTiers,
+			Producers:      retryProducers,
+			MaxAttempts:    cfg.RetryMaxAttempts,
+			MaxCircuitOpen: cfg.RetryMaxCircuitOpen,
+		}, cfg.ExpireAfter, cfg.MaxOutstandingRoutines, cfg.LagReportInterval)
 
 	if err != nil {
 		log.Panic().Err(err).Msg("cannot create outstanding service")
 	}
 
+	scheduler := notification.NewScheduler(pers, ous, cfg.SchedulerInterval, cfg.SchedulerBatchSize, cfg.SchedulerLease)
+
+	callbacks, err := notification.NewCallbackDispatcher(pers, notification.NewCallbackClient(cfg.CallbackTimeout, cfg.CallbackAllowPrivate), cfg.CallbackSigningSecrets,
+		notification.CallbackRetryPolicy{
+			MaxAttempts: cfg.CallbackMaxAttempts,
+			MinBackoff:  cfg.CallbackMinBackoff,
+			MaxBackoff:  cfg.CallbackMaxBackoff,
+		}, cfg.CallbackInterval, cfg.CallbackBatchSize, cfg.CallbackLease, cfg.CallbackMaxRoutines)
+	if err != nil {
+		log.Panic().Err(err).Msg("cannot create callback dispatcher")
+	}
+
+	statusEventsProducer, err := messaging.NewKafkaProducer(cfg.BootstrapServers, cfg.StatusEventsTopic, "notifications-status-events", "all")
+	if err != nil {
+		log.Panic().Err(err).Msg("cannot create kafka status events producer")
+	}
+	statusRelay := notification.NewStatusRelay(pers, statusEventsProducer, cfg.StatusRelayInterval, cfg.StatusRelayBatch,
+		cfg.StatusRelayLease)
+
+	retention, err := notification.NewRetentionPolicy(cfg.RetentionPeriod, cfg.RetentionPeriods, cfg.DedupWindow)
+	if err != nil {
+		log.Panic().Err(err).Msg("cannot create retention policy")
+	}
+	var purger *notification.Purger
+	if retention.Enabled() {
+		var archiver notification.Archiver
+		if cfg.RetentionArchiveDir != "" {
+			archiver, err = notification.NewFileArchiver(cfg.RetentionArchiveDir)
+			if err != nil {
+				log.Panic().Err(err).Msg("cannot create retention archive")
+			}
+		}
+		purger = notification.NewPurger(pers, retention, archiver, cfg.RetentionInterval, cfg.RetentionBatchSize,
+			cfg.RetentionBatchPause)
+	}
+
 	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
 
+	apiKeyService := notification.NewAPIKeyService(pers)
+	auth := notification.NewAuthenticator(apiKeyService, cfg.AuthEnabled, cfg.AdminAPIKey, cfg.AuthCacheTTL)
+	if !cfg.AuthEnabled {
+		log.Warn().Msg("authentication is disabled, every request acts as the default tenant")
+	}
+
+	destinationLimits, err := notification.NewDestinationLimits(cfg.DestinationRateLimits)
+	if err != nil {
+		log.Panic().Err(err).Msg("cannot create destination rate limits")
+	}
+	limiter, err := notification.NewTokenBucketLimiter(pers,
+		notification.Limit{Rate: cfg.CallerRateLimit, Burst: cfg.CallerBurst}, destinationLimits, cfg.DestinationRateLimitShards,
+		cfg.BucketIdleAfter, cfg.BucketCleanup)
+	if err != nil {
+		log.Panic().Err(err).Msg("cannot create rate limiter")
+	}
+
 	router := httprouter.New()
-	endpoint := notification.NewEndpoint(is)
-	router.POST("/notification", endpoint.CreateNotification)
+	endpoint := notification.NewEndpoint(is, limiter)
+	router.POST("/notification", auth.Authenticate(endpoint.CreateNotification))
+	router.POST("/notifications", auth.Authenticate(endpoint.CreateNotifications))
+	router.GET("/notification/:uuid", auth.Authenticate(endpoint.GetNotification))
+	router.GET("/notifications", auth.Authenticate(endpoint.ListNotifications))
+	router.DELETE("/notification/:uuid", auth.Authenticate(endpoint.CancelNotification))
+	router.POST("/notifications/status", auth.Authenticate(endpoint.GetNotificationStatuses))
+	statusEventsEndpoint := notification.NewStatusEventsEndpoint(notification.NewKafkaStatusFeed(cfg.BootstrapServers, cfg.StatusEventsTopic),
+		cfg.StatusStreamsMax, cfg.StatusStreamsPerTenant)
+	router.GET("/notifications/events", auth.Authenticate(statusEventsEndpoint.StreamStatusEvents))
+	templateEndpoint := notification.NewTemplateEndpoint(notification.NewTemplateService(pers))
+	router.POST("/templates", auth.Authenticate(templateEndpoint.CreateTemplate))
+	router.GET("/templates", auth.Authenticate(templateEndpoint.ListTemplates))
+	router.GET("/templates/:name", auth.Authenticate(templateEndpoint.GetTemplate))
+	router.PUT("/templates/:name", auth.Authenticate(templateEndpoint.UpdateTemplate))
+	router.DELETE("/templates/:name", auth.Authenticate(templateEndpoint.DeleteTemplate))
+	adminEndpoint := notification.NewAdminEndpoint(ous, notifiers, notifiers)
+	router.GET("/admin/lag", auth.Admin(adminEndpoint.GetLag))
+	router.GET("/admin/breakers", auth.Admin(adminEndpoint.GetBreakers))
+	router.GET("/admin/providers", auth.Admin(adminEndpoint.GetProviders))
+	apiKeyEndpoint := notification.NewAPIKeyEndpoint(apiKeyService)
+	router.POST("/admin/api-keys", auth.Admin(apiKeyEndpoint.CreateAPIKey))
+	router.GET("/admin/api-keys", auth.Admin(apiKeyEndpoint.ListAPIKeys))
+	router.POST("/admin/api-keys/:id/rotate", auth.Admin(apiKeyEndpoint.RotateAPIKey))
+	router.DELETE("/admin/api-keys/:id", auth.Admin(apiKeyEndpoint.RevokeAPIKey))
 
 	srv := http.Server{
 		Addr:    fmt.Sprintf(":%d", cfg.Port),
 		Handler: router,
 	}
+	srv.RegisterOnShutdown(statusEventsEndpoint.Stop)
+
+	grpcSrv := grpc.NewServer(grpc.UnaryInterceptor(auth.UnaryInterceptor), grpc.StreamInterceptor(auth.StreamInterceptor))
+	notificationpb.RegisterNotificationServiceServer(grpcSrv, notification.NewGRPCServer(is, limiter))
+	grpcListener, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.GRPCPort))
+	if err != nil {
+		log.Panic().Err(err).Msg("cannot listen for grpc")
+	}
 
 	wait := make(chan struct{})
 	go func() {
@@ -107,11 +481,29 @@ func main() {
 		<-sigint
 
 		// We received an interrupt signal, shut down.
-		if err := srv.Shutdown(context.Background()); err != nil {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
 			// Error from closing listeners, or context timeout:
 			log.Printf("HTTP server Shutdown: %v", err)
 		}
+		grpcSrv.GracefulStop()
+		scheduler.Stop()
+		callbacks.Stop()
+		limiter.Stop()
+		if purger != nil {
+			purger.Stop()
+		}
 		ous.Stop()
+		deadLetterProducer.Stop()
+		for _, p := range retryProducers {
+			p.Stop()
+		}
+		statusRelay.Stop()
+		statusEventsProducer.Stop()
+		for _, p := range smtpPools {
+			p.Close()
+		}
 		connPool.Close()
 		close(wait)
 	}()
@@ -122,11 +514,96 @@ func main() {
 			log.Fatal().Err(err).Msg(fmt.Sprintf("HTTP server ListenAndServe"))
 		}
 	}()
-	log.Info().Msg(fmt.Sprintf("notifications notifications started at port %d", cfg.Port))
+	go func() {
+		if err := grpcSrv.Serve(grpcListener); err != nil {
+			log.Fatal().Err(err).Msg("gRPC server Serve")
+		}
+	}()
+	log.Info().Msg(fmt.Sprintf("notifications notifications started at port %d, grpc at port %d", cfg.Port, cfg.GRPCPort))
 
 	<-wait
 }
 
+// mapParsers parse settings like a:1,b:2, a comma or backslash in a value is escaped with a backslash
+var mapParsers = map[reflect.Type]env.ParserFunc{
+	reflect.TypeOf(map[string]string{}): mapParser(func(v string) (string, error) {
+		return v, nil
+	}),
+	reflect.TypeOf(map[string]int{}):           mapParser(strconv.Atoi),
+	reflect.TypeOf(map[string]time.Duration{}): mapParser(time.ParseDuration),
+	reflect.TypeOf(map[string]float64{}): mapParser(func(v string) (float64, error) {
+		return strconv.ParseFloat(v, 64)
+	}),
+}
+
+func mapParser[V any](parseValue func(string) (V, error)) env.ParserFunc {
+	return func(s string) (interface{}, error) {
+		m := make(map[string]V)
+		if s == "" {
+			return m, nil
+		}
+		for _, pair := range splitUnescaped(s) {
+			k, v, ok := strings.Cut(pair, ":")
+			if !ok {
+				return nil, fmt.Errorf("%q must look like key:value", pair)
+			}
+			value, err := parseValue(unescape(strings.TrimSpace(v)))
+			if err != nil {
+				return nil, fmt.Errorf("value of %q: %w", k, err)
+			}
+			m[strings.TrimSpace(k)] = value
+		}
+		return m, nil
+	}
+}
+
+func mapKeys[V any](m map[string]V) map[string]struct{} {
+	keys := make(map[string]struct{}, len(m))
+	for k := range m {
+		keys[k] = struct{}{}
+	}
+	return keys
+}
+
+// splitUnescaped splits s on the commas that aren't escaped as \, so values like passwords can have commas
+func splitUnescaped(s string) []string {
+	var (
+		pairs   []string
+		start   int
+		escaped bool
+	)
+	for i := 0; i < len(s); i++ {
+		switch {
+		case escaped:
+			escaped = false
+		case s[i] == '\\':
+			escaped = true
+		case s[i] == ',':
+			pairs = append(pairs, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(pairs, s[start:])
+}
+
+// unescape turns \, into , and \\ into \
+func unescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	b := strings.Builder{}
+	escaped := false
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && !escaped {
+			escaped = true
+			continue
+		}
+		escaped = false
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
 func runMigrations(dbConnectString string) {
 	crdbMigrationString := strings.Replace(dbConnectString, "postgres", "cockroachdb", 1)
 	err := backoff.Retry(func() error {
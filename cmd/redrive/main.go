@@ -0,0 +1,257 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/despondency/notifications-service/internal/messaging"
+	"github.com/google/uuid"
+	"os"
+	"strings"
+)
+
+const timeoutMs = 10000
+
+// redrive re-publishes selected dead letters to the topic they were read from, or to -to.
+// It never commits, so it can be run again
+func main() {
+	bootstrapServers := flag.String("bootstrap-servers", os.Getenv("KAFKA_BOOTSTRAP_SERVERS"), "kafka bootstrap servers")
+	deadLetterTopic := flag.String("dead-letter-topic", envOr("DEAD_LETTER_TOPIC", "notifications-dead-letter"), "dead letter topic to read")
+	to := flag.String("to", "", "topic to re-publish to, defaults to the one every dead letter was read from")
+	partition := flag.Int("partition", -1, "only the dead letters of this partition of the dead letter topic")
+	fromOffset := flag.Int64("from-offset", 0, "only the dead letters at or after this offset of the dead letter topic")
+	toOffset := flag.Int64("to-offset", -1, "only the dead letters at or before this offset of the dead letter topic")
+	uuids := flag.String("uuids", "", "only the dead letters of these comma separated notification uuids")
+	errorContains := flag.String("error-contains", "", "only the dead letters whose error contains this")
+	all := flag.Bool("all", false, "redrive every dead letter, required when no other selection is given")
+	dryRun := flag.Bool("dry-run", false, "only list the selected dead letters")
+	flag.Parse()
+
+	s := &selection{
+		partition:     int32(*partition),
+		fromOffset:    *fromOffset,
+		toOffset:      *toOffset,
+		uuids:         make(map[uuid.UUID]struct{}),
+		errorContains: *errorContains,
+	}
+	for _, id := range strings.Split(*uuids, ",") {
+		if id == "" {
+			continue
+		}
+		nUUID, err := uuid.Parse(strings.TrimSpace(id))
+		if err != nil {
+			exit(fmt.Errorf("uuid %q: %w", id, err))
+		}
+		s.uuids[nUUID] = struct{}{}
+	}
+	if *bootstrapServers == "" {
+		exit(fmt.Errorf("-bootstrap-servers or KAFKA_BOOTSTRAP_SERVERS is required"))
+	}
+	if !*all && s.partition < 0 && s.fromOffset == 0 && s.toOffset < 0 && len(s.uuids) == 0 && s.errorContains == "" {
+		exit(fmt.Errorf("select dead letters with -partition, -from-offset, -to-offset, -uuids or -error-contains, or pass -all"))
+	}
+	r := &redriver{
+		bootstrapServers: *bootstrapServers,
+		deadLetterTopic:  *deadLetterTopic,
+		to:               *to,
+		dryRun:           *dryRun,
+		producers:        make(map[string]*messaging.KafkaProducer),
+	}
+	redriven, err := r.redrive(s)
+	r.stop()
+	if err != nil {
+		exit(err)
+	}
+	if *dryRun {
+		fmt.Printf("%d dead letters selected\n", redriven)
+		return
+	}
+	fmt.Printf("%d dead letters redriven\n", redriven)
+}
+
+// selection keeps a dead letter when it matches every criterion that was given
+type selection struct {
+	partition     int32
+	fromOffset    int64
+	toOffset      int64
+	uuids         map[uuid.UUID]struct{}
+	errorContains string
+}
+
+func (s *selection) matches(msg *kafka.Message, dl *messaging.DeadLetter) bool {
+	offset := int64(msg.TopicPartition.Offset)
+	if (s.partition >= 0 && msg.TopicPartition.Partition != s.partition) || offset < s.fromOffset ||
+		(s.toOffset >= 0 && offset > s.toOffset) {
+		return false
+	}
+	if s.errorContains != "" && !strings.Contains(dl.Error, s.errorContains) {
+		return false
+	}
+	if len(s.uuids) == 0 {
+		return true
+	}
+	// a payload that can't be decoded has no uuid to match
+	var payload struct {
+		UUID uuid.UUID `json:"uuid"`
+	}
+	if err := json.Unmarshal(msg.Value, &payload); err != nil {
+		return false
+	}
+	_, ok := s.uuids[payload.UUID]
+	return ok
+}
+
+type redriver struct {
+	bootstrapServers string
+	deadLetterTopic  string
+	to               string
+	dryRun           bool
+	producers        map[string]*messaging.KafkaProducer
+}
+
+func (r *redriver) redrive(s *selection) (int, error) {
+	consumer, err := kafka.NewConsumer(&kafka.ConfigMap{
+		"bootstrap.servers":  r.bootstrapServers,
+		"group.id":           "notifications-redrive-" + uuid.NewString(),
+		"enable.auto.commit": "false"})
+	if err != nil {
+		return 0, err
+	}
+	defer consumer.Close()
+	ends, err := r.assign(consumer, s)
+	if err != nil {
+		return 0, err
+	}
+	redriven := 0
+	for len(ends) > 0 {
+		switch e := consumer.Poll(timeoutMs).(type) {
+		case *kafka.Message:
+			p := e.TopicPartition.Partition
+			end, ok := ends[p]
+			if !ok {
+				continue
+			}
+			if int64(e.TopicPartition.Offset) >= end-1 {
+				delete(ends, p)
+			}
+			if int64(e.TopicPartition.Offset) >= end {
+				// dead lettered after the redrive started
+				continue
+			}
+			dl, errParse := messaging.ParseDeadLetter(e.Headers)
+			if errParse != nil {
+				fmt.Fprintf(os.Stderr, "skipped %d:%d: %v\n", p, e.TopicPartition.Offset, errParse)
+				continue
+			}
+			if !s.matches(e, dl) {
+				continue
+			}
+			fmt.Printf("%d:%d from %s %d:%d after %d attempts at %s: %s\n", p, e.TopicPartition.Offset,
+				dl.Topic, dl.Partition, dl.Offset, dl.Attempts, dl.FailedAt, dl.Error)
+			if !r.dryRun {
+				if err = r.republish(e, dl); err != nil {
+					return redriven, fmt.Errorf("could not redrive %d:%d: %w", p, e.TopicPartition.Offset, err)
+				}
+			}
+			redriven++
+		case kafka.Error:
+			return redriven, e
+		case nil:
+			if err = r.dropRead(consumer, ends); err != nil {
+				return redriven, err
+			}
+			if len(ends) > 0 {
+				return redriven, fmt.Errorf("no dead letters arrived for %dms, %d partitions weren't read to their end", timeoutMs, len(ends))
+			}
+		}
+	}
+	return redriven, nil
+}
+
+// dropRead drops the partitions the consumer is past the end of, the end may be a marker no message is read at
+func (r *redriver) dropRead(consumer *kafka.Consumer, ends map[int32]int64) error {
+	tps := make([]kafka.TopicPartition, 0, len(ends))
+	for p := range ends {
+		tps = append(tps, kafka.TopicPartition{Topic: &r.deadLetterTopic, Partition: p})
+	}
+	positions, err := consumer.Position(tps)
+	if err != nil {
+		return err
+	}
+	for _, tp := range positions {
+		if tp.Offset >= 0 && int64(tp.Offset) >= ends[tp.Partition] {
+			delete(ends, tp.Partition)
+		}
+	}
+	return nil
+}
+
+// assign reads every selected partition from its first selected offset
+func (r *redriver) assign(consumer *kafka.Consumer, s *selection) (map[int32]int64, error) {
+	md, err := consumer.GetMetadata(&r.deadLetterTopic, false, timeoutMs)
+	if err != nil {
+		return nil, err
+	}
+	ends := make(map[int32]int64)
+	assignments := make([]kafka.TopicPartition, 0)
+	for _, p := range md.Topics[r.deadLetterTopic].Partitions {
+		if s.partition >= 0 && p.ID != s.partition {
+			continue
+		}
+		low, high, err := consumer.QueryWatermarkOffsets(r.deadLetterTopic, p.ID, timeoutMs)
+		if err != nil {
+			return nil, err
+		}
+		start := low
+		if s.fromOffset > start {
+			start = s.fromOffset
+		}
+		end := high
+		if s.toOffset >= 0 && s.toOffset+1 < end {
+			end = s.toOffset + 1
+		}
+		if start >= end {
+			continue
+		}
+		ends[p.ID] = end
+		assignments = append(assignments, kafka.TopicPartition{Topic: &r.deadLetterTopic, Partition: p.ID, Offset: kafka.Offset(start)})
+	}
+	return ends, consumer.Assign(assignments)
+}
+
+// republish produces the original message, without the dead letter headers
+func (r *redriver) republish(msg *kafka.Message, dl *messaging.DeadLetter) error {
+	topic := r.to
+	if topic == "" {
+		topic = dl.Topic
+	}
+	producer, ok := r.producers[topic]
+	if !ok {
+		var err error
+		producer, err = messaging.NewKafkaProducer(r.bootstrapServers, topic, "notifications-redrive", "all")
+		if err != nil {
+			return err
+		}
+		r.producers[topic] = producer
+	}
+	return producer.ProduceMessage(msg.Key, msg.Value, messaging.StripDeadLetterHeaders(msg.Headers))
+}
+
+func (r *redriver) stop() {
+	for _, p := range r.producers {
+		p.Stop()
+	}
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func exit(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
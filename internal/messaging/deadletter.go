@@ -0,0 +1,92 @@
+package messaging
+
+import (
+	"fmt"
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// the headers a dead letter carries on top of the ones of the original message
+const (
+	DeadLetterHeaderPrefix    = "dlq-"
+	DeadLetterErrorHeader     = DeadLetterHeaderPrefix + "error"
+	DeadLetterAttemptsHeader  = DeadLetterHeaderPrefix + "attempts"
+	DeadLetterTopicHeader     = DeadLetterHeaderPrefix + "source-topic"
+	DeadLetterPartitionHeader = DeadLetterHeaderPrefix + "source-partition"
+	DeadLetterOffsetHeader    = DeadLetterHeaderPrefix + "source-offset"
+	DeadLetterFailedAtHeader  = DeadLetterHeaderPrefix + "failed-at"
+)
+
+var ErrNotADeadLetter = fmt.Errorf("message is not a dead letter")
+
+// DeadLetter is why a message was given up on and where it was read from
+type DeadLetter struct {
+	Topic     string
+	Partition int32
+	Offset    int64
+	Error     string
+	Attempts  int
+	FailedAt  time.Time
+}
+
+func NewDeadLetter(msg *kafka.Message, err error, attempts int) *DeadLetter {
+	dl := &DeadLetter{
+		Partition: msg.TopicPartition.Partition,
+		Offset:    int64(msg.TopicPartition.Offset),
+		Error:     err.Error(),
+		Attempts:  attempts,
+		FailedAt:  time.Now().UTC(),
+	}
+	if msg.TopicPartition.Topic != nil {
+		dl.Topic = *msg.TopicPartition.Topic
+	}
+	return dl
+}
+
+// Headers are the headers of the original message followed by the dead letter ones
+func (dl *DeadLetter) Headers(original []kafka.Header) []kafka.Header {
+	headers := make([]kafka.Header, 0, len(original)+6)
+	headers = append(headers, StripDeadLetterHeaders(original)...)
+	return append(headers,
+		kafka.Header{Key: DeadLetterErrorHeader, Value: []byte(dl.Error)},
+		kafka.Header{Key: DeadLetterAttemptsHeader, Value: []byte(strconv.Itoa(dl.Attempts))},
+		kafka.Header{Key: DeadLetterTopicHeader, Value: []byte(dl.Topic)},
+		kafka.Header{Key: DeadLetterPartitionHeader, Value: []byte(strconv.FormatInt(int64(dl.Partition), 10))},
+		kafka.Header{Key: DeadLetterOffsetHeader, Value: []byte(strconv.FormatInt(dl.Offset, 10))},
+		kafka.Header{Key: DeadLetterFailedAtHeader, Value: []byte(dl.FailedAt.Format(time.RFC3339Nano))},
+	)
+}
+
+// ParseDeadLetter reads the dead letter headers of a message of the dead letter topic
+func ParseDeadLetter(headers []kafka.Header) (*DeadLetter, error) {
+	values := make(map[string]string, len(headers))
+	for _, h := range headers {
+		values[h.Key] = string(h.Value)
+	}
+	dl := &DeadLetter{
+		Topic: values[DeadLetterTopicHeader],
+		Error: values[DeadLetterErrorHeader],
+	}
+	partition, errPartition := strconv.ParseInt(values[DeadLetterPartitionHeader], 10, 32)
+	offset, errOffset := strconv.ParseInt(values[DeadLetterOffsetHeader], 10, 64)
+	attempts, errAttempts := strconv.Atoi(values[DeadLetterAttemptsHeader])
+	failedAt, errFailedAt := time.Parse(time.RFC3339Nano, values[DeadLetterFailedAtHeader])
+	if dl.Topic == "" || errPartition != nil || errOffset != nil || errAttempts != nil || errFailedAt != nil {
+		return nil, ErrNotADeadLetter
+	}
+	dl.Partition, dl.Offset, dl.Attempts, dl.FailedAt = int32(partition), offset, attempts, failedAt
+	return dl, nil
+}
+
+// StripDeadLetterHeaders returns the headers the original message had, a redriven message starts over
+func StripDeadLetterHeaders(headers []kafka.Header) []kafka.Header {
+	stripped := make([]kafka.Header, 0, len(headers))
+	for _, h := range headers {
+		if !strings.HasPrefix(h.Key, DeadLetterHeaderPrefix) {
+			stripped = append(stripped, h)
+		}
+	}
+	return stripped
+}
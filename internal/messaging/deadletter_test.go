@@ -0,0 +1,57 @@
+package messaging_test
+
+import (
+	"fmt"
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/despondency/notifications-service/internal/messaging"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Dead letters", func() {
+
+	var msg *kafka.Message
+
+	BeforeEach(func() {
+		topic := "outstanding-notifications-normal"
+		msg = &kafka.Message{
+			TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: 3, Offset: 42},
+			Value:          []byte("{not json"),
+			Headers:        []kafka.Header{{Key: "traceparent", Value: []byte("00-abc-def-01")}},
+		}
+	})
+
+	Context("Round trip", func() {
+		It("should keep the original headers and record where the message came from", func() {
+			headers := messaging.NewDeadLetter(msg, fmt.Errorf("malformed"), 5).Headers(msg.Headers)
+			Expect(headers[0].Key).To(Equal("traceparent"))
+			dl, err := messaging.ParseDeadLetter(headers)
+			Expect(err).To(BeNil())
+			Expect(dl.Topic).To(Equal("outstanding-notifications-normal"))
+			Expect(dl.Partition).To(Equal(int32(3)))
+			Expect(dl.Offset).To(Equal(int64(42)))
+			Expect(dl.Error).To(Equal("malformed"))
+			Expect(dl.Attempts).To(Equal(5))
+			Expect(dl.FailedAt).ToNot(BeZero())
+		})
+	})
+
+	Context("Dead lettered again after a redrive", func() {
+		It("should only carry the latest dead letter headers", func() {
+			first := messaging.NewDeadLetter(msg, fmt.Errorf("first"), 5).Headers(msg.Headers)
+			Expect(messaging.StripDeadLetterHeaders(first)).To(Equal(msg.Headers))
+			second := messaging.NewDeadLetter(msg, fmt.Errorf("second"), 1).Headers(first)
+			Expect(second).To(HaveLen(len(first)))
+			dl, err := messaging.ParseDeadLetter(second)
+			Expect(err).To(BeNil())
+			Expect(dl.Error).To(Equal("second"))
+		})
+	})
+
+	Context("Message without dead letter headers", func() {
+		It("should not be a dead letter", func() {
+			_, err := messaging.ParseDeadLetter(msg.Headers)
+			Expect(err).To(Equal(messaging.ErrNotADeadLetter))
+		})
+	})
+})
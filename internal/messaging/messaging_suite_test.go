@@ -0,0 +1,12 @@
+package messaging_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"testing"
+)
+
+func TestMessaging(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Messaging Suite")
+}
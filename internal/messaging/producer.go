@@ -41,13 +41,20 @@ func (kp *KafkaProducer) Stop() {
 }
 
 func (kp *KafkaProducer) Produce(payload []byte) error {
+	return kp.ProduceMessage(nil, payload, nil)
+}
+
+// ProduceMessage produces a payload with its key and headers, either may be nil
+func (kp *KafkaProducer) ProduceMessage(key, payload []byte, headers []kafka.Header) error {
 	if kp.stopped.Load() {
 		return ErrAlreadyStopped
 	}
 	receiver := make(chan kafka.Event, 1)
 	err := kp.producer.Produce(&kafka.Message{
 		TopicPartition: kafka.TopicPartition{Topic: &kp.topic, Partition: kafka.PartitionAny},
+		Key:            key,
 		Value:          payload,
+		Headers:        headers,
 	},
 		receiver,
 	)
@@ -62,3 +69,49 @@ func (kp *KafkaProducer) Produce(payload []byte) error {
 	}
 	return nil
 }
+
+// ProduceBatch enqueues every payload before waiting for delivery reports,
+// the returned errors are index aligned with payloads
+func (kp *KafkaProducer) ProduceBatch(payloads [][]byte) []error {
+	return kp.ProduceKeyedBatch(nil, payloads)
+}
+
+// ProduceKeyedBatch is ProduceBatch with a key per payload, payloads of the same key keep their order
+func (kp *KafkaProducer) ProduceKeyedBatch(keys, payloads [][]byte) []error {
+	errs := make([]error, len(payloads))
+	if kp.stopped.Load() {
+		for i := range errs {
+			errs[i] = ErrAlreadyStopped
+		}
+		return errs
+	}
+	receiver := make(chan kafka.Event, len(payloads))
+	pending := 0
+	for i, payload := range payloads {
+		msg := &kafka.Message{
+			TopicPartition: kafka.TopicPartition{Topic: &kp.topic, Partition: kafka.PartitionAny},
+			Value:          payload,
+			Opaque:         i,
+		}
+		if keys != nil {
+			msg.Key = keys[i]
+		}
+		err := kp.producer.Produce(msg,
+			receiver,
+		)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		pending++
+	}
+	for ; pending > 0; pending-- {
+		e := <-receiver
+		m := e.(*kafka.Message)
+		if m.TopicPartition.Error != nil {
+			log.Err(m.TopicPartition.Error).Msg("Delivery failed")
+			errs[m.Opaque.(int)] = m.TopicPartition.Error
+		}
+	}
+	return errs
+}
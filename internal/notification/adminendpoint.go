@@ -0,0 +1,64 @@
+package notification
+
+import (
+	"github.com/julienschmidt/httprouter"
+	"github.com/rs/zerolog/log"
+	"net/http"
+)
+
+//go:generate mockgen -source adminendpoint.go -destination ./notificationmocks/adminendpoint_mock.go -package notificationmocks
+type LagReporter interface {
+	Lag() ([]*LaneLag, error)
+}
+
+type BreakerReporter interface {
+	Breakers() []*BreakerStatus
+}
+
+type ProviderReporter interface {
+	Providers() []*ProviderStatus
+}
+
+type LagResponse struct {
+	Lanes []*LaneLag `json:"lanes"`
+}
+
+type BreakersResponse struct {
+	Breakers []*BreakerStatus `json:"breakers"`
+}
+
+type ProvidersResponse struct {
+	Providers []*ProviderStatus `json:"providers"`
+}
+
+type AdminEndpoint struct {
+	lagReporter      LagReporter
+	breakerReporter  BreakerReporter
+	providerReporter ProviderReporter
+}
+
+func NewAdminEndpoint(lagReporter LagReporter, breakerReporter BreakerReporter, providerReporter ProviderReporter) *AdminEndpoint {
+	return &AdminEndpoint{
+		lagReporter:      lagReporter,
+		breakerReporter:  breakerReporter,
+		providerReporter: providerReporter,
+	}
+}
+
+func (ae *AdminEndpoint) GetLag(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	lags, err := ae.lagReporter.Lag()
+	if err != nil {
+		log.Err(err).Msg("internal error")
+		writeProblem(w, r, internalProblem())
+		return
+	}
+	writeJSON(w, http.StatusOK, &LagResponse{Lanes: lags})
+}
+
+func (ae *AdminEndpoint) GetBreakers(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+	writeJSON(w, http.StatusOK, &BreakersResponse{Breakers: ae.breakerReporter.Breakers()})
+}
+
+func (ae *AdminEndpoint) GetProviders(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+	writeJSON(w, http.StatusOK, &ProvidersResponse{Providers: ae.providerReporter.Providers()})
+}
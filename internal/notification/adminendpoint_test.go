@@ -0,0 +1,115 @@
+package notification_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/despondency/notifications-service/internal/notification"
+	"github.com/despondency/notifications-service/internal/notification/notificationmocks"
+	"github.com/golang/mock/gomock"
+	"github.com/julienschmidt/httprouter"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"net/http"
+	"net/http/httptest"
+	"time"
+)
+
+var _ = Describe("Admin endpoint", func() {
+
+	var (
+		mockedLagReporter      *notificationmocks.MockLagReporter
+		mockedBreakerReporter  *notificationmocks.MockBreakerReporter
+		mockedProviderReporter *notificationmocks.MockProviderReporter
+		ctrl                   *gomock.Controller
+		router                 *httprouter.Router
+		rr                     *httptest.ResponseRecorder
+		path                   string
+	)
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		mockedLagReporter = notificationmocks.NewMockLagReporter(ctrl)
+		mockedBreakerReporter = notificationmocks.NewMockBreakerReporter(ctrl)
+		mockedProviderReporter = notificationmocks.NewMockProviderReporter(ctrl)
+		router = httprouter.New()
+		adminEndpoint := notification.NewAdminEndpoint(mockedLagReporter, mockedBreakerReporter, mockedProviderReporter)
+		router.GET("/admin/lag", adminEndpoint.GetLag)
+		router.GET("/admin/breakers", adminEndpoint.GetBreakers)
+		router.GET("/admin/providers", adminEndpoint.GetProviders)
+		path = "/admin/lag"
+	})
+
+	JustBeforeEach(func() {
+		req, _ := http.NewRequest("GET", path, nil)
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+	})
+
+	Context("Lag of every lane, 200", func() {
+		BeforeEach(func() {
+			mockedLagReporter.EXPECT().Lag().Return([]*notification.LaneLag{
+				{Priority: notification.PriorityCritical, Topic: "outstanding-notifications-critical", Lag: 0},
+				{Priority: notification.PriorityBulk, Topic: "outstanding-notifications-bulk", Lag: 100_000},
+			}, nil).Times(1)
+		})
+
+		It("should list the lanes", func() {
+			Expect(rr.Code).To(Equal(http.StatusOK))
+			resp := &notification.LagResponse{}
+			Expect(json.Unmarshal(rr.Body.Bytes(), resp)).To(Succeed())
+			Expect(resp.Lanes).To(HaveLen(2))
+			Expect(resp.Lanes[1].Lag).To(Equal(int64(100_000)))
+		})
+	})
+
+	Context("Kafka unavailable, 500 problem", func() {
+		BeforeEach(func() {
+			mockedLagReporter.EXPECT().Lag().Return(nil, fmt.Errorf("timed out")).Times(1)
+		})
+
+		It("should return 500", func() {
+			Expect(rr.Code).To(Equal(http.StatusInternalServerError))
+		})
+	})
+
+	Context("State of every breaker, 200", func() {
+		BeforeEach(func() {
+			path = "/admin/breakers"
+			openedAt := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+			mockedBreakerReporter.EXPECT().Breakers().Return([]*notification.BreakerStatus{
+				{Destination: "SMS", State: notification.BreakerOpen, Calls: 0, OpenedAt: &openedAt},
+				{TenantID: "acme", Destination: "EMAIL", State: notification.BreakerClosed, Calls: 20, FailureRate: 0.1},
+			}).Times(1)
+		})
+
+		It("should list the breakers", func() {
+			Expect(rr.Code).To(Equal(http.StatusOK))
+			resp := &notification.BreakersResponse{}
+			Expect(json.Unmarshal(rr.Body.Bytes(), resp)).To(Succeed())
+			Expect(resp.Breakers).To(HaveLen(2))
+			Expect(resp.Breakers[0].State).To(Equal(notification.BreakerOpen))
+			Expect(resp.Breakers[1].TenantID).To(Equal("acme"))
+			Expect(resp.Breakers[1].FailureRate).To(Equal(0.1))
+		})
+	})
+
+	Context("Health of every provider, 200", func() {
+		BeforeEach(func() {
+			path = "/admin/providers"
+			demotedUntil := time.Date(2022, 6, 1, 12, 1, 0, 0, time.UTC)
+			mockedProviderReporter.EXPECT().Providers().Return([]*notification.ProviderStatus{
+				{Destination: "SMS", Provider: "vendor-a", Score: 0.3, DemotedUntil: &demotedUntil},
+				{Destination: "SMS", Provider: "vendor-b", Score: 1},
+			}).Times(1)
+		})
+
+		It("should list the providers", func() {
+			Expect(rr.Code).To(Equal(http.StatusOK))
+			resp := &notification.ProvidersResponse{}
+			Expect(json.Unmarshal(rr.Body.Bytes(), resp)).To(Succeed())
+			Expect(resp.Providers).To(HaveLen(2))
+			Expect(resp.Providers[0].DemotedUntil).ToNot(BeNil())
+			Expect(resp.Providers[1].Provider).To(Equal("vendor-b"))
+		})
+	})
+})
@@ -0,0 +1,114 @@
+package notification
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"github.com/google/uuid"
+	"regexp"
+	"time"
+)
+
+const (
+	// DefaultTenant owns every notification received while authentication is disabled or before tenants existed
+	DefaultTenant = "default"
+
+	apiKeyPrefix       = "nsk_"
+	apiKeyPrefixLength = 12
+	maxAPIKeyGrace     = 30 * 24 * time.Hour
+)
+
+var tenantIDRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]{0,63}$`)
+
+var (
+	ErrAPIKeyNotFound = fmt.Errorf("api key not found")
+	ErrAPIKeyExpired  = fmt.Errorf("api key expired")
+	ErrInvalidAPIKey  = fmt.Errorf("invalid api key")
+)
+
+// Identity is who a request authenticated as, CallbackURL is the default of the requests it sends
+type Identity struct {
+	KeyID       uuid.UUID
+	TenantID    string
+	CallbackURL string
+}
+
+type identityKey struct{}
+
+func WithIdentity(ctx context.Context, identity *Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// IdentityFromContext returns the authenticated identity, the default tenant when the request went through no authentication
+func IdentityFromContext(ctx context.Context) *Identity {
+	if identity, ok := ctx.Value(identityKey{}).(*Identity); ok {
+		return identity
+	}
+	return &Identity{TenantID: DefaultTenant}
+}
+
+// APIKey is never returned with its Key, except by the create and rotate responses
+type APIKey struct {
+	ID          uuid.UUID  `json:"id"`
+	TenantID    string     `json:"tenant_id"`
+	Name        string     `json:"name,omitempty"`
+	Prefix      string     `json:"prefix"`
+	Key         string     `json:"key,omitempty"`
+	CallbackURL string     `json:"callback_url,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty"`
+}
+
+// APIKeyRequest creates a key, CallbackURL is where status events of requests sent with it go unless they name their own
+type APIKeyRequest struct {
+	TenantID    string `json:"tenant_id"`
+	Name        string `json:"name,omitempty"`
+	CallbackURL string `json:"callback_url,omitempty"`
+}
+
+// RotateAPIKeyRequest keeps the rotated key working for GracePeriodSeconds, so clients can roll over
+type RotateAPIKeyRequest struct {
+	GracePeriodSeconds int64 `json:"grace_period_seconds,omitempty"`
+}
+
+func (ar *APIKeyRequest) Validate() error {
+	ve := &ValidationError{}
+	if !tenantIDRegex.MatchString(ar.TenantID) {
+		ve.add("tenant_id", "must be lowercase letters, digits, '_', '-' or '.' and at most 64 characters")
+	}
+	if len(ar.Name) > 128 {
+		ve.add("name", "must be at most 128 characters")
+	}
+	if ar.CallbackURL != "" && !validCallbackURL(ar.CallbackURL) {
+		ve.add("callback_url", callbackURLReason)
+	}
+	if len(ve.Fields) > 0 {
+		return ve
+	}
+	return nil
+}
+
+func (rr *RotateAPIKeyRequest) Validate() error {
+	// compared in seconds, a large enough period overflows a Duration
+	if rr.GracePeriodSeconds < 0 || rr.GracePeriodSeconds > int64(maxAPIKeyGrace/time.Second) {
+		return &ValidationError{Fields: []*FieldError{{Name: "grace_period_seconds", Reason: "must be between 0 and 30 days"}}}
+	}
+	return nil
+}
+
+// newAPIKey returns a random key, 32 bytes are enough for a plain SHA-256 to be safe to store
+func newAPIKey() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return apiKeyPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashAPIKey(key string) []byte {
+	h := sha256.Sum256([]byte(key))
+	return h[:]
+}
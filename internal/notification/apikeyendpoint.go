@@ -0,0 +1,119 @@
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+	"github.com/rs/zerolog/log"
+	"io"
+	"net/http"
+)
+
+//go:generate mockgen -source apikeyendpoint.go -destination ./notificationmocks/apikeyservice_mock.go -package notificationmocks
+type APIKeyManager interface {
+	CreateAPIKey(ctx context.Context, req *APIKeyRequest) (*APIKey, error)
+	RotateAPIKey(ctx context.Context, id uuid.UUID, req *RotateAPIKeyRequest) (*APIKey, error)
+	RevokeAPIKey(ctx context.Context, id uuid.UUID) error
+	ListAPIKeys(ctx context.Context, tenantID string) ([]*APIKey, error)
+	ResolveAPIKey(ctx context.Context, key string) (*Identity, error)
+}
+
+type APIKeyEndpoint struct {
+	svc APIKeyManager
+}
+
+func NewAPIKeyEndpoint(svc APIKeyManager) *APIKeyEndpoint {
+	return &APIKeyEndpoint{
+		svc: svc,
+	}
+}
+
+func (ae *APIKeyEndpoint) CreateAPIKey(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	req := &APIKeyRequest{}
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(req)
+	if err != nil {
+		log.Err(err).Msg("error while unmarshalling")
+		writeProblem(w, r, malformedProblem(err))
+		return
+	}
+	err = req.Validate()
+	var key *APIKey
+	if err == nil {
+		key, err = ae.svc.CreateAPIKey(r.Context(), req)
+	}
+	ae.writeAPIKey(w, r, key, err)
+}
+
+func (ae *APIKeyEndpoint) RotateAPIKey(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	id, err := uuid.Parse(ps.ByName("id"))
+	if err != nil {
+		writeProblem(w, r, invalidUUIDProblem("id"))
+		return
+	}
+	req := &RotateAPIKeyRequest{}
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	// the body is optional, without one the rotated key stops working straight away
+	err = decoder.Decode(req)
+	if err != nil && err != io.EOF {
+		log.Err(err).Msg("error while unmarshalling")
+		writeProblem(w, r, malformedProblem(err))
+		return
+	}
+	err = req.Validate()
+	var key *APIKey
+	if err == nil {
+		key, err = ae.svc.RotateAPIKey(r.Context(), id, req)
+	}
+	ae.writeAPIKey(w, r, key, err)
+}
+
+func (ae *APIKeyEndpoint) RevokeAPIKey(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	id, err := uuid.Parse(ps.ByName("id"))
+	if err != nil {
+		writeProblem(w, r, invalidUUIDProblem("id"))
+		return
+	}
+	err = ae.svc.RevokeAPIKey(r.Context(), id)
+	if err == ErrAPIKeyNotFound {
+		writeProblem(w, r, notFoundProblem(err))
+		return
+	}
+	if err != nil {
+		log.Err(err).Msg("internal error")
+		writeProblem(w, r, internalProblem())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (ae *APIKeyEndpoint) ListAPIKeys(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	keys, err := ae.svc.ListAPIKeys(r.Context(), r.URL.Query().Get("tenant_id"))
+	if err != nil {
+		log.Err(err).Msg("internal error")
+		writeProblem(w, r, internalProblem())
+		return
+	}
+	writeJSON(w, http.StatusOK, keys)
+}
+
+func (ae *APIKeyEndpoint) writeAPIKey(w http.ResponseWriter, r *http.Request, key *APIKey, err error) {
+	var ve *ValidationError
+	switch {
+	case errors.As(err, &ve):
+		writeProblem(w, r, validationProblem(ve))
+	case err == ErrAPIKeyNotFound:
+		writeProblem(w, r, notFoundProblem(err))
+	case err == ErrAPIKeyExpired:
+		writeProblem(w, r, conflictProblem(err))
+	case err != nil:
+		log.Err(err).Msg("internal error")
+		writeProblem(w, r, internalProblem())
+	default:
+		writeJSON(w, http.StatusCreated, key)
+	}
+}
@@ -0,0 +1,156 @@
+package notification_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/despondency/notifications-service/internal/notification"
+	"github.com/despondency/notifications-service/internal/notification/notificationmocks"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"io"
+	"net/http"
+	"net/http/httptest"
+)
+
+var _ = Describe("API key endpoint", func() {
+
+	var (
+		mockedAPIKeyManager *notificationmocks.MockAPIKeyManager
+		ctrl                *gomock.Controller
+		router              *httprouter.Router
+		method              string
+		path                string
+		body                io.Reader
+		rr                  *httptest.ResponseRecorder
+	)
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		mockedAPIKeyManager = notificationmocks.NewMockAPIKeyManager(ctrl)
+		endpoint := notification.NewAPIKeyEndpoint(mockedAPIKeyManager)
+
+		router = httprouter.New()
+		router.POST("/admin/api-keys", endpoint.CreateAPIKey)
+		router.POST("/admin/api-keys/:id/rotate", endpoint.RotateAPIKey)
+		router.DELETE("/admin/api-keys/:id", endpoint.RevokeAPIKey)
+		body = http.NoBody
+	})
+
+	JustBeforeEach(func() {
+		req, _ := http.NewRequest(method, path, body)
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+	})
+
+	Context("Create a key, 201", func() {
+		BeforeEach(func() {
+			method, path = "POST", "/admin/api-keys"
+			mockedAPIKeyManager.EXPECT().CreateAPIKey(gomock.Any(), &notification.APIKeyRequest{TenantID: "payments", Name: "checkout"}).
+				Return(&notification.APIKey{ID: uuid.New(), TenantID: "payments", Key: "nsk_secret"}, nil).Times(1)
+			body = bytes.NewBufferString(`{"tenant_id": "payments", "name": "checkout"}`)
+		})
+
+		It("should return the key once", func() {
+			Expect(rr.Code).To(Equal(http.StatusCreated))
+			key := &notification.APIKey{}
+			Expect(json.Unmarshal(rr.Body.Bytes(), key)).To(Succeed())
+			Expect(key.Key).To(Equal("nsk_secret"))
+		})
+	})
+
+	Context("Create a key for an invalid tenant, 422 problem", func() {
+		BeforeEach(func() {
+			method, path = "POST", "/admin/api-keys"
+			mockedAPIKeyManager.EXPECT().CreateAPIKey(gomock.Any(), gomock.Any()).Times(0)
+			body = bytes.NewBufferString(`{"tenant_id": "Payments Team"}`)
+		})
+
+		It("should name the tenant_id", func() {
+			Expect(rr.Code).To(Equal(http.StatusUnprocessableEntity))
+			p := &notification.Problem{}
+			Expect(json.Unmarshal(rr.Body.Bytes(), p)).To(Succeed())
+			Expect(p.InvalidParams[0].Name).To(Equal("tenant_id"))
+		})
+	})
+
+	Context("Create a key with an invalid callback url, 422 problem", func() {
+		BeforeEach(func() {
+			method, path = "POST", "/admin/api-keys"
+			mockedAPIKeyManager.EXPECT().CreateAPIKey(gomock.Any(), gomock.Any()).Times(0)
+			body = bytes.NewBufferString(`{"tenant_id": "payments", "callback_url": "payments.example.com/hooks"}`)
+		})
+
+		It("should name the callback_url", func() {
+			Expect(rr.Code).To(Equal(http.StatusUnprocessableEntity))
+			p := &notification.Problem{}
+			Expect(json.Unmarshal(rr.Body.Bytes(), p)).To(Succeed())
+			Expect(p.InvalidParams[0].Name).To(Equal("callback_url"))
+		})
+	})
+
+	Context("Rotate a key without a body, 201", func() {
+		var id uuid.UUID
+
+		BeforeEach(func() {
+			id = uuid.New()
+			method, path = "POST", "/admin/api-keys/"+id.String()+"/rotate"
+			mockedAPIKeyManager.EXPECT().RotateAPIKey(gomock.Any(), id, &notification.RotateAPIKeyRequest{}).
+				Return(&notification.APIKey{ID: uuid.New(), TenantID: "payments", Key: "nsk_rotated"}, nil).Times(1)
+		})
+
+		It("should return the new key", func() {
+			Expect(rr.Code).To(Equal(http.StatusCreated))
+		})
+	})
+
+	Context("Rotate with a too long grace period, 422 problem", func() {
+		BeforeEach(func() {
+			method, path = "POST", "/admin/api-keys/"+uuid.New().String()+"/rotate"
+			mockedAPIKeyManager.EXPECT().RotateAPIKey(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			body = bytes.NewBufferString(`{"grace_period_seconds": 31536000}`)
+		})
+
+		It("should return 422", func() {
+			Expect(rr.Code).To(Equal(http.StatusUnprocessableEntity))
+		})
+	})
+
+	Context("Rotate with a grace period overflowing a duration, 422 problem", func() {
+		BeforeEach(func() {
+			method, path = "POST", "/admin/api-keys/"+uuid.New().String()+"/rotate"
+			mockedAPIKeyManager.EXPECT().RotateAPIKey(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			body = bytes.NewBufferString(`{"grace_period_seconds": 9300000000}`)
+		})
+
+		It("should return 422", func() {
+			Expect(rr.Code).To(Equal(http.StatusUnprocessableEntity))
+		})
+	})
+
+	Context("Rotate an expired key, 409 problem", func() {
+		BeforeEach(func() {
+			method, path = "POST", "/admin/api-keys/"+uuid.New().String()+"/rotate"
+			mockedAPIKeyManager.EXPECT().RotateAPIKey(gomock.Any(), gomock.Any(), gomock.Any()).
+				Return(nil, notification.ErrAPIKeyExpired).Times(1)
+		})
+
+		It("should return 409", func() {
+			Expect(rr.Code).To(Equal(http.StatusConflict))
+		})
+	})
+
+	Context("Revoke an unknown key, 404 problem", func() {
+		BeforeEach(func() {
+			method, path = "DELETE", "/admin/api-keys/"+uuid.New().String()
+			mockedAPIKeyManager.EXPECT().RevokeAPIKey(gomock.Any(), gomock.Any()).
+				Return(notification.ErrAPIKeyNotFound).Times(1)
+		})
+
+		It("should return 404", func() {
+			Expect(rr.Code).To(Equal(http.StatusNotFound))
+		})
+	})
+})
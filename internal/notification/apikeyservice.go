@@ -0,0 +1,114 @@
+package notification
+
+import (
+	"context"
+	"github.com/cockroachdb/cockroach-go/v2/crdb/crdbpgx"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"time"
+)
+
+type APIKeyService struct {
+	persistence *CRDBPersistence
+}
+
+func NewAPIKeyService(persistence *CRDBPersistence) *APIKeyService {
+	return &APIKeyService{
+		persistence: persistence,
+	}
+}
+
+func (as *APIKeyService) CreateAPIKey(ctx context.Context, req *APIKeyRequest) (*APIKey, error) {
+	key, err := generateAPIKey(req.TenantID, req.Name, req.CallbackURL)
+	if err != nil {
+		return nil, err
+	}
+	err = crdbpgx.ExecuteTx(ctx, as.persistence.GetPool(), pgx.TxOptions{}, func(tx pgx.Tx) error {
+		return as.persistence.InsertAPIKey(ctx, key, tx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// RotateAPIKey creates a new key for the same tenant, the rotated one keeps working until the grace period ends
+func (as *APIKeyService) RotateAPIKey(ctx context.Context, id uuid.UUID, req *RotateAPIKeyRequest) (*APIKey, error) {
+	var rotated *APIKey
+	err := crdbpgx.ExecuteTx(ctx, as.persistence.GetPool(), pgx.TxOptions{}, func(tx pgx.Tx) error {
+		old, errGet := as.persistence.GetAPIKey(ctx, id, tx)
+		if errGet != nil {
+			return errGet
+		}
+		if old.RevokedAt != nil {
+			return ErrAPIKeyNotFound
+		}
+		if old.ExpiresAt != nil && !old.ExpiresAt.After(time.Now()) {
+			return ErrAPIKeyExpired
+		}
+		var errGenerate error
+		rotated, errGenerate = generateAPIKey(old.TenantID, old.Name, old.CallbackURL)
+		if errGenerate != nil {
+			return errGenerate
+		}
+		errInsert := as.persistence.InsertAPIKey(ctx, rotated, tx)
+		if errInsert != nil {
+			return errInsert
+		}
+		expiresAt := rotated.CreatedAt.Add(time.Duration(req.GracePeriodSeconds) * time.Second)
+		return as.persistence.ExpireAPIKey(ctx, id, expiresAt, tx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rotated, nil
+}
+
+func (as *APIKeyService) RevokeAPIKey(ctx context.Context, id uuid.UUID) error {
+	return crdbpgx.ExecuteTx(ctx, as.persistence.GetPool(), pgx.TxOptions{}, func(tx pgx.Tx) error {
+		affected, err := as.persistence.RevokeAPIKey(ctx, id, tx)
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			return ErrAPIKeyNotFound
+		}
+		return nil
+	})
+}
+
+func (as *APIKeyService) ListAPIKeys(ctx context.Context, tenantID string) ([]*APIKey, error) {
+	var keys []*APIKey
+	err := crdbpgx.ExecuteTx(ctx, as.persistence.GetPool(), pgx.TxOptions{AccessMode: pgx.ReadOnly}, func(tx pgx.Tx) error {
+		var errList error
+		keys, errList = as.persistence.ListAPIKeys(ctx, tenantID, tx)
+		return errList
+	})
+	return keys, err
+}
+
+func (as *APIKeyService) ResolveAPIKey(ctx context.Context, key string) (*Identity, error) {
+	var identity *Identity
+	err := crdbpgx.ExecuteTx(ctx, as.persistence.GetPool(), pgx.TxOptions{AccessMode: pgx.ReadOnly}, func(tx pgx.Tx) error {
+		var errResolve error
+		identity, errResolve = as.persistence.ResolveAPIKey(ctx, key, tx)
+		return errResolve
+	})
+	return identity, err
+}
+
+func generateAPIKey(tenantID, name, callbackURL string) (*APIKey, error) {
+	secret, err := newAPIKey()
+	if err != nil {
+		return nil, err
+	}
+	return &APIKey{
+		ID:          uuid.New(),
+		TenantID:    tenantID,
+		Name:        name,
+		Prefix:      secret[:apiKeyPrefixLength],
+		Key:         secret,
+		CallbackURL: callbackURL,
+		CreatedAt:   time.Now().UTC(),
+	}, nil
+}
@@ -0,0 +1,114 @@
+package notification
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
+	"time"
+)
+
+const apiKeyColumns = "id, tenant_id, name, prefix, callback_url, created_at, expires_at, revoked_at"
+
+func (crdbp *CRDBPersistence) InsertAPIKey(ctx context.Context, key *APIKey, tx pgx.Tx) error {
+	_, errExec := tx.Exec(ctx,
+		"INSERT into api_keys(id, tenant_id, name, prefix, key_hash, created_at, callback_url) VALUES ($1, $2, $3, $4, $5, $6, $7)",
+		key.ID,
+		key.TenantID,
+		toDBVarchar(key.Name),
+		key.Prefix,
+		hashAPIKey(key.Key),
+		toDBTimestamp(&key.CreatedAt),
+		toDBVarchar(key.CallbackURL),
+	)
+	return errExec
+}
+
+func (crdbp *CRDBPersistence) GetAPIKey(ctx context.Context, id uuid.UUID, tx pgx.Tx) (*APIKey, error) {
+	r := tx.QueryRow(ctx, "SELECT "+apiKeyColumns+" FROM api_keys WHERE id = $1", id)
+	key, err := scanAPIKey(r)
+	if err == pgx.ErrNoRows {
+		return nil, ErrAPIKeyNotFound
+	}
+	return key, err
+}
+
+func (crdbp *CRDBPersistence) ListAPIKeys(ctx context.Context, tenantID string, tx pgx.Tx) ([]*APIKey, error) {
+	rows, err := tx.Query(ctx, "SELECT "+apiKeyColumns+" FROM api_keys WHERE ($1 = '' OR tenant_id = $1) "+
+		"ORDER BY tenant_id, created_at", tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	keys := make([]*APIKey, 0)
+	for rows.Next() {
+		key, errScan := scanAPIKey(rows)
+		if errScan != nil {
+			return nil, errScan
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// ExpireAPIKey makes a key stop working after the grace period, a key already expiring sooner keeps its expiry
+func (crdbp *CRDBPersistence) ExpireAPIKey(ctx context.Context, id uuid.UUID, expiresAt time.Time, tx pgx.Tx) error {
+	_, errExec := tx.Exec(ctx,
+		"UPDATE api_keys SET expires_at = $2 WHERE id = $1 AND (expires_at IS NULL OR expires_at > $2)",
+		id,
+		toDBTimestamp(&expiresAt),
+	)
+	return errExec
+}
+
+func (crdbp *CRDBPersistence) RevokeAPIKey(ctx context.Context, id uuid.UUID, tx pgx.Tx) (int64, error) {
+	v, errExec := tx.Exec(ctx, "UPDATE api_keys SET revoked_at = now() WHERE id = $1 AND revoked_at IS NULL", id)
+	if errExec != nil {
+		return -1, errExec
+	}
+	return v.RowsAffected(), nil
+}
+
+// ResolveAPIKey returns the identity of a key that is neither revoked nor expired
+func (crdbp *CRDBPersistence) ResolveAPIKey(ctx context.Context, key string, tx pgx.Tx) (*Identity, error) {
+	identity := &Identity{}
+	var callbackURL pgtype.Varchar
+	errScan := tx.QueryRow(ctx,
+		"SELECT id, tenant_id, callback_url FROM api_keys WHERE key_hash = $1 AND revoked_at IS NULL "+
+			"AND (expires_at IS NULL OR expires_at > now()::TIMESTAMP)",
+		hashAPIKey(key),
+	).Scan(&identity.KeyID, &identity.TenantID, &callbackURL)
+	if errScan == pgx.ErrNoRows {
+		return nil, ErrInvalidAPIKey
+	}
+	if errScan != nil {
+		return nil, errScan
+	}
+	identity.CallbackURL = callbackURL.String
+	return identity, nil
+}
+
+func scanAPIKey(r pgx.Row) (*APIKey, error) {
+	var (
+		key         = &APIKey{}
+		name        pgtype.Varchar
+		callbackURL pgtype.Varchar
+		createdAt   pgtype.Timestamp
+		expiresAt   pgtype.Timestamp
+		revokedAt   pgtype.Timestamp
+	)
+	errScan := r.Scan(&key.ID, &key.TenantID, &name, &key.Prefix, &callbackURL, &createdAt, &expiresAt, &revokedAt)
+	if errScan != nil {
+		return nil, errScan
+	}
+	key.Name = name.String
+	key.CallbackURL = callbackURL.String
+	key.CreatedAt = createdAt.Time
+	if expiresAt.Status == pgtype.Present {
+		key.ExpiresAt = &expiresAt.Time
+	}
+	if revokedAt.Status == pgtype.Present {
+		key.RevokedAt = &revokedAt.Time
+	}
+	return key, nil
+}
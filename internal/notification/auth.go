@@ -0,0 +1,178 @@
+package notification
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"github.com/julienschmidt/httprouter"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const apiKeyHeader = "X-API-Key"
+
+var (
+	ErrMissingAPIKey = fmt.Errorf("missing api key, send it as a bearer token or in the %s header", apiKeyHeader)
+	ErrNotAdmin      = fmt.Errorf("admin api key required")
+)
+
+type cachedIdentity struct {
+	identity *Identity
+	until    time.Time
+}
+
+// Authenticator resolves api keys to identities, cached for cacheTTL so a revoked key works up to that long
+type Authenticator struct {
+	resolver APIKeyManager
+	enabled  bool
+	adminKey string
+	cacheTTL time.Duration
+	mu       sync.Mutex
+	cache    map[string]*cachedIdentity
+}
+
+// NewAuthenticator lets everything through as the default tenant when disabled, admin routes need an admin key
+func NewAuthenticator(resolver APIKeyManager, enabled bool, adminKey string, cacheTTL time.Duration) *Authenticator {
+	return &Authenticator{
+		resolver: resolver,
+		enabled:  enabled,
+		adminKey: adminKey,
+		cacheTTL: cacheTTL,
+		cache:    make(map[string]*cachedIdentity),
+	}
+}
+
+// Authenticate attaches the identity of the api key of the request to its context
+func (a *Authenticator) Authenticate(next httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if !a.enabled {
+			next(w, r, ps)
+			return
+		}
+		identity, err := a.resolve(r.Context(), apiKeyFromHeaders(r.Header.Get("Authorization"), r.Header.Get(apiKeyHeader)))
+		if err == ErrMissingAPIKey || err == ErrInvalidAPIKey {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeProblem(w, r, unauthorizedProblem(err))
+			return
+		}
+		if err != nil {
+			log.Err(err).Msg("could not resolve api key")
+			writeProblem(w, r, internalProblem())
+			return
+		}
+		next(w, r.WithContext(WithIdentity(r.Context(), identity)), ps)
+	}
+}
+
+// Admin only lets requests with the admin api key through
+func (a *Authenticator) Admin(next httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if !a.enabled {
+			next(w, r, ps)
+			return
+		}
+		key := apiKeyFromHeaders(r.Header.Get("Authorization"), r.Header.Get(apiKeyHeader))
+		if a.adminKey == "" || subtle.ConstantTimeCompare([]byte(key), []byte(a.adminKey)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeProblem(w, r, unauthorizedProblem(ErrNotAdmin))
+			return
+		}
+		next(w, r, ps)
+	}
+}
+
+func (a *Authenticator) UnaryInterceptor(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := a.authenticateGRPC(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (a *Authenticator) StreamInterceptor(srv interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo,
+	handler grpc.StreamHandler) error {
+	ctx, err := a.authenticateGRPC(ss.Context())
+	if err != nil {
+		return err
+	}
+	return handler(srv, &identityStream{ServerStream: ss, ctx: ctx})
+}
+
+func (a *Authenticator) authenticateGRPC(ctx context.Context) (context.Context, error) {
+	if !a.enabled {
+		return ctx, nil
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	identity, err := a.resolve(ctx, apiKeyFromHeaders(firstValue(md, "authorization"), firstValue(md, strings.ToLower(apiKeyHeader))))
+	if err == ErrMissingAPIKey || err == ErrInvalidAPIKey {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	if err != nil {
+		log.Err(err).Msg("could not resolve api key")
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+	return WithIdentity(ctx, identity), nil
+}
+
+func (a *Authenticator) resolve(ctx context.Context, key string) (*Identity, error) {
+	if key == "" {
+		return nil, ErrMissingAPIKey
+	}
+	// only valid keys are cached, so unknown keys can't grow it
+	cacheKey := string(hashAPIKey(key))
+	now := time.Now()
+	a.mu.Lock()
+	cached, ok := a.cache[cacheKey]
+	if ok && now.After(cached.until) {
+		delete(a.cache, cacheKey)
+		ok = false
+	}
+	a.mu.Unlock()
+	if ok {
+		return cached.identity, nil
+	}
+	identity, err := a.resolver.ResolveAPIKey(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if a.cacheTTL > 0 {
+		a.mu.Lock()
+		a.cache[cacheKey] = &cachedIdentity{identity: identity, until: now.Add(a.cacheTTL)}
+		a.mu.Unlock()
+	}
+	return identity, nil
+}
+
+type identityStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *identityStream) Context() context.Context {
+	return s.ctx
+}
+
+func apiKeyFromHeaders(authorization, apiKey string) string {
+	if apiKey != "" {
+		return apiKey
+	}
+	if len(authorization) > len("Bearer ") && strings.EqualFold(authorization[:len("Bearer ")], "Bearer ") {
+		return strings.TrimSpace(authorization[len("Bearer "):])
+	}
+	return ""
+}
+
+func firstValue(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
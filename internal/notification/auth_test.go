@@ -0,0 +1,125 @@
+package notification_test
+
+import (
+	"github.com/despondency/notifications-service/internal/notification"
+	"github.com/despondency/notifications-service/internal/notification/notificationmocks"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"net/http"
+	"net/http/httptest"
+	"time"
+)
+
+var _ = Describe("Authenticator", func() {
+
+	var (
+		mockedAPIKeyManager *notificationmocks.MockAPIKeyManager
+		ctrl                *gomock.Controller
+		auth                *notification.Authenticator
+		enabled             bool
+		router              *httprouter.Router
+		identity            *notification.Identity
+		headers             map[string]string
+		rr                  *httptest.ResponseRecorder
+	)
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		mockedAPIKeyManager = notificationmocks.NewMockAPIKeyManager(ctrl)
+		enabled = true
+		identity = nil
+		headers = map[string]string{}
+	})
+
+	JustBeforeEach(func() {
+		auth = notification.NewAuthenticator(mockedAPIKeyManager, enabled, "admin-secret", time.Minute)
+		router = httprouter.New()
+		handler := func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+			identity = notification.IdentityFromContext(r.Context())
+			w.WriteHeader(http.StatusOK)
+		}
+		router.GET("/notification/:uuid", auth.Authenticate(handler))
+		router.GET("/admin/lag", auth.Admin(handler))
+	})
+
+	serve := func(path string) {
+		req, _ := http.NewRequest("GET", path, nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+	}
+
+	Context("No api key", func() {
+		It("should be unauthorized", func() {
+			mockedAPIKeyManager.EXPECT().ResolveAPIKey(gomock.Any(), gomock.Any()).Times(0)
+			serve("/notification/" + uuid.New().String())
+			Expect(rr.Code).To(Equal(http.StatusUnauthorized))
+			Expect(rr.Header().Get("WWW-Authenticate")).To(Equal("Bearer"))
+			Expect(identity).To(BeNil())
+		})
+	})
+
+	Context("Revoked api key", func() {
+		BeforeEach(func() {
+			headers["X-API-Key"] = "nsk_revoked"
+		})
+
+		It("should be unauthorized", func() {
+			mockedAPIKeyManager.EXPECT().ResolveAPIKey(gomock.Any(), "nsk_revoked").
+				Return(nil, notification.ErrInvalidAPIKey).Times(1)
+			serve("/notification/" + uuid.New().String())
+			Expect(rr.Code).To(Equal(http.StatusUnauthorized))
+		})
+	})
+
+	Context("Valid bearer api key", func() {
+		var resolved *notification.Identity
+
+		BeforeEach(func() {
+			headers["Authorization"] = "Bearer nsk_valid"
+			resolved = &notification.Identity{KeyID: uuid.New(), TenantID: "payments"}
+		})
+
+		It("should attach the tenant and cache the key", func() {
+			mockedAPIKeyManager.EXPECT().ResolveAPIKey(gomock.Any(), "nsk_valid").Return(resolved, nil).Times(1)
+			serve("/notification/" + uuid.New().String())
+			serve("/notification/" + uuid.New().String())
+			Expect(rr.Code).To(Equal(http.StatusOK))
+			Expect(identity).To(Equal(resolved))
+		})
+
+		It("should not let a tenant key into admin routes", func() {
+			serve("/admin/lag")
+			Expect(rr.Code).To(Equal(http.StatusUnauthorized))
+		})
+	})
+
+	Context("Admin api key", func() {
+		BeforeEach(func() {
+			headers["Authorization"] = "Bearer admin-secret"
+		})
+
+		It("should let admin routes through", func() {
+			serve("/admin/lag")
+			Expect(rr.Code).To(Equal(http.StatusOK))
+		})
+	})
+
+	Context("Authentication disabled", func() {
+		BeforeEach(func() {
+			enabled = false
+		})
+
+		It("should act as the default tenant", func() {
+			mockedAPIKeyManager.EXPECT().ResolveAPIKey(gomock.Any(), gomock.Any()).Times(0)
+			serve("/notification/" + uuid.New().String())
+			Expect(rr.Code).To(Equal(http.StatusOK))
+			Expect(identity.TenantID).To(Equal(notification.DefaultTenant))
+		})
+	})
+})
@@ -0,0 +1,213 @@
+package notification
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var ErrCircuitOpen = fmt.Errorf("circuit open")
+
+type BreakerState string
+
+const (
+	BreakerClosed   BreakerState = "closed"
+	BreakerOpen     BreakerState = "open"
+	BreakerHalfOpen BreakerState = "half-open"
+)
+
+// BreakerConfig opens a breaker on the rates of the last WindowSize calls, once there were MinCalls.
+// It half-opens after OpenFor and closes after Probes calls in a row went through
+type BreakerConfig struct {
+	WindowSize  int
+	MinCalls    int
+	FailureRate float64
+	// SlowCall is how long a call may take before it counts as slow, 0 ignores latency
+	SlowCall     time.Duration
+	SlowCallRate float64
+	OpenFor      time.Duration
+	Probes       int
+}
+
+func (c *BreakerConfig) validate() error {
+	if c.WindowSize < 1 || c.MinCalls < 1 || c.MinCalls > c.WindowSize {
+		return fmt.Errorf("breaker min calls must be between 1 and the window size %d, got %d", c.WindowSize, c.MinCalls)
+	}
+	if c.FailureRate <= 0 || c.FailureRate > 1 || c.SlowCallRate <= 0 || c.SlowCallRate > 1 {
+		return fmt.Errorf("breaker rates must be in (0, 1], got %v and %v", c.FailureRate, c.SlowCallRate)
+	}
+	if c.OpenFor <= 0 || c.Probes < 1 {
+		return fmt.Errorf("breaker open for and probes must be positive, got %s and %d", c.OpenFor, c.Probes)
+	}
+	return nil
+}
+
+// BreakerStatus is what the admin endpoint reports of a breaker, tenant is empty for the default notificators
+type BreakerStatus struct {
+	TenantID    string       `json:"tenant_id,omitempty"`
+	Destination string       `json:"destination"`
+	Provider    string       `json:"provider"`
+	State       BreakerState `json:"state"`
+	Calls       int          `json:"calls"`
+	FailureRate float64      `json:"failure_rate"`
+	SlowRate    float64      `json:"slow_call_rate"`
+	OpenedAt    *time.Time   `json:"opened_at,omitempty"`
+}
+
+type callOutcome struct {
+	failed bool
+	slow   bool
+}
+
+// CircuitBreaker stops calling the wrapped Notificator while it fails or is slow, permanent errors don't count
+type CircuitBreaker struct {
+	Notificator
+	tenantID string
+	provider string
+	config   *BreakerConfig
+	now      func() time.Time
+
+	mu       sync.Mutex
+	state    BreakerState
+	window   []callOutcome
+	next     int
+	openedAt time.Time
+	// probing is how many probes are in flight, probed how many went through
+	probing int
+	probed  int
+}
+
+func NewCircuitBreaker(n Notificator, tenantID, provider string, config *BreakerConfig) *CircuitBreaker {
+	return &CircuitBreaker{
+		Notificator: n,
+		tenantID:    tenantID,
+		provider:    provider,
+		config:      config,
+		now:         time.Now,
+		state:       BreakerClosed,
+		window:      make([]callOutcome, 0, config.WindowSize),
+	}
+}
+
+// Send refuses the notification as rate limited while the breaker is open
+func (cb *CircuitBreaker) Send(notification *DelegatingNotification) error {
+	if wait, ok := cb.admit(); !ok {
+		return &ProviderError{Kind: RateLimited, RetryAfter: wait,
+			Err: fmt.Errorf("%w for %s %s", ErrCircuitOpen, cb.Destination(), cb.provider)}
+	}
+	start := cb.now()
+	err := cb.Notificator.Send(notification)
+	var pe *ProviderError
+	failed := err != nil && !(errors.As(err, &pe) && pe.Kind == Permanent) && !errors.Is(err, ErrNoRecipient)
+	slow := cb.config.SlowCall > 0 && cb.now().Sub(start) > cb.config.SlowCall
+	cb.record(callOutcome{failed: failed, slow: slow})
+	return err
+}
+
+// admit returns whether the call may go through, and how long until it may when it may not
+func (cb *CircuitBreaker) admit() (time.Duration, bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if cb.state == BreakerOpen {
+		wait := cb.openedAt.Add(cb.config.OpenFor).Sub(cb.now())
+		if wait > 0 {
+			return wait, false
+		}
+		cb.state, cb.probing, cb.probed = BreakerHalfOpen, 0, 0
+	}
+	if cb.state == BreakerHalfOpen {
+		if cb.probing+cb.probed >= cb.config.Probes {
+			return 0, false
+		}
+		cb.probing++
+	}
+	return 0, true
+}
+
+// openFor returns how long until the breaker half-opens while it is open, without admitting anything
+func (cb *CircuitBreaker) openFor() (time.Duration, bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if cb.state != BreakerOpen {
+		return 0, false
+	}
+	wait := cb.openedAt.Add(cb.config.OpenFor).Sub(cb.now())
+	return wait, wait > 0
+}
+
+func (cb *CircuitBreaker) record(outcome callOutcome) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	switch cb.state {
+	case BreakerHalfOpen:
+		if cb.probing > 0 {
+			cb.probing--
+		}
+		if outcome.failed || outcome.slow {
+			cb.open()
+			return
+		}
+		cb.probed++
+		if cb.probed >= cb.config.Probes {
+			cb.state, cb.window, cb.next = BreakerClosed, cb.window[:0], 0
+		}
+	case BreakerClosed:
+		if len(cb.window) < cb.config.WindowSize {
+			cb.window = append(cb.window, outcome)
+		} else {
+			cb.window[cb.next] = outcome
+		}
+		cb.next = (cb.next + 1) % cb.config.WindowSize
+		if len(cb.window) < cb.config.MinCalls {
+			return
+		}
+		failureRate, slowRate := cb.rates()
+		if failureRate >= cb.config.FailureRate || (cb.config.SlowCall > 0 && slowRate >= cb.config.SlowCallRate) {
+			cb.open()
+		}
+	default:
+		// a call admitted before the breaker opened
+	}
+}
+
+func (cb *CircuitBreaker) open() {
+	cb.state, cb.openedAt = BreakerOpen, cb.now()
+	cb.window, cb.next = cb.window[:0], 0
+}
+
+func (cb *CircuitBreaker) rates() (float64, float64) {
+	if len(cb.window) == 0 {
+		return 0, 0
+	}
+	failed, slow := 0, 0
+	for _, o := range cb.window {
+		if o.failed {
+			failed++
+		}
+		if o.slow {
+			slow++
+		}
+	}
+	return float64(failed) / float64(len(cb.window)), float64(slow) / float64(len(cb.window))
+}
+
+func (cb *CircuitBreaker) Status() *BreakerStatus {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	failureRate, slowRate := cb.rates()
+	status := &BreakerStatus{
+		TenantID:    cb.tenantID,
+		Destination: cb.Destination().String(),
+		Provider:    cb.provider,
+		State:       cb.state,
+		Calls:       len(cb.window),
+		FailureRate: failureRate,
+		SlowRate:    slowRate,
+	}
+	if cb.state != BreakerClosed {
+		openedAt := cb.openedAt
+		status.OpenedAt = &openedAt
+	}
+	return status
+}
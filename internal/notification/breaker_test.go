@@ -0,0 +1,217 @@
+package notification
+
+import (
+	"errors"
+	"fmt"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"time"
+)
+
+// flakyNotificator fails while err is set and takes latency of the breaker's clock to send
+type flakyNotificator struct {
+	err     error
+	latency time.Duration
+	clock   *time.Time
+	sent    int
+}
+
+func (fn *flakyNotificator) Send(*DelegatingNotification) error {
+	fn.sent++
+	*fn.clock = fn.clock.Add(fn.latency)
+	return fn.err
+}
+
+func (fn *flakyNotificator) Destination() Destination {
+	return SMS
+}
+
+var _ = Describe("Circuit breaker", func() {
+
+	var (
+		clock    time.Time
+		provider *flakyNotificator
+		cb       *CircuitBreaker
+		dn       *DelegatingNotification
+	)
+
+	BeforeEach(func() {
+		clock = time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+		provider = &flakyNotificator{clock: &clock}
+		cb = NewCircuitBreaker(provider, "acme", "vendor-a", &BreakerConfig{
+			WindowSize:   10,
+			MinCalls:     4,
+			FailureRate:  0.5,
+			SlowCall:     time.Second,
+			SlowCallRate: 0.75,
+			OpenFor:      30 * time.Second,
+			Probes:       2,
+		})
+		cb.now = func() time.Time {
+			return clock
+		}
+		dn = &DelegatingNotification{dest: SMS, recipient: &Recipient{Phone: "+359888123456"}}
+	})
+
+	send := func(times int) {
+		for i := 0; i < times; i++ {
+			_ = cb.Send(dn)
+		}
+	}
+
+	It("should stay closed below min calls", func() {
+		provider.err = fmt.Errorf("connection refused")
+		send(3)
+		Expect(cb.Status().State).To(Equal(BreakerClosed))
+		Expect(cb.Status().FailureRate).To(Equal(1.0))
+	})
+
+	It("should open on the failure rate and refuse without calling the provider", func() {
+		send(2)
+		provider.err = fmt.Errorf("connection refused")
+		send(2)
+		Expect(cb.Status().State).To(Equal(BreakerOpen))
+		Expect(cb.Status().OpenedAt).To(Equal(&clock))
+
+		clock = clock.Add(10 * time.Second)
+		err := cb.Send(dn)
+		Expect(errors.Is(err, ErrCircuitOpen)).To(BeTrue())
+		pe := toProviderError(err)
+		Expect(pe.Kind).To(Equal(RateLimited))
+		Expect(pe.RetryAfter).To(Equal(20 * time.Second))
+		Expect(provider.sent).To(Equal(4))
+	})
+
+	It("should tell how long it stays open without admitting anything", func() {
+		_, open := cb.openFor()
+		Expect(open).To(BeFalse())
+		provider.err = fmt.Errorf("connection refused")
+		send(4)
+		clock = clock.Add(10 * time.Second)
+		wait, open := cb.openFor()
+		Expect(open).To(BeTrue())
+		Expect(wait).To(Equal(20 * time.Second))
+		clock = clock.Add(20 * time.Second)
+		_, open = cb.openFor()
+		Expect(open).To(BeFalse())
+		Expect(cb.Status().State).To(Equal(BreakerOpen))
+	})
+
+	It("should open on the slow call rate", func() {
+		provider.latency = 2 * time.Second
+		send(3)
+		provider.latency = 0
+		send(1)
+		Expect(cb.Status().State).To(Equal(BreakerOpen))
+	})
+
+	It("should not count permanent errors", func() {
+		provider.err = NewPermanentError(fmt.Errorf("unknown number"))
+		send(10)
+		Expect(cb.Status().State).To(Equal(BreakerClosed))
+		Expect(cb.Status().FailureRate).To(Equal(0.0))
+	})
+
+	It("should only take the last window size calls", func() {
+		provider.err = fmt.Errorf("connection refused")
+		send(4)
+		Expect(cb.Status().State).To(Equal(BreakerOpen))
+		clock = clock.Add(30 * time.Second)
+		provider.err = nil
+		send(2)
+		Expect(cb.Status().State).To(Equal(BreakerClosed))
+		Expect(cb.Status().Calls).To(Equal(0))
+		send(12)
+		Expect(cb.Status().Calls).To(Equal(10))
+	})
+
+	Context("Half-open", func() {
+		BeforeEach(func() {
+			provider.err = fmt.Errorf("connection refused")
+			send(4)
+			clock = clock.Add(30 * time.Second)
+		})
+
+		It("should close once every probe went through", func() {
+			provider.err = nil
+			Expect(cb.Send(dn)).To(Succeed())
+			Expect(cb.Status().State).To(Equal(BreakerHalfOpen))
+			Expect(cb.Send(dn)).To(Succeed())
+			Expect(cb.Status().State).To(Equal(BreakerClosed))
+			Expect(cb.Status().OpenedAt).To(BeNil())
+		})
+
+		It("should open again when a probe fails", func() {
+			Expect(cb.Send(dn)).ToNot(Succeed())
+			Expect(cb.Status().State).To(Equal(BreakerOpen))
+			Expect(cb.Status().OpenedAt).To(Equal(&clock))
+			Expect(provider.sent).To(Equal(5))
+		})
+
+		It("should admit no more than the probes at once", func() {
+			_, ok := cb.admit()
+			Expect(ok).To(BeTrue())
+			_, ok = cb.admit()
+			Expect(ok).To(BeTrue())
+			_, ok = cb.admit()
+			Expect(ok).To(BeFalse())
+		})
+	})
+
+	Context("Delegating notificator", func() {
+		health := &HealthConfig{Decay: 0.5, DemoteBelow: 0.5, DemoteFor: time.Minute}
+
+		It("should wrap every provider in a breaker of its own", func() {
+			dnr, err := NewDelegatingNotificator([]*Provider{{Name: "vendor-a", Notificator: &SMSNotificator{}},
+				{Name: "relay", Notificator: &EmailNotificator{}}},
+				map[string][]*Provider{"acme": {{Name: "sms", Notificator: &SMSNotificator{SenderID: "ACME"}}}}, cb.config, health)
+			Expect(err).To(BeNil())
+			statuses := dnr.Breakers()
+			Expect(statuses).To(HaveLen(3))
+			Expect(statuses[0].TenantID).To(BeEmpty())
+			Expect(statuses[0].Provider).To(Equal("vendor-a"))
+			Expect(statuses[1].Destination).To(Equal("EMAIL"))
+			Expect(statuses[2].TenantID).To(Equal("acme"))
+			Expect(statuses[2].Provider).To(Equal("sms"))
+			Expect(dnr.chainFor("acme", SMS).links[0].Notificator).To(BeAssignableToTypeOf(&CircuitBreaker{}))
+		})
+
+		It("should refuse an invalid config", func() {
+			_, err := NewDelegatingNotificator(nil, nil, &BreakerConfig{WindowSize: 5, MinCalls: 10}, health)
+			Expect(err).ToNot(BeNil())
+		})
+
+		It("should only be open for a destination while every breaker of its chain is", func() {
+			failing := &flakyNotificator{clock: &clock, err: fmt.Errorf("connection refused")}
+			dnr, err := NewDelegatingNotificator([]*Provider{{Name: "vendor-a", Notificator: failing},
+				{Name: "vendor-b", Notificator: &flakyNotificator{clock: &clock}}}, nil, cb.config, health)
+			Expect(err).To(BeNil())
+			for _, b := range dnr.breakers {
+				b.now = func() time.Time {
+					return clock
+				}
+			}
+			for i := 0; i < 4; i++ {
+				_ = dnr.breakers[0].Send(dn)
+			}
+			_, open := dnr.OpenFor(DefaultTenant, SMS)
+			Expect(open).To(BeFalse())
+			dnr.breakers[1].Notificator = failing
+			for i := 0; i < 4; i++ {
+				_ = dnr.breakers[1].Send(dn)
+			}
+			clock = clock.Add(5 * time.Second)
+			wait, open := dnr.OpenFor(DefaultTenant, SMS)
+			Expect(open).To(BeTrue())
+			Expect(wait).To(Equal(25 * time.Second))
+			_, open = dnr.OpenFor(DefaultTenant, Email)
+			Expect(open).To(BeFalse())
+		})
+
+		It("should not wrap without a config", func() {
+			dnr, err := NewDelegatingNotificator([]*Provider{{Name: "vendor-a", Notificator: &SMSNotificator{}}}, nil, nil, health)
+			Expect(err).To(BeNil())
+			Expect(dnr.Breakers()).To(BeEmpty())
+		})
+	})
+})
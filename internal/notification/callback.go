@@ -0,0 +1,293 @@
+package notification
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/cockroachdb/cockroach-go/v2/crdb/crdbpgx"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/rs/zerolog/log"
+	"go.uber.org/atomic"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// CallbackSignatureHeader is t=<unix seconds>,v1=<hex HMAC-SHA256 of "<unix seconds>.<body>">
+	CallbackSignatureHeader = "X-Notification-Signature"
+	// CallbackEventIDHeader stays the same across the retries of an event
+	CallbackEventIDHeader = "X-Notification-Event-ID"
+)
+
+var (
+	ErrNoSigningSecret = fmt.Errorf("no callback signing secret for tenant")
+	ErrCallbackAddress = fmt.Errorf("callback address not allowed")
+)
+
+// CallbackEvent is posted to the callback url of a notification once it reaches a final state
+type CallbackEvent struct {
+	ID           uuid.UUID       `json:"id"`
+	Type         string          `json:"type"`
+	CreatedAt    time.Time       `json:"created_at"`
+	Notification *StatusResponse `json:"notification"`
+}
+
+// SignCallback returns the CallbackSignatureHeader of a body sent at the given time
+func SignCallback(secret string, at time.Time, body []byte) string {
+	ts := strconv.FormatInt(at.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "t=" + ts + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// CallbackClient posts signed status events, unless allowPrivate only to public addresses once resolved.
+// Redirects are never followed
+type CallbackClient struct {
+	client  *http.Client
+	timeout time.Duration
+}
+
+func NewCallbackClient(timeout time.Duration, allowPrivate bool) *CallbackClient {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowPrivate {
+		dialer.Control = publicAddressOnly
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// a proxy would be the only address checked
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &CallbackClient{
+		client: &http.Client{
+			Timeout:   timeout,
+			Transport: transport,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		timeout: timeout,
+	}
+}
+
+// publicAddressOnly refuses to connect to loopback, private, link-local, multicast and unspecified addresses
+func publicAddressOnly(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return fmt.Errorf("%w: %s", ErrCallbackAddress, host)
+	}
+	return nil
+}
+
+// Send posts the event signed with the secret, any response but a 2xx is an error
+func (cc *CallbackClient) Send(ctx context.Context, url, secret string, event *CallbackEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(CallbackEventIDHeader, event.ID.String())
+	req.Header.Set(CallbackSignatureHeader, SignCallback(secret, time.Now(), body))
+	resp, err := cc.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// drained so the connection can be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("callback responded %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// CallbackRetryPolicy backs off exponentially from MinBackoff up to MaxBackoff for up to MaxAttempts
+type CallbackRetryPolicy struct {
+	MaxAttempts int
+	MinBackoff  time.Duration
+	MaxBackoff  time.Duration
+}
+
+// Backoff is how long to wait after the given failed attempt, the first one is 1
+func (p CallbackRetryPolicy) Backoff(attempt int) time.Duration {
+	backoff := p.MinBackoff
+	for i := 1; i < attempt && backoff < p.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > p.MaxBackoff {
+		return p.MaxBackoff
+	}
+	return backoff
+}
+
+// CallbackDispatcher posts the status events of notifications reaching a final state, every instance runs one.
+// An event can be posted twice, receivers dedupe on its id
+type CallbackDispatcher struct {
+	persistence *CRDBPersistence
+	client      *CallbackClient
+	secrets     map[string]string
+	policy      CallbackRetryPolicy
+	interval    time.Duration
+	batchSize   int
+	lease       time.Duration
+	maxReq      chan struct{}
+	stopped     *atomic.Bool
+	done        chan struct{}
+}
+
+// NewCallbackDispatcher dead letters the events of a tenant without a secret
+func NewCallbackDispatcher(persistence *CRDBPersistence, client *CallbackClient, secrets map[string]string, policy CallbackRetryPolicy,
+	interval time.Duration, batchSize int, lease time.Duration, maxRoutines int) (*CallbackDispatcher, error) {
+	if lease <= 0 || maxRoutines < 1 {
+		return nil, fmt.Errorf("callback lease must be positive and max routines at least 1, got %s and %d", lease, maxRoutines)
+	}
+	cd := &CallbackDispatcher{
+		persistence: persistence,
+		client:      client,
+		secrets:     secrets,
+		policy:      policy,
+		interval:    interval,
+		batchSize:   batchSize,
+		lease:       lease,
+		maxReq:      make(chan struct{}, maxRoutines),
+		stopped:     atomic.NewBool(false),
+		done:        make(chan struct{}),
+	}
+	cd.dispatchCallbacks()
+	return cd, nil
+}
+
+func (cd *CallbackDispatcher) Stop() {
+	cd.stopped.Store(true)
+	<-cd.done
+}
+
+func (cd *CallbackDispatcher) dispatchCallbacks() {
+	go func() {
+		defer close(cd.done)
+		ticker := time.NewTicker(cd.interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if cd.stopped.Load() {
+				return
+			}
+			sent, err := cd.dispatchBatch(context.Background())
+			if err != nil {
+				log.Err(err).Msg("could not dispatch callback")
+			}
+			if sent > 0 {
+				log.Info().Int("sent", sent).Msg("dispatched callbacks")
+			}
+		}
+	}()
+}
+
+func (cd *CallbackDispatcher) dispatchBatch(ctx context.Context) (int, error) {
+	var claimed []*Callback
+	err := crdbpgx.ExecuteTx(ctx, cd.persistence.GetPool(), pgx.TxOptions{}, func(tx pgx.Tx) error {
+		var err error
+		claimed, err = cd.persistence.ClaimCallbacks(ctx, cd.batchSize, cd.lease, tx)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	// attempts end halfway through the lease, leaving the rest to record them
+	attemptCtx, cancel := context.WithTimeout(ctx, cd.lease/2)
+	defer cancel()
+	sent := atomic.NewInt64(0)
+	var wg sync.WaitGroup
+	for _, cb := range claimed {
+		cd.maxReq <- struct{}{}
+		// the rest are claimed again once the lease is over
+		if cd.stopped.Load() || attemptCtx.Err() != nil {
+			<-cd.maxReq
+			break
+		}
+		wg.Add(1)
+		go func(cb *Callback) {
+			defer func() {
+				<-cd.maxReq
+				wg.Done()
+			}()
+			if errDispatch := cd.dispatch(ctx, attemptCtx, cb); errDispatch != nil {
+				log.Err(errDispatch).Str("callback", cb.ID.String()).Msg("could not dispatch callback")
+				return
+			}
+			sent.Inc()
+		}(cb)
+	}
+	wg.Wait()
+	return int(sent.Load()), nil
+}
+
+// dispatch posts the event within attemptCtx and records the outcome
+func (cd *CallbackDispatcher) dispatch(ctx, attemptCtx context.Context, claimed *Callback) error {
+	var event *CallbackEvent
+	errSend := crdbpgx.ExecuteTx(attemptCtx, cd.persistence.GetPool(), pgx.TxOptions{}, func(tx pgx.Tx) error {
+		n, err := cd.persistence.Get(attemptCtx, claimed.TenantID, claimed.NotificationUUID, tx)
+		if err == pgx.ErrNoRows {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		event = &CallbackEvent{
+			ID:           claimed.ID,
+			Type:         "notification." + string(claimed.State),
+			CreatedAt:    claimed.CreatedAt,
+			Notification: toStatusResponse(n),
+		}
+		return nil
+	})
+	if errSend == nil {
+		errSend = cd.send(attemptCtx, claimed, event)
+	}
+	return crdbpgx.ExecuteTx(ctx, cd.persistence.GetPool(), pgx.TxOptions{}, func(tx pgx.Tx) error {
+		return cd.record(ctx, claimed, errSend, tx)
+	})
+}
+
+func (cd *CallbackDispatcher) send(ctx context.Context, claimed *Callback, event *CallbackEvent) error {
+	secret, ok := cd.secrets[claimed.TenantID]
+	if !ok || secret == "" {
+		return fmt.Errorf("%w %s", ErrNoSigningSecret, claimed.TenantID)
+	}
+	return cd.client.Send(ctx, claimed.URL, secret, event)
+}
+
+// record the outcome of an attempt, errors no retry can fix are dead lettered straight away
+func (cd *CallbackDispatcher) record(ctx context.Context, claimed *Callback, errSend error, tx pgx.Tx) error {
+	if errSend == nil {
+		return cd.persistence.DeleteCallback(ctx, claimed.ID, tx)
+	}
+	attempt := claimed.Attempts + 1
+	failed := log.Warn().Err(errSend).Str("callback", claimed.ID.String()).Str("uuid", claimed.NotificationUUID.String()).
+		Int("attempt", attempt)
+	if attempt >= cd.policy.MaxAttempts || errors.Is(errSend, ErrNoSigningSecret) || errors.Is(errSend, ErrNotFound) {
+		failed.Msg("dead lettered callback")
+		return cd.persistence.DeadLetterCallback(ctx, claimed.ID, errSend.Error(), tx)
+	}
+	failed.Msg("callback failed")
+	return cd.persistence.RetryCallback(ctx, claimed.ID, cd.policy.Backoff(attempt), errSend.Error(), tx)
+}
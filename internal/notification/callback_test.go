@@ -0,0 +1,131 @@
+package notification_test
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/despondency/notifications-service/internal/notification"
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var _ = Describe("Callbacks", func() {
+
+	Context("Signature", func() {
+		It("should be a HMAC-SHA256 of the timestamp and body", func() {
+			body := []byte(`{"id":"1"}`)
+			mac := hmac.New(sha256.New, []byte("s3cr3t"))
+			mac.Write([]byte("1700000000." + string(body)))
+			Expect(notification.SignCallback("s3cr3t", time.Unix(1700000000, 0), body)).
+				To(Equal("t=1700000000,v1=" + hex.EncodeToString(mac.Sum(nil))))
+		})
+	})
+
+	Context("Client", func() {
+		var (
+			event        *notification.CallbackEvent
+			status       int
+			received     *http.Request
+			body         []byte
+			server       *httptest.Server
+			allowPrivate bool
+			err          error
+		)
+
+		BeforeEach(func() {
+			status = http.StatusNoContent
+			allowPrivate = true
+			event = &notification.CallbackEvent{
+				ID:           uuid.New(),
+				Type:         "notification.delivered",
+				CreatedAt:    time.Now().UTC(),
+				Notification: &notification.StatusResponse{UUID: uuid.New(), State: notification.StateDelivered},
+			}
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				received = r
+				body, _ = io.ReadAll(r.Body)
+				w.Header().Set("Location", "/elsewhere")
+				w.WriteHeader(status)
+			}))
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		JustBeforeEach(func() {
+			err = notification.NewCallbackClient(time.Second, allowPrivate).Send(context.Background(), server.URL, "s3cr3t", event)
+		})
+
+		Context("Accepted", func() {
+			It("should post the signed event", func() {
+				Expect(err).To(BeNil())
+				Expect(received.Method).To(Equal(http.MethodPost))
+				Expect(received.Header.Get(notification.CallbackEventIDHeader)).To(Equal(event.ID.String()))
+				signature := received.Header.Get(notification.CallbackSignatureHeader)
+				ts, _, _ := strings.Cut(strings.TrimPrefix(signature, "t="), ",")
+				sent, errParse := strconv.ParseInt(ts, 10, 64)
+				Expect(errParse).To(BeNil())
+				Expect(signature).To(Equal(notification.SignCallback("s3cr3t", time.Unix(sent, 0), body)))
+				got := &notification.CallbackEvent{}
+				Expect(json.Unmarshal(body, got)).To(Succeed())
+				Expect(got.ID).To(Equal(event.ID))
+				Expect(got.Notification.State).To(Equal(notification.StateDelivered))
+			})
+		})
+
+		Context("Refused", func() {
+			BeforeEach(func() {
+				status = http.StatusServiceUnavailable
+			})
+
+			It("should fail", func() {
+				Expect(err).ToNot(BeNil())
+			})
+		})
+
+		Context("Redirected", func() {
+			BeforeEach(func() {
+				status = http.StatusFound
+			})
+
+			It("should fail without following it", func() {
+				Expect(err).ToNot(BeNil())
+				Expect(received.URL.Path).To(Equal("/"))
+			})
+		})
+
+		Context("Private address", func() {
+			BeforeEach(func() {
+				allowPrivate = false
+				received = nil
+			})
+
+			It("should not connect", func() {
+				Expect(errors.Is(err, notification.ErrCallbackAddress)).To(BeTrue())
+				Expect(received).To(BeNil())
+			})
+		})
+	})
+
+	Context("Retry policy", func() {
+		It("should back off exponentially up to the max", func() {
+			p := notification.CallbackRetryPolicy{MaxAttempts: 10, MinBackoff: 5 * time.Second, MaxBackoff: time.Minute}
+			Expect(p.Backoff(1)).To(Equal(5 * time.Second))
+			Expect(p.Backoff(2)).To(Equal(10 * time.Second))
+			Expect(p.Backoff(4)).To(Equal(40 * time.Second))
+			Expect(p.Backoff(5)).To(Equal(time.Minute))
+			Expect(p.Backoff(60)).To(Equal(time.Minute))
+		})
+	})
+})
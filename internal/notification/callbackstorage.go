@@ -0,0 +1,93 @@
+package notification
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
+	"time"
+)
+
+// Callback is a status event waiting to be posted to its url
+type Callback struct {
+	ID               uuid.UUID
+	TenantID         string
+	NotificationUUID uuid.UUID
+	State            State
+	URL              string
+	Attempts         int
+	CreatedAt        time.Time
+}
+
+// InsertCallback queues the status event of a notification that reached a final state
+func (crdbp *CRDBPersistence) InsertCallback(ctx context.Context, tenantID string, notifUUID uuid.UUID, state State, url string,
+	tx pgx.Tx) error {
+	_, errExec := tx.Exec(ctx,
+		"INSERT into callbacks(tenant_id, notification_uuid, state, url, next_attempt_at, created_at) "+
+			"VALUES ($1, $2, $3, $4, now(), now())",
+		tenantID,
+		notifUUID,
+		state,
+		url,
+	)
+	return errExec
+}
+
+// ClaimCallbacks leases up to limit due callbacks, skipping the ones another instance is claiming.
+// They stay queued until deleted
+func (crdbp *CRDBPersistence) ClaimCallbacks(ctx context.Context, limit int, lease time.Duration, tx pgx.Tx) ([]*Callback, error) {
+	rows, err := tx.Query(ctx,
+		"UPDATE callbacks SET next_attempt_at = now()::TIMESTAMP + $2 * INTERVAL '1 second' "+
+			"WHERE id IN (SELECT id FROM callbacks WHERE next_attempt_at <= now()::TIMESTAMP "+
+			"ORDER BY next_attempt_at LIMIT $1 FOR UPDATE SKIP LOCKED) "+
+			"RETURNING id, tenant_id, notification_uuid, state, url, attempts, created_at",
+		limit,
+		lease.Seconds(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	claimed := make([]*Callback, 0, limit)
+	for rows.Next() {
+		cb := &Callback{}
+		var createdAt pgtype.Timestamp
+		if err = rows.Scan(&cb.ID, &cb.TenantID, &cb.NotificationUUID, &cb.State, &cb.URL, &cb.Attempts, &createdAt); err != nil {
+			return nil, err
+		}
+		cb.CreatedAt = createdAt.Time
+		claimed = append(claimed, cb)
+	}
+	return claimed, rows.Err()
+}
+
+func (crdbp *CRDBPersistence) DeleteCallback(ctx context.Context, id uuid.UUID, tx pgx.Tx) error {
+	_, errExec := tx.Exec(ctx, "DELETE FROM callbacks WHERE id = $1", id)
+	return errExec
+}
+
+// RetryCallback records a failed attempt and when to try again
+func (crdbp *CRDBPersistence) RetryCallback(ctx context.Context, id uuid.UUID, after time.Duration, lastErr string, tx pgx.Tx) error {
+	_, errExec := tx.Exec(ctx,
+		"UPDATE callbacks SET attempts = attempts + 1, next_attempt_at = now()::TIMESTAMP + $2 * INTERVAL '1 second', "+
+			"last_error = $3 WHERE id = $1",
+		id,
+		after.Seconds(),
+		lastErr,
+	)
+	return errExec
+}
+
+// DeadLetterCallback records a failed attempt and gives up on the callback, it moves to the dead letters
+func (crdbp *CRDBPersistence) DeadLetterCallback(ctx context.Context, id uuid.UUID, lastErr string, tx pgx.Tx) error {
+	_, errExec := tx.Exec(ctx,
+		"INSERT into callback_dead_letters(id, tenant_id, notification_uuid, state, url, attempts, last_error, created_at, dead_at) "+
+			"SELECT id, tenant_id, notification_uuid, state, url, attempts + 1, $2, created_at, now() FROM callbacks WHERE id = $1",
+		id,
+		lastErr,
+	)
+	if errExec != nil {
+		return errExec
+	}
+	return crdbp.DeleteCallback(ctx, id, tx)
+}
@@ -1,20 +1,116 @@
 package notification
 
 import (
+	"bytes"
 	"fmt"
+	"github.com/google/uuid"
 	"github.com/rs/zerolog/log"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
 )
 
 type EmailNotificator struct {
-	// business stuff
+	// From is the sender address, the provider's default when empty
+	From    string
+	ReplyTo string
+	// SMTP is the relay the notifications are sent through, they are only logged without one
+	SMTP *SMTPPool
 }
 
-func (en *EmailNotificator) Send(txt string) error {
-	// business logic regarding email notifications
-	log.Info().Msg(fmt.Sprintf("Sent an Email NotificationRequest with txt %s", txt))
-	return nil
+func (en *EmailNotificator) Send(notification *DelegatingNotification) error {
+	if en.SMTP == nil {
+		log.Info().Str("tenant_id", notification.TenantID()).Str("from", en.From).Msg(fmt.Sprintf("Sent an Email NotificationRequest to %s with subject %s and txt %s",
+			notification.Recipient(), notification.Subject(), notification.Txt()))
+		return nil
+	}
+	from, err := mail.ParseAddress(en.From)
+	if err != nil {
+		return NewPermanentError(fmt.Errorf("sender address %q: %w", en.From, err))
+	}
+	msg, err := en.buildMessage(from, notification, time.Now())
+	if err != nil {
+		return NewPermanentError(err)
+	}
+	return en.SMTP.Send(from.Address, []string{notification.Recipient().Email}, msg)
 }
 
 func (sn *EmailNotificator) Destination() Destination {
 	return Email
 }
+
+// buildMessage renders the notification as a MIME message, its Message-ID is derived from the uuid
+// so retries keep it
+func (en *EmailNotificator) buildMessage(from *mail.Address, notification *DelegatingNotification, now time.Time) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	writeHeader(buf, "From", from.String())
+	writeHeader(buf, "To", notification.Recipient().String())
+	if en.ReplyTo != "" {
+		replyTo, err := mail.ParseAddress(en.ReplyTo)
+		if err != nil {
+			return nil, fmt.Errorf("reply-to address %q: %w", en.ReplyTo, err)
+		}
+		writeHeader(buf, "Reply-To", replyTo.String())
+	}
+	if notification.Subject() != "" {
+		writeHeader(buf, "Subject", mime.QEncoding.Encode("utf-8", notification.Subject()))
+	}
+	writeHeader(buf, "Date", now.Format(time.RFC1123Z))
+	writeHeader(buf, "Message-ID", messageID(notification.UUID(), from.Address))
+	writeHeader(buf, "MIME-Version", "1.0")
+	if notification.HTML() == "" {
+		writeHeader(buf, "Content-Type", "text/plain; charset=utf-8")
+		writeHeader(buf, "Content-Transfer-Encoding", "quoted-printable")
+		buf.WriteString("\r\n")
+		if err := writeQuotedPrintable(buf, notification.Txt()); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	mw := multipart.NewWriter(buf)
+	writeHeader(buf, "Content-Type", mime.FormatMediaType("multipart/alternative", map[string]string{"boundary": mw.Boundary()}))
+	buf.WriteString("\r\n")
+	// the last part is the preferred one
+	for _, part := range []struct {
+		contentType string
+		body        string
+	}{{"text/plain; charset=utf-8", notification.Txt()}, {"text/html; charset=utf-8", notification.HTML()}} {
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err = writeQuotedPrintable(w, part.body); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeHeader(buf *bytes.Buffer, key, value string) {
+	buf.WriteString(key + ": " + value + "\r\n")
+}
+
+func writeQuotedPrintable(w io.Writer, s string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write([]byte(s)); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+// messageID is the notification uuid at the domain of the sender
+func messageID(notificationUUID uuid.UUID, from string) string {
+	domain := from[strings.LastIndex(from, "@")+1:]
+	return "<" + notificationUUID.String() + "@" + domain + ">"
+}
@@ -0,0 +1,411 @@
+package notification
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"errors"
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"io"
+	"math/big"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+	"time"
+)
+
+// smtpStub is an in-process relay that accepts every message unless told otherwise
+type smtpStub struct {
+	listener    net.Listener
+	tlsConfig   *tls.Config
+	implicitTLS bool
+	// rcptReply refuses the recipients when set, like 550 5.1.1 no such user
+	rcptReply string
+	// closeAfterMessage hangs up once a message is queued, like a relay dropping idle connections
+	closeAfterMessage bool
+	// replies is how many messages are replied to when set, later ones are queued and hung up on, like a relay timing out
+	replies int
+
+	mu       sync.Mutex
+	conns    int
+	auths    []string
+	messages []string
+}
+
+func newSMTPStub(tlsConfig *tls.Config, implicitTLS bool) *smtpStub {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	Expect(err).To(BeNil())
+	if implicitTLS {
+		listener = tls.NewListener(listener, tlsConfig)
+	}
+	s := &smtpStub{listener: listener, tlsConfig: tlsConfig, implicitTLS: implicitTLS}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.conns++
+			s.mu.Unlock()
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *smtpStub) serve(conn net.Conn) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	secure := s.implicitTLS
+	_ = tp.PrintfLine("220 stub ESMTP")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			if !secure {
+				_ = tp.PrintfLine("250-stub")
+				_ = tp.PrintfLine("250-STARTTLS")
+			} else {
+				_ = tp.PrintfLine("250-stub")
+			}
+			_ = tp.PrintfLine("250 AUTH PLAIN LOGIN")
+		case "STARTTLS":
+			_ = tp.PrintfLine("220 ready")
+			tlsConn := tls.Server(conn, s.tlsConfig)
+			if tlsConn.Handshake() != nil {
+				return
+			}
+			conn, tp, secure = tlsConn, textproto.NewConn(tlsConn), true
+		case "AUTH":
+			s.auth(tp, arg)
+		case "MAIL":
+			_ = tp.PrintfLine("250 ok")
+		case "RCPT":
+			if s.rcptReply != "" {
+				_ = tp.PrintfLine(s.rcptReply)
+				continue
+			}
+			_ = tp.PrintfLine("250 ok")
+		case "DATA":
+			_ = tp.PrintfLine("354 go ahead")
+			data, err := io.ReadAll(tp.DotReader())
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.messages = append(s.messages, string(data))
+			hangUp := s.replies > 0 && len(s.messages) > s.replies
+			s.mu.Unlock()
+			if hangUp {
+				return
+			}
+			_ = tp.PrintfLine("250 queued")
+			if s.closeAfterMessage {
+				return
+			}
+		case "QUIT":
+			_ = tp.PrintfLine("221 bye")
+			return
+		default:
+			_ = tp.PrintfLine("250 ok")
+		}
+	}
+}
+
+func (s *smtpStub) auth(tp *textproto.Conn, arg string) {
+	mechanism, initial, _ := strings.Cut(arg, " ")
+	var credentials string
+	switch mechanism {
+	case "PLAIN":
+		b, _ := base64.StdEncoding.DecodeString(initial)
+		credentials = strings.TrimPrefix(string(b), "\x00")
+		credentials = strings.Replace(credentials, "\x00", ":", 1)
+	case "LOGIN":
+		parts := make([]string, 0, 2)
+		for _, challenge := range []string{"Username:", "Password:"} {
+			_ = tp.PrintfLine("334 %s", base64.StdEncoding.EncodeToString([]byte(challenge)))
+			line, _ := tp.ReadLine()
+			b, _ := base64.StdEncoding.DecodeString(line)
+			parts = append(parts, string(b))
+		}
+		credentials = strings.Join(parts, ":")
+	}
+	if credentials != "user:s3cr3t" {
+		_ = tp.PrintfLine("535 bad credentials")
+		return
+	}
+	s.mu.Lock()
+	s.auths = append(s.auths, mechanism)
+	s.mu.Unlock()
+	_ = tp.PrintfLine("235 ok")
+}
+
+func (s *smtpStub) stats() (int, []string, []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conns, append([]string(nil), s.auths...), append([]string(nil), s.messages...)
+}
+
+// selfSigned returns the stub's certificate and a client config trusting it
+func selfSigned() (*tls.Config, *tls.Config) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).To(BeNil())
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	Expect(err).To(BeNil())
+	cert, err := x509.ParseCertificate(der)
+	Expect(err).To(BeNil())
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	return &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}},
+		&tls.Config{RootCAs: roots}
+}
+
+var _ = Describe("Email notificator", func() {
+
+	var (
+		serverTLS, clientTLS *tls.Config
+		stub                 *smtpStub
+		pool                 *SMTPPool
+		config               *SMTPConfig
+		en                   *EmailNotificator
+		dn                   *DelegatingNotification
+	)
+
+	BeforeEach(func() {
+		serverTLS, clientTLS = selfSigned()
+		config = &SMTPConfig{
+			Security:    SMTPStartTLS,
+			Auth:        SMTPAuthPlain,
+			Username:    "user",
+			Password:    "s3cr3t",
+			MaxConns:    2,
+			IdleTimeout: time.Minute,
+			Timeout:     5 * time.Second,
+			TLSConfig:   clientTLS,
+		}
+		dn = &DelegatingNotification{
+			uuid:      uuid.MustParse("8f58c11d-ebc2-4ca7-a934-226e2bb6192c"),
+			dest:      Email,
+			recipient: &Recipient{Email: "ana@example.com", Name: "Ana Petrova"},
+			subject:   "Ваша поръчка",
+			txt:       "Your order shipped.\nTrack it at https://example.com/orders/42",
+			html:      "<p>Your order <b>shipped</b>.</p>",
+		}
+	})
+
+	JustBeforeEach(func() {
+		var err error
+		stub = newSMTPStub(serverTLS, config.Security == SMTPImplicitTLS)
+		config.Addr = stub.listener.Addr().String()
+		pool, err = NewSMTPPool(config)
+		Expect(err).To(BeNil())
+		en = &EmailNotificator{From: "Shop <orders@shop.example>", ReplyTo: "support@shop.example", SMTP: pool}
+	})
+
+	AfterEach(func() {
+		pool.Close()
+		_ = stub.listener.Close()
+	})
+
+	Context("STARTTLS and PLAIN", func() {
+		It("should send a multipart/alternative message", func() {
+			Expect(en.Send(dn)).To(Succeed())
+			_, auths, messages := stub.stats()
+			Expect(auths).To(Equal([]string{"PLAIN"}))
+			Expect(messages).To(HaveLen(1))
+
+			msg, err := mail.ReadMessage(strings.NewReader(messages[0]))
+			Expect(err).To(BeNil())
+			Expect(msg.Header.Get("From")).To(Equal(`"Shop" <orders@shop.example>`))
+			Expect(msg.Header.Get("To")).To(Equal(`"Ana Petrova" <ana@example.com>`))
+			Expect(msg.Header.Get("Reply-To")).To(Equal("<support@shop.example>"))
+			Expect(msg.Header.Get("Message-ID")).To(Equal("<8f58c11d-ebc2-4ca7-a934-226e2bb6192c@shop.example>"))
+			subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+			Expect(err).To(BeNil())
+			Expect(subject).To(Equal("Ваша поръчка"))
+
+			mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+			Expect(err).To(BeNil())
+			Expect(mediaType).To(Equal("multipart/alternative"))
+			mr := multipart.NewReader(msg.Body, params["boundary"])
+			bodies := make(map[string]string)
+			for {
+				part, errPart := mr.NextPart()
+				if errPart == io.EOF {
+					break
+				}
+				Expect(errPart).To(BeNil())
+				// the reader decodes quoted-printable parts
+				b, errRead := io.ReadAll(part)
+				Expect(errRead).To(BeNil())
+				bodies[part.Header.Get("Content-Type")] = string(b)
+			}
+			Expect(bodies).To(HaveKeyWithValue("text/plain; charset=utf-8", "Your order shipped.\nTrack it at https://example.com/orders/42"))
+			Expect(bodies).To(HaveKeyWithValue("text/html; charset=utf-8", "<p>Your order <b>shipped</b>.</p>"))
+		})
+
+		It("should reuse its connections", func() {
+			for i := 0; i < 3; i++ {
+				Expect(en.Send(dn)).To(Succeed())
+			}
+			conns, _, messages := stub.stats()
+			Expect(conns).To(Equal(1))
+			Expect(messages).To(HaveLen(3))
+		})
+
+		It("should open no more than max conns", func() {
+			var wg sync.WaitGroup
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					defer GinkgoRecover()
+					Expect(en.Send(dn)).To(Succeed())
+				}()
+			}
+			wg.Wait()
+			conns, _, messages := stub.stats()
+			Expect(conns).To(BeNumerically("<=", 2))
+			Expect(messages).To(HaveLen(10))
+		})
+
+		Context("Relay dropping idle connections", func() {
+			BeforeEach(func() {
+				dn.html = ""
+			})
+
+			JustBeforeEach(func() {
+				stub.closeAfterMessage = true
+			})
+
+			It("should send with a new connection", func() {
+				Expect(en.Send(dn)).To(Succeed())
+				Expect(en.Send(dn)).To(Succeed())
+				conns, _, messages := stub.stats()
+				Expect(conns).To(Equal(2))
+				Expect(messages).To(HaveLen(2))
+			})
+		})
+
+		Context("Relay hanging up after DATA", func() {
+			JustBeforeEach(func() {
+				stub.replies = 1
+			})
+
+			It("should be retried without sending the message again", func() {
+				Expect(en.Send(dn)).To(Succeed())
+				err := en.Send(dn)
+				var pe *ProviderError
+				Expect(errors.As(err, &pe)).To(BeTrue())
+				Expect(pe.Kind).To(Equal(Retryable))
+				conns, _, messages := stub.stats()
+				Expect(conns).To(Equal(1))
+				Expect(messages).To(HaveLen(2))
+			})
+		})
+
+		Context("Refused recipient", func() {
+			JustBeforeEach(func() {
+				stub.rcptReply = "550 5.1.1 no such user"
+			})
+
+			It("should fail permanently", func() {
+				err := en.Send(dn)
+				var pe *ProviderError
+				Expect(errors.As(err, &pe)).To(BeTrue())
+				Expect(pe.Kind).To(Equal(Permanent))
+			})
+		})
+
+		Context("Recipient greylisted", func() {
+			JustBeforeEach(func() {
+				stub.rcptReply = "451 4.7.1 try again later"
+			})
+
+			It("should be retried", func() {
+				err := en.Send(dn)
+				Expect(toProviderError(err).Kind).To(Equal(Retryable))
+			})
+		})
+
+		Context("Wrong password", func() {
+			BeforeEach(func() {
+				config.Password = "wrong"
+			})
+
+			It("should be retried, it isn't the notification's fault", func() {
+				err := en.Send(dn)
+				Expect(toProviderError(err).Kind).To(Equal(Retryable))
+				Expect(err.Error()).To(ContainSubstring("535"))
+			})
+		})
+	})
+
+	Context("Implicit TLS and LOGIN", func() {
+		BeforeEach(func() {
+			config.Security = SMTPImplicitTLS
+			config.Auth = SMTPAuthLogin
+			dn.html = ""
+		})
+
+		It("should send a text message", func() {
+			Expect(en.Send(dn)).To(Succeed())
+			_, auths, messages := stub.stats()
+			Expect(auths).To(Equal([]string{"LOGIN"}))
+			msg, err := mail.ReadMessage(strings.NewReader(messages[0]))
+			Expect(err).To(BeNil())
+			Expect(msg.Header.Get("Content-Type")).To(Equal("text/plain; charset=utf-8"))
+			Expect(msg.Header.Get("Content-Transfer-Encoding")).To(Equal("quoted-printable"))
+		})
+	})
+
+	Context("Untrusted relay", func() {
+		BeforeEach(func() {
+			config.TLSConfig = nil
+		})
+
+		It("should refuse to send", func() {
+			err := en.Send(dn)
+			Expect(err).ToNot(BeNil())
+			_, _, messages := stub.stats()
+			Expect(messages).To(BeEmpty())
+		})
+	})
+
+	Context("Invalid config", func() {
+		It("should be refused", func() {
+			_, err := NewSMTPPool(&SMTPConfig{Addr: "smtp.example.com:587", Security: "ssl", MaxConns: 1, Timeout: time.Second})
+			Expect(err).ToNot(BeNil())
+			_, err = NewSMTPPool(&SMTPConfig{Addr: "smtp.example.com", Security: SMTPStartTLS, MaxConns: 1, Timeout: time.Second})
+			Expect(err).ToNot(BeNil())
+		})
+	})
+
+	It("should log without a relay", func() {
+		Expect((&EmailNotificator{From: "orders@shop.example"}).Send(dn)).To(Succeed())
+	})
+})
@@ -1,50 +1,363 @@
 package notification
 
 import (
+	"bufio"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
 	"github.com/julienschmidt/httprouter"
 	"github.com/rs/zerolog/log"
 	"io"
 	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	MaxBatchSize     = 10_000
+	MaxStatusLookups = 1_000
+	// MaxBatchBytes bounds the body of a batch, it leaves about 1.6KB per notification of a full batch
+	MaxBatchBytes = 16 << 20
+)
+
+var (
+	ErrBatchTooLarge  = fmt.Errorf("batch exceeds %d notifications", MaxBatchSize)
+	ErrBodyTooLarge   = fmt.Errorf("batch exceeds %d bytes", MaxBatchBytes)
+	ErrTooManyLookups = fmt.Errorf("status lookup exceeds %d uuids", MaxStatusLookups)
 )
 
 //go:generate mockgen -source endpoint.go -destination ./notificationmocks/internalservice_mock.go -package notificationmocks
 type InternalManager interface {
 	PushNotificationInternal(notification *Request) error
+	PushNotificationsInternal(notifications []*Request) *BatchResponse
+	GetNotificationStatus(ctx context.Context, tenantID string, notifUUID uuid.UUID) (*StatusResponse, error)
+	GetNotificationStatuses(ctx context.Context, tenantID string, notifUUIDs []uuid.UUID) (*BulkStatusResponse, error)
+	CancelNotification(ctx context.Context, tenantID string, notifUUID uuid.UUID) (*CancelResponse, error)
+	ListNotifications(ctx context.Context, filter *ListFilter) (*ListResponse, error)
 }
 
 type Endpoint struct {
-	svc InternalManager
+	svc     InternalManager
+	limiter RateLimiter
 }
 
-func NewEndpoint(svc InternalManager) *Endpoint {
+func NewEndpoint(svc InternalManager, limiter RateLimiter) *Endpoint {
 	return &Endpoint{
-		svc: svc,
+		svc:     svc,
+		limiter: limiter,
 	}
 }
 
 func (e *Endpoint) CreateNotification(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
-	reader := r.Body
-	length := r.ContentLength
-	b := make([]byte, length)
-	_, err := io.ReadFull(reader, b)
+	n := &Request{}
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(n)
 	if err != nil {
-		log.Err(err).Msg("error while reading req")
-		w.WriteHeader(http.StatusBadRequest)
+		log.Err(err).Msg("error while unmarshalling")
+		writeProblem(w, r, malformedProblem(err))
 		return
 	}
-	n := &Request{}
-	err = json.Unmarshal(b, n)
+	n.withIdentity(IdentityFromContext(r.Context()))
+	caller := callerID(r)
+	err = n.Validate()
+	if err == nil {
+		err = e.limiter.Take(r.Context(), caller, destinationCounts(n))
+		if err == nil {
+			err = e.svc.PushNotificationInternal(n)
+			if err != nil {
+				refund(r.Context(), e.limiter, caller, n)
+			}
+		}
+	}
+	var (
+		ve  *ValidationError
+		rle *RateLimitError
+	)
+	if errors.As(err, &ve) {
+		writeProblem(w, r, validationProblem(ve))
+	} else if errors.As(err, &rle) {
+		writeRateLimited(w, r, rle)
+	} else if err != nil {
+		log.Err(err).Msg("internal error")
+		writeProblem(w, r, internalProblem())
+	} else {
+		w.WriteHeader(http.StatusCreated)
+	}
+}
+
+func (e *Endpoint) CreateNotifications(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	requests, err := decodeBatch(http.MaxBytesReader(w, r.Body, MaxBatchBytes+1))
+	if errors.Is(err, ErrBatchTooLarge) || errors.Is(err, ErrBodyTooLarge) {
+		log.Err(err).Msg("batch too large")
+		writeProblem(w, r, tooLargeProblem(err))
+		return
+	}
+	if err != nil {
+		log.Err(err).Msg("error while decoding batch")
+		writeProblem(w, r, malformedProblem(err))
+		return
+	}
+	identity := IdentityFromContext(r.Context())
+	for _, n := range requests {
+		if n != nil {
+			n.withIdentity(identity)
+		}
+	}
+	// the whole batch is limited, a partially accepted batch would have to be split by the client anyway
+	caller := callerID(r)
+	err = e.limiter.Take(r.Context(), caller, destinationCounts(requests...))
+	var rle *RateLimitError
+	if errors.As(err, &rle) {
+		writeRateLimited(w, r, rle)
+		return
+	}
+	if err != nil {
+		log.Err(err).Msg("internal error")
+		writeProblem(w, r, internalProblem())
+		return
+	}
+	resp := e.svc.PushNotificationsInternal(requests)
+	refund(r.Context(), e.limiter, caller, rejectedRequests(requests, resp)...)
+	writeJSON(w, http.StatusMultiStatus, resp)
+}
+
+func (e *Endpoint) GetNotification(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	notifUUID, err := uuid.Parse(ps.ByName("uuid"))
+	if err != nil {
+		log.Err(err).Msg("error while parsing uuid")
+		writeProblem(w, r, invalidUUIDProblem("uuid"))
+		return
+	}
+	resp, err := e.svc.GetNotificationStatus(r.Context(), IdentityFromContext(r.Context()).TenantID, notifUUID)
+	if err == ErrNotFound {
+		writeProblem(w, r, notFoundProblem(err))
+		return
+	}
+	if err != nil {
+		log.Err(err).Msg("internal error")
+		writeProblem(w, r, internalProblem())
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// CancelNotification answers 200 whether or not the cancellation won the race, the body says which
+func (e *Endpoint) CancelNotification(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	notifUUID, err := uuid.Parse(ps.ByName("uuid"))
+	if err != nil {
+		log.Err(err).Msg("error while parsing uuid")
+		writeProblem(w, r, invalidUUIDProblem("uuid"))
+		return
+	}
+	resp, err := e.svc.CancelNotification(r.Context(), IdentityFromContext(r.Context()).TenantID, notifUUID)
+	if err != nil {
+		log.Err(err).Msg("internal error")
+		writeProblem(w, r, internalProblem())
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (e *Endpoint) GetNotificationStatuses(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	req := &BulkStatusRequest{}
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(req)
 	if err != nil {
 		log.Err(err).Msg("error while unmarshalling")
-		w.WriteHeader(http.StatusBadRequest)
+		writeProblem(w, r, malformedProblem(err))
+		return
+	}
+	if len(req.UUIDs) > MaxStatusLookups {
+		writeProblem(w, r, tooLargeProblem(ErrTooManyLookups))
+		return
+	}
+	notifUUIDs := make([]uuid.UUID, 0, len(req.UUIDs))
+	seen := make(map[uuid.UUID]struct{}, len(req.UUIDs))
+	for i, id := range req.UUIDs {
+		notifUUID, errParse := uuid.Parse(id)
+		if errParse != nil {
+			log.Err(errParse).Msg("error while parsing uuid")
+			writeProblem(w, r, invalidUUIDProblem(fmt.Sprintf("uuids[%d]", i)))
+			return
+		}
+		if _, ok := seen[notifUUID]; ok {
+			continue
+		}
+		seen[notifUUID] = struct{}{}
+		notifUUIDs = append(notifUUIDs, notifUUID)
+	}
+	resp, err := e.svc.GetNotificationStatuses(r.Context(), IdentityFromContext(r.Context()).TenantID, notifUUIDs)
+	if err != nil {
+		log.Err(err).Msg("internal error")
+		writeProblem(w, r, internalProblem())
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// ListNotifications lists the caller's notifications newest first, the cursor of a response fetches the next page
+func (e *Endpoint) ListNotifications(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	filter, ve := toListFilter(r)
+	if len(ve.Fields) > 0 {
+		writeProblem(w, r, validationProblem(ve))
 		return
 	}
-	err = e.svc.PushNotificationInternal(n)
+	resp, err := e.svc.ListNotifications(r.Context(), filter)
 	if err != nil {
 		log.Err(err).Msg("internal error")
+		writeProblem(w, r, internalProblem())
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func toListFilter(r *http.Request) (*ListFilter, *ValidationError) {
+	query := r.URL.Query()
+	filter := &ListFilter{
+		TenantID: IdentityFromContext(r.Context()).TenantID,
+		Limit:    DefaultListLimit,
+	}
+	ve := &ValidationError{}
+	for _, d := range query["destination"] {
+		dest, err := toServerNotificationDestination(d)
+		if err != nil {
+			ve.add("destination", "must be one of SMS, EMAIL, SLACK")
+			continue
+		}
+		filter.Destinations = append(filter.Destinations, dest)
+	}
+	for _, s := range query["state"] {
+		state, ok := toServerState(s)
+		if !ok {
+			ve.add("state", "must be one of received, scheduled, dispatching, delivered, failed, suppressed, cancelled, expired")
+			continue
+		}
+		filter.States = append(filter.States, state)
+	}
+	for name, t := range map[string]**time.Time{"from": &filter.From, "to": &filter.To} {
+		if v := query.Get(name); v != "" {
+			parsed, err := time.Parse(time.RFC3339Nano, v)
+			if err != nil {
+				ve.add(name, "must be a RFC 3339 timestamp")
+				continue
+			}
+			*t = &parsed
+		}
+	}
+	if filter.From != nil && filter.To != nil && !filter.From.Before(*filter.To) {
+		ve.add("to", "must be after from")
+	}
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > MaxListLimit {
+			ve.add("limit", fmt.Sprintf("must be between 1 and %d", MaxListLimit))
+		}
+		filter.Limit = limit
+	}
+	if v := query.Get("cursor"); v != "" {
+		var err error
+		if filter.After, err = ParseListCursor(v); err != nil {
+			ve.add("cursor", "must be the next_cursor of a previous page")
+		}
+	}
+	return filter, ve
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		log.Err(err).Msg("error while marshalling response")
 		w.WriteHeader(http.StatusInternalServerError)
-	} else {
-		w.WriteHeader(http.StatusCreated)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, err = w.Write(b)
+	if err != nil {
+		log.Err(err).Msg("error while writing response")
+	}
+}
+
+// decodeBatch accepts a JSON array or NDJSON stream, it stops past MaxBatchSize requests or MaxBatchBytes
+func decodeBatch(body io.Reader) ([]*Request, error) {
+	reader := bufio.NewReader(&batchBody{r: body, remaining: MaxBatchBytes + 1})
+	first, err := peekNonSpace(reader)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(reader)
+	decoder.DisallowUnknownFields()
+	requests := make([]*Request, 0)
+	if first == '[' {
+		if _, err = decoder.Token(); err != nil {
+			return nil, err
+		}
+		for decoder.More() {
+			if len(requests) == MaxBatchSize {
+				return nil, ErrBatchTooLarge
+			}
+			var n *Request
+			if err = decoder.Decode(&n); err != nil {
+				return nil, err
+			}
+			requests = append(requests, n)
+		}
+		if _, err = decoder.Token(); err != nil {
+			return nil, err
+		}
+		return requests, nil
+	}
+	for {
+		n := &Request{}
+		err = decoder.Decode(n)
+		if err == io.EOF {
+			return requests, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(requests) == MaxBatchSize {
+			return nil, ErrBatchTooLarge
+		}
+		requests = append(requests, n)
+	}
+}
+
+// batchBody fails with ErrBodyTooLarge once it read remaining bytes
+type batchBody struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (b *batchBody) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		return 0, ErrBodyTooLarge
+	}
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+	n, err := b.r.Read(p)
+	b.remaining -= int64(n)
+	if b.remaining <= 0 {
+		return n, ErrBodyTooLarge
+	}
+	return n, err
+}
+
+func peekNonSpace(reader *bufio.Reader) (byte, error) {
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		switch b {
+		case ' ', '\t', '\r', '\n':
+			continue
+		}
+		return b, reader.UnreadByte()
 	}
 }
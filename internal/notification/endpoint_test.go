@@ -2,6 +2,7 @@ package notification_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/despondency/notifications-service/internal/notification"
@@ -14,6 +15,8 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"time"
 )
 
 var _ = Describe("Endpoint", func() {
@@ -22,15 +25,25 @@ var _ = Describe("Endpoint", func() {
 		var (
 			endpoint              *notification.Endpoint
 			mockedInternalManager *notificationmocks.MockInternalManager
+			mockedRateLimiter     *notificationmocks.MockRateLimiter
+			limitErr              error
 			ctrl                  *gomock.Controller
 			router                *httprouter.Router
 			body                  io.Reader
 			rr                    *httptest.ResponseRecorder
+			identity              *notification.Identity
 		)
 		BeforeEach(func() {
 			ctrl = gomock.NewController(GinkgoT())
 			mockedInternalManager = notificationmocks.NewMockInternalManager(ctrl)
-			endpoint = notification.NewEndpoint(mockedInternalManager)
+			mockedRateLimiter = notificationmocks.NewMockRateLimiter(ctrl)
+			limitErr = nil
+			identity = nil
+			mockedRateLimiter.EXPECT().Take(gomock.Any(), gomock.Any(), gomock.Any()).
+				DoAndReturn(func(_ context.Context, _ string, _ map[notification.Destination]int) error {
+					return limitErr
+				}).AnyTimes()
+			endpoint = notification.NewEndpoint(mockedInternalManager, mockedRateLimiter)
 
 			router = httprouter.New()
 			router.POST("/notifications", endpoint.CreateNotification)
@@ -38,6 +51,9 @@ var _ = Describe("Endpoint", func() {
 
 		JustBeforeEach(func() {
 			req, _ := http.NewRequest("POST", "/notifications", body)
+			if identity != nil {
+				req = req.WithContext(notification.WithIdentity(req.Context(), identity))
+			}
 			rr = httptest.NewRecorder()
 			router.ServeHTTP(rr, req)
 		})
@@ -49,6 +65,7 @@ var _ = Describe("Endpoint", func() {
 					UUID:            uuid.New().String(),
 					NotificationTxt: "TXT",
 					Destination:     "EMAIL",
+					Recipient:       &notification.Recipient{Email: "jane@example.com"},
 				}
 				b, err := json.Marshal(n)
 				if err != nil {
@@ -62,6 +79,69 @@ var _ = Describe("Endpoint", func() {
 			})
 		})
 
+		Context("Test callback url of the api key, 201", func() {
+			var pushed *notification.Request
+			BeforeEach(func() {
+				identity = &notification.Identity{TenantID: "payments", CallbackURL: "https://payments.example.com/hooks"}
+				mockedInternalManager.EXPECT().PushNotificationInternal(gomock.Any()).DoAndReturn(func(n *notification.Request) error {
+					pushed = n
+					return nil
+				}).Times(1)
+				body = bytes.NewBufferString(`{"uuid": "` + uuid.New().String() + `", "txt": "TXT", "destination": "EMAIL", ` +
+					`"recipient": {"email": "jane@example.com"}}`)
+			})
+
+			It("should default to it", func() {
+				Expect(rr.Code).To(Equal(http.StatusCreated))
+				Expect(pushed.TenantID).To(Equal("payments"))
+				Expect(pushed.CallbackURL).To(Equal("https://payments.example.com/hooks"))
+			})
+		})
+
+		Context("Test callback url of the request, 201", func() {
+			var pushed *notification.Request
+			BeforeEach(func() {
+				identity = &notification.Identity{TenantID: "payments", CallbackURL: "https://payments.example.com/hooks"}
+				mockedInternalManager.EXPECT().PushNotificationInternal(gomock.Any()).DoAndReturn(func(n *notification.Request) error {
+					pushed = n
+					return nil
+				}).Times(1)
+				body = bytes.NewBufferString(`{"uuid": "` + uuid.New().String() + `", "txt": "TXT", "destination": "EMAIL", ` +
+					`"recipient": {"email": "jane@example.com"}, "callback_url": "https://orders.example.com/hooks"}`)
+			})
+
+			It("should override the api key's", func() {
+				Expect(rr.Code).To(Equal(http.StatusCreated))
+				Expect(pushed.CallbackURL).To(Equal("https://orders.example.com/hooks"))
+			})
+		})
+
+		Context("Test rate limited, 429", func() {
+			BeforeEach(func() {
+				mockedInternalManager.EXPECT().PushNotificationInternal(gomock.Any()).Times(0)
+				limitErr = &notification.RateLimitError{Limit: "caller", RetryAfter: 1500 * time.Millisecond}
+				n := &notification.Request{
+					UUID:            uuid.New().String(),
+					NotificationTxt: "TXT",
+					Destination:     "EMAIL",
+					Recipient:       &notification.Recipient{Email: "jane@example.com"},
+				}
+				b, err := json.Marshal(n)
+				if err != nil {
+					panic(err)
+				}
+				body = bytes.NewBuffer(b)
+			})
+
+			It("should return 429 with the seconds to wait", func() {
+				Expect(rr.Code).To(Equal(http.StatusTooManyRequests))
+				Expect(rr.Header().Get("Retry-After")).To(Equal("2"))
+				p := &notification.Problem{}
+				Expect(json.Unmarshal(rr.Body.Bytes(), p)).To(Succeed())
+				Expect(p.Type).To(Equal(notification.ProblemTypeRateLimited))
+			})
+		})
+
 		Context("Test bad path, 400", func() {
 			BeforeEach(func() {
 				mockedInternalManager.EXPECT().PushNotificationInternal(gomock.Any()).Times(0)
@@ -73,13 +153,56 @@ var _ = Describe("Endpoint", func() {
 			})
 		})
 
+		Context("Test unknown field, 400 problem", func() {
+			BeforeEach(func() {
+				mockedInternalManager.EXPECT().PushNotificationInternal(gomock.Any()).Times(0)
+				body = bytes.NewBufferString(`{"uuid": "` + uuid.New().String() + `", "txt": "TXT", "destination": "EMAIL", "colour": "blue"}`)
+			})
+
+			It("should return 400 naming the field", func() {
+				Expect(rr.Code).To(Equal(http.StatusBadRequest))
+				Expect(rr.Header().Get("Content-Type")).To(Equal("application/problem+json"))
+				p := &notification.Problem{}
+				Expect(json.Unmarshal(rr.Body.Bytes(), p)).To(Succeed())
+				Expect(p.InvalidParams).To(ConsistOf(&notification.FieldError{Name: "colour", Reason: "unknown field"}))
+			})
+		})
+
+		Context("Test invalid request, 422 problem", func() {
+			BeforeEach(func() {
+				mockedInternalManager.EXPECT().PushNotificationInternal(gomock.Any()).Times(0)
+				n := &notification.Request{
+					UUID:            "not-a-uuid",
+					NotificationTxt: "TXT",
+					Destination:     "PIGEON",
+				}
+				b, err := json.Marshal(n)
+				if err != nil {
+					panic(err)
+				}
+				body = bytes.NewBuffer(b)
+			})
+
+			It("should return 422 listing every invalid field", func() {
+				Expect(rr.Code).To(Equal(http.StatusUnprocessableEntity))
+				Expect(rr.Header().Get("Content-Type")).To(Equal("application/problem+json"))
+				p := &notification.Problem{}
+				Expect(json.Unmarshal(rr.Body.Bytes(), p)).To(Succeed())
+				Expect(p.Status).To(Equal(http.StatusUnprocessableEntity))
+				Expect(p.Type).To(Equal(notification.ProblemTypeValidation))
+				Expect(p.InvalidParams).To(HaveLen(2))
+			})
+		})
+
 		Context("Test bad path, 500 because push failed", func() {
 			BeforeEach(func() {
 				mockedInternalManager.EXPECT().PushNotificationInternal(gomock.Any()).Return(fmt.Errorf("some-error-occurred")).Times(1)
+				mockedRateLimiter.EXPECT().Refund(gomock.Any(), "default/", map[notification.Destination]int{notification.Email: 1}).Return(nil).Times(1)
 				n := &notification.Request{
 					UUID:            uuid.New().String(),
 					NotificationTxt: "TXT",
 					Destination:     "EMAIL",
+					Recipient:       &notification.Recipient{Email: "jane@example.com"},
 				}
 				b, err := json.Marshal(n)
 				if err != nil {
@@ -95,4 +218,370 @@ var _ = Describe("Endpoint", func() {
 
 	})
 
+	Context("Test batch notifications endpoint", func() {
+		var (
+			endpoint              *notification.Endpoint
+			mockedInternalManager *notificationmocks.MockInternalManager
+			mockedRateLimiter     *notificationmocks.MockRateLimiter
+			limitErr              error
+			ctrl                  *gomock.Controller
+			router                *httprouter.Router
+			body                  io.Reader
+			rr                    *httptest.ResponseRecorder
+			requests              []*notification.Request
+		)
+		BeforeEach(func() {
+			ctrl = gomock.NewController(GinkgoT())
+			mockedInternalManager = notificationmocks.NewMockInternalManager(ctrl)
+			mockedRateLimiter = notificationmocks.NewMockRateLimiter(ctrl)
+			limitErr = nil
+			mockedRateLimiter.EXPECT().Take(gomock.Any(), gomock.Any(), gomock.Any()).
+				DoAndReturn(func(_ context.Context, _ string, _ map[notification.Destination]int) error {
+					return limitErr
+				}).AnyTimes()
+			endpoint = notification.NewEndpoint(mockedInternalManager, mockedRateLimiter)
+
+			router = httprouter.New()
+			router.POST("/notifications", endpoint.CreateNotifications)
+
+			// the tenant isn't part of the body, without authentication it's the default one
+			requests = []*notification.Request{
+				{UUID: uuid.New().String(), NotificationTxt: "TXT", Destination: "EMAIL", TenantID: notification.DefaultTenant},
+				{UUID: uuid.New().String(), NotificationTxt: "TXT", Destination: "SMS", TenantID: notification.DefaultTenant},
+			}
+		})
+
+		JustBeforeEach(func() {
+			req, _ := http.NewRequest("POST", "/notifications", body)
+			rr = httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+		})
+
+		Context("Test JSON array, 207", func() {
+			var pushed []*notification.Request
+			BeforeEach(func() {
+				mockedInternalManager.EXPECT().PushNotificationsInternal(gomock.Any()).DoAndReturn(func(n []*notification.Request) *notification.BatchResponse {
+					pushed = n
+					return &notification.BatchResponse{Accepted: len(n)}
+				}).Times(1)
+				b, err := json.Marshal(requests)
+				if err != nil {
+					panic(err)
+				}
+				body = bytes.NewBuffer(b)
+			})
+
+			It("should return 207 with every item pushed", func() {
+				Expect(rr.Code).To(Equal(http.StatusMultiStatus))
+				Expect(pushed).To(Equal(requests))
+				resp := &notification.BatchResponse{}
+				Expect(json.Unmarshal(rr.Body.Bytes(), resp)).To(Succeed())
+				Expect(resp.Accepted).To(Equal(2))
+			})
+		})
+
+		Context("Test NDJSON stream, 207", func() {
+			var pushed []*notification.Request
+			BeforeEach(func() {
+				mockedInternalManager.EXPECT().PushNotificationsInternal(gomock.Any()).DoAndReturn(func(n []*notification.Request) *notification.BatchResponse {
+					pushed = n
+					return &notification.BatchResponse{Accepted: len(n)}
+				}).Times(1)
+				buf := &bytes.Buffer{}
+				for _, n := range requests {
+					b, err := json.Marshal(n)
+					if err != nil {
+						panic(err)
+					}
+					buf.Write(b)
+					buf.WriteString("\n")
+				}
+				body = buf
+			})
+
+			It("should return 207 with every item pushed", func() {
+				Expect(rr.Code).To(Equal(http.StatusMultiStatus))
+				Expect(pushed).To(Equal(requests))
+			})
+		})
+
+		Context("Test partially queued batch, 207", func() {
+			BeforeEach(func() {
+				requests[0].Recipient = &notification.Recipient{Email: "jane@example.com"}
+				requests[1].Recipient = &notification.Recipient{Phone: "+15551234567"}
+				mockedInternalManager.EXPECT().PushNotificationsInternal(gomock.Any()).DoAndReturn(func(n []*notification.Request) *notification.BatchResponse {
+					return &notification.BatchResponse{Accepted: 1, Rejected: 1, Results: map[string]*notification.BatchItemResult{
+						n[0].UUID: {Status: notification.BatchItemAccepted},
+						n[1].UUID: {Status: notification.BatchItemRejected, Reason: "timed out"},
+					}}
+				}).Times(1)
+				mockedRateLimiter.EXPECT().Refund(gomock.Any(), gomock.Any(), map[notification.Destination]int{notification.SMS: 1}).Return(nil).Times(1)
+				b, err := json.Marshal(requests)
+				if err != nil {
+					panic(err)
+				}
+				body = bytes.NewBuffer(b)
+			})
+
+			It("should give back the tokens of the rejected items", func() {
+				Expect(rr.Code).To(Equal(http.StatusMultiStatus))
+			})
+		})
+
+		Context("Test bad path, 400", func() {
+			BeforeEach(func() {
+				mockedInternalManager.EXPECT().PushNotificationsInternal(gomock.Any()).Times(0)
+				body = bytes.NewBufferString("[{invalid json}]")
+			})
+
+			It("should be return 400", func() {
+				Expect(rr.Code).To(Equal(http.StatusBadRequest))
+			})
+		})
+
+		Context("Test rate limited, 429", func() {
+			BeforeEach(func() {
+				mockedInternalManager.EXPECT().PushNotificationsInternal(gomock.Any()).Times(0)
+				limitErr = &notification.RateLimitError{Limit: "EMAIL", RetryAfter: time.Second}
+				b, err := json.Marshal(requests)
+				if err != nil {
+					panic(err)
+				}
+				body = bytes.NewBuffer(b)
+			})
+
+			It("should reject the whole batch", func() {
+				Expect(rr.Code).To(Equal(http.StatusTooManyRequests))
+				Expect(rr.Header().Get("Retry-After")).To(Equal("1"))
+			})
+		})
+
+		Context("Test bad path, 413 because batch is too large", func() {
+			BeforeEach(func() {
+				mockedInternalManager.EXPECT().PushNotificationsInternal(gomock.Any()).Times(0)
+				buf := &bytes.Buffer{}
+				for i := 0; i <= notification.MaxBatchSize; i++ {
+					buf.WriteString("{}\n")
+				}
+				body = buf
+			})
+
+			It("should be return 413", func() {
+				Expect(rr.Code).To(Equal(http.StatusRequestEntityTooLarge))
+			})
+		})
+
+		Context("Test bad path, 413 because the array is too long", func() {
+			BeforeEach(func() {
+				mockedInternalManager.EXPECT().PushNotificationsInternal(gomock.Any()).Times(0)
+				body = bytes.NewBufferString("[" + strings.Repeat("{},", notification.MaxBatchSize) + "{}]")
+			})
+
+			It("should be return 413", func() {
+				Expect(rr.Code).To(Equal(http.StatusRequestEntityTooLarge))
+			})
+		})
+
+		Context("Test bad path, 413 because the body is too large", func() {
+			BeforeEach(func() {
+				mockedInternalManager.EXPECT().PushNotificationsInternal(gomock.Any()).Times(0)
+				body = bytes.NewBufferString(`[{"txt":"` + strings.Repeat("a", notification.MaxBatchBytes) + `"}]`)
+			})
+
+			It("should be return 413", func() {
+				Expect(rr.Code).To(Equal(http.StatusRequestEntityTooLarge))
+			})
+		})
+	})
+
+	Context("Test notification status endpoints", func() {
+		var (
+			endpoint              *notification.Endpoint
+			mockedInternalManager *notificationmocks.MockInternalManager
+			ctrl                  *gomock.Controller
+			router                *httprouter.Router
+			req                   *http.Request
+			rr                    *httptest.ResponseRecorder
+			notifUUID             uuid.UUID
+		)
+		BeforeEach(func() {
+			ctrl = gomock.NewController(GinkgoT())
+			mockedInternalManager = notificationmocks.NewMockInternalManager(ctrl)
+			endpoint = notification.NewEndpoint(mockedInternalManager, notificationmocks.NewMockRateLimiter(ctrl))
+
+			router = httprouter.New()
+			router.GET("/notification/:uuid", endpoint.GetNotification)
+			router.POST("/notifications/status", endpoint.GetNotificationStatuses)
+			router.DELETE("/notification/:uuid", endpoint.CancelNotification)
+			router.GET("/notifications", endpoint.ListNotifications)
+			notifUUID = uuid.New()
+		})
+
+		JustBeforeEach(func() {
+			rr = httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+		})
+
+		Context("Test happy path, 200", func() {
+			BeforeEach(func() {
+				mockedInternalManager.EXPECT().GetNotificationStatus(gomock.Any(), notification.DefaultTenant, notifUUID).Return(&notification.StatusResponse{
+					UUID:        notifUUID,
+					Destination: notification.SMS.String(),
+					State:       notification.StateDelivered,
+				}, nil).Times(1)
+				req, _ = http.NewRequest("GET", "/notification/"+notifUUID.String(), nil)
+			})
+
+			It("should return 200 with the status", func() {
+				Expect(rr.Code).To(Equal(http.StatusOK))
+				resp := &notification.StatusResponse{}
+				Expect(json.Unmarshal(rr.Body.Bytes(), resp)).To(Succeed())
+				Expect(resp.Destination).To(Equal("SMS"))
+				Expect(resp.State).To(Equal(notification.StateDelivered))
+			})
+		})
+
+		Context("Test not found, 404", func() {
+			BeforeEach(func() {
+				mockedInternalManager.EXPECT().GetNotificationStatus(gomock.Any(), notification.DefaultTenant, notifUUID).Return(nil, notification.ErrNotFound).Times(1)
+				req, _ = http.NewRequest("GET", "/notification/"+notifUUID.String(), nil)
+			})
+
+			It("should return 404", func() {
+				Expect(rr.Code).To(Equal(http.StatusNotFound))
+			})
+		})
+
+		Context("Test lookup of another tenant, 404", func() {
+			BeforeEach(func() {
+				mockedInternalManager.EXPECT().GetNotificationStatus(gomock.Any(), "payments", notifUUID).Return(nil, notification.ErrNotFound).Times(1)
+				req, _ = http.NewRequest("GET", "/notification/"+notifUUID.String(), nil)
+				req = req.WithContext(notification.WithIdentity(req.Context(), &notification.Identity{TenantID: "payments"}))
+			})
+
+			It("should only look up the notifications of the caller's tenant", func() {
+				Expect(rr.Code).To(Equal(http.StatusNotFound))
+			})
+		})
+
+		Context("Test bad uuid, 400", func() {
+			BeforeEach(func() {
+				mockedInternalManager.EXPECT().GetNotificationStatus(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+				req, _ = http.NewRequest("GET", "/notification/not-a-uuid", nil)
+			})
+
+			It("should return 400", func() {
+				Expect(rr.Code).To(Equal(http.StatusBadRequest))
+			})
+		})
+
+		Context("Test cancel before delivery, 200", func() {
+			BeforeEach(func() {
+				mockedInternalManager.EXPECT().CancelNotification(gomock.Any(), notification.DefaultTenant, notifUUID).
+					Return(&notification.CancelResponse{UUID: notifUUID, Cancelled: true, State: notification.StateCancelled}, nil).Times(1)
+				req, _ = http.NewRequest("DELETE", "/notification/"+notifUUID.String(), nil)
+			})
+
+			It("should say the cancellation won", func() {
+				Expect(rr.Code).To(Equal(http.StatusOK))
+				resp := &notification.CancelResponse{}
+				Expect(json.Unmarshal(rr.Body.Bytes(), resp)).To(Succeed())
+				Expect(resp.Cancelled).To(BeTrue())
+				Expect(resp.State).To(Equal(notification.StateCancelled))
+			})
+		})
+
+		Context("Test cancel after delivery, 200", func() {
+			BeforeEach(func() {
+				mockedInternalManager.EXPECT().CancelNotification(gomock.Any(), notification.DefaultTenant, notifUUID).
+					Return(&notification.CancelResponse{UUID: notifUUID, State: notification.StateDelivered}, nil).Times(1)
+				req, _ = http.NewRequest("DELETE", "/notification/"+notifUUID.String(), nil)
+			})
+
+			It("should say it was already delivered", func() {
+				Expect(rr.Code).To(Equal(http.StatusOK))
+				resp := &notification.CancelResponse{}
+				Expect(json.Unmarshal(rr.Body.Bytes(), resp)).To(Succeed())
+				Expect(resp.Cancelled).To(BeFalse())
+				Expect(resp.State).To(Equal(notification.StateDelivered))
+			})
+		})
+
+		Context("Test cancel with a bad uuid, 400", func() {
+			BeforeEach(func() {
+				mockedInternalManager.EXPECT().CancelNotification(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+				req, _ = http.NewRequest("DELETE", "/notification/not-a-uuid", nil)
+			})
+
+			It("should return 400", func() {
+				Expect(rr.Code).To(Equal(http.StatusBadRequest))
+			})
+		})
+
+		Context("Test bulk lookup, 200", func() {
+			BeforeEach(func() {
+				mockedInternalManager.EXPECT().GetNotificationStatuses(gomock.Any(), notification.DefaultTenant, []uuid.UUID{notifUUID}).Return(&notification.BulkStatusResponse{
+					Notifications: []*notification.StatusResponse{{UUID: notifUUID, State: notification.StateDelivered}},
+					NotFound:      []string{},
+				}, nil).Times(1)
+				b, err := json.Marshal(&notification.BulkStatusRequest{UUIDs: []string{notifUUID.String(), notifUUID.String()}})
+				if err != nil {
+					panic(err)
+				}
+				req, _ = http.NewRequest("POST", "/notifications/status", bytes.NewBuffer(b))
+			})
+
+			It("should return 200 with deduplicated lookups", func() {
+				Expect(rr.Code).To(Equal(http.StatusOK))
+				resp := &notification.BulkStatusResponse{}
+				Expect(json.Unmarshal(rr.Body.Bytes(), resp)).To(Succeed())
+				Expect(resp.Notifications).To(HaveLen(1))
+			})
+		})
+
+		Context("Test list with filters, 200", func() {
+			var cursor *notification.ListCursor
+
+			BeforeEach(func() {
+				cursor = &notification.ListCursor{ServerTimestamp: time.Date(2022, 5, 1, 10, 0, 0, 0, time.UTC), UUID: uuid.New()}
+				from := time.Date(2022, 5, 1, 9, 0, 0, 0, time.UTC)
+				mockedInternalManager.EXPECT().ListNotifications(gomock.Any(), &notification.ListFilter{
+					TenantID:     notification.DefaultTenant,
+					Destinations: []notification.Destination{notification.Slack},
+					States:       []notification.State{notification.StateFailed, notification.StateSuppressed},
+					From:         &from,
+					After:        cursor,
+					Limit:        2,
+				}).Return(&notification.ListResponse{
+					Notifications: []*notification.StatusResponse{{UUID: notifUUID, State: notification.StateFailed}},
+					NextCursor:    "next",
+				}, nil).Times(1)
+				req, _ = http.NewRequest("GET", "/notifications?destination=SLACK&state=failed&state=SUPPRESSED"+
+					"&from=2022-05-01T09:00:00Z&limit=2&cursor="+cursor.String(), nil)
+			})
+
+			It("should return 200 with the page and the next cursor", func() {
+				Expect(rr.Code).To(Equal(http.StatusOK))
+				resp := &notification.ListResponse{}
+				Expect(json.Unmarshal(rr.Body.Bytes(), resp)).To(Succeed())
+				Expect(resp.Notifications).To(HaveLen(1))
+				Expect(resp.NextCursor).To(Equal("next"))
+			})
+		})
+
+		Context("Test list with invalid filters, 422", func() {
+			BeforeEach(func() {
+				mockedInternalManager.EXPECT().ListNotifications(gomock.Any(), gomock.Any()).Times(0)
+				req, _ = http.NewRequest("GET", "/notifications?destination=FAX&state=lost&from=yesterday"+
+					"&limit=5000&cursor=nope", nil)
+			})
+
+			It("should return 422 listing every invalid filter", func() {
+				Expect(rr.Code).To(Equal(http.StatusUnprocessableEntity))
+				Expect(rr.Body.String()).To(And(ContainSubstring(`"destination"`), ContainSubstring(`"state"`),
+					ContainSubstring(`"from"`), ContainSubstring(`"limit"`), ContainSubstring(`"cursor"`)))
+			})
+		})
+	})
+
 })
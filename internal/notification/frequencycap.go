@@ -0,0 +1,123 @@
+package notification
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v4"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FrequencyCap allows at most Max notifications of a destination to the same recipient per Window
+type FrequencyCap struct {
+	Dest   Destination
+	Max    int
+	Window time.Duration
+	rule   string
+}
+
+// ParseFrequencyCaps parses rules like SMS:5/1h, at most 5 SMS per recipient per hour, or EMAIL:20/24h
+func ParseFrequencyCaps(rules []string) ([]*FrequencyCap, error) {
+	caps := make([]*FrequencyCap, 0, len(rules))
+	for _, rule := range rules {
+		dest, limit, ok := strings.Cut(rule, ":")
+		if !ok {
+			return nil, fmt.Errorf("frequency cap %q must look like DESTINATION:MAX/WINDOW", rule)
+		}
+		d, err := toServerNotificationDestination(dest)
+		if err != nil {
+			return nil, fmt.Errorf("frequency cap %q: %w", rule, err)
+		}
+		max, window, ok := strings.Cut(limit, "/")
+		if !ok {
+			return nil, fmt.Errorf("frequency cap %q must look like DESTINATION:MAX/WINDOW", rule)
+		}
+		m, err := strconv.Atoi(max)
+		if err != nil || m < 1 {
+			return nil, fmt.Errorf("frequency cap %q: max must be a positive integer", rule)
+		}
+		w, err := time.ParseDuration(window)
+		if err != nil || w <= 0 {
+			return nil, fmt.Errorf("frequency cap %q: window must be a positive duration", rule)
+		}
+		caps = append(caps, &FrequencyCap{Dest: d, Max: m, Window: w, rule: d.String() + ":" + limit})
+	}
+	return caps, nil
+}
+
+func (fc *FrequencyCap) String() string {
+	if fc.rule != "" {
+		return fc.rule
+	}
+	return fmt.Sprintf("%s:%d/%s", fc.Dest, fc.Max, fc.Window)
+}
+
+// FrequencyCapper suppresses notifications to recipients over a cap of their destination
+type FrequencyCapper struct {
+	persistence *CRDBPersistence
+	caps        map[Destination][]*FrequencyCap
+	exempt      map[Priority]struct{}
+}
+
+func NewFrequencyCapper(persistence *CRDBPersistence, caps []*FrequencyCap, exempt []Priority) *FrequencyCapper {
+	fc := &FrequencyCapper{
+		persistence: persistence,
+		caps:        make(map[Destination][]*FrequencyCap, len(caps)),
+		exempt:      make(map[Priority]struct{}, len(exempt)),
+	}
+	for _, c := range caps {
+		fc.caps[c.Dest] = append(fc.caps[c.Dest], c)
+	}
+	for _, p := range exempt {
+		fc.exempt[p] = struct{}{}
+	}
+	return fc
+}
+
+// ParseExemptPriorities parses the priorities frequency caps don't apply to
+func ParseExemptPriorities(priorities []string) ([]Priority, error) {
+	exempt := make([]Priority, 0, len(priorities))
+	for _, p := range priorities {
+		priority, err := toServerPriority(p)
+		if err != nil || p == "" {
+			return nil, fmt.Errorf("exempt priority %q: %w", p, ErrNoSuchPriority)
+		}
+		exempt = append(exempt, priority)
+	}
+	return exempt, nil
+}
+
+// overCap returns why the notification must be suppressed, "" when it can be delivered.
+// It counts in the dispatching transaction, so concurrent dispatches to a recipient conflict
+func (fc *FrequencyCapper) overCap(ctx context.Context, n *Notification, tx pgx.Tx) (string, error) {
+	caps := fc.caps[n.Dest]
+	if len(caps) == 0 || n.Recipient == nil {
+		return "", nil
+	}
+	if _, ok := fc.exempt[n.Priority]; ok {
+		return "", nil
+	}
+	now, err := fc.persistence.Now(ctx, tx)
+	if err != nil {
+		return "", err
+	}
+	for _, c := range caps {
+		dispatched, err := fc.persistence.CountDispatched(ctx, n, now.Add(-c.Window), tx)
+		if err != nil {
+			return "", err
+		}
+		if dispatched >= int64(c.Max) {
+			return fmt.Sprintf("frequency cap %s reached", c), nil
+		}
+	}
+	return "", nil
+}
+
+// recipientKey identifies a recipient whatever display name or casing it was sent with
+func recipientKey(r *Recipient) string {
+	if r == nil {
+		return ""
+	}
+	return strings.ToLower(r.Address())
+}
@@ -0,0 +1,44 @@
+package notification_test
+
+import (
+	"github.com/despondency/notifications-service/internal/notification"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"time"
+)
+
+var _ = Describe("Frequency caps", func() {
+
+	Context("Valid rules", func() {
+		It("should parse every rule", func() {
+			caps, err := notification.ParseFrequencyCaps([]string{"sms:5/1h", "EMAIL:20/24h"})
+			Expect(err).To(BeNil())
+			Expect(caps).To(HaveLen(2))
+			Expect(caps[0].Dest).To(Equal(notification.SMS))
+			Expect(caps[0].Max).To(Equal(5))
+			Expect(caps[0].Window).To(Equal(time.Hour))
+			Expect(caps[0].String()).To(Equal("SMS:5/1h"))
+			Expect(caps[1].Dest).To(Equal(notification.Email))
+			Expect(caps[1].Window).To(Equal(24 * time.Hour))
+		})
+	})
+
+	Context("Invalid rules", func() {
+		It("should reject them", func() {
+			for _, rule := range []string{"SMS", "FAX:5/1h", "SMS:5", "SMS:0/1h", "SMS:5/forever", "SMS:5/-1h"} {
+				_, err := notification.ParseFrequencyCaps([]string{rule})
+				Expect(err).To(Not(BeNil()), rule)
+			}
+		})
+	})
+
+	Context("Exempt priorities", func() {
+		It("should parse known priorities only", func() {
+			exempt, err := notification.ParseExemptPriorities([]string{"critical", "high"})
+			Expect(err).To(BeNil())
+			Expect(exempt).To(Equal([]notification.Priority{notification.PriorityCritical, notification.PriorityHigh}))
+			_, err = notification.ParseExemptPriorities([]string{"urgent"})
+			Expect(err).To(MatchError(notification.ErrNoSuchPriority))
+		})
+	})
+})
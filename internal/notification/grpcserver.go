@@ -0,0 +1,250 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"github.com/despondency/notifications-service/internal/notificationpb"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"io"
+	"strings"
+	"time"
+)
+
+// GRPCServer serves the gRPC API with the same InternalManager as the HTTP Endpoint
+type GRPCServer struct {
+	notificationpb.UnimplementedNotificationServiceServer
+	svc     InternalManager
+	limiter RateLimiter
+}
+
+func NewGRPCServer(svc InternalManager, limiter RateLimiter) *GRPCServer {
+	return &GRPCServer{
+		svc:     svc,
+		limiter: limiter,
+	}
+}
+
+func (gs *GRPCServer) Send(ctx context.Context, req *notificationpb.SendRequest) (*notificationpb.SendResponse, error) {
+	n := fromProtoRequest(req)
+	n.withIdentity(IdentityFromContext(ctx))
+	caller := grpcCallerID(ctx)
+	err := n.Validate()
+	if err == nil {
+		err = gs.limiter.Take(ctx, caller, destinationCounts(n))
+		if err == nil {
+			err = gs.svc.PushNotificationInternal(n)
+			if err != nil {
+				refund(ctx, gs.limiter, caller, n)
+			}
+		}
+	}
+	var (
+		ve  *ValidationError
+		rle *RateLimitError
+	)
+	if errors.As(err, &ve) {
+		return nil, validationStatus(ve)
+	}
+	if errors.As(err, &rle) {
+		return nil, rateLimitedStatus(rle)
+	}
+	if err != nil {
+		log.Err(err).Msg("internal error")
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+	return &notificationpb.SendResponse{}, nil
+}
+
+func (gs *GRPCServer) SendStream(stream notificationpb.NotificationService_SendStreamServer) error {
+	identity := IdentityFromContext(stream.Context())
+	requests := make([]*Request, 0)
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if len(requests) == MaxBatchSize {
+			return status.Error(codes.InvalidArgument, ErrBatchTooLarge.Error())
+		}
+		n := fromProtoRequest(req)
+		n.withIdentity(identity)
+		requests = append(requests, n)
+	}
+	caller := grpcCallerID(stream.Context())
+	err := gs.limiter.Take(stream.Context(), caller, destinationCounts(requests...))
+	var rle *RateLimitError
+	if errors.As(err, &rle) {
+		return rateLimitedStatus(rle)
+	}
+	if err != nil {
+		log.Err(err).Msg("internal error")
+		return status.Error(codes.Internal, "internal error")
+	}
+	resp := gs.svc.PushNotificationsInternal(requests)
+	refund(stream.Context(), gs.limiter, caller, rejectedRequests(requests, resp)...)
+	results := make(map[string]*notificationpb.BatchItemResult, len(resp.Results))
+	for k, r := range resp.Results {
+		results[k] = &notificationpb.BatchItemResult{Status: string(r.Status), Reason: r.Reason}
+	}
+	return stream.SendAndClose(&notificationpb.SendStreamResponse{
+		Accepted: int32(resp.Accepted),
+		Rejected: int32(resp.Rejected),
+		Results:  results,
+	})
+}
+
+func (gs *GRPCServer) GetStatus(ctx context.Context, req *notificationpb.GetStatusRequest) (*notificationpb.Notification, error) {
+	notifUUID, err := uuid.Parse(req.GetUuid())
+	if err != nil {
+		return nil, validationStatus(&ValidationError{Fields: []*FieldError{{Name: "uuid", Reason: "must be a valid uuid"}}})
+	}
+	resp, err := gs.svc.GetNotificationStatus(ctx, IdentityFromContext(ctx).TenantID, notifUUID)
+	if err == ErrNotFound {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	if err != nil {
+		log.Err(err).Msg("internal error")
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+	return toProtoNotification(resp), nil
+}
+
+// validationStatus lists every invalid field as a BadRequest field violation
+func validationStatus(ve *ValidationError) error {
+	st := status.New(codes.InvalidArgument, "request validation failed")
+	br := &errdetails.BadRequest{}
+	for _, f := range ve.Fields {
+		br.FieldViolations = append(br.FieldViolations, &errdetails.BadRequest_FieldViolation{Field: f.Name, Description: f.Reason})
+	}
+	detailed, err := st.WithDetails(br)
+	if err != nil {
+		return st.Err()
+	}
+	return detailed.Err()
+}
+
+// rateLimitedStatus tells the client when to retry with a RetryInfo
+func rateLimitedStatus(rle *RateLimitError) error {
+	st := status.New(codes.ResourceExhausted, rle.Error())
+	detailed, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(rle.RetryAfter)})
+	if err != nil {
+		return st.Err()
+	}
+	return detailed.Err()
+}
+
+func grpcCallerID(ctx context.Context) string {
+	remoteAddr := ""
+	if p, ok := peer.FromContext(ctx); ok {
+		remoteAddr = p.Addr.String()
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	return callerKey(IdentityFromContext(ctx), firstValue(md, strings.ToLower(ClientIDHeader)), remoteAddr)
+}
+
+func fromProtoRequest(req *notificationpb.SendRequest) *Request {
+	n := &Request{
+		UUID:            req.GetUuid(),
+		NotificationTxt: req.GetTxt(),
+		Destination:     req.GetDestination(),
+		Recipient:       fromProtoRecipient(req.GetRecipient()),
+		TemplateID:      req.GetTemplateId(),
+		TemplateVersion: req.GetTemplateVersion(),
+		Priority:        req.GetPriority(),
+		CallbackURL:     req.GetCallbackUrl(),
+	}
+	if req.GetSendAt() != nil {
+		sendAt := req.GetSendAt().AsTime()
+		n.SendAt = &sendAt
+	}
+	if req.GetParams() != nil {
+		n.Params = req.GetParams().AsMap()
+	}
+	// proto3 can't tell an empty list from an absent one, no destinations is a single destination request
+	if len(req.GetDestinations()) > 0 {
+		n.Destinations = make([]*DestinationRequest, len(req.GetDestinations()))
+		for i, d := range req.GetDestinations() {
+			n.Destinations[i] = &DestinationRequest{
+				Destination: d.GetDestination(),
+				Recipient:   fromProtoRecipient(d.GetRecipient()),
+			}
+		}
+	}
+	return n
+}
+
+func fromProtoRecipient(r *notificationpb.Recipient) *Recipient {
+	if r == nil {
+		return nil
+	}
+	return &Recipient{
+		Phone:        r.GetPhone(),
+		Email:        r.GetEmail(),
+		Name:         r.GetName(),
+		SlackChannel: r.GetSlackChannel(),
+		SlackUser:    r.GetSlackUser(),
+	}
+}
+
+func toProtoNotification(resp *StatusResponse) *notificationpb.Notification {
+	n := &notificationpb.Notification{
+		Uuid:             resp.UUID.String(),
+		Txt:              resp.NotificationTxt,
+		Destination:      resp.Destination,
+		ServerTimestamp:  timestamppb.New(resp.ServerTimestamp),
+		LastUpdated:      timestamppb.New(resp.LastUpdated),
+		State:            string(resp.State),
+		ConflictCount:    resp.ConflictCount,
+		LastConflictAt:   toProtoTimestamp(resp.LastConflictAt),
+		SendAt:           toProtoTimestamp(resp.SendAt),
+		TemplateId:       resp.TemplateID,
+		TemplateVersion:  resp.TemplateVersion,
+		Priority:         string(resp.Priority),
+		TenantId:         resp.TenantID,
+		DeliveredAt:      toProtoTimestamp(resp.DeliveredAt),
+		SuppressedReason: resp.SuppressedReason,
+		FailureReason:    resp.FailureReason,
+		RetryReason:      resp.RetryReason,
+		Provider:         resp.Provider,
+	}
+	if len(resp.Transitions) > 0 {
+		n.Transitions = make(map[string]*timestamppb.Timestamp, len(resp.Transitions))
+		for s, at := range resp.Transitions {
+			n.Transitions[string(s)] = timestamppb.New(at)
+		}
+	}
+	if resp.Recipient != nil {
+		n.Recipient = &notificationpb.Recipient{
+			Phone:        resp.Recipient.Phone,
+			Email:        resp.Recipient.Email,
+			Name:         resp.Recipient.Name,
+			SlackChannel: resp.Recipient.SlackChannel,
+			SlackUser:    resp.Recipient.SlackUser,
+		}
+	}
+	if resp.ParentUUID != nil {
+		n.ParentUuid = resp.ParentUUID.String()
+	}
+	for _, c := range resp.Children {
+		n.Children = append(n.Children, toProtoNotification(c))
+	}
+	return n
+}
+
+func toProtoTimestamp(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
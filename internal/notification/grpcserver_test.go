@@ -0,0 +1,207 @@
+package notification_test
+
+import (
+	"context"
+	"github.com/despondency/notifications-service/internal/notification"
+	"github.com/despondency/notifications-service/internal/notification/notificationmocks"
+	"github.com/despondency/notifications-service/internal/notificationpb"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/structpb"
+	"net"
+	"time"
+)
+
+var _ = Describe("GRPC server", func() {
+
+	var (
+		mockedInternalManager *notificationmocks.MockInternalManager
+		mockedRateLimiter     *notificationmocks.MockRateLimiter
+		limitErr              error
+		ctrl                  *gomock.Controller
+		srv                   *grpc.Server
+		conn                  *grpc.ClientConn
+		client                notificationpb.NotificationServiceClient
+	)
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		mockedInternalManager = notificationmocks.NewMockInternalManager(ctrl)
+		mockedRateLimiter = notificationmocks.NewMockRateLimiter(ctrl)
+		limitErr = nil
+		mockedRateLimiter.EXPECT().Take(gomock.Any(), gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, _ string, _ map[notification.Destination]int) error {
+				return limitErr
+			}).AnyTimes()
+
+		listener := bufconn.Listen(1024 * 1024)
+		srv = grpc.NewServer()
+		notificationpb.RegisterNotificationServiceServer(srv, notification.NewGRPCServer(mockedInternalManager, mockedRateLimiter))
+		go func() {
+			_ = srv.Serve(listener)
+		}()
+		var err error
+		conn, err = grpc.Dial("bufnet",
+			grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+				return listener.DialContext(ctx)
+			}),
+			grpc.WithTransportCredentials(insecure.NewCredentials()))
+		Expect(err).To(BeNil())
+		client = notificationpb.NewNotificationServiceClient(conn)
+	})
+
+	AfterEach(func() {
+		_ = conn.Close()
+		srv.Stop()
+	})
+
+	Context("Send a templated request", func() {
+		var err error
+
+		BeforeEach(func() {
+			mockedInternalManager.EXPECT().PushNotificationInternal(gomock.Any()).
+				DoAndReturn(func(n *notification.Request) error {
+					Expect(n.TemplateID).To(Equal("welcome"))
+					Expect(n.Params).To(Equal(map[string]interface{}{"name": "Jane"}))
+					Expect(n.Recipient).To(Equal(&notification.Recipient{Email: "jane@example.com"}))
+					return nil
+				}).Times(1)
+			params, _ := structpb.NewStruct(map[string]interface{}{"name": "Jane"})
+			_, err = client.Send(context.Background(), &notificationpb.SendRequest{
+				Uuid:        uuid.New().String(),
+				Destination: "EMAIL",
+				Recipient:   &notificationpb.Recipient{Email: "jane@example.com"},
+				TemplateId:  "welcome",
+				Params:      params,
+			})
+		})
+
+		It("should push it", func() {
+			Expect(err).To(BeNil())
+		})
+	})
+
+	Context("Send an invalid request", func() {
+		var err error
+
+		BeforeEach(func() {
+			mockedInternalManager.EXPECT().PushNotificationInternal(gomock.Any()).Times(0)
+			_, err = client.Send(context.Background(), &notificationpb.SendRequest{Txt: "TXT", Destination: "PIGEON"})
+		})
+
+		It("should list every invalid field", func() {
+			st := status.Convert(err)
+			Expect(st.Code()).To(Equal(codes.InvalidArgument))
+			Expect(st.Details()).To(HaveLen(1))
+			br := st.Details()[0].(*errdetails.BadRequest)
+			Expect(br.FieldViolations).To(HaveLen(2))
+			Expect(br.FieldViolations[0].Field).To(Equal("uuid"))
+			Expect(br.FieldViolations[1].Field).To(Equal("destination"))
+		})
+	})
+
+	Context("Stream a batch", func() {
+		var (
+			resp *notificationpb.SendStreamResponse
+			err  error
+		)
+
+		BeforeEach(func() {
+			mockedInternalManager.EXPECT().PushNotificationsInternal(gomock.Len(2)).
+				Return(&notification.BatchResponse{
+					Accepted: 1,
+					Rejected: 1,
+					Results: map[string]*notification.BatchItemResult{
+						"first":  {Status: notification.BatchItemAccepted},
+						"item-1": {Status: notification.BatchItemRejected, Reason: "uuid: is required"},
+					},
+				}).Times(1)
+			stream, errStream := client.SendStream(context.Background())
+			Expect(errStream).To(BeNil())
+			Expect(stream.Send(&notificationpb.SendRequest{Uuid: "first", Txt: "TXT"})).To(Succeed())
+			Expect(stream.Send(&notificationpb.SendRequest{Txt: "TXT"})).To(Succeed())
+			resp, err = stream.CloseAndRecv()
+		})
+
+		It("should push every request as one batch", func() {
+			Expect(err).To(BeNil())
+			Expect(resp.Accepted).To(Equal(int32(1)))
+			Expect(resp.Rejected).To(Equal(int32(1)))
+			Expect(resp.Results["item-1"].Reason).To(Equal("uuid: is required"))
+		})
+	})
+
+	Context("Send over the rate limit", func() {
+		var err error
+
+		BeforeEach(func() {
+			mockedInternalManager.EXPECT().PushNotificationInternal(gomock.Any()).Times(0)
+			limitErr = &notification.RateLimitError{Limit: "caller", RetryAfter: 2 * time.Second}
+			_, err = client.Send(context.Background(), &notificationpb.SendRequest{
+				Uuid:        uuid.New().String(),
+				Txt:         "TXT",
+				Destination: "SMS",
+				Recipient:   &notificationpb.Recipient{Phone: "+14155550100"},
+			})
+		})
+
+		It("should be resource exhausted with when to retry", func() {
+			st, _ := status.FromError(err)
+			Expect(st.Code()).To(Equal(codes.ResourceExhausted))
+			Expect(st.Details()).To(HaveLen(1))
+			Expect(st.Details()[0].(*errdetails.RetryInfo).RetryDelay.AsDuration()).To(Equal(2 * time.Second))
+		})
+	})
+
+	Context("Get the status of an unknown notification", func() {
+		var err error
+
+		BeforeEach(func() {
+			mockedInternalManager.EXPECT().GetNotificationStatus(gomock.Any(), notification.DefaultTenant, gomock.Any()).
+				Return(nil, notification.ErrNotFound).Times(1)
+			_, err = client.GetStatus(context.Background(), &notificationpb.GetStatusRequest{Uuid: uuid.New().String()})
+		})
+
+		It("should be not found", func() {
+			Expect(status.Code(err)).To(Equal(codes.NotFound))
+		})
+	})
+
+	Context("Get the status of a fan-out", func() {
+		var (
+			resp   *notificationpb.Notification
+			parent uuid.UUID
+			err    error
+		)
+
+		BeforeEach(func() {
+			parent = uuid.New()
+			mockedInternalManager.EXPECT().GetNotificationStatus(gomock.Any(), notification.DefaultTenant, parent).
+				Return(&notification.StatusResponse{
+					UUID:        parent,
+					Destination: "EMAIL,SLACK",
+					State:       notification.StateDelivered,
+					Children: []*notification.StatusResponse{
+						{UUID: uuid.New(), Destination: "EMAIL", ParentUUID: &parent, State: notification.StateDelivered},
+						{UUID: uuid.New(), Destination: "SLACK", ParentUUID: &parent, State: notification.StateDelivered},
+					},
+				}, nil).Times(1)
+			resp, err = client.GetStatus(context.Background(), &notificationpb.GetStatusRequest{Uuid: parent.String()})
+		})
+
+		It("should return the children", func() {
+			Expect(err).To(BeNil())
+			Expect(resp.Uuid).To(Equal(parent.String()))
+			Expect(resp.Children).To(HaveLen(2))
+			Expect(resp.Children[1].ParentUuid).To(Equal(parent.String()))
+		})
+	})
+})
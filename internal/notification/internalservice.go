@@ -1,51 +1,443 @@
 package notification
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/cockroachdb/cockroach-go/v2/crdb/crdbpgx"
 	"github.com/confluentinc/confluent-kafka-go/kafka"
 	"github.com/despondency/notifications-service/internal/messaging"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
 	"github.com/rs/zerolog/log"
 	"go.uber.org/atomic"
+	"strconv"
 	"time"
 )
 
 type InternalService struct {
-	consumer                         *kafka.Consumer
-	outstandingNotificationsProducer *messaging.KafkaProducer
-	persistence                      *CRDBPersistence
-	stopped                          *atomic.Bool
+	consumer                          *kafka.Consumer
+	outstandingNotificationsProducers map[Priority]*messaging.KafkaProducer
+	persistence                       *CRDBPersistence
+	stopped                           *atomic.Bool
+	// followerReads lists notifications from a slightly stale snapshot that doesn't contend with inserts
+	followerReads bool
 }
 
-func NewInternalService(outstandingNotificationsProducer *messaging.KafkaProducer,
-	persistence *CRDBPersistence) (*InternalService, error) {
+// NewInternalService needs a producer per priority lane
+func NewInternalService(outstandingNotificationsProducers map[Priority]*messaging.KafkaProducer,
+	persistence *CRDBPersistence, followerReads bool) (*InternalService, error) {
+	for _, p := range Priorities {
+		if _, ok := outstandingNotificationsProducers[p]; !ok {
+			return nil, fmt.Errorf("no outstanding producer for the %s lane", p)
+		}
+	}
 	is := &InternalService{
-		persistence:                      persistence,
-		outstandingNotificationsProducer: outstandingNotificationsProducer,
-		stopped:                          atomic.NewBool(false),
+		persistence:                       persistence,
+		outstandingNotificationsProducers: outstandingNotificationsProducers,
+		stopped:                           atomic.NewBool(false),
+		followerReads:                     followerReads,
 	}
 	return is, nil
 }
 
 func (s *InternalService) PushNotificationInternal(n *Request) error {
-	dest, err := toServerNotificationDestination(n.Destination)
+	serverNotifications, err := toServerNotifications(n)
+	if err == nil {
+		err = s.pinTemplates(context.Background(), serverNotifications, map[templateKey]*Template{})
+	}
 	if err != nil {
-		log.Err(err).Msg(fmt.Sprintf("destination conversion to server notification destination failed, original destination is %s", n.Destination))
+		log.Err(err).Msg(fmt.Sprintf("invalid notification request %s", n.UUID))
+		return err
 	}
-	nUUID, err := uuid.Parse(n.UUID)
+	payloads, err := marshalNotifications(serverNotifications)
 	if err != nil {
 		return err
 	}
-	serverNotification := &Notification{
-		UUID:                    nUUID,
-		ServerReceivedTimestamp: time.Now().UTC(),
-		NotificationTxt:         n.NotificationTxt,
-		Dest:                    dest,
+	producer := s.outstandingNotificationsProducers[serverNotifications[0].Priority]
+	if len(payloads) == 1 {
+		return producer.Produce(payloads[0])
+	}
+	// children have deterministic uuids, so the client can safely retry a partially produced fan-out
+	for _, err = range producer.ProduceBatch(payloads) {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *InternalService) PushNotificationsInternal(requests []*Request) *BatchResponse {
+	resp := &BatchResponse{
+		Results: make(map[string]*BatchItemResult, len(requests)),
+	}
+	keys := make(map[Priority][]string, len(Priorities))
+	payloads := make(map[Priority][][]byte, len(Priorities))
+	templates := make(map[templateKey]*Template)
+	for i, n := range requests {
+		key := batchItemKey(i, n)
+		if _, seen := resp.Results[key]; seen {
+			// the first occurrence of a uuid in a batch wins, the rest would be deduped anyway
+			continue
+		}
+		serverNotifications, err := toServerNotifications(n)
+		if err == nil {
+			err = s.pinTemplates(context.Background(), serverNotifications, templates)
+		}
+		if err != nil {
+			resp.Results[key] = &BatchItemResult{Status: BatchItemRejected, Reason: err.Error()}
+			continue
+		}
+		b, err := marshalNotifications(serverNotifications)
+		if err != nil {
+			resp.Results[key] = &BatchItemResult{Status: BatchItemRejected, Reason: err.Error()}
+			continue
+		}
+		resp.Results[key] = &BatchItemResult{Status: BatchItemAccepted}
+		p := serverNotifications[0].Priority
+		for range b {
+			keys[p] = append(keys[p], key)
+		}
+		payloads[p] = append(payloads[p], b...)
+	}
+	for p, lanePayloads := range payloads {
+		errs := s.outstandingNotificationsProducers[p].ProduceBatch(lanePayloads)
+		for i, err := range errs {
+			if err != nil {
+				resp.Results[keys[p][i]] = &BatchItemResult{Status: BatchItemRejected, Reason: err.Error()}
+			}
+		}
 	}
-	b, err := json.Marshal(serverNotification)
+	for _, r := range resp.Results {
+		if r.Status == BatchItemAccepted {
+			resp.Accepted++
+		} else {
+			resp.Rejected++
+		}
+	}
+	return resp
+}
+
+func (s *InternalService) GetNotificationStatus(ctx context.Context, tenantID string, notifUUID uuid.UUID) (*StatusResponse, error) {
+	var (
+		stored   *Notification
+		children []*Notification
+	)
+	err := crdbpgx.ExecuteTx(ctx, s.persistence.GetPool(), pgx.TxOptions{AccessMode: pgx.ReadOnly}, func(tx pgx.Tx) error {
+		var errGet error
+		stored, errGet = s.persistence.Get(ctx, tenantID, notifUUID, tx)
+		if errGet != pgx.ErrNoRows {
+			return errGet
+		}
+		// the parent of a fan-out has no row of its own, only its children do
+		children, errGet = s.persistence.GetByParents(ctx, tenantID, []uuid.UUID{notifUUID}, tx)
+		return errGet
+	})
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if stored != nil {
+		return toStatusResponse(stored), nil
+	}
+	if len(children) == 0 {
+		return nil, ErrNotFound
+	}
+	return toParentStatusResponse(notifUUID, children), nil
+}
+
+func (s *InternalService) GetNotificationStatuses(ctx context.Context, tenantID string, notifUUIDs []uuid.UUID) (*BulkStatusResponse, error) {
+	var (
+		stored   []*Notification
+		children []*Notification
+	)
+	err := crdbpgx.ExecuteTx(ctx, s.persistence.GetPool(), pgx.TxOptions{AccessMode: pgx.ReadOnly}, func(tx pgx.Tx) error {
+		var errGet error
+		stored, errGet = s.persistence.GetMany(ctx, tenantID, notifUUIDs, tx)
+		if errGet != nil {
+			return errGet
+		}
+		found := make(map[uuid.UUID]struct{}, len(stored))
+		for _, n := range stored {
+			found[n.UUID] = struct{}{}
+		}
+		missing := make([]uuid.UUID, 0)
+		for _, id := range notifUUIDs {
+			if _, ok := found[id]; !ok {
+				missing = append(missing, id)
+			}
+		}
+		children = nil
+		if len(missing) > 0 {
+			children, errGet = s.persistence.GetByParents(ctx, tenantID, missing, tx)
+		}
+		return errGet
+	})
+	if err != nil {
+		return nil, err
+	}
+	resp := &BulkStatusResponse{
+		Notifications: make([]*StatusResponse, 0, len(notifUUIDs)),
+		NotFound:      make([]string, 0),
+	}
+	found := make(map[uuid.UUID]struct{}, len(stored))
+	for _, n := range stored {
+		found[n.UUID] = struct{}{}
+		resp.Notifications = append(resp.Notifications, toStatusResponse(n))
+	}
+	childrenByParent := make(map[uuid.UUID][]*Notification)
+	for _, n := range children {
+		childrenByParent[*n.ParentUUID] = append(childrenByParent[*n.ParentUUID], n)
+	}
+	for _, id := range notifUUIDs {
+		if _, ok := found[id]; ok {
+			continue
+		}
+		if c, ok := childrenByParent[id]; ok {
+			resp.Notifications = append(resp.Notifications, toParentStatusResponse(id, c))
+			continue
+		}
+		resp.NotFound = append(resp.NotFound, id.String())
+	}
+	return resp, nil
+}
+
+func (s *InternalService) ListNotifications(ctx context.Context, filter *ListFilter) (*ListResponse, error) {
+	// one more than the page tells if there is a next one
+	page := *filter
+	page.Limit++
+	var (
+		stored []*Notification
+		err    error
+	)
+	if s.followerReads {
+		stored, err = s.listStale(ctx, &page)
+	} else {
+		err = crdbpgx.ExecuteTx(ctx, s.persistence.GetPool(), pgx.TxOptions{AccessMode: pgx.ReadOnly}, func(tx pgx.Tx) error {
+			var errList error
+			stored, errList = s.persistence.ListNotifications(ctx, &page, tx)
+			return errList
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+	resp := &ListResponse{Notifications: make([]*StatusResponse, 0, len(stored))}
+	if len(stored) > filter.Limit {
+		stored = stored[:filter.Limit]
+		last := stored[len(stored)-1]
+		resp.NextCursor = (&ListCursor{ServerTimestamp: last.ServerReceivedTimestamp, UUID: last.UUID}).String()
+	}
+	for _, n := range stored {
+		resp.Notifications = append(resp.Notifications, toStatusResponse(n))
+	}
+	return resp, nil
+}
+
+// listStale runs outside ExecuteTx, the follower read must be the first statement of its transaction
+func (s *InternalService) listStale(ctx context.Context, filter *ListFilter) ([]*Notification, error) {
+	tx, err := s.persistence.GetPool().BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		// a no-op once committed
+		_ = tx.Rollback(ctx)
+	}()
+	if err = s.persistence.FollowerReads(ctx, tx); err != nil {
+		return nil, err
+	}
+	stored, err := s.persistence.ListNotifications(ctx, filter, tx)
+	if err != nil {
+		return nil, err
+	}
+	return stored, tx.Commit(ctx)
+}
+
+// CancelNotification cancels a notification that wasn't delivered yet, or records a tombstone for one not stored yet
+func (s *InternalService) CancelNotification(ctx context.Context, tenantID string, notifUUID uuid.UUID) (*CancelResponse, error) {
+	var resp *CancelResponse
+	err := crdbpgx.ExecuteTx(ctx, s.persistence.GetPool(), pgx.TxOptions{}, func(tx pgx.Tx) error {
+		stored, errGet := s.persistence.Get(ctx, tenantID, notifUUID, tx)
+		if errGet == nil {
+			var errCancel error
+			resp, errCancel = s.cancel(ctx, stored, tx)
+			return errCancel
+		}
+		if errGet != pgx.ErrNoRows {
+			return errGet
+		}
+		resp = &CancelResponse{UUID: notifUUID, Cancelled: true, State: StateCancelled}
+		// children of a fan-out still in kafka are cancelled by the tombstone of their parent
+		errCancel := s.persistence.InsertCancellation(ctx, tenantID, notifUUID, tx)
+		if errCancel != nil {
+			return errCancel
+		}
+		children, errGet := s.persistence.GetByParents(ctx, tenantID, []uuid.UUID{notifUUID}, tx)
+		if errGet != nil || len(children) == 0 {
+			return errGet
+		}
+		resp.Cancelled = false
+		resp.Children = make([]*CancelResponse, len(children))
+		states := make([]State, len(children))
+		for i, c := range children {
+			resp.Children[i], errCancel = s.cancel(ctx, c, tx)
+			if errCancel != nil {
+				return errCancel
+			}
+			resp.Cancelled = resp.Cancelled || resp.Children[i].Cancelled
+			states[i] = resp.Children[i].State
+		}
+		// the same as its status reports
+		resp.State = parentState(states)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// cancel a stored notification that wasn't dispatched yet or is waiting for a retry
+func (s *InternalService) cancel(ctx context.Context, stored *Notification, tx pgx.Tx) (*CancelResponse, error) {
+	resp := &CancelResponse{UUID: stored.UUID, State: stored.State}
+	if resp.State == StateCancelled {
+		resp.Cancelled = true
+		return resp, nil
+	}
+	if resp.State == StateScheduled {
+		err := s.persistence.Unschedule(ctx, stored, tx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err := s.persistence.Transition(ctx, stored, StateCancelled, TransitionOpts{}, tx)
+	if errors.Is(err, ErrInvalidTransition) {
+		// it is already on its way
+		return resp, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	resp.Cancelled = true
+	resp.State = StateCancelled
+	return resp, nil
+}
+
+// toServerNotifications returns the single notification of the request, or one child per destination of a fan-out
+func toServerNotifications(n *Request) ([]*Notification, error) {
+	if n == nil {
+		return nil, ErrEmptyBatchItem
+	}
+	destinations, err := n.resolve()
+	if err != nil {
+		return nil, err
+	}
+	nUUID, _ := uuid.Parse(n.UUID)
+	// validated by resolve
+	priority, _ := toServerPriority(n.Priority)
+	tenantID := tenantOrDefault(n.TenantID)
+	var sendAt *time.Time
+	if n.SendAt != nil {
+		// stored as a timestamp without zone, and must hash the same whatever zone the client used
+		utc := n.SendAt.UTC()
+		sendAt = &utc
+	}
+	now := time.Now().UTC()
+	serverNotifications := make([]*Notification, len(destinations))
+	for i, d := range destinations {
+		serverNotifications[i] = &Notification{
+			UUID:                    nUUID,
+			ServerReceivedTimestamp: now,
+			NotificationTxt:         n.NotificationTxt,
+			Dest:                    d.dest,
+			Recipient:               d.recipient,
+			SendAt:                  sendAt,
+			TemplateID:              n.TemplateID,
+			TemplateVersion:         n.TemplateVersion,
+			Params:                  n.Params,
+			Priority:                priority,
+			TenantID:                tenantID,
+			CallbackURL:             n.CallbackURL,
+		}
+		if n.Destinations != nil {
+			serverNotifications[i].UUID = childUUID(nUUID, d.dest)
+			serverNotifications[i].ParentUUID = &nUUID
+		}
+	}
+	return serverNotifications, nil
+}
+
+type templateKey struct {
+	tenantID string
+	name     string
+	version  int64
+}
+
+// pinTemplates checks at ingest that every template renders, pinning requests for the latest version.
+// templates caches what was read
+func (s *InternalService) pinTemplates(ctx context.Context, serverNotifications []*Notification, templates map[templateKey]*Template) error {
+	for _, n := range serverNotifications {
+		if n.TemplateID == "" {
+			continue
+		}
+		key := templateKey{tenantID: tenantOrDefault(n.TenantID), name: n.TemplateID, version: n.TemplateVersion}
+		t, ok := templates[key]
+		if !ok {
+			err := crdbpgx.ExecuteTx(ctx, s.persistence.GetPool(), pgx.TxOptions{AccessMode: pgx.ReadOnly}, func(tx pgx.Tx) error {
+				var errGet error
+				t, errGet = s.persistence.GetTemplate(ctx, key.tenantID, key.name, key.version, tx)
+				return errGet
+			})
+			if err != nil && err != ErrTemplateNotFound {
+				return err
+			}
+			templates[key] = t
+		}
+		if err := checkTemplate(t, n); err != nil {
+			return err
+		}
+		if n.TemplateVersion == 0 {
+			n.TemplateVersion, n.TemplatePinned = t.Version, true
+		}
+	}
+	return nil
+}
+
+// checkTemplate renders the variant of the notification destination, t is nil when there is no such template
+func checkTemplate(t *Template, n *Notification) error {
+	ve := &ValidationError{}
+	if t == nil && n.TemplateVersion != 0 {
+		ve.add("template_version", fmt.Sprintf("is not a version of template %s", n.TemplateID))
+	} else if t == nil {
+		ve.add("template_id", "is not a template")
+	} else if variant := t.Variant(n.Dest); variant == nil {
+		ve.add("template_id", fmt.Sprintf("has no %s variant in version %d", n.Dest, t.Version))
+	} else if _, err := variant.Render(n.Params); err != nil {
+		ve.add("params", fmt.Sprintf("don't render template %s version %d: %v", t.Name, t.Version, err))
+	}
+	if len(ve.Fields) > 0 {
+		return ve
+	}
+	return nil
+}
+
+func marshalNotifications(serverNotifications []*Notification) ([][]byte, error) {
+	payloads := make([][]byte, len(serverNotifications))
+	for i, n := range serverNotifications {
+		b, err := json.Marshal(n)
+		if err != nil {
+			return nil, err
+		}
+		payloads[i] = b
+	}
+	return payloads, nil
+}
+
+// batchItemKey keys results by the client uuid, items without one fall back to their position
+func batchItemKey(idx int, n *Request) string {
+	if n == nil || n.UUID == "" {
+		return "item-" + strconv.Itoa(idx)
 	}
-	return s.outstandingNotificationsProducer.Produce(b)
+	return n.UUID
 }
@@ -0,0 +1,144 @@
+package notification
+
+import (
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Server notifications", func() {
+
+	var (
+		req                 *Request
+		parent              uuid.UUID
+		serverNotifications []*Notification
+		err                 error
+	)
+
+	BeforeEach(func() {
+		parent = uuid.New()
+	})
+
+	JustBeforeEach(func() {
+		serverNotifications, err = toServerNotifications(req)
+	})
+
+	Context("Single destination", func() {
+		BeforeEach(func() {
+			req = &Request{
+				UUID:            parent.String(),
+				NotificationTxt: "TXT",
+				Destination:     "sms",
+				Recipient:       &Recipient{Phone: "+1 555 123 4567"},
+			}
+		})
+
+		It("should keep the client uuid", func() {
+			Expect(err).To(BeNil())
+			Expect(serverNotifications).To(HaveLen(1))
+			Expect(serverNotifications[0].UUID).To(Equal(parent))
+			Expect(serverNotifications[0].ParentUUID).To(BeNil())
+			Expect(serverNotifications[0].Recipient).To(Equal(&Recipient{Phone: "+15551234567"}))
+		})
+
+		It("should default to the normal lane", func() {
+			Expect(serverNotifications[0].Priority).To(Equal(PriorityNormal))
+		})
+	})
+
+	Context("Fan-out", func() {
+		BeforeEach(func() {
+			req = &Request{
+				UUID:            parent.String(),
+				NotificationTxt: "TXT",
+				Destinations: []*DestinationRequest{
+					{Destination: "EMAIL", Recipient: &Recipient{Email: "jane@example.com"}},
+					{Destination: "SLACK", Recipient: &Recipient{SlackUser: "U0123456789"}},
+				},
+			}
+		})
+
+		It("should derive a child per destination", func() {
+			Expect(err).To(BeNil())
+			Expect(serverNotifications).To(HaveLen(2))
+			Expect(serverNotifications[0].UUID).To(Not(Equal(serverNotifications[1].UUID)))
+			for _, n := range serverNotifications {
+				Expect(n.UUID).To(Not(Equal(parent)))
+				Expect(*n.ParentUUID).To(Equal(parent))
+			}
+		})
+
+		It("should derive the same children on retry, whatever the order", func() {
+			req.Destinations[0], req.Destinations[1] = req.Destinations[1], req.Destinations[0]
+			retried, errRetry := toServerNotifications(req)
+			Expect(errRetry).To(BeNil())
+			Expect(retried[0].UUID).To(Equal(serverNotifications[1].UUID))
+			Expect(retried[1].UUID).To(Equal(serverNotifications[0].UUID))
+		})
+
+		It("should derive the same child for another recipient, so its reuse is detected", func() {
+			req.Destinations[0].Recipient = &Recipient{Email: "john@example.com"}
+			reused, errReuse := toServerNotifications(req)
+			Expect(errReuse).To(BeNil())
+			Expect(reused[0].UUID).To(Equal(serverNotifications[0].UUID))
+			Expect(reused[0].PayloadHash()).To(Not(Equal(serverNotifications[0].PayloadHash())))
+		})
+
+		It("should route every child to the lane of the request", func() {
+			req.Priority = "critical"
+			critical, errCritical := toServerNotifications(req)
+			Expect(errCritical).To(BeNil())
+			for _, n := range critical {
+				Expect(n.Priority).To(Equal(PriorityCritical))
+			}
+		})
+	})
+})
+
+var _ = Describe("Template check at ingest", func() {
+
+	var (
+		t *Template
+		n *Notification
+	)
+
+	BeforeEach(func() {
+		t = &Template{Name: "welcome", Version: 2, Variants: []*TemplateVariant{{Destination: "SMS", Body: "Hi {{.name}}"}}}
+		n = &Notification{UUID: uuid.New(), Dest: SMS, TemplateID: "welcome", Params: map[string]interface{}{"name": "Jane"}}
+	})
+
+	fields := func(err error) []*FieldError {
+		ve, ok := err.(*ValidationError)
+		Expect(ok).To(BeTrue())
+		return ve.Fields
+	}
+
+	It("should accept params that render", func() {
+		Expect(checkTemplate(t, n)).To(Succeed())
+	})
+
+	It("should refuse an unknown template", func() {
+		Expect(fields(checkTemplate(nil, n))).To(ConsistOf(&FieldError{Name: "template_id", Reason: "is not a template"}))
+	})
+
+	It("should refuse an unknown version", func() {
+		n.TemplateVersion = 3
+		Expect(fields(checkTemplate(nil, n))).To(ConsistOf(&FieldError{Name: "template_version", Reason: "is not a version of template welcome"}))
+	})
+
+	It("should refuse a destination without a variant", func() {
+		n.Dest = Email
+		Expect(fields(checkTemplate(t, n))).To(ConsistOf(&FieldError{Name: "template_id", Reason: "has no EMAIL variant in version 2"}))
+	})
+
+	It("should refuse missing params", func() {
+		n.Params = nil
+		Expect(fields(checkTemplate(t, n))[0].Name).To(Equal("params"))
+	})
+
+	It("should hash a pinned version like the latest one it was asked for", func() {
+		hash := n.PayloadHash()
+		n.TemplateVersion, n.TemplatePinned = 2, true
+		Expect(n.PayloadHash()).To(Equal(hash))
+	})
+})
@@ -0,0 +1,121 @@
+package notification
+
+import (
+	"fmt"
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+)
+
+type Priority string
+
+const (
+	PriorityCritical Priority = "critical"
+	PriorityHigh     Priority = "high"
+	PriorityNormal   Priority = "normal"
+	PriorityBulk     Priority = "bulk"
+)
+
+// Priorities are ordered from the most to the least urgent, lanes are always polled in this order
+var Priorities = []Priority{PriorityCritical, PriorityHigh, PriorityNormal, PriorityBulk}
+
+var ErrNoSuchPriority = fmt.Errorf("no such priority exists")
+
+func toServerPriority(priority string) (Priority, error) {
+	if priority == "" {
+		return PriorityNormal, nil
+	}
+	for _, p := range Priorities {
+		if string(p) == priority {
+			return p, nil
+		}
+	}
+	return "", ErrNoSuchPriority
+}
+
+// Lane is the outstanding topic of a priority, Weight is how many messages are polled from it per round
+type Lane struct {
+	Priority Priority
+	Topic    string
+	Weight   int
+}
+
+// LaneLag is how far the consumer of a lane is behind, summed over the partitions assigned to this instance
+type LaneLag struct {
+	Priority Priority `json:"priority"`
+	Topic    string   `json:"topic"`
+	Lag      int64    `json:"lag"`
+}
+
+// NewLanes returns a lane per priority, normal keeps the outstanding topic and the others suffix it
+func NewLanes(outstandingTopic string, weights map[string]int) ([]*Lane, error) {
+	for p := range weights {
+		if _, err := toServerPriority(p); err != nil || p == "" {
+			return nil, fmt.Errorf("weight of %q: %w", p, ErrNoSuchPriority)
+		}
+	}
+	lanes := make([]*Lane, len(Priorities))
+	for i, p := range Priorities {
+		weight, ok := weights[string(p)]
+		if !ok {
+			weight = 1
+		}
+		if weight < 1 {
+			return nil, fmt.Errorf("weight of %s must be at least 1, got %d", p, weight)
+		}
+		lanes[i] = &Lane{
+			Priority: p,
+			Topic:    laneTopic(outstandingTopic, p),
+			Weight:   weight,
+		}
+	}
+	return lanes, nil
+}
+
+func laneTopic(outstandingTopic string, p Priority) string {
+	if p == PriorityNormal {
+		return outstandingTopic
+	}
+	return outstandingTopic + "-" + string(p)
+}
+
+// laneGroupID keeps the outstanding group of the normal lane so its committed offsets carry over
+func laneGroupID(outstandingGroupID string, p Priority) string {
+	if p == PriorityNormal {
+		return outstandingGroupID
+	}
+	return outstandingGroupID + "-" + string(p)
+}
+
+type laneConsumer struct {
+	lane     *Lane
+	consumer *kafka.Consumer
+	offsets  *offsetTracker
+}
+
+// lag sums the distance between the high watermark and the committed offset of every assigned partition
+func (lc *laneConsumer) lag(timeoutMs int) (int64, error) {
+	assigned, err := lc.consumer.Assignment()
+	if err != nil {
+		return -1, err
+	}
+	if len(assigned) == 0 {
+		return 0, nil
+	}
+	committed, err := lc.consumer.Committed(assigned, timeoutMs)
+	if err != nil {
+		return -1, err
+	}
+	var lag int64
+	for _, tp := range committed {
+		low, high, errWatermark := lc.consumer.QueryWatermarkOffsets(*tp.Topic, tp.Partition, timeoutMs)
+		if errWatermark != nil {
+			return -1, errWatermark
+		}
+		offset := int64(tp.Offset)
+		if offset < 0 {
+			// nothing committed yet, everything still retained is outstanding
+			offset = low
+		}
+		lag += high - offset
+	}
+	return lag, nil
+}
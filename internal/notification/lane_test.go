@@ -0,0 +1,67 @@
+package notification_test
+
+import (
+	"github.com/despondency/notifications-service/internal/notification"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Priority lanes", func() {
+
+	var (
+		weights map[string]int
+		lanes   []*notification.Lane
+		err     error
+	)
+
+	BeforeEach(func() {
+		weights = map[string]int{"critical": 8, "high": 4, "normal": 2, "bulk": 1}
+	})
+
+	JustBeforeEach(func() {
+		lanes, err = notification.NewLanes("outstanding-notifications", weights)
+	})
+
+	Context("Every weight given", func() {
+		It("should order the lanes by priority and keep the outstanding topic for normal", func() {
+			Expect(err).To(BeNil())
+			Expect(lanes).To(Equal([]*notification.Lane{
+				{Priority: notification.PriorityCritical, Topic: "outstanding-notifications-critical", Weight: 8},
+				{Priority: notification.PriorityHigh, Topic: "outstanding-notifications-high", Weight: 4},
+				{Priority: notification.PriorityNormal, Topic: "outstanding-notifications", Weight: 2},
+				{Priority: notification.PriorityBulk, Topic: "outstanding-notifications-bulk", Weight: 1},
+			}))
+		})
+	})
+
+	Context("Missing weight", func() {
+		BeforeEach(func() {
+			delete(weights, "bulk")
+		})
+
+		It("should default to 1", func() {
+			Expect(err).To(BeNil())
+			Expect(lanes[3].Weight).To(Equal(1))
+		})
+	})
+
+	Context("Unknown priority", func() {
+		BeforeEach(func() {
+			weights["urgent"] = 3
+		})
+
+		It("should fail", func() {
+			Expect(err).To(MatchError(ContainSubstring("urgent")))
+		})
+	})
+
+	Context("Zero weight", func() {
+		BeforeEach(func() {
+			weights["bulk"] = 0
+		})
+
+		It("should fail, a lane without weight would starve", func() {
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
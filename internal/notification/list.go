@@ -0,0 +1,61 @@
+package notification
+
+import (
+	"encoding/base64"
+	"fmt"
+	"github.com/google/uuid"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultListLimit = 100
+	MaxListLimit     = 1_000
+)
+
+var ErrInvalidListCursor = fmt.Errorf("invalid list cursor")
+
+// ListCursor is the last notification of a page, the next page starts right after it
+type ListCursor struct {
+	ServerTimestamp time.Time
+	UUID            uuid.UUID
+}
+
+// String is an opaque url safe token
+func (c *ListCursor) String() string {
+	return base64.RawURLEncoding.EncodeToString(
+		[]byte(strconv.FormatInt(c.ServerTimestamp.UnixNano(), 10) + ":" + c.UUID.String()))
+}
+
+func ParseListCursor(s string) (*ListCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w %q", ErrInvalidListCursor, s)
+	}
+	ts, id, ok := strings.Cut(string(b), ":")
+	nanos, errTs := strconv.ParseInt(ts, 10, 64)
+	nUUID, errID := uuid.Parse(id)
+	if !ok || errTs != nil || errID != nil {
+		return nil, fmt.Errorf("%w %q", ErrInvalidListCursor, s)
+	}
+	return &ListCursor{ServerTimestamp: time.Unix(0, nanos).UTC(), UUID: nUUID}, nil
+}
+
+// ListFilter selects the notifications of a tenant received in [From, To), newest first,
+// up to Limit of them after the After cursor
+type ListFilter struct {
+	TenantID     string
+	Destinations []Destination
+	States       []State
+	From         *time.Time
+	To           *time.Time
+	After        *ListCursor
+	Limit        int
+}
+
+type ListResponse struct {
+	Notifications []*StatusResponse `json:"notifications"`
+	// NextCursor fetches the next page with the same filters, there is none after the last page
+	NextCursor string `json:"next_cursor,omitempty"`
+}
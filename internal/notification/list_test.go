@@ -0,0 +1,32 @@
+package notification_test
+
+import (
+	"errors"
+	"github.com/despondency/notifications-service/internal/notification"
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"time"
+)
+
+var _ = Describe("List cursor", func() {
+
+	Context("Round trip", func() {
+		It("should point at the same notification", func() {
+			c := &notification.ListCursor{ServerTimestamp: time.Date(2022, 5, 1, 10, 0, 0, 123456000, time.UTC), UUID: uuid.New()}
+			parsed, err := notification.ParseListCursor(c.String())
+			Expect(err).To(BeNil())
+			Expect(parsed.ServerTimestamp.Equal(c.ServerTimestamp)).To(BeTrue())
+			Expect(parsed.UUID).To(Equal(c.UUID))
+		})
+	})
+
+	Context("Tampered cursor", func() {
+		It("should be invalid", func() {
+			for _, s := range []string{"", "not base64!", "MTIzOm5vdC1hLXV1aWQ"} {
+				_, err := notification.ParseListCursor(s)
+				Expect(errors.Is(err, notification.ErrInvalidListCursor)).To(BeTrue(), s)
+			}
+		})
+	})
+})
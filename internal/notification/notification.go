@@ -1,6 +1,8 @@
 package notification
 
 import (
+	"crypto/sha256"
+	"encoding/json"
 	"fmt"
 	"github.com/google/uuid"
 	"strings"
@@ -15,7 +17,13 @@ const (
 	Slack
 )
 
-var ErrNoSuchDestination = fmt.Errorf("no such destination exists")
+var (
+	ErrNoSuchDestination = fmt.Errorf("no such destination exists")
+	ErrEmptyBatchItem    = fmt.Errorf("empty batch item")
+	ErrNotFound          = fmt.Errorf("notification not found")
+	ErrConflictingReuse  = fmt.Errorf("uuid reused with a different payload")
+	ErrNoRecipient       = fmt.Errorf("notification has no recipient")
+)
 
 func toServerNotificationDestination(destination string) (Destination, error) {
 	destinationUpper := strings.ToUpper(destination)
@@ -31,19 +39,273 @@ func toServerNotificationDestination(destination string) (Destination, error) {
 	}
 }
 
+func (d Destination) String() string {
+	switch d {
+	case SMS:
+		return "SMS"
+	case Email:
+		return "EMAIL"
+	case Slack:
+		return "SLACK"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// TemplatePinned is set when the request asked for the latest template version, TemplateVersion is then the one at ingest
 type Notification struct {
-	UUID                    uuid.UUID   `json:"uuid"`
-	ServerReceivedTimestamp time.Time   `json:"server_received_timestamp"`
-	NotificationTxt         string      `json:"txt"`
-	Dest                    Destination `json:"destination"`
+	UUID                    uuid.UUID              `json:"uuid"`
+	ServerReceivedTimestamp time.Time              `json:"server_received_timestamp"`
+	NotificationTxt         string                 `json:"txt"`
+	Dest                    Destination            `json:"destination"`
+	LastUpdated             time.Time              `json:"-"`
+	ConflictCount           int64                  `json:"-"`
+	LastConflictAt          *time.Time             `json:"-"`
+	SendAt                  *time.Time             `json:"send_at,omitempty"`
+	Recipient               *Recipient             `json:"recipient,omitempty"`
+	ParentUUID              *uuid.UUID             `json:"parent_uuid,omitempty"`
+	TemplateID              string                 `json:"template_id,omitempty"`
+	TemplateVersion         int64                  `json:"template_version,omitempty"`
+	TemplatePinned          bool                   `json:"template_pinned,omitempty"`
+	Params                  map[string]interface{} `json:"params,omitempty"`
+	Priority                Priority               `json:"priority,omitempty"`
+	TenantID                string                 `json:"tenant_id,omitempty"`
+	CallbackURL             string                 `json:"callback_url,omitempty"`
+	State                   State                  `json:"-"`
+	Transitions             map[State]time.Time    `json:"-"`
+	SuppressedReason        string                 `json:"-"`
+	FailureReason           string                 `json:"-"`
+	RetryReason             string                 `json:"-"`
+	Provider                string                 `json:"-"`
+}
+
+// canonicalPayload is everything the client decides about a notification, so retries hash the same.
+// Priority, tenant and callback url don't change what is sent
+type canonicalPayload struct {
+	UUID uuid.UUID   `json:"uuid"`
+	Txt  string      `json:"txt"`
+	Dest Destination `json:"destination"`
+	// new fields must be omitempty so hashes of notifications stored before them don't change
+	SendAt          *time.Time             `json:"send_at,omitempty"`
+	Recipient       *Recipient             `json:"recipient,omitempty"`
+	ParentUUID      *uuid.UUID             `json:"parent_uuid,omitempty"`
+	TemplateID      string                 `json:"template_id,omitempty"`
+	TemplateVersion int64                  `json:"template_version,omitempty"`
+	Params          map[string]interface{} `json:"params,omitempty"`
+}
+
+func (n *Notification) PayloadHash() []byte {
+	templateVersion := n.TemplateVersion
+	if n.TemplatePinned {
+		// the client asked for the latest version, a retry after the template changed is still the same notification
+		templateVersion = 0
+	}
+	// marshalling a struct is deterministic, fields are written in declaration order and map keys sorted
+	b, _ := json.Marshal(&canonicalPayload{
+		UUID:            n.UUID,
+		Txt:             n.NotificationTxt,
+		Dest:            n.Dest,
+		SendAt:          n.SendAt,
+		Recipient:       n.Recipient,
+		ParentUUID:      n.ParentUUID,
+		TemplateID:      n.TemplateID,
+		TemplateVersion: templateVersion,
+		Params:          n.Params,
+	})
+	h := sha256.Sum256(b)
+	return h[:]
+}
+
+// expired tells if a notification is more than expireAfter past its send_at, or when it was received
+func (n *Notification) expired(expireAfter time.Duration, now time.Time) bool {
+	if expireAfter <= 0 {
+		return false
+	}
+	due := n.ServerReceivedTimestamp
+	if n.SendAt != nil && n.SendAt.After(due) {
+		due = *n.SendAt
+	}
+	return now.After(due.Add(expireAfter))
 }
 
 type OutstandingNotification struct {
 	UUID uuid.UUID `json:"uuid"`
 }
 
+// Request targets a single Destination and Recipient, or fans out to every entry of Destinations.
+// TenantID is taken from the authenticated identity, never from the body
 type Request struct {
-	UUID            string `json:"uuid"`
-	NotificationTxt string `json:"txt"`
-	Destination     string `json:"destination"`
+	UUID            string                 `json:"uuid"`
+	NotificationTxt string                 `json:"txt,omitempty"`
+	Destination     string                 `json:"destination,omitempty"`
+	SendAt          *time.Time             `json:"send_at,omitempty"`
+	Recipient       *Recipient             `json:"recipient,omitempty"`
+	Destinations    []*DestinationRequest  `json:"destinations,omitempty"`
+	TemplateID      string                 `json:"template_id,omitempty"`
+	TemplateVersion int64                  `json:"template_version,omitempty"`
+	Params          map[string]interface{} `json:"params,omitempty"`
+	Priority        string                 `json:"priority,omitempty"`
+	CallbackURL     string                 `json:"callback_url,omitempty"`
+	TenantID        string                 `json:"-"`
+}
+
+// withIdentity makes the request act as the identity that sent it
+func (r *Request) withIdentity(identity *Identity) {
+	r.TenantID = identity.TenantID
+	if r.CallbackURL == "" {
+		r.CallbackURL = identity.CallbackURL
+	}
+}
+
+type DestinationRequest struct {
+	Destination string     `json:"destination"`
+	Recipient   *Recipient `json:"recipient"`
+}
+
+// childUUID is deterministic so a retried fan-out dedups on the same children, the recipient isn't part of it
+func childUUID(parent uuid.UUID, dest Destination) uuid.UUID {
+	return uuid.NewSHA1(parent, []byte(dest.String()))
+}
+
+type BatchItemStatus string
+
+const (
+	BatchItemAccepted BatchItemStatus = "accepted"
+	BatchItemRejected BatchItemStatus = "rejected"
+)
+
+type BatchItemResult struct {
+	Status BatchItemStatus `json:"status"`
+	Reason string          `json:"reason,omitempty"`
+}
+
+type BatchResponse struct {
+	Accepted int                         `json:"accepted"`
+	Rejected int                         `json:"rejected"`
+	Results  map[string]*BatchItemResult `json:"results"`
+}
+
+type StatusResponse struct {
+	UUID             uuid.UUID  `json:"uuid"`
+	TenantID         string     `json:"tenant_id,omitempty"`
+	NotificationTxt  string     `json:"txt"`
+	Destination      string     `json:"destination"`
+	ServerTimestamp  time.Time  `json:"server_timestamp"`
+	LastUpdated      time.Time  `json:"last_updated"`
+	State            State      `json:"state"`
+	ConflictCount    int64      `json:"conflict_count,omitempty"`
+	LastConflictAt   *time.Time `json:"last_conflict_at,omitempty"`
+	SendAt           *time.Time `json:"send_at,omitempty"`
+	Recipient        *Recipient `json:"recipient,omitempty"`
+	ParentUUID       *uuid.UUID `json:"parent_uuid,omitempty"`
+	TemplateID       string     `json:"template_id,omitempty"`
+	TemplateVersion  int64      `json:"template_version,omitempty"`
+	Priority         Priority   `json:"priority,omitempty"`
+	DeliveredAt      *time.Time `json:"delivered_at,omitempty"`
+	SuppressedReason string     `json:"suppressed_reason,omitempty"`
+	FailureReason    string     `json:"failure_reason,omitempty"`
+	// RetryReason is why the last attempt to deliver it was refused, when it was retried
+	RetryReason string `json:"retry_reason,omitempty"`
+	// Provider is the provider of its destination that delivered it
+	Provider string `json:"provider,omitempty"`
+	// Transitions is when the notification entered each state it went through
+	Transitions map[State]time.Time `json:"transitions,omitempty"`
+	Children    []*StatusResponse   `json:"children,omitempty"`
+}
+
+type BulkStatusRequest struct {
+	UUIDs []string `json:"uuids"`
+}
+
+type BulkStatusResponse struct {
+	Notifications []*StatusResponse `json:"notifications"`
+	// NotFound are either unknown or still waiting in the outstanding topic
+	NotFound []string `json:"not_found"`
+}
+
+// CancelResponse says whether the cancellation won the race with delivery, State is what the notification ended up as
+type CancelResponse struct {
+	UUID      uuid.UUID         `json:"uuid"`
+	Cancelled bool              `json:"cancelled"`
+	State     State             `json:"state"`
+	Children  []*CancelResponse `json:"children,omitempty"`
+}
+
+// toStatusResponse reports a notification without a stored state as received
+func toStatusResponse(n *Notification) *StatusResponse {
+	resp := &StatusResponse{
+		UUID:             n.UUID,
+		TenantID:         n.TenantID,
+		NotificationTxt:  n.NotificationTxt,
+		Destination:      n.Dest.String(),
+		ServerTimestamp:  n.ServerReceivedTimestamp,
+		LastUpdated:      n.LastUpdated,
+		State:            n.State,
+		ConflictCount:    n.ConflictCount,
+		LastConflictAt:   n.LastConflictAt,
+		SendAt:           n.SendAt,
+		Recipient:        n.Recipient,
+		ParentUUID:       n.ParentUUID,
+		TemplateID:       n.TemplateID,
+		TemplateVersion:  n.TemplateVersion,
+		Priority:         n.Priority,
+		SuppressedReason: n.SuppressedReason,
+		FailureReason:    n.FailureReason,
+		RetryReason:      n.RetryReason,
+		Provider:         n.Provider,
+		Transitions:      n.Transitions,
+	}
+	if resp.State == "" {
+		resp.State = StateReceived
+	}
+	if at, ok := n.Transitions[StateDelivered]; ok && resp.State == StateDelivered {
+		resp.DeliveredAt = &at
+	}
+	return resp
+}
+
+// parentStatePrecedence ranks the states of fan-out children, the parent is in the first one any child is in
+var parentStatePrecedence = []State{StateReceived, StateScheduled, StateRetrying, StateDispatching,
+	StateFailed, StateExpired, StateCancelled, StateSuppressed, StateDelivered}
+
+// parentState is the state of a fan-out whose children are in the given states, delivered when there are none
+func parentState(states []State) State {
+	for _, s := range parentStatePrecedence {
+		for _, child := range states {
+			if child == s {
+				return s
+			}
+		}
+	}
+	return StateDelivered
+}
+
+// toParentStatusResponse summarizes a fan-out, the state is the one of parentStatePrecedence
+func toParentStatusResponse(parent uuid.UUID, children []*Notification) *StatusResponse {
+	resp := &StatusResponse{
+		UUID:     parent,
+		Children: make([]*StatusResponse, len(children)),
+	}
+	if len(children) > 0 {
+		resp.TenantID = children[0].TenantID
+	}
+	destinations := make([]string, len(children))
+	states := make([]State, len(children))
+	for i, c := range children {
+		child := toStatusResponse(c)
+		resp.Children[i] = child
+		destinations[i] = child.Destination
+		states[i] = child.State
+		if i == 0 || c.ServerReceivedTimestamp.Before(resp.ServerTimestamp) {
+			resp.ServerTimestamp = c.ServerReceivedTimestamp
+		}
+		if c.LastUpdated.After(resp.LastUpdated) {
+			resp.LastUpdated = c.LastUpdated
+		}
+		resp.NotificationTxt = c.NotificationTxt
+		resp.SendAt = c.SendAt
+	}
+	resp.Destination = strings.Join(destinations, ",")
+	resp.State = parentState(states)
+	return resp
 }
@@ -1,8 +1,10 @@
 package notification
 
 import (
+	"github.com/google/uuid"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"time"
 )
 
 var _ = Describe("Notification test", func() {
@@ -67,3 +69,153 @@ var _ = Describe("Notification test", func() {
 	})
 
 })
+
+var _ = Describe("Notification payload hash", func() {
+
+	var (
+		notification *Notification
+		other        *Notification
+	)
+
+	BeforeEach(func() {
+		notification = &Notification{
+			UUID:                    uuid.New(),
+			ServerReceivedTimestamp: time.Now(),
+			NotificationTxt:         "TXT",
+			Dest:                    Email,
+		}
+		copied := *notification
+		other = &copied
+	})
+
+	Context("Retry received at a different time", func() {
+		BeforeEach(func() {
+			other.ServerReceivedTimestamp = notification.ServerReceivedTimestamp.Add(time.Minute)
+		})
+
+		It("should hash the same", func() {
+			Expect(other.PayloadHash()).To(Equal(notification.PayloadHash()))
+		})
+	})
+
+	Context("Reuse with a different txt", func() {
+		BeforeEach(func() {
+			other.NotificationTxt = "OTHER TXT"
+		})
+
+		It("should hash differently", func() {
+			Expect(other.PayloadHash()).To(Not(Equal(notification.PayloadHash())))
+		})
+	})
+
+	Context("Reuse with a different destination", func() {
+		BeforeEach(func() {
+			other.Dest = SMS
+		})
+
+		It("should hash differently", func() {
+			Expect(other.PayloadHash()).To(Not(Equal(notification.PayloadHash())))
+		})
+	})
+
+	Context("Reuse with different template params", func() {
+		BeforeEach(func() {
+			notification.TemplateID = "welcome"
+			notification.Params = map[string]interface{}{"name": "Jane", "plan": "pro"}
+			other.TemplateID = "welcome"
+			other.Params = map[string]interface{}{"name": "John", "plan": "pro"}
+		})
+
+		It("should hash differently", func() {
+			Expect(other.PayloadHash()).To(Not(Equal(notification.PayloadHash())))
+		})
+	})
+})
+
+var _ = Describe("Notification status", func() {
+
+	var (
+		notification *Notification
+		at           time.Time
+	)
+
+	BeforeEach(func() {
+		at = time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+		notification = &Notification{
+			UUID:        uuid.New(),
+			State:       StateDispatching,
+			Transitions: map[State]time.Time{StateReceived: at, StateDispatching: at},
+		}
+	})
+
+	It("should report the stored state", func() {
+		resp := toStatusResponse(notification)
+		Expect(resp.State).To(Equal(StateDispatching))
+		Expect(resp.DeliveredAt).To(BeNil())
+	})
+
+	It("should report a notification without a stored state as received", func() {
+		notification.State = ""
+		Expect(toStatusResponse(notification).State).To(Equal(StateReceived))
+	})
+
+	It("should only report when it was delivered once it was", func() {
+		notification.State, notification.Transitions[StateDelivered] = StateDelivered, at
+		Expect(toStatusResponse(notification).DeliveredAt).To(Equal(&at))
+	})
+})
+
+var _ = Describe("Fan-out status", func() {
+
+	children := func(states ...State) []*Notification {
+		ns := make([]*Notification, len(states))
+		for i, s := range states {
+			ns[i] = &Notification{UUID: uuid.New(), State: s}
+		}
+		return ns
+	}
+
+	It("should only be delivered once every child is", func() {
+		Expect(toParentStatusResponse(uuid.New(), children(StateDelivered, StateDelivered)).State).To(Equal(StateDelivered))
+	})
+
+	It("should be pending while any child is, whatever the order", func() {
+		Expect(toParentStatusResponse(uuid.New(), children(StateRetrying, StateFailed, StateDelivered)).State).To(Equal(StateRetrying))
+		Expect(toParentStatusResponse(uuid.New(), children(StateDelivered, StateFailed, StateRetrying)).State).To(Equal(StateRetrying))
+	})
+
+	It("should be the worst outcome once every child is final, whatever the order", func() {
+		Expect(parentState([]State{StateFailed, StateCancelled, StateDelivered})).To(Equal(StateFailed))
+		Expect(parentState([]State{StateDelivered, StateCancelled, StateFailed})).To(Equal(StateFailed))
+		Expect(parentState([]State{StateSuppressed, StateDelivered})).To(Equal(StateSuppressed))
+	})
+})
+
+var _ = Describe("Notification expiry", func() {
+
+	var (
+		notification *Notification
+		at           time.Time
+	)
+
+	BeforeEach(func() {
+		at = time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+		notification = &Notification{UUID: uuid.New(), ServerReceivedTimestamp: at}
+	})
+
+	It("should expire once it is past due by more than expire after", func() {
+		Expect(notification.expired(time.Hour, at.Add(time.Hour))).To(BeFalse())
+		Expect(notification.expired(time.Hour, at.Add(time.Hour+time.Second))).To(BeTrue())
+	})
+
+	It("should be due at its send at when it was scheduled", func() {
+		sendAt := at.Add(24 * time.Hour)
+		notification.SendAt = &sendAt
+		Expect(notification.expired(time.Hour, at.Add(2*time.Hour))).To(BeFalse())
+		Expect(notification.expired(time.Hour, sendAt.Add(2*time.Hour))).To(BeTrue())
+	})
+
+	It("should never expire without expire after", func() {
+		Expect(notification.expired(0, at.Add(365*24*time.Hour))).To(BeFalse())
+	})
+})
@@ -0,0 +1,124 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: adminendpoint.go
+
+// Package notificationmocks is a generated GoMock package.
+package notificationmocks
+
+import (
+	reflect "reflect"
+
+	notification "github.com/despondency/notifications-service/internal/notification"
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockLagReporter is a mock of LagReporter interface.
+type MockLagReporter struct {
+	ctrl     *gomock.Controller
+	recorder *MockLagReporterMockRecorder
+}
+
+// MockLagReporterMockRecorder is the mock recorder for MockLagReporter.
+type MockLagReporterMockRecorder struct {
+	mock *MockLagReporter
+}
+
+// NewMockLagReporter creates a new mock instance.
+func NewMockLagReporter(ctrl *gomock.Controller) *MockLagReporter {
+	mock := &MockLagReporter{ctrl: ctrl}
+	mock.recorder = &MockLagReporterMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockLagReporter) EXPECT() *MockLagReporterMockRecorder {
+	return m.recorder
+}
+
+// Lag mocks base method.
+func (m *MockLagReporter) Lag() ([]*notification.LaneLag, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Lag")
+	ret0, _ := ret[0].([]*notification.LaneLag)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Lag indicates an expected call of Lag.
+func (mr *MockLagReporterMockRecorder) Lag() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Lag", reflect.TypeOf((*MockLagReporter)(nil).Lag))
+}
+
+// MockBreakerReporter is a mock of BreakerReporter interface.
+type MockBreakerReporter struct {
+	ctrl     *gomock.Controller
+	recorder *MockBreakerReporterMockRecorder
+}
+
+// MockBreakerReporterMockRecorder is the mock recorder for MockBreakerReporter.
+type MockBreakerReporterMockRecorder struct {
+	mock *MockBreakerReporter
+}
+
+// NewMockBreakerReporter creates a new mock instance.
+func NewMockBreakerReporter(ctrl *gomock.Controller) *MockBreakerReporter {
+	mock := &MockBreakerReporter{ctrl: ctrl}
+	mock.recorder = &MockBreakerReporterMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockBreakerReporter) EXPECT() *MockBreakerReporterMockRecorder {
+	return m.recorder
+}
+
+// Breakers mocks base method.
+func (m *MockBreakerReporter) Breakers() []*notification.BreakerStatus {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Breakers")
+	ret0, _ := ret[0].([]*notification.BreakerStatus)
+	return ret0
+}
+
+// Breakers indicates an expected call of Breakers.
+func (mr *MockBreakerReporterMockRecorder) Breakers() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Breakers", reflect.TypeOf((*MockBreakerReporter)(nil).Breakers))
+}
+
+// MockProviderReporter is a mock of ProviderReporter interface.
+type MockProviderReporter struct {
+	ctrl     *gomock.Controller
+	recorder *MockProviderReporterMockRecorder
+}
+
+// MockProviderReporterMockRecorder is the mock recorder for MockProviderReporter.
+type MockProviderReporterMockRecorder struct {
+	mock *MockProviderReporter
+}
+
+// NewMockProviderReporter creates a new mock instance.
+func NewMockProviderReporter(ctrl *gomock.Controller) *MockProviderReporter {
+	mock := &MockProviderReporter{ctrl: ctrl}
+	mock.recorder = &MockProviderReporterMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockProviderReporter) EXPECT() *MockProviderReporterMockRecorder {
+	return m.recorder
+}
+
+// Providers mocks base method.
+func (m *MockProviderReporter) Providers() []*notification.ProviderStatus {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Providers")
+	ret0, _ := ret[0].([]*notification.ProviderStatus)
+	return ret0
+}
+
+// Providers indicates an expected call of Providers.
+func (mr *MockProviderReporterMockRecorder) Providers() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Providers", reflect.TypeOf((*MockProviderReporter)(nil).Providers))
+}
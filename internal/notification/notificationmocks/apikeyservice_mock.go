@@ -0,0 +1,111 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: apikeyendpoint.go
+
+// Package notificationmocks is a generated GoMock package.
+package notificationmocks
+
+import (
+	context "context"
+	reflect "reflect"
+
+	notification "github.com/despondency/notifications-service/internal/notification"
+	gomock "github.com/golang/mock/gomock"
+	uuid "github.com/google/uuid"
+)
+
+// MockAPIKeyManager is a mock of APIKeyManager interface.
+type MockAPIKeyManager struct {
+	ctrl     *gomock.Controller
+	recorder *MockAPIKeyManagerMockRecorder
+}
+
+// MockAPIKeyManagerMockRecorder is the mock recorder for MockAPIKeyManager.
+type MockAPIKeyManagerMockRecorder struct {
+	mock *MockAPIKeyManager
+}
+
+// NewMockAPIKeyManager creates a new mock instance.
+func NewMockAPIKeyManager(ctrl *gomock.Controller) *MockAPIKeyManager {
+	mock := &MockAPIKeyManager{ctrl: ctrl}
+	mock.recorder = &MockAPIKeyManagerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockAPIKeyManager) EXPECT() *MockAPIKeyManagerMockRecorder {
+	return m.recorder
+}
+
+// CreateAPIKey mocks base method.
+func (m *MockAPIKeyManager) CreateAPIKey(ctx context.Context, req *notification.APIKeyRequest) (*notification.APIKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateAPIKey", ctx, req)
+	ret0, _ := ret[0].(*notification.APIKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateAPIKey indicates an expected call of CreateAPIKey.
+func (mr *MockAPIKeyManagerMockRecorder) CreateAPIKey(ctx, req interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateAPIKey", reflect.TypeOf((*MockAPIKeyManager)(nil).CreateAPIKey), ctx, req)
+}
+
+// ListAPIKeys mocks base method.
+func (m *MockAPIKeyManager) ListAPIKeys(ctx context.Context, tenantID string) ([]*notification.APIKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListAPIKeys", ctx, tenantID)
+	ret0, _ := ret[0].([]*notification.APIKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListAPIKeys indicates an expected call of ListAPIKeys.
+func (mr *MockAPIKeyManagerMockRecorder) ListAPIKeys(ctx, tenantID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListAPIKeys", reflect.TypeOf((*MockAPIKeyManager)(nil).ListAPIKeys), ctx, tenantID)
+}
+
+// ResolveAPIKey mocks base method.
+func (m *MockAPIKeyManager) ResolveAPIKey(ctx context.Context, key string) (*notification.Identity, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ResolveAPIKey", ctx, key)
+	ret0, _ := ret[0].(*notification.Identity)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ResolveAPIKey indicates an expected call of ResolveAPIKey.
+func (mr *MockAPIKeyManagerMockRecorder) ResolveAPIKey(ctx, key interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResolveAPIKey", reflect.TypeOf((*MockAPIKeyManager)(nil).ResolveAPIKey), ctx, key)
+}
+
+// RevokeAPIKey mocks base method.
+func (m *MockAPIKeyManager) RevokeAPIKey(ctx context.Context, id uuid.UUID) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeAPIKey", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeAPIKey indicates an expected call of RevokeAPIKey.
+func (mr *MockAPIKeyManagerMockRecorder) RevokeAPIKey(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeAPIKey", reflect.TypeOf((*MockAPIKeyManager)(nil).RevokeAPIKey), ctx, id)
+}
+
+// RotateAPIKey mocks base method.
+func (m *MockAPIKeyManager) RotateAPIKey(ctx context.Context, id uuid.UUID, req *notification.RotateAPIKeyRequest) (*notification.APIKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RotateAPIKey", ctx, id, req)
+	ret0, _ := ret[0].(*notification.APIKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RotateAPIKey indicates an expected call of RotateAPIKey.
+func (mr *MockAPIKeyManagerMockRecorder) RotateAPIKey(ctx, id, req interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RotateAPIKey", reflect.TypeOf((*MockAPIKeyManager)(nil).RotateAPIKey), ctx, id, req)
+}
@@ -5,10 +5,12 @@
 package notificationmocks
 
 import (
+	context "context"
 	reflect "reflect"
 
 	notification "github.com/despondency/notifications-service/internal/notification"
 	gomock "github.com/golang/mock/gomock"
+	uuid "github.com/google/uuid"
 )
 
 // MockInternalManager is a mock of InternalManager interface.
@@ -34,6 +36,66 @@ func (m *MockInternalManager) EXPECT() *MockInternalManagerMockRecorder {
 	return m.recorder
 }
 
+// CancelNotification mocks base method.
+func (m *MockInternalManager) CancelNotification(ctx context.Context, tenantID string, notifUUID uuid.UUID) (*notification.CancelResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CancelNotification", ctx, tenantID, notifUUID)
+	ret0, _ := ret[0].(*notification.CancelResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CancelNotification indicates an expected call of CancelNotification.
+func (mr *MockInternalManagerMockRecorder) CancelNotification(ctx, tenantID, notifUUID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CancelNotification", reflect.TypeOf((*MockInternalManager)(nil).CancelNotification), ctx, tenantID, notifUUID)
+}
+
+// GetNotificationStatus mocks base method.
+func (m *MockInternalManager) GetNotificationStatus(ctx context.Context, tenantID string, notifUUID uuid.UUID) (*notification.StatusResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetNotificationStatus", ctx, tenantID, notifUUID)
+	ret0, _ := ret[0].(*notification.StatusResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetNotificationStatus indicates an expected call of GetNotificationStatus.
+func (mr *MockInternalManagerMockRecorder) GetNotificationStatus(ctx, tenantID, notifUUID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetNotificationStatus", reflect.TypeOf((*MockInternalManager)(nil).GetNotificationStatus), ctx, tenantID, notifUUID)
+}
+
+// GetNotificationStatuses mocks base method.
+func (m *MockInternalManager) GetNotificationStatuses(ctx context.Context, tenantID string, notifUUIDs []uuid.UUID) (*notification.BulkStatusResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetNotificationStatuses", ctx, tenantID, notifUUIDs)
+	ret0, _ := ret[0].(*notification.BulkStatusResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetNotificationStatuses indicates an expected call of GetNotificationStatuses.
+func (mr *MockInternalManagerMockRecorder) GetNotificationStatuses(ctx, tenantID, notifUUIDs interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetNotificationStatuses", reflect.TypeOf((*MockInternalManager)(nil).GetNotificationStatuses), ctx, tenantID, notifUUIDs)
+}
+
+// ListNotifications mocks base method.
+func (m *MockInternalManager) ListNotifications(ctx context.Context, filter *notification.ListFilter) (*notification.ListResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListNotifications", ctx, filter)
+	ret0, _ := ret[0].(*notification.ListResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListNotifications indicates an expected call of ListNotifications.
+func (mr *MockInternalManagerMockRecorder) ListNotifications(ctx, filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListNotifications", reflect.TypeOf((*MockInternalManager)(nil).ListNotifications), ctx, filter)
+}
+
 // PushNotificationInternal mocks base method.
 func (m *MockInternalManager) PushNotificationInternal(notification *notification.Request) error {
 	m.ctrl.T.Helper()
@@ -47,3 +109,17 @@ func (mr *MockInternalManagerMockRecorder) PushNotificationInternal(notification
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PushNotificationInternal", reflect.TypeOf((*MockInternalManager)(nil).PushNotificationInternal), notification)
 }
+
+// PushNotificationsInternal mocks base method.
+func (m *MockInternalManager) PushNotificationsInternal(notifications []*notification.Request) *notification.BatchResponse {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PushNotificationsInternal", notifications)
+	ret0, _ := ret[0].(*notification.BatchResponse)
+	return ret0
+}
+
+// PushNotificationsInternal indicates an expected call of PushNotificationsInternal.
+func (mr *MockInternalManagerMockRecorder) PushNotificationsInternal(notifications interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PushNotificationsInternal", reflect.TypeOf((*MockInternalManager)(nil).PushNotificationsInternal), notifications)
+}
@@ -0,0 +1,51 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: statusevent.go
+
+// Package notificationmocks is a generated GoMock package.
+package notificationmocks
+
+import (
+	context "context"
+	reflect "reflect"
+
+	notification "github.com/despondency/notifications-service/internal/notification"
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockStatusFeed is a mock of StatusFeed interface.
+type MockStatusFeed struct {
+	ctrl     *gomock.Controller
+	recorder *MockStatusFeedMockRecorder
+}
+
+// MockStatusFeedMockRecorder is the mock recorder for MockStatusFeed.
+type MockStatusFeedMockRecorder struct {
+	mock *MockStatusFeed
+}
+
+// NewMockStatusFeed creates a new mock instance.
+func NewMockStatusFeed(ctrl *gomock.Controller) *MockStatusFeed {
+	mock := &MockStatusFeed{ctrl: ctrl}
+	mock.recorder = &MockStatusFeedMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockStatusFeed) EXPECT() *MockStatusFeedMockRecorder {
+	return m.recorder
+}
+
+// Subscribe mocks base method.
+func (m *MockStatusFeed) Subscribe(ctx context.Context, after notification.StatusCursor) (<-chan *notification.StatusFeedEvent, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Subscribe", ctx, after)
+	ret0, _ := ret[0].(<-chan *notification.StatusFeedEvent)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Subscribe indicates an expected call of Subscribe.
+func (mr *MockStatusFeedMockRecorder) Subscribe(ctx, after interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Subscribe", reflect.TypeOf((*MockStatusFeed)(nil).Subscribe), ctx, after)
+}
@@ -0,0 +1,110 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: templateendpoint.go
+
+// Package notificationmocks is a generated GoMock package.
+package notificationmocks
+
+import (
+	context "context"
+	reflect "reflect"
+
+	notification "github.com/despondency/notifications-service/internal/notification"
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockTemplateManager is a mock of TemplateManager interface.
+type MockTemplateManager struct {
+	ctrl     *gomock.Controller
+	recorder *MockTemplateManagerMockRecorder
+}
+
+// MockTemplateManagerMockRecorder is the mock recorder for MockTemplateManager.
+type MockTemplateManagerMockRecorder struct {
+	mock *MockTemplateManager
+}
+
+// NewMockTemplateManager creates a new mock instance.
+func NewMockTemplateManager(ctrl *gomock.Controller) *MockTemplateManager {
+	mock := &MockTemplateManager{ctrl: ctrl}
+	mock.recorder = &MockTemplateManagerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockTemplateManager) EXPECT() *MockTemplateManagerMockRecorder {
+	return m.recorder
+}
+
+// CreateTemplate mocks base method.
+func (m *MockTemplateManager) CreateTemplate(ctx context.Context, tenantID string, req *notification.TemplateRequest) (*notification.Template, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateTemplate", ctx, tenantID, req)
+	ret0, _ := ret[0].(*notification.Template)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateTemplate indicates an expected call of CreateTemplate.
+func (mr *MockTemplateManagerMockRecorder) CreateTemplate(ctx, tenantID, req interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateTemplate", reflect.TypeOf((*MockTemplateManager)(nil).CreateTemplate), ctx, tenantID, req)
+}
+
+// DeleteTemplate mocks base method.
+func (m *MockTemplateManager) DeleteTemplate(ctx context.Context, tenantID, name string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteTemplate", ctx, tenantID, name)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteTemplate indicates an expected call of DeleteTemplate.
+func (mr *MockTemplateManagerMockRecorder) DeleteTemplate(ctx, tenantID, name interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteTemplate", reflect.TypeOf((*MockTemplateManager)(nil).DeleteTemplate), ctx, tenantID, name)
+}
+
+// GetTemplate mocks base method.
+func (m *MockTemplateManager) GetTemplate(ctx context.Context, tenantID, name string, version int64) (*notification.Template, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTemplate", ctx, tenantID, name, version)
+	ret0, _ := ret[0].(*notification.Template)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetTemplate indicates an expected call of GetTemplate.
+func (mr *MockTemplateManagerMockRecorder) GetTemplate(ctx, tenantID, name, version interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTemplate", reflect.TypeOf((*MockTemplateManager)(nil).GetTemplate), ctx, tenantID, name, version)
+}
+
+// ListTemplates mocks base method.
+func (m *MockTemplateManager) ListTemplates(ctx context.Context, tenantID string) ([]*notification.Template, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListTemplates", ctx, tenantID)
+	ret0, _ := ret[0].([]*notification.Template)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListTemplates indicates an expected call of ListTemplates.
+func (mr *MockTemplateManagerMockRecorder) ListTemplates(ctx, tenantID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListTemplates", reflect.TypeOf((*MockTemplateManager)(nil).ListTemplates), ctx, tenantID)
+}
+
+// UpdateTemplate mocks base method.
+func (m *MockTemplateManager) UpdateTemplate(ctx context.Context, tenantID, name string, req *notification.TemplateRequest) (*notification.Template, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateTemplate", ctx, tenantID, name, req)
+	ret0, _ := ret[0].(*notification.Template)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateTemplate indicates an expected call of UpdateTemplate.
+func (mr *MockTemplateManagerMockRecorder) UpdateTemplate(ctx, tenantID, name, req interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateTemplate", reflect.TypeOf((*MockTemplateManager)(nil).UpdateTemplate), ctx, tenantID, name, req)
+}
@@ -1,32 +1,165 @@
 package notification
 
 import (
+	"fmt"
 	"github.com/google/uuid"
+	"sort"
+	"time"
 )
 
 type Notificator interface {
-	Send(txt string) error
+	// Send returns a *ProviderError to say how to retry, any other error is retryable
+	Send(notification *DelegatingNotification) error
 	Destination() Destination
 }
 
 type DelegatingNotification struct {
-	uuid uuid.UUID
-	txt  string
-	dest Destination
+	uuid      uuid.UUID
+	txt       string
+	dest      Destination
+	recipient *Recipient
+	subject   string
+	html      string
+	tenantID  string
 }
 
+func (dn *DelegatingNotification) UUID() uuid.UUID {
+	return dn.uuid
+}
+
+func (dn *DelegatingNotification) Txt() string {
+	return dn.txt
+}
+
+func (dn *DelegatingNotification) Recipient() *Recipient {
+	return dn.recipient
+}
+
+// Subject is only set for templated email notifications
+func (dn *DelegatingNotification) Subject() string {
+	return dn.subject
+}
+
+// HTML is only set for templated email notifications with a html body
+func (dn *DelegatingNotification) HTML() string {
+	return dn.html
+}
+
+func (dn *DelegatingNotification) TenantID() string {
+	return dn.tenantID
+}
+
+// DelegatingNotificator sends with the provider chain of the destination, a tenant's chains replace the default ones
 type DelegatingNotificator struct {
-	Notificators []Notificator
+	chains       map[Destination]*ProviderChain
+	tenantChains map[string]map[Destination]*ProviderChain
+	// ordered are the chains in the order they are reported in, the default ones first
+	ordered  []*ProviderChain
+	breakers []*CircuitBreaker
+}
+
+// NewDelegatingNotificator gives every provider a circuit breaker, unless breakerConfig is nil
+func NewDelegatingNotificator(providers []*Provider, tenantProviders map[string][]*Provider,
+	breakerConfig *BreakerConfig, health *HealthConfig) (*DelegatingNotificator, error) {
+	if breakerConfig != nil {
+		if err := breakerConfig.validate(); err != nil {
+			return nil, err
+		}
+	}
+	if err := health.validate(); err != nil {
+		return nil, err
+	}
+	dn := &DelegatingNotificator{tenantChains: make(map[string]map[Destination]*ProviderChain, len(tenantProviders))}
+	var err error
+	dn.chains, err = dn.newChains("", providers, breakerConfig, health)
+	if err != nil {
+		return nil, err
+	}
+	tenantIDs := make([]string, 0, len(tenantProviders))
+	for tenantID := range tenantProviders {
+		tenantIDs = append(tenantIDs, tenantID)
+	}
+	sort.Strings(tenantIDs)
+	for _, tenantID := range tenantIDs {
+		dn.tenantChains[tenantID], err = dn.newChains(tenantID, tenantProviders[tenantID], breakerConfig, health)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return dn, nil
 }
 
-func (dn *DelegatingNotificator) DelegateNotification(notification *DelegatingNotification) error {
-	for _, n := range dn.Notificators {
-		if n.Destination() == notification.dest {
-			err := n.Send(notification.txt)
-			if err != nil {
-				return err
+func (dn *DelegatingNotificator) newChains(tenantID string, providers []*Provider, breakerConfig *BreakerConfig,
+	health *HealthConfig) (map[Destination]*ProviderChain, error) {
+	byDest := make(map[Destination][]*Provider)
+	for _, p := range providers {
+		dest := p.Notificator.Destination()
+		for _, other := range byDest[dest] {
+			if other.Name == p.Name {
+				return nil, fmt.Errorf("%s provider %s is in the chain twice", dest, p.Name)
 			}
 		}
+		if breakerConfig != nil {
+			cb := NewCircuitBreaker(p.Notificator, tenantID, p.Name, breakerConfig)
+			dn.breakers = append(dn.breakers, cb)
+			p = &Provider{Name: p.Name, Weight: p.Weight, Notificator: cb}
+		}
+		byDest[dest] = append(byDest[dest], p)
+	}
+	chains := make(map[Destination]*ProviderChain, len(byDest))
+	for _, dest := range []Destination{SMS, Email, Slack} {
+		if len(byDest[dest]) == 0 {
+			continue
+		}
+		chains[dest] = newProviderChain(tenantID, dest, byDest[dest], health)
+		dn.ordered = append(dn.ordered, chains[dest])
+	}
+	return chains, nil
+}
+
+// Breakers returns the status of every breaker, the default providers' first
+func (dn *DelegatingNotificator) Breakers() []*BreakerStatus {
+	statuses := make([]*BreakerStatus, len(dn.breakers))
+	for i, cb := range dn.breakers {
+		statuses[i] = cb.Status()
+	}
+	return statuses
+}
+
+// Providers returns the health of every provider, the default ones first
+func (dn *DelegatingNotificator) Providers() []*ProviderStatus {
+	statuses := make([]*ProviderStatus, 0, len(dn.ordered))
+	for _, pc := range dn.ordered {
+		statuses = append(statuses, pc.statuses()...)
+	}
+	return statuses
+}
+
+// DelegateNotification returns the provider that delivered the notification
+func (dn *DelegatingNotificator) DelegateNotification(notification *DelegatingNotification) (string, error) {
+	if notification.recipient == nil {
+		// only notifications produced before recipients existed can get here
+		return "", ErrNoRecipient
+	}
+	chain := dn.chainFor(notification.tenantID, notification.dest)
+	if chain == nil {
+		return "", NewPermanentError(fmt.Errorf("no %s provider", notification.dest))
+	}
+	return chain.Send(notification)
+}
+
+// OpenFor returns how long until a provider of the destination takes notifications again, while every breaker is open
+func (dn *DelegatingNotificator) OpenFor(tenantID string, dest Destination) (time.Duration, bool) {
+	chain := dn.chainFor(tenantID, dest)
+	if chain == nil {
+		return 0, false
+	}
+	return chain.openFor()
+}
+
+func (dn *DelegatingNotificator) chainFor(tenantID string, dest Destination) *ProviderChain {
+	if chain, ok := dn.tenantChains[tenantID][dest]; ok {
+		return chain
 	}
-	return nil
+	return dn.chains[dest]
 }
@@ -0,0 +1,97 @@
+package notification
+
+import (
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"sync"
+)
+
+type partitionKey struct {
+	topic     string
+	partition int32
+}
+
+// offsetTracker commits a partition up to its oldest message that isn't handled yet
+type offsetTracker struct {
+	commit func([]kafka.TopicPartition) ([]kafka.TopicPartition, error)
+
+	mu        sync.Mutex
+	pending   map[partitionKey]map[kafka.Offset]bool
+	committed map[partitionKey]kafka.Offset
+}
+
+func newOffsetTracker(commit func([]kafka.TopicPartition) ([]kafka.TopicPartition, error)) *offsetTracker {
+	return &offsetTracker{
+		commit:    commit,
+		pending:   make(map[partitionKey]map[kafka.Offset]bool),
+		committed: make(map[partitionKey]kafka.Offset),
+	}
+}
+
+// track is called with every message before it is handed to a handler
+func (ot *offsetTracker) track(msg *kafka.Message) {
+	ot.mu.Lock()
+	defer ot.mu.Unlock()
+	key := partitionKey{topic: *msg.TopicPartition.Topic, partition: msg.TopicPartition.Partition}
+	if ot.pending[key] == nil {
+		ot.pending[key] = make(map[kafka.Offset]bool)
+	}
+	ot.pending[key][msg.TopicPartition.Offset] = false
+}
+
+// forget drops the partitions revoked from the consumer
+func (ot *offsetTracker) forget(tps []kafka.TopicPartition) {
+	ot.mu.Lock()
+	defer ot.mu.Unlock()
+	for _, tp := range tps {
+		key := partitionKey{topic: *tp.Topic, partition: tp.Partition}
+		delete(ot.pending, key)
+		delete(ot.committed, key)
+	}
+}
+
+// rebalanced forgets the revoked partitions, librdkafka assigns and revokes them itself
+func (ot *offsetTracker) rebalanced(_ *kafka.Consumer, ev kafka.Event) error {
+	if revoked, ok := ev.(kafka.RevokedPartitions); ok {
+		ot.forget(revoked.Partitions)
+	}
+	return nil
+}
+
+// done marks the message handled and commits its partition
+func (ot *offsetTracker) done(msg *kafka.Message) error {
+	ot.mu.Lock()
+	defer ot.mu.Unlock()
+	key := partitionKey{topic: *msg.TopicPartition.Topic, partition: msg.TopicPartition.Partition}
+	offsets := ot.pending[key]
+	if offsets == nil {
+		return nil
+	}
+	offsets[msg.TopicPartition.Offset] = true
+	next := kafka.Offset(-1)
+	for offset, handled := range offsets {
+		if !handled && (next < 0 || offset < next) {
+			next = offset
+		}
+	}
+	if next < 0 {
+		for offset := range offsets {
+			if offset+1 > next {
+				next = offset + 1
+			}
+		}
+	}
+	for offset := range offsets {
+		if offset < next {
+			delete(offsets, offset)
+		}
+	}
+	if committed, ok := ot.committed[key]; ok && next <= committed {
+		return nil
+	}
+	_, err := ot.commit([]kafka.TopicPartition{{Topic: msg.TopicPartition.Topic, Partition: key.partition, Offset: next}})
+	if err != nil {
+		return err
+	}
+	ot.committed[key] = next
+	return nil
+}
@@ -0,0 +1,53 @@
+package notification
+
+import (
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Offset tracker", func() {
+
+	var (
+		topic     = "notifications"
+		committed []kafka.Offset
+		ot        *offsetTracker
+	)
+
+	msg := func(offset kafka.Offset) *kafka.Message {
+		return &kafka.Message{TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: 3, Offset: offset}}
+	}
+
+	BeforeEach(func() {
+		committed = nil
+		ot = newOffsetTracker(func(tps []kafka.TopicPartition) ([]kafka.TopicPartition, error) {
+			Expect(tps).To(HaveLen(1))
+			Expect(tps[0].Partition).To(Equal(int32(3)))
+			committed = append(committed, tps[0].Offset)
+			return tps, nil
+		})
+		for _, offset := range []kafka.Offset{10, 11, 12} {
+			ot.track(msg(offset))
+		}
+	})
+
+	It("should commit up to the oldest message still being handled", func() {
+		Expect(ot.done(msg(11))).To(Succeed())
+		Expect(ot.done(msg(10))).To(Succeed())
+		Expect(committed).To(Equal([]kafka.Offset{10, 12}))
+		Expect(ot.done(msg(12))).To(Succeed())
+		Expect(committed).To(Equal([]kafka.Offset{10, 12, 13}))
+	})
+
+	It("should never commit past a message that wasn't handled", func() {
+		Expect(ot.done(msg(11))).To(Succeed())
+		Expect(ot.done(msg(12))).To(Succeed())
+		Expect(committed).To(Equal([]kafka.Offset{10}))
+	})
+
+	It("should forget revoked partitions", func() {
+		ot.forget([]kafka.TopicPartition{{Topic: &topic, Partition: 3}})
+		Expect(ot.done(msg(12))).To(Succeed())
+		Expect(committed).To(BeEmpty())
+	})
+})
@@ -3,117 +3,495 @@ package notification
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/cockroachdb/cockroach-go/v2/crdb/crdbpgx"
 	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/despondency/notifications-service/internal/messaging"
 	"github.com/jackc/pgx/v4"
 	"github.com/rs/zerolog/log"
 	"go.uber.org/atomic"
+	"time"
 )
 
+const lagTimeoutMs = 5000
+
+var ErrMalformedMessage = fmt.Errorf("malformed outstanding message")
+
+type msgHandler func(ctx context.Context, msg *kafka.Message) error
+
+// DeadLetterQueue gets a message once it failed MaxAttempts times, RetryBackoff grows linearly between them
+type DeadLetterQueue struct {
+	Producer     *messaging.KafkaProducer
+	MaxAttempts  int
+	RetryBackoff time.Duration
+}
+
 type OutstandingService struct {
 	notificator *DelegatingNotificator
-	consumer    *kafka.Consumer
-	persistence *CRDBPersistence
-	stopped     *atomic.Bool
-	maxRoutines int
+	capper      *FrequencyCapper
+	deadLetters *DeadLetterQueue
+	retries     *RetryQueue
+	// expireAfter is how long past due a notification is still dispatched, 0 never expires it
+	expireAfter time.Duration
+	consumers   []*laneConsumer
+	// retryConsumers consume the retry tiers, each in its own loop
+	retryConsumers []*retryConsumer
+	persistence    *CRDBPersistence
+	stopped        *atomic.Bool
+	// stopping is closed by Stop, so handlers backing off give up at once
+	stopping chan struct{}
+	done     chan struct{}
+	maxReq   chan struct{}
 }
 
+// NewOutstandingService takes the lanes from the most urgent
 func NewOutstandingService(
-	bootstrapServers, outstandingGroupID, autoResetOffset, enableAutoCommit, outstandingNotificationsTopic string, persistence *CRDBPersistence,
-	notificator *DelegatingNotificator, maxRoutines int) (*OutstandingService, error) {
-	consumer, err := kafka.NewConsumer(&kafka.ConfigMap{
-		"bootstrap.servers":  bootstrapServers,
-		"group.id":           outstandingGroupID,
-		"auto.offset.reset":  autoResetOffset,
-		"enable.auto.commit": enableAutoCommit})
-	if err != nil {
-		return nil, err
+	bootstrapServers, outstandingGroupID, autoResetOffset, enableAutoCommit string, lanes []*Lane, persistence *CRDBPersistence,
+	notificator *DelegatingNotificator, capper *FrequencyCapper, deadLetters *DeadLetterQueue, retries *RetryQueue,
+	expireAfter time.Duration, maxRoutines int, lagReportInterval time.Duration) (*OutstandingService, error) {
+	if deadLetters.MaxAttempts < 1 {
+		return nil, fmt.Errorf("dead letter max attempts must be at least 1, got %d", deadLetters.MaxAttempts)
 	}
-	err = consumer.Subscribe(outstandingNotificationsTopic, nil)
-	if err != nil {
-		return nil, err
+	if retries.MaxAttempts < 1 || retries.MaxCircuitOpen < 0 {
+		return nil, fmt.Errorf("retry max attempts must be at least 1 and max circuit open at least 0, got %d and %d",
+			retries.MaxAttempts, retries.MaxCircuitOpen)
+	}
+	for _, tier := range retries.Tiers {
+		if _, ok := retries.Producers[tier.Topic]; !ok {
+			return nil, fmt.Errorf("no producer for the %s retry tier", tier.Topic)
+		}
+	}
+	consumers := make([]*laneConsumer, 0, len(lanes))
+	for _, lane := range lanes {
+		consumer, err := kafka.NewConsumer(&kafka.ConfigMap{
+			"bootstrap.servers":  bootstrapServers,
+			"group.id":           laneGroupID(outstandingGroupID, lane.Priority),
+			"auto.offset.reset":  autoResetOffset,
+			"enable.auto.commit": enableAutoCommit})
+		if err != nil {
+			return nil, err
+		}
+		offsets := newOffsetTracker(consumer.CommitOffsets)
+		err = consumer.Subscribe(lane.Topic, offsets.rebalanced)
+		if err != nil {
+			return nil, err
+		}
+		consumers = append(consumers, &laneConsumer{lane: lane, consumer: consumer, offsets: offsets})
+	}
+	retryConsumers := make([]*retryConsumer, 0, len(retries.Tiers))
+	for _, tier := range retries.Tiers {
+		consumer, err := kafka.NewConsumer(&kafka.ConfigMap{
+			"bootstrap.servers":  bootstrapServers,
+			"group.id":           outstandingGroupID + "-retry-" + tierName(tier.Delay),
+			"auto.offset.reset":  autoResetOffset,
+			"enable.auto.commit": enableAutoCommit})
+		if err != nil {
+			return nil, err
+		}
+		offsets := newOffsetTracker(consumer.CommitOffsets)
+		err = consumer.Subscribe(tier.Topic, offsets.rebalanced)
+		if err != nil {
+			return nil, err
+		}
+		retryConsumers = append(retryConsumers, &retryConsumer{
+			tier:     tier,
+			consumer: consumer,
+			offsets:  offsets,
+			paused:   make(map[int32]*pausedPartition),
+			done:     make(chan struct{}),
+		})
 	}
 	ous := &OutstandingService{
-		consumer:    consumer,
-		persistence: persistence,
-		notificator: notificator,
-		maxRoutines: maxRoutines,
-		stopped:     atomic.NewBool(false),
+		consumers:      consumers,
+		retryConsumers: retryConsumers,
+		persistence:    persistence,
+		notificator:    notificator,
+		capper:         capper,
+		deadLetters:    deadLetters,
+		retries:        retries,
+		expireAfter:    expireAfter,
+		maxReq:         make(chan struct{}, maxRoutines),
+		stopped:        atomic.NewBool(false),
+		stopping:       make(chan struct{}),
+		done:           make(chan struct{}),
 	}
 	ous.consumeNotificationOutstanding()
+	for _, rc := range retryConsumers {
+		ous.consumeRetries(rc)
+	}
+	ous.reportLag(lagReportInterval)
 	return ous, nil
 }
 
 func (ous *OutstandingService) Stop() {
 	ous.stopped.Store(true)
-	_, err := ous.consumer.Commit()
-	if err != nil {
-		log.Err(err).Msg("could not commit consumer while stopping in outstanding notifications")
+	close(ous.stopping)
+	// the poll loops must be out of the consumers before they are closed
+	<-ous.done
+	for _, rc := range ous.retryConsumers {
+		<-rc.done
 	}
-	err = ous.consumer.Close()
-	if err != nil {
-		log.Err(err).Msg("could not close consumer while stopping in outstanding notifications")
+	// and so must the handlers, taking every routine slot waits for them to return
+	for i := 0; i < cap(ous.maxReq); i++ {
+		ous.maxReq <- struct{}{}
+	}
+	// handled messages are committed as they are, a commit here would take the unhandled ones along
+	for _, rc := range ous.retryConsumers {
+		err := rc.consumer.Close()
+		if err != nil {
+			log.Err(err).Str("topic", rc.tier.Topic).Msg("could not close retry consumer while stopping in outstanding notifications")
+		}
+	}
+	for _, lc := range ous.consumers {
+		err := lc.consumer.Close()
+		if err != nil {
+			log.Err(err).Str("lane", string(lc.lane.Priority)).
+				Msg("could not close consumer while stopping in outstanding notifications")
+		}
+	}
+}
+
+// Lag returns the lag of every lane, in priority order
+func (ous *OutstandingService) Lag() ([]*LaneLag, error) {
+	lags := make([]*LaneLag, len(ous.consumers))
+	for i, lc := range ous.consumers {
+		lag, err := lc.lag(lagTimeoutMs)
+		if err != nil {
+			return nil, err
+		}
+		lags[i] = &LaneLag{Priority: lc.lane.Priority, Topic: lc.lane.Topic, Lag: lag}
 	}
+	return lags, nil
 }
+
+// consumeNotificationOutstanding polls the lanes in weighted rounds, up to weight messages from each lane in priority order
 func (ous *OutstandingService) consumeNotificationOutstanding() {
-	maxReq := make(chan struct{}, ous.maxRoutines)
 	go func() {
+		defer close(ous.done)
 		for ous.stopped.Load() == false {
-			ev := ous.consumer.Poll(100) // release CPU quota 100ms
-			switch e := ev.(type) {
-			case *kafka.Message:
-				maxReq <- struct{}{}
-				go func() {
-					ctx := context.Background()
-					defer func() {
-						<-maxReq
-					}()
-					err := ous.handleMsg(ctx, e)
-					if err != nil {
-						log.Err(err).Msg("could not handle msg in outstanding service")
-						return
+			polled := 0
+			for _, lc := range ous.consumers {
+				for i := 0; i < lc.lane.Weight; i++ {
+					if !ous.dispatch(lc, 0) {
+						break
 					}
-				}()
-			case kafka.Error:
-				log.Err(e).Msg("kafka produced an error in outstanding service")
-			default:
+					polled++
+				}
+			}
+			if polled == 0 {
+				// every lane is drained, wait on the most urgent one
+				ous.dispatch(ous.consumers[0], 100) // release CPU quota 100ms
 			}
 		}
 	}()
 }
 
+// dispatch hands a polled message to a routine, it returns whether there was one
+func (ous *OutstandingService) dispatch(lc *laneConsumer, timeoutMs int) bool {
+	ev := lc.consumer.Poll(timeoutMs)
+	switch e := ev.(type) {
+	case *kafka.Message:
+		ous.handleAsync(lc.offsets, e, ous.handleMsg, "lane", string(lc.lane.Priority))
+		return true
+	case kafka.Error:
+		log.Err(e).Str("lane", string(lc.lane.Priority)).Msg("kafka produced an error in outstanding service")
+	default:
+	}
+	return false
+}
+
+// handleAsync handles the message in a routine, source names where it was read from in logs
+func (ous *OutstandingService) handleAsync(offsets *offsetTracker, msg *kafka.Message, handler msgHandler, sourceKey, source string) {
+	offsets.track(msg)
+	ous.async(func() {
+		err := ous.handle(context.Background(), offsets, msg, handler)
+		if err != nil {
+			log.Err(err).Str(sourceKey, source).Msg("could not handle msg in outstanding service")
+		}
+	})
+}
+
+// async runs f in a routine once there are less than maxRoutines of them, Stop waits for it
+func (ous *OutstandingService) async(f func()) {
+	ous.maxReq <- struct{}{}
+	go func() {
+		defer func() {
+			<-ous.maxReq
+		}()
+		f()
+	}()
+}
+
+func (ous *OutstandingService) reportLag(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for ous.stopped.Load() == false {
+			<-ticker.C
+			if ous.stopped.Load() {
+				return
+			}
+			lags, err := ous.Lag()
+			if err != nil {
+				log.Err(err).Msg("could not get lag in outstanding service")
+				continue
+			}
+			for _, l := range lags {
+				log.Info().Str("lane", string(l.Priority)).Str("topic", l.Topic).Int64("lag", l.Lag).Msg("outstanding lane lag")
+			}
+		}
+	}()
+}
+
+// handle retries a failed message and dead letters it once it is out of attempts, its partition isn't committed past it until then
+func (ous *OutstandingService) handle(ctx context.Context, offsets *offsetTracker, msg *kafka.Message, handler msgHandler) error {
+	var err error
+	attempts := 0
+	for attempts < ous.deadLetters.MaxAttempts {
+		attempts++
+		err = handler(ctx, msg)
+		if err == nil || errors.Is(err, ErrMalformedMessage) {
+			break
+		}
+		if ous.stopped.Load() {
+			return err
+		}
+		if attempts < ous.deadLetters.MaxAttempts {
+			log.Warn().Err(err).Int("attempt", attempts).Msg("retrying msg in outstanding service")
+			if !ous.backoff(time.Duration(attempts) * ous.deadLetters.RetryBackoff) {
+				return err
+			}
+		}
+	}
+	if err == nil {
+		commit(offsets, msg)
+		return nil
+	}
+	dl := messaging.NewDeadLetter(msg, err, attempts)
+	errProduce := ous.deadLetters.Producer.ProduceMessage(msg.Key, msg.Value, dl.Headers(msg.Headers))
+	if errProduce != nil {
+		return fmt.Errorf("could not dead letter msg failing with %v: %w", err, errProduce)
+	}
+	log.Error().Err(err).Str("topic", dl.Topic).Int32("partition", dl.Partition).Int64("offset", dl.Offset).
+		Int("attempts", attempts).Msg("dead lettered msg in outstanding service")
+	commit(offsets, msg)
+	return nil
+}
+
+// commit only logs a failed commit, a later one of the partition covers the message
+func commit(offsets *offsetTracker, msg *kafka.Message) {
+	if err := offsets.done(msg); err != nil {
+		log.Err(err).Str("topic", *msg.TopicPartition.Topic).Msg("failed to commit outstanding message")
+	}
+}
+
+// backoff waits d, it returns false as soon as the service stops
+func (ous *OutstandingService) backoff(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ous.stopping:
+		return false
+	}
+}
+
 func (ous *OutstandingService) handleMsg(ctx context.Context, msg *kafka.Message) error {
 	var serverNotification *Notification
 	errUnmarshall := json.Unmarshal(msg.Value, &serverNotification)
+	if errUnmarshall == nil && serverNotification == nil {
+		errUnmarshall = fmt.Errorf("null notification")
+	}
 	if errUnmarshall != nil {
-		return errUnmarshall
+		return fmt.Errorf("%w: %v", ErrMalformedMessage, errUnmarshall)
 	}
+	var (
+		conflicting bool
+		dispatching *DelegatingNotification
+		parkFor     time.Duration
+	)
 	err := crdbpgx.ExecuteTx(ctx, ous.persistence.GetPool(), pgx.TxOptions{}, func(tx pgx.Tx) error {
+		dispatching, parkFor = nil, 0
 		affected, err := ous.persistence.InsertIfNotExists(ctx, serverNotification, tx)
 		if err != nil {
 			return err
 		}
+		if affected == 0 {
+			// a retry with the same payload is an idempotent success, a different payload is a client bug
+			conflicting, err = ous.persistence.RecordIfConflicting(ctx, serverNotification, tx)
+			if err != nil || conflicting {
+				return err
+			}
+			dispatching, parkFor, err = ous.resume(ctx, serverNotification, tx)
+			return err
+		}
 		if affected == 1 {
 			// it's a new notification
-			// delegate it
-			// on err the ExecuteTx will rollback, and retry later from the log because we won't commit the msg
-			err = ous.notificator.DelegateNotification(&DelegatingNotification{
-				uuid: serverNotification.UUID,
-				txt:  serverNotification.NotificationTxt,
-				dest: serverNotification.Dest,
-			})
+			cancelled, err := ous.persistence.IsCancelled(ctx, serverNotification, tx)
 			if err != nil {
-				return err // this is non retryable so we will rollback
+				return err
 			}
+			if cancelled {
+				// the cancellation arrived before the notification did
+				return ous.persistence.Transition(ctx, serverNotification, StateCancelled, TransitionOpts{}, tx)
+			}
+			if serverNotification.SendAt != nil && serverNotification.SendAt.After(time.Now()) {
+				// park it in the db so the partition keeps moving, the scheduler releases it when due
+				err = ous.persistence.Schedule(ctx, serverNotification, tx)
+				if err != nil {
+					return err
+				}
+				return ous.persistence.Transition(ctx, serverNotification, StateScheduled, TransitionOpts{}, tx)
+			}
+			if wait, open := ous.circuitOpen(serverNotification); open {
+				// stored as received and parked once committed, nothing would take it now
+				parkFor = wait
+				return nil
+			}
+			// on err the ExecuteTx will rollback, and retry later from the log because we won't commit the msg
+			dispatching, err = ous.prepare(ctx, serverNotification, tx)
+			return err
 		}
 		return nil
 	})
-	// if there is no error, commit the msg
-	if err == nil {
-		_, err = ous.consumer.CommitMessage(msg)
+	if err == nil && conflicting {
+		log.Warn().Err(ErrConflictingReuse).Str("uuid", serverNotification.UUID.String()).
+			Msg("rejected conflicting duplicate in outstanding service")
+	}
+	if err == nil && dispatching != nil {
+		err = ous.deliver(ctx, serverNotification, dispatching, 1, 0)
+	}
+	if err == nil && parkFor > 0 {
+		// if it can't be parked the redelivered msg finds it received and parks it again
+		err = ous.park(&RetryMessage{
+			UUID:        serverNotification.UUID,
+			TenantID:    tenantOrDefault(serverNotification.TenantID),
+			Destination: serverNotification.Dest.String(),
+			Attempt:     1,
+		}, parkFor)
+	}
+	return err
+}
+
+// resume dispatches a redelivered message whose outcome was never recorded, it may be sent twice but is never lost.
+// One still received is parked again
+func (ous *OutstandingService) resume(ctx context.Context, serverNotification *Notification, tx pgx.Tx) (*DelegatingNotification,
+	time.Duration, error) {
+	stored, err := ous.persistence.Get(ctx, tenantOrDefault(serverNotification.TenantID), serverNotification.UUID, tx)
+	if err != nil || (stored.State != StateDispatching && stored.State != StateReceived) {
+		return nil, 0, err
+	}
+	if wait, open := ous.circuitOpen(stored); open && stored.State == StateReceived {
+		return nil, wait, nil
+	}
+	dn, err := ous.prepare(ctx, stored, tx)
+	return dn, 0, err
+}
+
+// circuitOpen returns how long to park a notification while every breaker of its destination is open
+func (ous *OutstandingService) circuitOpen(serverNotification *Notification) (time.Duration, bool) {
+	if ous.retries.MaxCircuitOpen == 0 {
+		return 0, false
+	}
+	return ous.notificator.OpenFor(tenantOrDefault(serverNotification.TenantID), serverNotification.Dest)
+}
+
+// prepare moves the notification to dispatching, nil when it was suppressed, failed or expired instead.
+// The notificator is only called once its transaction committed
+func (ous *OutstandingService) prepare(ctx context.Context, serverNotification *Notification, tx pgx.Tx) (*DelegatingNotification, error) {
+	if serverNotification.State != StateDispatching {
+		if serverNotification.expired(ous.expireAfter, time.Now()) {
+			// scheduled sends released late and retries that kept failing are stale by now
+			log.Info().Str("uuid", serverNotification.UUID.String()).Msg("expired notification")
+			return nil, ous.persistence.Transition(ctx, serverNotification, StateExpired, TransitionOpts{}, tx)
+		}
+		err := ous.persistence.Transition(ctx, serverNotification, StateDispatching, TransitionOpts{}, tx)
 		if err != nil {
-			log.Err(err).Msg("failed to commit outstanding message")
+			return nil, err
 		}
 	}
-	return err
+	if serverNotification.Recipient == nil {
+		// only notifications produced before recipients existed get here, no attempt would ever deliver them
+		log.Warn().Err(ErrNoRecipient).Str("uuid", serverNotification.UUID.String()).Msg("failed notification")
+		return nil, ous.persistence.Transition(ctx, serverNotification, StateFailed, TransitionOpts{Reason: ErrNoRecipient.Error()}, tx)
+	}
+	reason, err := ous.capper.overCap(ctx, serverNotification, tx)
+	if err != nil {
+		return nil, err
+	}
+	if reason != "" {
+		log.Info().Str("uuid", serverNotification.UUID.String()).Str("reason", reason).Msg("suppressed notification")
+		return nil, ous.persistence.Transition(ctx, serverNotification, StateSuppressed, TransitionOpts{Reason: reason}, tx)
+	}
+	dn := &DelegatingNotification{
+		uuid:      serverNotification.UUID,
+		txt:       serverNotification.NotificationTxt,
+		dest:      serverNotification.Dest,
+		recipient: serverNotification.Recipient,
+		tenantID:  tenantOrDefault(serverNotification.TenantID),
+	}
+	if serverNotification.TemplateID != "" {
+		rendered, err := ous.render(ctx, serverNotification, tx)
+		if errors.Is(err, ErrRender) {
+			log.Warn().Err(err).Str("uuid", serverNotification.UUID.String()).Msg("failed notification")
+			return nil, ous.persistence.Transition(ctx, serverNotification, StateFailed, TransitionOpts{Reason: err.Error()}, tx)
+		}
+		if err != nil {
+			return nil, err
+		}
+		dn.txt = rendered.Txt
+		dn.subject = rendered.Subject
+		dn.html = rendered.HTML
+	}
+	return dn, nil
+}
+
+// deliver hands a dispatching notification to its notificator and records the outcome, attempts count from 1.
+// A refusal by an open breaker doesn't use the attempt up, unless it was parked MaxCircuitOpen times already
+func (ous *OutstandingService) deliver(ctx context.Context, serverNotification *Notification, dn *DelegatingNotification,
+	attempt, circuitOpen int) error {
+	provider, err := ous.notificator.DelegateNotification(dn)
+	to, opts := StateDelivered, TransitionOpts{Provider: provider}
+	if err != nil {
+		pe := toProviderError(err)
+		if errors.Is(err, ErrCircuitOpen) && circuitOpen < ous.retries.MaxCircuitOpen {
+			return ous.retry(ctx, serverNotification, ous.retries.tier(1, pe), attempt, circuitOpen+1, pe)
+		}
+		if pe.Kind != Permanent && attempt < ous.retries.MaxAttempts {
+			return ous.retry(ctx, serverNotification, ous.retries.tier(attempt, pe), attempt+1, circuitOpen, pe)
+		}
+		to, opts = StateFailed, TransitionOpts{Reason: pe.Error()}
+		if pe.Kind != Permanent {
+			opts.Reason = fmt.Sprintf("gave up after %d attempts: %s", attempt, opts.Reason)
+		}
+		log.Warn().Err(err).Str("uuid", serverNotification.UUID.String()).Msg("failed notification")
+	}
+	return crdbpgx.ExecuteTx(ctx, ous.persistence.GetPool(), pgx.TxOptions{}, func(tx pgx.Tx) error {
+		return ous.persistence.Transition(ctx, serverNotification, to, opts, tx)
+	})
+}
+
+// render renders the destination variant of the notification template with its params
+func (ous *OutstandingService) render(ctx context.Context, serverNotification *Notification, tx pgx.Tx) (*RenderedContent, error) {
+	t, err := ous.persistence.GetTemplate(ctx, tenantOrDefault(serverNotification.TenantID), serverNotification.TemplateID, serverNotification.TemplateVersion, tx)
+	if err == ErrTemplateNotFound {
+		return nil, fmt.Errorf("%w: template %s: %v", ErrRender, serverNotification.TemplateID, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	variant := t.Variant(serverNotification.Dest)
+	if variant == nil {
+		return nil, fmt.Errorf("%w: template %s version %d: %v %s", ErrRender, t.Name, t.Version, ErrNoVariant, serverNotification.Dest)
+	}
+	rendered, err := variant.Render(serverNotification.Params)
+	if err != nil {
+		return nil, fmt.Errorf("%w: template %s version %d: %v", ErrRender, t.Name, t.Version, err)
+	}
+	return rendered, nil
 }
@@ -0,0 +1,36 @@
+package notification
+
+import (
+	"context"
+	"fmt"
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/atomic"
+	"time"
+)
+
+var _ = Describe("Outstanding message handling", func() {
+
+	It("should stop backing off as soon as the service stops", func() {
+		ous := &OutstandingService{
+			deadLetters: &DeadLetterQueue{MaxAttempts: 3, RetryBackoff: time.Hour},
+			stopped:     atomic.NewBool(false),
+			stopping:    make(chan struct{}),
+		}
+		calls := atomic.NewInt32(0)
+		failing := func(context.Context, *kafka.Message) error {
+			calls.Inc()
+			return fmt.Errorf("connection refused")
+		}
+		handled := make(chan error, 1)
+		go func() {
+			handled <- ous.handle(context.Background(), nil, &kafka.Message{}, failing)
+		}()
+		Eventually(calls.Load).Should(Equal(int32(1)))
+		ous.stopped.Store(true)
+		close(ous.stopping)
+		Eventually(handled).Should(Receive(MatchError("connection refused")))
+		Expect(calls.Load()).To(Equal(int32(1)))
+	})
+})
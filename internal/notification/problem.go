@@ -0,0 +1,131 @@
+package notification
+
+import (
+	"encoding/json"
+	"github.com/rs/zerolog/log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	problemContentType = "application/problem+json"
+
+	ProblemTypeMalformedRequest = "/problems/malformed-request"
+	ProblemTypeValidation       = "/problems/validation-failed"
+	ProblemTypeNotFound         = "/problems/not-found"
+	ProblemTypeTooLarge         = "/problems/too-large"
+	ProblemTypeConflict         = "/problems/conflict"
+	ProblemTypeUnauthorized     = "/problems/unauthorized"
+	ProblemTypeRateLimited      = "/problems/rate-limited"
+	ProblemTypeInternal         = "/problems/internal"
+)
+
+// Problem is a RFC 7807 problem details body
+type Problem struct {
+	Type          string        `json:"type"`
+	Title         string        `json:"title"`
+	Status        int           `json:"status"`
+	Detail        string        `json:"detail,omitempty"`
+	Instance      string        `json:"instance,omitempty"`
+	InvalidParams []*FieldError `json:"invalid-params,omitempty"`
+}
+
+func writeProblem(w http.ResponseWriter, r *http.Request, p *Problem) {
+	if p.Title == "" {
+		p.Title = http.StatusText(p.Status)
+	}
+	p.Instance = r.URL.Path
+	b, err := json.Marshal(p)
+	if err != nil {
+		log.Err(err).Msg("error while marshalling problem")
+		w.WriteHeader(p.Status)
+		return
+	}
+	w.Header().Set("Content-Type", problemContentType)
+	w.WriteHeader(p.Status)
+	_, err = w.Write(b)
+	if err != nil {
+		log.Err(err).Msg("error while writing problem")
+	}
+}
+
+// writeRateLimited answers 429 with the whole seconds until the limit has room again
+func writeRateLimited(w http.ResponseWriter, r *http.Request, rle *RateLimitError) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(rle.RetryAfter.Seconds()))))
+	writeProblem(w, r, &Problem{
+		Type:   ProblemTypeRateLimited,
+		Status: http.StatusTooManyRequests,
+		Detail: rle.Error(),
+	})
+}
+
+func malformedProblem(err error) *Problem {
+	p := &Problem{
+		Type:   ProblemTypeMalformedRequest,
+		Status: http.StatusBadRequest,
+		Detail: err.Error(),
+	}
+	// encoding/json has no typed error for unknown fields
+	if field := strings.TrimPrefix(err.Error(), "json: unknown field "); field != err.Error() {
+		p.InvalidParams = []*FieldError{{Name: strings.Trim(field, `"`), Reason: "unknown field"}}
+	}
+	return p
+}
+
+func validationProblem(ve *ValidationError) *Problem {
+	return &Problem{
+		Type:          ProblemTypeValidation,
+		Title:         "Request validation failed",
+		Status:        http.StatusUnprocessableEntity,
+		InvalidParams: ve.Fields,
+	}
+}
+
+func invalidUUIDProblem(name string) *Problem {
+	return &Problem{
+		Type:          ProblemTypeMalformedRequest,
+		Status:        http.StatusBadRequest,
+		InvalidParams: []*FieldError{{Name: name, Reason: "must be a valid uuid"}},
+	}
+}
+
+func notFoundProblem(err error) *Problem {
+	return &Problem{
+		Type:   ProblemTypeNotFound,
+		Status: http.StatusNotFound,
+		Detail: err.Error(),
+	}
+}
+
+func unauthorizedProblem(err error) *Problem {
+	return &Problem{
+		Type:   ProblemTypeUnauthorized,
+		Status: http.StatusUnauthorized,
+		Detail: err.Error(),
+	}
+}
+
+func conflictProblem(err error) *Problem {
+	return &Problem{
+		Type:   ProblemTypeConflict,
+		Status: http.StatusConflict,
+		Detail: err.Error(),
+	}
+}
+
+func tooLargeProblem(err error) *Problem {
+	return &Problem{
+		Type:   ProblemTypeTooLarge,
+		Status: http.StatusRequestEntityTooLarge,
+		Detail: err.Error(),
+	}
+}
+
+func internalProblem() *Problem {
+	return &Problem{
+		Type:   ProblemTypeInternal,
+		Status: http.StatusInternalServerError,
+	}
+}
@@ -0,0 +1,235 @@
+package notification
+
+import (
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Provider is one of the notificators of a destination, Weight is its share of first tries
+type Provider struct {
+	Name        string
+	Weight      int
+	Notificator Notificator
+}
+
+// ParseProviders reads a chain like primary,backup, or a weighted one like vendor-a:3,vendor-b:1
+func ParseProviders(entries []string, newNotificator func(name string) Notificator) ([]*Provider, error) {
+	providers := make([]*Provider, 0, len(entries))
+	names := make(map[string]struct{}, len(entries))
+	weighted := 0
+	for _, entry := range entries {
+		name, w, hasWeight := strings.Cut(strings.TrimSpace(entry), ":")
+		if name == "" {
+			return nil, fmt.Errorf("provider %q has no name", entry)
+		}
+		if _, ok := names[name]; ok {
+			return nil, fmt.Errorf("provider %s is in the chain twice", name)
+		}
+		names[name] = struct{}{}
+		p := &Provider{Name: name, Notificator: newNotificator(name)}
+		if hasWeight {
+			weight, err := strconv.Atoi(w)
+			if err != nil || weight < 1 {
+				return nil, fmt.Errorf("provider %s must have a positive weight, got %q", name, w)
+			}
+			p.Weight = weight
+			weighted++
+		}
+		providers = append(providers, p)
+	}
+	if weighted > 0 && weighted < len(providers) {
+		return nil, fmt.Errorf("either every provider of %v has a weight or none does", entries)
+	}
+	return providers, nil
+}
+
+// HealthConfig scores providers, every call moves its score Decay of the way to 1 or 0.
+// A provider under DemoteBelow is tried last for DemoteFor
+type HealthConfig struct {
+	Decay       float64
+	DemoteBelow float64
+	DemoteFor   time.Duration
+}
+
+func (c *HealthConfig) validate() error {
+	if c.Decay <= 0 || c.Decay > 1 || c.DemoteBelow < 0 || c.DemoteBelow >= 1 || c.DemoteFor < 0 {
+		return fmt.Errorf("provider health decay must be in (0, 1] and demote below in [0, 1), got %v and %v", c.Decay, c.DemoteBelow)
+	}
+	return nil
+}
+
+// ProviderStatus is what the admin endpoint reports of a provider, tenant is empty for the default providers
+type ProviderStatus struct {
+	TenantID     string     `json:"tenant_id,omitempty"`
+	Destination  string     `json:"destination"`
+	Provider     string     `json:"provider"`
+	Weight       int        `json:"weight,omitempty"`
+	Score        float64    `json:"score"`
+	DemotedUntil *time.Time `json:"demoted_until,omitempty"`
+}
+
+type chainLink struct {
+	*Provider
+	score        float64
+	demotedUntil time.Time
+}
+
+// ProviderChain sends with the first provider that takes the notification, demoted ones last
+type ProviderChain struct {
+	tenantID string
+	dest     Destination
+	health   *HealthConfig
+	weighted bool
+	now      func() time.Time
+	intn     func(n int) int
+
+	mu    sync.Mutex
+	links []*chainLink
+}
+
+func newProviderChain(tenantID string, dest Destination, providers []*Provider, health *HealthConfig) *ProviderChain {
+	pc := &ProviderChain{
+		tenantID: tenantID,
+		dest:     dest,
+		health:   health,
+		now:      time.Now,
+		intn:     rand.Intn,
+		links:    make([]*chainLink, len(providers)),
+	}
+	for i, p := range providers {
+		pc.links[i] = &chainLink{Provider: p, score: 1}
+		pc.weighted = pc.weighted || p.Weight > 0
+	}
+	if pc.weighted {
+		sort.SliceStable(pc.links, func(i, j int) bool {
+			return pc.links[i].Weight > pc.links[j].Weight
+		})
+	}
+	return pc
+}
+
+// Send returns the provider that took the notification, a permanent error ends the chain.
+// Otherwise it returns an error that reached a provider, unless every breaker was open
+func (pc *ProviderChain) Send(notification *DelegatingNotification) (string, error) {
+	var refused error
+	for _, l := range pc.order() {
+		err := l.Notificator.Send(notification)
+		if err == nil {
+			pc.report(l, true)
+			return l.Name, nil
+		}
+		if toProviderError(err).Kind == Permanent {
+			return "", fmt.Errorf("%s: %w", l.Name, err)
+		}
+		if !errors.Is(err, ErrCircuitOpen) {
+			pc.report(l, false)
+		}
+		log.Warn().Err(err).Str("uuid", notification.UUID().String()).Str("provider", l.Name).
+			Msg("provider refused notification")
+		if refused == nil || (errors.Is(refused, ErrCircuitOpen) && !errors.Is(err, ErrCircuitOpen)) {
+			refused = fmt.Errorf("%s: %w", l.Name, err)
+		}
+	}
+	return "", refused
+}
+
+// openFor returns how long until the first breaker of the chain half-opens while every provider's is open
+func (pc *ProviderChain) openFor() (time.Duration, bool) {
+	var first time.Duration
+	for _, l := range pc.links {
+		cb, ok := l.Notificator.(*CircuitBreaker)
+		if !ok {
+			return 0, false
+		}
+		wait, open := cb.openFor()
+		if !open {
+			return 0, false
+		}
+		if first == 0 || wait < first {
+			first = wait
+		}
+	}
+	return first, len(pc.links) > 0
+}
+
+func (pc *ProviderChain) order() []*chainLink {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	now := pc.now()
+	healthy := make([]*chainLink, 0, len(pc.links))
+	demoted := make([]*chainLink, 0)
+	for _, l := range pc.links {
+		if now.Before(l.demotedUntil) {
+			demoted = append(demoted, l)
+		} else {
+			healthy = append(healthy, l)
+		}
+	}
+	if pc.weighted && len(healthy) > 1 {
+		total := 0
+		for _, l := range healthy {
+			total += l.Weight
+		}
+		pick := pc.intn(total)
+		for i, l := range healthy {
+			if pick < l.Weight {
+				copy(healthy[1:i+1], healthy[:i])
+				healthy[0] = l
+				break
+			}
+			pick -= l.Weight
+		}
+	}
+	sort.SliceStable(demoted, func(i, j int) bool {
+		return demoted[i].score > demoted[j].score
+	})
+	return append(healthy, demoted...)
+}
+
+// report scores the call, a demoted provider that recovered while it was tried last is promoted back
+func (pc *ProviderChain) report(l *chainLink, ok bool) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	target := 0.0
+	if ok {
+		target = 1
+	}
+	l.score += pc.health.Decay * (target - l.score)
+	now := pc.now()
+	switch {
+	case ok && l.score >= pc.health.DemoteBelow:
+		l.demotedUntil = time.Time{}
+	case !ok && l.score < pc.health.DemoteBelow && !now.Before(l.demotedUntil):
+		l.demotedUntil = now.Add(pc.health.DemoteFor)
+		log.Warn().Str("provider", l.Name).Str("destination", pc.dest.String()).Float64("score", l.score).
+			Msg("demoted provider")
+	}
+}
+
+func (pc *ProviderChain) statuses() []*ProviderStatus {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	now := pc.now()
+	statuses := make([]*ProviderStatus, len(pc.links))
+	for i, l := range pc.links {
+		statuses[i] = &ProviderStatus{
+			TenantID:    pc.tenantID,
+			Destination: pc.dest.String(),
+			Provider:    l.Name,
+			Weight:      l.Weight,
+			Score:       l.score,
+		}
+		if now.Before(l.demotedUntil) {
+			demotedUntil := l.demotedUntil
+			statuses[i].DemotedUntil = &demotedUntil
+		}
+	}
+	return statuses
+}
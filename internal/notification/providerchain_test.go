@@ -0,0 +1,143 @@
+package notification
+
+import (
+	"errors"
+	"fmt"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"time"
+)
+
+var _ = Describe("Provider chains", func() {
+
+	Context("Parsing", func() {
+		newSMS := func(string) Notificator {
+			return &SMSNotificator{}
+		}
+
+		It("should keep the order of an ordered chain", func() {
+			providers, err := ParseProviders([]string{"vendor-a", " vendor-b"}, newSMS)
+			Expect(err).To(BeNil())
+			Expect(providers).To(HaveLen(2))
+			Expect(providers[1].Name).To(Equal("vendor-b"))
+			Expect(providers[1].Weight).To(BeZero())
+		})
+
+		It("should read the weights of a weighted chain", func() {
+			providers, err := ParseProviders([]string{"vendor-a:3", "vendor-b:1"}, newSMS)
+			Expect(err).To(BeNil())
+			Expect(providers[0].Weight).To(Equal(3))
+		})
+
+		It("should refuse invalid chains", func() {
+			for _, entries := range [][]string{{"vendor-a:3", "vendor-b"}, {"vendor-a", "vendor-a"}, {"vendor-a:0"}, {":2"}} {
+				_, err := ParseProviders(entries, newSMS)
+				Expect(err).ToNot(BeNil(), fmt.Sprint(entries))
+			}
+		})
+	})
+
+	Context("Failover", func() {
+		var (
+			clock            time.Time
+			primary, backup  *flakyNotificator
+			chain            *ProviderChain
+			dn               *DelegatingNotification
+			refused, offline error
+		)
+
+		BeforeEach(func() {
+			clock = time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+			primary = &flakyNotificator{clock: &clock}
+			backup = &flakyNotificator{clock: &clock}
+			chain = newProviderChain("", SMS, []*Provider{{Name: "vendor-a", Notificator: primary}, {Name: "vendor-b", Notificator: backup}},
+				&HealthConfig{Decay: 0.5, DemoteBelow: 0.4, DemoteFor: time.Minute})
+			chain.now = func() time.Time {
+				return clock
+			}
+			dn = &DelegatingNotification{dest: SMS, recipient: &Recipient{Phone: "+359888123456"}}
+			refused = fmt.Errorf("connection refused")
+			offline = &ProviderError{Kind: RateLimited, RetryAfter: 10 * time.Second, Err: ErrCircuitOpen}
+		})
+
+		It("should deliver with the primary", func() {
+			provider, err := chain.Send(dn)
+			Expect(err).To(BeNil())
+			Expect(provider).To(Equal("vendor-a"))
+			Expect(backup.sent).To(BeZero())
+		})
+
+		It("should fall back to the next provider on a retryable error", func() {
+			primary.err = refused
+			provider, err := chain.Send(dn)
+			Expect(err).To(BeNil())
+			Expect(provider).To(Equal("vendor-b"))
+		})
+
+		It("should not fall back on a permanent error", func() {
+			primary.err = NewPermanentError(fmt.Errorf("unknown number"))
+			_, err := chain.Send(dn)
+			Expect(toProviderError(err).Kind).To(Equal(Permanent))
+			Expect(backup.sent).To(BeZero())
+		})
+
+		It("should return an error that reached a provider when every provider refused", func() {
+			primary.err, backup.err = offline, refused
+			_, err := chain.Send(dn)
+			Expect(errors.Is(err, refused)).To(BeTrue())
+			Expect(err.Error()).To(HavePrefix("vendor-b: "))
+		})
+
+		It("should return the breaker's error when every breaker is open", func() {
+			primary.err, backup.err = offline, offline
+			_, err := chain.Send(dn)
+			Expect(errors.Is(err, ErrCircuitOpen)).To(BeTrue())
+			Expect(chain.statuses()[0].Score).To(Equal(1.0))
+		})
+
+		It("should demote a failing provider until it recovers", func() {
+			primary.err = refused
+			chain.Send(dn)
+			Expect(chain.statuses()[0].DemotedUntil).To(BeNil())
+			chain.Send(dn)
+			Expect(chain.statuses()[0].Score).To(Equal(0.25))
+			Expect(chain.statuses()[0].DemotedUntil).ToNot(BeNil())
+
+			provider, _ := chain.Send(dn)
+			Expect(provider).To(Equal("vendor-b"))
+			Expect(primary.sent).To(Equal(2))
+
+			clock = clock.Add(time.Minute)
+			chain.Send(dn)
+			Expect(primary.sent).To(Equal(3))
+		})
+
+		It("should promote a demoted provider that went through as a fallback", func() {
+			primary.err = refused
+			chain.Send(dn)
+			chain.Send(dn)
+			primary.err, backup.err = nil, refused
+			provider, err := chain.Send(dn)
+			Expect(err).To(BeNil())
+			Expect(provider).To(Equal("vendor-a"))
+			Expect(chain.statuses()[0].Score).To(Equal(0.625))
+			Expect(chain.statuses()[0].DemotedUntil).To(BeNil())
+		})
+
+		It("should try the provider picked by weight first", func() {
+			chain = newProviderChain("", SMS, []*Provider{{Name: "vendor-a", Weight: 1, Notificator: primary},
+				{Name: "vendor-b", Weight: 3, Notificator: backup}}, chain.health)
+			Expect(chain.statuses()[0].Provider).To(Equal("vendor-b"))
+			chain.intn = func(int) int {
+				return 3
+			}
+			provider, _ := chain.Send(dn)
+			Expect(provider).To(Equal("vendor-a"))
+			chain.intn = func(int) int {
+				return 2
+			}
+			provider, _ = chain.Send(dn)
+			Expect(provider).To(Equal("vendor-b"))
+		})
+	})
+})
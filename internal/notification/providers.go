@@ -0,0 +1,184 @@
+package notification
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ProviderConfig configures the provider chains of a tenant, destinations left out are sent with the default providers
+type ProviderConfig struct {
+	SMS   SMSConfigs   `json:"sms,omitempty"`
+	Email EmailConfigs `json:"email,omitempty"`
+	Slack SlackConfigs `json:"slack,omitempty"`
+}
+
+// TenantProvider names a provider of a tenant's chain, after its destination when Name is empty
+type TenantProvider struct {
+	Name   string `json:"name,omitempty"`
+	Weight int    `json:"weight,omitempty"`
+}
+
+type SMSConfig struct {
+	TenantProvider
+	SenderID string `json:"sender_id"`
+}
+
+type EmailConfig struct {
+	TenantProvider
+	From    string `json:"from"`
+	ReplyTo string `json:"reply_to,omitempty"`
+}
+
+type SlackConfig struct {
+	TenantProvider
+	Workspace string `json:"workspace"`
+	Token     string `json:"token"`
+}
+
+// SMSConfigs is the chain of SMS providers of a tenant, a single one can be given as an object instead of a list
+type SMSConfigs []*SMSConfig
+
+func (c *SMSConfigs) UnmarshalJSON(data []byte) error {
+	return decodeOneOrMany(data, (*[]*SMSConfig)(c))
+}
+
+type EmailConfigs []*EmailConfig
+
+func (c *EmailConfigs) UnmarshalJSON(data []byte) error {
+	return decodeOneOrMany(data, (*[]*EmailConfig)(c))
+}
+
+type SlackConfigs []*SlackConfig
+
+func (c *SlackConfigs) UnmarshalJSON(data []byte) error {
+	return decodeOneOrMany(data, (*[]*SlackConfig)(c))
+}
+
+// decodeOneOrMany decodes a JSON list, or a single object as a list of one, refusing unknown fields like the file itself
+func decodeOneOrMany(data []byte, list interface{}) error {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		data = append(append([]byte{'['}, trimmed...), ']')
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(list)
+}
+
+// LoadProviderConfigs reads the provider configuration of every tenant, keyed by tenant id
+func LoadProviderConfigs(path string) (map[string]*ProviderConfig, error) {
+	configs := make(map[string]*ProviderConfig)
+	if path == "" {
+		return configs, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	decoder := json.NewDecoder(f)
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(&configs); err != nil {
+		return nil, fmt.Errorf("provider configs %s: %w", path, err)
+	}
+	for tenantID, c := range configs {
+		if !tenantIDRegex.MatchString(tenantID) {
+			return nil, fmt.Errorf("provider configs %s: invalid tenant id %q", path, tenantID)
+		}
+		if c == nil {
+			return nil, fmt.Errorf("provider configs %s: tenant %s has no providers", path, tenantID)
+		}
+		if err = c.validate(); err != nil {
+			return nil, fmt.Errorf("provider configs %s: tenant %s: %w", path, tenantID, err)
+		}
+	}
+	return configs, nil
+}
+
+func (c *ProviderConfig) validate() error {
+	chains := make(map[Destination][]TenantProvider, 3)
+	for _, p := range c.SMS {
+		if p == nil {
+			return fmt.Errorf("%s provider is null", SMS)
+		}
+		chains[SMS] = append(chains[SMS], p.TenantProvider)
+	}
+	for _, p := range c.Email {
+		if p == nil {
+			return fmt.Errorf("%s provider is null", Email)
+		}
+		chains[Email] = append(chains[Email], p.TenantProvider)
+	}
+	for _, p := range c.Slack {
+		if p == nil {
+			return fmt.Errorf("%s provider is null", Slack)
+		}
+		chains[Slack] = append(chains[Slack], p.TenantProvider)
+	}
+	for dest, providers := range chains {
+		names := make(map[string]struct{}, len(providers))
+		weighted := 0
+		for _, p := range providers {
+			name := p.name(dest)
+			if _, ok := names[name]; ok {
+				return fmt.Errorf("%s provider %s is in the chain twice", dest, name)
+			}
+			names[name] = struct{}{}
+			if p.Weight < 0 {
+				return fmt.Errorf("%s provider %s must have a positive weight, got %d", dest, name, p.Weight)
+			}
+			if p.Weight > 0 {
+				weighted++
+			}
+		}
+		if weighted > 0 && weighted < len(providers) {
+			return fmt.Errorf("either every %s provider has a weight or none does", dest)
+		}
+	}
+	return nil
+}
+
+func (tp TenantProvider) name(dest Destination) string {
+	if tp.Name == "" {
+		return strings.ToLower(dest.String())
+	}
+	return tp.Name
+}
+
+func (tp TenantProvider) provider(dest Destination, n Notificator) *Provider {
+	return &Provider{Name: tp.name(dest), Weight: tp.Weight, Notificator: n}
+}
+
+// NewTenantNotificators creates the provider chains of every tenant, emails without a sender use defaultEmail
+// and without a relay defaultRelay, or are only logged
+func NewTenantNotificators(configs map[string]*ProviderConfig, defaultEmail *EmailConfig, relays map[string]*SMTPPool,
+	defaultRelay *SMTPPool) map[string][]*Provider {
+	tenantProviders := make(map[string][]*Provider, len(configs))
+	for tenantID, c := range configs {
+		providers := make([]*Provider, 0, len(c.SMS)+len(c.Email)+len(c.Slack))
+		for _, sms := range c.SMS {
+			providers = append(providers, sms.provider(SMS, &SMSNotificator{SenderID: sms.SenderID}))
+		}
+		for _, email := range c.Email {
+			relay, ok := relays[email.name(Email)]
+			if !ok {
+				relay = defaultRelay
+			}
+			from, replyTo := email.From, email.ReplyTo
+			if from == "" {
+				from = defaultEmail.From
+				if replyTo == "" {
+					replyTo = defaultEmail.ReplyTo
+				}
+			}
+			providers = append(providers, email.provider(Email, &EmailNotificator{From: from, ReplyTo: replyTo, SMTP: relay}))
+		}
+		for _, slack := range c.Slack {
+			providers = append(providers, slack.provider(Slack, &SlackNotificator{Workspace: slack.Workspace, Token: slack.Token}))
+		}
+		tenantProviders[tenantID] = providers
+	}
+	return tenantProviders
+}
@@ -0,0 +1,103 @@
+package notification_test
+
+import (
+	"github.com/despondency/notifications-service/internal/notification"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"os"
+	"path/filepath"
+)
+
+var _ = Describe("Tenant providers", func() {
+
+	var (
+		contents string
+		path     string
+		configs  map[string]*notification.ProviderConfig
+		err      error
+	)
+
+	JustBeforeEach(func() {
+		path = filepath.Join(GinkgoT().TempDir(), "providers.json")
+		Expect(os.WriteFile(path, []byte(contents), 0o600)).To(Succeed())
+		configs, err = notification.LoadProviderConfigs(path)
+	})
+
+	Context("Valid configs", func() {
+		BeforeEach(func() {
+			contents = `{"payments": {"sms": {"sender_id": "PAY"}, "slack": {"workspace": "payments", "token": "xoxb-1"}},
+				"marketing": {"email": [{"name": "relay-a", "weight": 3, "from": "news@example.com"},
+					{"name": "relay-b", "weight": 1, "from": "news@b.example.com"}]},
+				"support": {"email": {"reply_to": "help@support.example.com"}},
+				"sales": {"email": {}}}`
+		})
+
+		It("should create the providers of the configured destinations only", func() {
+			Expect(err).To(BeNil())
+			relay := &notification.SMTPPool{}
+			defaultEmail := &notification.EmailConfig{From: "orders@shop.example", ReplyTo: "support@shop.example"}
+			providers := notification.NewTenantNotificators(configs, defaultEmail, map[string]*notification.SMTPPool{"relay-b": relay}, nil)
+			Expect(providers).To(HaveLen(4))
+			Expect(providers["payments"]).To(ConsistOf(
+				&notification.Provider{Name: "sms", Notificator: &notification.SMSNotificator{SenderID: "PAY"}},
+				&notification.Provider{Name: "slack", Notificator: &notification.SlackNotificator{Workspace: "payments", Token: "xoxb-1"}},
+			))
+			Expect(providers["marketing"]).To(Equal([]*notification.Provider{
+				{Name: "relay-a", Weight: 3, Notificator: &notification.EmailNotificator{From: "news@example.com"}},
+				{Name: "relay-b", Weight: 1, Notificator: &notification.EmailNotificator{From: "news@b.example.com", SMTP: relay}},
+			}))
+			Expect(providers["support"]).To(ConsistOf(&notification.Provider{Name: "email",
+				Notificator: &notification.EmailNotificator{From: "orders@shop.example", ReplyTo: "help@support.example.com"}}))
+			Expect(providers["sales"]).To(ConsistOf(&notification.Provider{Name: "email",
+				Notificator: &notification.EmailNotificator{From: "orders@shop.example", ReplyTo: "support@shop.example"}}))
+		})
+	})
+
+	Context("Same provider twice", func() {
+		BeforeEach(func() {
+			contents = `{"payments": {"sms": [{"sender_id": "PAY"}, {"sender_id": "PAY-2"}]}}`
+		})
+
+		It("should fail", func() {
+			Expect(err).To(MatchError(ContainSubstring("SMS provider sms is in the chain twice")))
+		})
+	})
+
+	Context("Some providers weighted", func() {
+		BeforeEach(func() {
+			contents = `{"payments": {"slack": [{"name": "a", "weight": 2, "workspace": "a"}, {"name": "b", "workspace": "b"}]}}`
+		})
+
+		It("should fail", func() {
+			Expect(err).To(MatchError(ContainSubstring("either every SLACK provider has a weight or none does")))
+		})
+	})
+
+	Context("Invalid tenant id", func() {
+		BeforeEach(func() {
+			contents = `{"Payments!": {"sms": {"sender_id": "PAY"}}}`
+		})
+
+		It("should fail", func() {
+			Expect(err).To(MatchError(ContainSubstring("invalid tenant id")))
+		})
+	})
+
+	Context("Unknown provider", func() {
+		BeforeEach(func() {
+			contents = `{"payments": {"fax": {"number": "1"}}}`
+		})
+
+		It("should fail", func() {
+			Expect(err).To(Not(BeNil()))
+		})
+	})
+
+	Context("No path", func() {
+		It("should leave every tenant on the default providers", func() {
+			configs, err = notification.LoadProviderConfigs("")
+			Expect(err).To(BeNil())
+			Expect(configs).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,330 @@
+package notification
+
+import (
+	"context"
+	"fmt"
+	"github.com/cockroachdb/cockroach-go/v2/crdb/crdbpgx"
+	"github.com/jackc/pgx/v4"
+	"github.com/rs/zerolog/log"
+	"go.uber.org/atomic"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// ClientIDHeader tells the callers of a tenant apart, without it a caller is its source address
+const ClientIDHeader = "X-Client-ID"
+
+const maxClientIDLength = 64
+
+// RateLimitError is returned when a limit is short of tokens, nothing was taken from any bucket
+type RateLimitError struct {
+	Limit      string
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("%s rate limit exceeded, retry after %s", e.Limit, e.RetryAfter)
+}
+
+// Limit is a token bucket refilled with Rate tokens per second up to Burst, a zero Rate is no limit
+type Limit struct {
+	Rate  float64
+	Burst float64
+}
+
+// TokenBucket is the state of a bucket as of Updated
+type TokenBucket struct {
+	Tokens  float64
+	Updated time.Time
+}
+
+// Take refills the bucket and takes n tokens, returning 0, or how long until it has them and leaves it untouched.
+// A take larger than the burst empties a full bucket into debt
+func (l Limit) Take(b *TokenBucket, n float64, now time.Time) time.Duration {
+	tokens := b.Tokens
+	if elapsed := now.Sub(b.Updated).Seconds(); elapsed > 0 {
+		tokens = math.Min(l.Burst, tokens+elapsed*l.Rate)
+	}
+	needed := math.Min(n, l.Burst)
+	if tokens < needed {
+		return time.Duration(math.Ceil((needed - tokens) / l.Rate * float64(time.Second)))
+	}
+	b.Tokens = tokens - n
+	b.Updated = now
+	return 0
+}
+
+// Refund gives back n tokens taken from the bucket, it never holds more than the burst
+func (l Limit) Refund(b *TokenBucket, n float64) {
+	b.Tokens = math.Min(l.Burst, b.Tokens+n)
+}
+
+// NewDestinationLimits returns the limit of every destination with a rate, its burst is one second of it
+func NewDestinationLimits(rates map[string]float64) (map[Destination]Limit, error) {
+	limits := make(map[Destination]Limit, len(rates))
+	for d, rate := range rates {
+		dest, err := toServerNotificationDestination(d)
+		if err != nil {
+			return nil, fmt.Errorf("rate limit of %q: %w", d, err)
+		}
+		if rate < 0 {
+			return nil, fmt.Errorf("rate limit of %s must not be negative, got %v", dest, rate)
+		}
+		limits[dest] = Limit{Rate: rate, Burst: rate}
+	}
+	return limits, nil
+}
+
+//go:generate mockgen -source ratelimit.go -destination ./notificationmocks/ratelimiter_mock.go -package notificationmocks
+type RateLimiter interface {
+	// Take takes a token per notification from the caller's and every destination's bucket, all or nothing
+	Take(ctx context.Context, caller string, destinations map[Destination]int) error
+	// Refund gives back what Take took for notifications that were never queued
+	Refund(ctx context.Context, caller string, destinations map[Destination]int) error
+}
+
+// TokenBucketLimiter keeps its buckets in CRDB so every instance enforces the same limits.
+// A destination limit is split over shards buckets, picked at random
+type TokenBucketLimiter struct {
+	persistence  *CRDBPersistence
+	caller       Limit
+	destinations map[Destination]Limit
+	shards       int
+	intn         func(n int) int
+	idleAfter    time.Duration
+	interval     time.Duration
+	stopped      *atomic.Bool
+	done         chan struct{}
+}
+
+// NewTokenBucketLimiter never deletes idle buckets when idleAfter is 0
+func NewTokenBucketLimiter(persistence *CRDBPersistence, caller Limit, destinations map[Destination]Limit, shards int,
+	idleAfter, interval time.Duration) (*TokenBucketLimiter, error) {
+	if caller.Rate < 0 || (caller.Rate > 0 && caller.Burst < 1) {
+		return nil, fmt.Errorf("caller rate limit must not be negative and its burst at least 1, got %v and %v",
+			caller.Rate, caller.Burst)
+	}
+	if shards < 1 {
+		return nil, fmt.Errorf("destination rate limit shards must be at least 1, got %d", shards)
+	}
+	shardLimits := make(map[Destination]Limit, len(destinations))
+	for d, l := range destinations {
+		shardLimits[d] = Limit{Rate: l.Rate / float64(shards), Burst: l.Burst / float64(shards)}
+	}
+	tbl := &TokenBucketLimiter{
+		persistence:  persistence,
+		caller:       caller,
+		destinations: shardLimits,
+		shards:       shards,
+		intn:         rand.Intn,
+		idleAfter:    idleAfter,
+		interval:     interval,
+		stopped:      atomic.NewBool(false),
+		done:         make(chan struct{}),
+	}
+	if idleAfter > 0 {
+		tbl.deleteIdleBuckets()
+	} else {
+		close(tbl.done)
+	}
+	return tbl, nil
+}
+
+func (tbl *TokenBucketLimiter) Stop() {
+	tbl.stopped.Store(true)
+	<-tbl.done
+}
+
+func (tbl *TokenBucketLimiter) deleteIdleBuckets() {
+	go func() {
+		defer close(tbl.done)
+		ticker := time.NewTicker(tbl.interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if tbl.stopped.Load() {
+				return
+			}
+			var deleted int64
+			ctx := context.Background()
+			err := crdbpgx.ExecuteTx(ctx, tbl.persistence.GetPool(), pgx.TxOptions{}, func(tx pgx.Tx) error {
+				deleted = 0
+				prefixes := map[string]Limit{"caller:%": tbl.caller}
+				for d, l := range tbl.destinations {
+					prefixes["destination:"+d.String()+":%"] = l
+				}
+				for prefix, l := range prefixes {
+					if l.Rate <= 0 {
+						continue
+					}
+					n, err := tbl.persistence.DeleteIdleRateLimitBuckets(ctx, prefix, l, tbl.idleAfter, tx)
+					if err != nil {
+						return err
+					}
+					deleted += n
+				}
+				return nil
+			})
+			if err != nil {
+				log.Err(err).Msg("could not delete idle rate limit buckets")
+			}
+			if deleted > 0 {
+				log.Info().Int64("deleted", deleted).Msg("deleted idle rate limit buckets")
+			}
+		}
+	}()
+}
+
+type bucketTake struct {
+	key   string
+	name  string
+	limit Limit
+	n     float64
+}
+
+func (tbl *TokenBucketLimiter) Take(ctx context.Context, caller string, destinations map[Destination]int) error {
+	takes := tbl.takes(caller, destinations)
+	if len(takes) == 0 {
+		return nil
+	}
+	var limited *RateLimitError
+	err := crdbpgx.ExecuteTx(ctx, tbl.persistence.GetPool(), pgx.TxOptions{}, func(tx pgx.Tx) error {
+		limited = nil
+		now, err := tbl.persistence.Now(ctx, tx)
+		if err != nil {
+			return err
+		}
+		buckets := make([]*TokenBucket, len(takes))
+		for i, t := range takes {
+			buckets[i], err = tbl.persistence.GetRateLimitBucket(ctx, t.key, tx)
+			if err != nil {
+				return err
+			}
+			if buckets[i] == nil {
+				buckets[i] = &TokenBucket{Tokens: t.limit.Burst, Updated: now}
+			}
+			if retryAfter := t.limit.Take(buckets[i], t.n, now); retryAfter > 0 {
+				limited = &RateLimitError{Limit: t.name, RetryAfter: retryAfter}
+				return nil
+			}
+		}
+		for i, t := range takes {
+			if err = tbl.persistence.UpsertRateLimitBucket(ctx, t.key, buckets[i], tx); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if limited != nil {
+		return limited
+	}
+	return nil
+}
+
+// Refund skips a bucket deleted meanwhile, it is full
+func (tbl *TokenBucketLimiter) Refund(ctx context.Context, caller string, destinations map[Destination]int) error {
+	takes := tbl.takes(caller, destinations)
+	if len(takes) == 0 {
+		return nil
+	}
+	return crdbpgx.ExecuteTx(ctx, tbl.persistence.GetPool(), pgx.TxOptions{}, func(tx pgx.Tx) error {
+		for _, t := range takes {
+			b, err := tbl.persistence.GetRateLimitBucket(ctx, t.key, tx)
+			if err != nil || b == nil {
+				return err
+			}
+			t.limit.Refund(b, t.n)
+			if err = tbl.persistence.UpsertRateLimitBucket(ctx, t.key, b, tx); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// takes lists the buckets the notifications take from, in a stable lock order
+func (tbl *TokenBucketLimiter) takes(caller string, destinations map[Destination]int) []*bucketTake {
+	takes := make([]*bucketTake, 0, len(destinations)+1)
+	total := 0
+	for d, n := range destinations {
+		total += n
+		if limit := tbl.destinations[d]; limit.Rate > 0 && n > 0 {
+			key := "destination:" + d.String() + ":" + strconv.Itoa(tbl.intn(tbl.shards))
+			takes = append(takes, &bucketTake{key: key, name: d.String(), limit: limit, n: float64(n)})
+		}
+	}
+	if tbl.caller.Rate > 0 && total > 0 {
+		takes = append(takes, &bucketTake{key: "caller:" + caller, name: "caller", limit: tbl.caller, n: float64(total)})
+	}
+	sort.Slice(takes, func(i, j int) bool {
+		return takes[i].key < takes[j].key
+	})
+	return takes
+}
+
+func callerID(r *http.Request) string {
+	return callerKey(IdentityFromContext(r.Context()), r.Header.Get(ClientIDHeader), r.RemoteAddr)
+}
+
+// callerKey is the client id, or the source address without one, within the tenant
+func callerKey(identity *Identity, clientID, remoteAddr string) string {
+	if clientID == "" || len(clientID) > maxClientIDLength {
+		clientID = sourceHost(remoteAddr)
+	}
+	return identity.TenantID + "/" + clientID
+}
+
+func sourceHost(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
+// refund gives the caller back the tokens of requests that weren't queued
+func refund(ctx context.Context, limiter RateLimiter, caller string, requests ...*Request) {
+	counts := destinationCounts(requests...)
+	if len(counts) == 0 {
+		return
+	}
+	if err := limiter.Refund(ctx, caller, counts); err != nil {
+		log.Err(err).Str("caller", caller).Msg("could not refund rate limit tokens")
+	}
+}
+
+// rejectedRequests are the requests of a batch whose item was rejected
+func rejectedRequests(requests []*Request, resp *BatchResponse) []*Request {
+	rejected := make([]*Request, 0, resp.Rejected)
+	for i, n := range requests {
+		if r, ok := resp.Results[batchItemKey(i, n)]; ok && r.Status == BatchItemRejected {
+			rejected = append(rejected, n)
+		}
+	}
+	return rejected
+}
+
+// destinationCounts counts the notifications the requests fan out to per destination, invalid requests aren't counted
+func destinationCounts(requests ...*Request) map[Destination]int {
+	counts := make(map[Destination]int, 3)
+	for _, n := range requests {
+		if n == nil {
+			continue
+		}
+		destinations, err := n.resolve()
+		if err != nil {
+			continue
+		}
+		for _, d := range destinations {
+			counts[d.dest]++
+		}
+	}
+	return counts
+}
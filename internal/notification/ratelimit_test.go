@@ -0,0 +1,81 @@
+package notification_test
+
+import (
+	"github.com/despondency/notifications-service/internal/notification"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"time"
+)
+
+var _ = Describe("Rate limits", func() {
+
+	var (
+		limit  notification.Limit
+		bucket *notification.TokenBucket
+		now    time.Time
+	)
+
+	BeforeEach(func() {
+		limit = notification.Limit{Rate: 10, Burst: 20}
+		now = time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+		bucket = &notification.TokenBucket{Tokens: 5, Updated: now.Add(-time.Second)}
+	})
+
+	Context("Enough tokens after the refill", func() {
+		It("should take them", func() {
+			Expect(limit.Take(bucket, 12, now)).To(Equal(time.Duration(0)))
+			Expect(bucket.Tokens).To(Equal(float64(3)))
+			Expect(bucket.Updated).To(Equal(now))
+		})
+	})
+
+	Context("Short of tokens", func() {
+		It("should leave the bucket untouched and say when it has them", func() {
+			Expect(limit.Take(bucket, 18, now)).To(Equal(300 * time.Millisecond))
+			Expect(bucket.Tokens).To(Equal(float64(5)))
+		})
+	})
+
+	Context("Refill past the burst", func() {
+		It("should cap the tokens at the burst", func() {
+			bucket.Updated = now.Add(-time.Hour)
+			Expect(limit.Take(bucket, 1, now)).To(Equal(time.Duration(0)))
+			Expect(bucket.Tokens).To(Equal(float64(19)))
+		})
+	})
+
+	Context("Take larger than the burst", func() {
+		It("should only go through a full bucket and leave it in debt", func() {
+			Expect(limit.Take(bucket, 50, now)).To(Equal(500 * time.Millisecond))
+			bucket.Updated = now.Add(-time.Hour)
+			Expect(limit.Take(bucket, 50, now)).To(Equal(time.Duration(0)))
+			Expect(bucket.Tokens).To(Equal(float64(-30)))
+		})
+	})
+
+	Context("Refund", func() {
+		It("should give the tokens back up to the burst", func() {
+			limit.Refund(bucket, 10)
+			Expect(bucket.Tokens).To(Equal(float64(15)))
+			limit.Refund(bucket, 10)
+			Expect(bucket.Tokens).To(Equal(float64(20)))
+			Expect(bucket.Updated).To(Equal(now.Add(-time.Second)))
+		})
+	})
+
+	Context("Destination limits", func() {
+		It("should parse the destinations", func() {
+			limits, err := notification.NewDestinationLimits(map[string]float64{"sms": 50, "EMAIL": 100})
+			Expect(err).To(BeNil())
+			Expect(limits).To(Equal(map[notification.Destination]notification.Limit{
+				notification.SMS:   {Rate: 50, Burst: 50},
+				notification.Email: {Rate: 100, Burst: 100},
+			}))
+		})
+
+		It("should reject unknown destinations", func() {
+			_, err := notification.NewDestinationLimits(map[string]float64{"fax": 1})
+			Expect(err).To(MatchError(notification.ErrNoSuchDestination))
+		})
+	})
+})
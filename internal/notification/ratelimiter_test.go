@@ -0,0 +1,31 @@
+package notification
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"strings"
+	"time"
+)
+
+var _ = Describe("Token bucket limiter", func() {
+
+	It("should split the limit of a destination over its shards", func() {
+		tbl, err := NewTokenBucketLimiter(nil, Limit{Rate: 10, Burst: 20}, map[Destination]Limit{SMS: {Rate: 80, Burst: 80}}, 8, 0, time.Minute)
+		Expect(err).To(BeNil())
+		tbl.intn = func(n int) int {
+			return n - 1
+		}
+		takes := tbl.takes("payments/checkout", map[Destination]int{SMS: 3})
+		Expect(takes).To(HaveLen(2))
+		Expect(takes[0].key).To(Equal("caller:payments/checkout"))
+		Expect(takes[1].key).To(Equal("destination:SMS:7"))
+		Expect(takes[1].limit).To(Equal(Limit{Rate: 10, Burst: 10}))
+	})
+
+	It("should tell the callers of a tenant apart by client id, or source address without one", func() {
+		identity := &Identity{TenantID: "payments"}
+		Expect(callerKey(identity, "checkout", "10.0.0.7:5123")).To(Equal("payments/checkout"))
+		Expect(callerKey(identity, "", "10.0.0.7:5123")).To(Equal("payments/10.0.0.7"))
+		Expect(callerKey(identity, strings.Repeat("x", 65), "10.0.0.7:5123")).To(Equal("payments/10.0.0.7"))
+	})
+})
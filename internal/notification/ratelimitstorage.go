@@ -0,0 +1,61 @@
+package notification
+
+import (
+	"context"
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
+	"time"
+)
+
+// Now is the time of the transaction on the cluster, so every instance refills buckets on the same clock
+func (crdbp *CRDBPersistence) Now(ctx context.Context, tx pgx.Tx) (time.Time, error) {
+	var now pgtype.Timestamp
+	errScan := tx.QueryRow(ctx, "SELECT now()::TIMESTAMP").Scan(&now)
+	if errScan != nil {
+		return time.Time{}, errScan
+	}
+	return now.Time, nil
+}
+
+// GetRateLimitBucket locks the bucket until the transaction ends, nil when nothing was ever taken from it
+func (crdbp *CRDBPersistence) GetRateLimitBucket(ctx context.Context, key string, tx pgx.Tx) (*TokenBucket, error) {
+	var (
+		tokens    float64
+		updatedAt pgtype.Timestamp
+	)
+	errScan := tx.QueryRow(ctx, "SELECT tokens, updated_at FROM rate_limit_buckets WHERE bucket_key = $1 FOR UPDATE", key).
+		Scan(&tokens, &updatedAt)
+	if errScan == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if errScan != nil {
+		return nil, errScan
+	}
+	return &TokenBucket{Tokens: tokens, Updated: updatedAt.Time}, nil
+}
+
+// DeleteIdleRateLimitBuckets deletes the refilled buckets matching keyPattern nothing was taken from for idleAfter
+func (crdbp *CRDBPersistence) DeleteIdleRateLimitBuckets(ctx context.Context, keyPattern string, limit Limit, idleAfter time.Duration,
+	tx pgx.Tx) (int64, error) {
+	v, errExec := tx.Exec(ctx, "DELETE FROM rate_limit_buckets WHERE bucket_key LIKE $1 "+
+		"AND updated_at < now()::TIMESTAMP - $2 * INTERVAL '1 second' "+
+		"AND tokens + $3 * extract(epoch FROM now()::TIMESTAMP - updated_at) >= $4",
+		keyPattern,
+		idleAfter.Seconds(),
+		limit.Rate,
+		limit.Burst,
+	)
+	if errExec != nil {
+		return 0, errExec
+	}
+	return v.RowsAffected(), nil
+}
+
+func (crdbp *CRDBPersistence) UpsertRateLimitBucket(ctx context.Context, key string, b *TokenBucket, tx pgx.Tx) error {
+	_, errExec := tx.Exec(ctx, "UPSERT INTO rate_limit_buckets(bucket_key, tokens, updated_at) VALUES ($1, $2, $3)",
+		key,
+		b.Tokens,
+		pgtype.Timestamp{Time: b.Updated, Status: pgtype.Present},
+	)
+	return errExec
+}
@@ -0,0 +1,115 @@
+package notification
+
+import (
+	"net/mail"
+	"regexp"
+	"strings"
+)
+
+var (
+	e164Regex         = regexp.MustCompile(`^\+[1-9][0-9]{1,14}$`)
+	slackChannelRegex = regexp.MustCompile(`^[CGD][A-Z0-9]{8,}$`)
+	slackUserRegex    = regexp.MustCompile(`^[UW][A-Z0-9]{8,}$`)
+	phoneFormatting   = strings.NewReplacer(" ", "", "-", "", "(", "", ")", "", ".", "")
+)
+
+// Recipient addresses a notification, only the fields of its destination may be set:
+// Phone for SMS, Email and an optional Name for EMAIL, one of SlackChannel or SlackUser for SLACK
+type Recipient struct {
+	Phone        string `json:"phone,omitempty"`
+	Email        string `json:"email,omitempty"`
+	Name         string `json:"name,omitempty"`
+	SlackChannel string `json:"slack_channel,omitempty"`
+	SlackUser    string `json:"slack_user,omitempty"`
+}
+
+// Address is the recipient without its display name
+func (r *Recipient) Address() string {
+	switch {
+	case r.Phone != "":
+		return r.Phone
+	case r.Email != "":
+		return r.Email
+	case r.SlackChannel != "":
+		return r.SlackChannel
+	default:
+		return r.SlackUser
+	}
+}
+
+func (r *Recipient) String() string {
+	if r.Email != "" {
+		return (&mail.Address{Name: r.Name, Address: r.Email}).String()
+	}
+	return r.Address()
+}
+
+// normalizeRecipient returns the normalized recipient for dest, or why it is invalid
+func normalizeRecipient(field string, dest Destination, r *Recipient) (*Recipient, []*FieldError) {
+	if r == nil {
+		return nil, []*FieldError{{Name: field, Reason: "is required"}}
+	}
+	errs := make([]*FieldError, 0)
+	invalid := func(name, reason string) {
+		errs = append(errs, &FieldError{Name: field + "." + name, Reason: reason})
+	}
+	notAllowed := func(name, value string) {
+		if value != "" {
+			invalid(name, "is not allowed for "+dest.String())
+		}
+	}
+	normalized := &Recipient{}
+	switch dest {
+	case SMS:
+		notAllowed("email", r.Email)
+		notAllowed("name", r.Name)
+		notAllowed("slack_channel", r.SlackChannel)
+		notAllowed("slack_user", r.SlackUser)
+		phone := phoneFormatting.Replace(r.Phone)
+		if strings.HasPrefix(phone, "00") {
+			phone = "+" + phone[2:]
+		}
+		if r.Phone == "" {
+			invalid("phone", "is required")
+		} else if !e164Regex.MatchString(phone) {
+			invalid("phone", "must be an E.164 phone number")
+		}
+		normalized.Phone = phone
+	case Email:
+		notAllowed("phone", r.Phone)
+		notAllowed("slack_channel", r.SlackChannel)
+		notAllowed("slack_user", r.SlackUser)
+		if r.Email == "" {
+			invalid("email", "is required")
+			break
+		}
+		addr, err := mail.ParseAddress(r.Email)
+		if err != nil || addr.Name != "" {
+			invalid("email", "must be a plain email address")
+			break
+		}
+		at := strings.LastIndex(addr.Address, "@")
+		// the local part is case sensitive by the RFC, the domain never is
+		normalized.Email = addr.Address[:at] + strings.ToLower(addr.Address[at:])
+		normalized.Name = strings.TrimSpace(r.Name)
+	case Slack:
+		notAllowed("phone", r.Phone)
+		notAllowed("email", r.Email)
+		notAllowed("name", r.Name)
+		channel := strings.ToUpper(strings.TrimSpace(r.SlackChannel))
+		user := strings.ToUpper(strings.TrimSpace(r.SlackUser))
+		if (channel == "") == (user == "") {
+			invalid("slack_channel", "exactly one of slack_channel or slack_user is required")
+		} else if channel != "" && !slackChannelRegex.MatchString(channel) {
+			invalid("slack_channel", "must be a Slack channel ID")
+		} else if user != "" && !slackUserRegex.MatchString(user) {
+			invalid("slack_user", "must be a Slack user ID")
+		}
+		normalized.SlackChannel = channel
+		normalized.SlackUser = user
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return normalized, nil
+}
@@ -0,0 +1,113 @@
+package notification
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Recipient normalization", func() {
+
+	var (
+		dest       Destination
+		recipient  *Recipient
+		normalized *Recipient
+		errs       []*FieldError
+	)
+
+	JustBeforeEach(func() {
+		normalized, errs = normalizeRecipient("recipient", dest, recipient)
+	})
+
+	Context("Missing recipient", func() {
+		BeforeEach(func() {
+			dest = SMS
+			recipient = nil
+		})
+
+		It("should be required", func() {
+			Expect(errs).To(ConsistOf(&FieldError{Name: "recipient", Reason: "is required"}))
+		})
+	})
+
+	Context("SMS phone with formatting", func() {
+		BeforeEach(func() {
+			dest = SMS
+			recipient = &Recipient{Phone: "0044 (20) 7946-0958"}
+		})
+
+		It("should be normalized to E.164", func() {
+			Expect(errs).To(BeEmpty())
+			Expect(normalized).To(Equal(&Recipient{Phone: "+442079460958"}))
+		})
+	})
+
+	Context("SMS phone without country code", func() {
+		BeforeEach(func() {
+			dest = SMS
+			recipient = &Recipient{Phone: "079460958"}
+		})
+
+		It("should be rejected", func() {
+			Expect(errs).To(ConsistOf(&FieldError{Name: "recipient.phone", Reason: "must be an E.164 phone number"}))
+		})
+	})
+
+	Context("SMS with an email", func() {
+		BeforeEach(func() {
+			dest = SMS
+			recipient = &Recipient{Phone: "+442079460958", Email: "jane@example.com"}
+		})
+
+		It("should reject the email", func() {
+			Expect(errs).To(ConsistOf(&FieldError{Name: "recipient.email", Reason: "is not allowed for SMS"}))
+		})
+	})
+
+	Context("Email with display name", func() {
+		BeforeEach(func() {
+			dest = Email
+			recipient = &Recipient{Email: "Jane.Doe@Example.COM", Name: " Jane Doe "}
+		})
+
+		It("should lowercase only the domain", func() {
+			Expect(errs).To(BeEmpty())
+			Expect(normalized).To(Equal(&Recipient{Email: "Jane.Doe@example.com", Name: "Jane Doe"}))
+			Expect(normalized.String()).To(Equal(`"Jane Doe" <Jane.Doe@example.com>`))
+		})
+	})
+
+	Context("Invalid email", func() {
+		BeforeEach(func() {
+			dest = Email
+			recipient = &Recipient{Email: "jane"}
+		})
+
+		It("should be rejected", func() {
+			Expect(errs).To(ConsistOf(&FieldError{Name: "recipient.email", Reason: "must be a plain email address"}))
+		})
+	})
+
+	Context("Slack user ID", func() {
+		BeforeEach(func() {
+			dest = Slack
+			recipient = &Recipient{SlackUser: "u0123456789"}
+		})
+
+		It("should be uppercased", func() {
+			Expect(errs).To(BeEmpty())
+			Expect(normalized).To(Equal(&Recipient{SlackUser: "U0123456789"}))
+		})
+	})
+
+	Context("Slack with both channel and user", func() {
+		BeforeEach(func() {
+			dest = Slack
+			recipient = &Recipient{SlackChannel: "C0123456789", SlackUser: "U0123456789"}
+		})
+
+		It("should be rejected", func() {
+			Expect(errs).To(HaveLen(1))
+			Expect(errs[0].Name).To(Equal("recipient.slack_channel"))
+		})
+	})
+})
@@ -0,0 +1,215 @@
+package notification
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/cockroachdb/cockroach-go/v2/crdb/crdbpgx"
+	"github.com/jackc/pgx/v4"
+	"github.com/rs/zerolog/log"
+	"go.uber.org/atomic"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// RetentionPolicy is how long the notifications of every destination are kept once final, 0 keeps them forever
+type RetentionPolicy struct {
+	periods map[Destination]time.Duration
+}
+
+// NewRetentionPolicy keeps every destination for the default period unless periods has its own.
+// Retries dedup against the notifications table, so no period may be shorter than the dedup window
+func NewRetentionPolicy(defaultPeriod time.Duration, periods map[string]time.Duration, dedupWindow time.Duration) (*RetentionPolicy, error) {
+	rp := &RetentionPolicy{
+		periods: map[Destination]time.Duration{SMS: defaultPeriod, Email: defaultPeriod, Slack: defaultPeriod},
+	}
+	for d, period := range periods {
+		dest, err := toServerNotificationDestination(d)
+		if err != nil {
+			return nil, fmt.Errorf("retention period of %q: %w", d, err)
+		}
+		rp.periods[dest] = period
+	}
+	for dest, period := range rp.periods {
+		if period < 0 || (period > 0 && period < dedupWindow) {
+			return nil, fmt.Errorf("retention period of %s must be 0 or at least the dedup window of %s, got %s",
+				dest, dedupWindow, period)
+		}
+	}
+	return rp, nil
+}
+
+func (rp *RetentionPolicy) Period(dest Destination) time.Duration {
+	return rp.periods[dest]
+}
+
+// Enabled tells if any destination is ever purged
+func (rp *RetentionPolicy) Enabled() bool {
+	for _, period := range rp.periods {
+		if period > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+type Archiver interface {
+	// Archive keeps the notifications before they are purged, it may get the same batch again
+	Archive(dest Destination, notifications []*Notification) error
+}
+
+// FileArchiver writes every batch to a gzipped JSONL file named after its first and last notification,
+// archiving a batch again replaces it
+type FileArchiver struct {
+	dir string
+}
+
+func NewFileArchiver(dir string) (*FileArchiver, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+	return &FileArchiver{
+		dir: dir,
+	}, nil
+}
+
+func (fa *FileArchiver) Archive(dest Destination, notifications []*Notification) error {
+	if len(notifications) == 0 {
+		return nil
+	}
+	first, last := notifications[0], notifications[len(notifications)-1]
+	name := fmt.Sprintf("notifications-%s-%s-%s-%s.jsonl.gz", dest,
+		first.ServerReceivedTimestamp.UTC().Format("20060102T150405.000000000Z"), first.UUID, last.UUID)
+	// written aside and renamed, so a file with the final name is always whole
+	tmp, err := os.CreateTemp(fa.dir, "."+name+"-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// a no-op once renamed
+		_ = os.Remove(tmp.Name())
+	}()
+	zw := gzip.NewWriter(tmp)
+	w := bufio.NewWriter(zw)
+	encoder := json.NewEncoder(w)
+	for _, n := range notifications {
+		if err = encoder.Encode(toStatusResponse(n)); err != nil {
+			_ = tmp.Close()
+			return err
+		}
+	}
+	if err = w.Flush(); err == nil {
+		err = zw.Close()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if errClose := tmp.Close(); err == nil {
+		err = errClose
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(fa.dir, name))
+}
+
+// Purger deletes the notifications past the retention period of their destination, archiving them first
+// when it has an archiver. Every instance runs one, each locks its own batches
+type Purger struct {
+	persistence *CRDBPersistence
+	policy      *RetentionPolicy
+	archiver    Archiver
+	interval    time.Duration
+	batchSize   int
+	pause       time.Duration
+	stopped     *atomic.Bool
+	done        chan struct{}
+}
+
+// NewPurger purges without archiving when archiver is nil
+func NewPurger(persistence *CRDBPersistence, policy *RetentionPolicy, archiver Archiver, interval time.Duration, batchSize int,
+	pause time.Duration) *Purger {
+	p := &Purger{
+		persistence: persistence,
+		policy:      policy,
+		archiver:    archiver,
+		interval:    interval,
+		batchSize:   batchSize,
+		pause:       pause,
+		stopped:     atomic.NewBool(false),
+		done:        make(chan struct{}),
+	}
+	p.purgeExpiredNotifications()
+	return p
+}
+
+func (p *Purger) Stop() {
+	p.stopped.Store(true)
+	<-p.done
+}
+
+func (p *Purger) purgeExpiredNotifications() {
+	go func() {
+		defer close(p.done)
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if p.stopped.Load() {
+				return
+			}
+			for _, dest := range []Destination{SMS, Email, Slack} {
+				if p.policy.Period(dest) == 0 {
+					continue
+				}
+				purged, err := p.purge(context.Background(), dest)
+				if err != nil {
+					log.Err(err).Str("destination", dest.String()).Msg("could not purge expired notifications")
+				}
+				if purged > 0 {
+					log.Info().Int("purged", purged).Str("destination", dest.String()).Msg("purged expired notifications")
+				}
+			}
+		}
+	}()
+}
+
+// purge deletes batches of expired notifications of the destination until there are none left
+func (p *Purger) purge(ctx context.Context, dest Destination) (int, error) {
+	purged := 0
+	for !p.stopped.Load() {
+		n, err := p.purgeBatch(ctx, dest)
+		purged += n
+		if err != nil || n < p.batchSize {
+			return purged, err
+		}
+		time.Sleep(p.pause)
+	}
+	return purged, nil
+}
+
+func (p *Purger) purgeBatch(ctx context.Context, dest Destination) (int, error) {
+	var expired []*Notification
+	err := crdbpgx.ExecuteTx(ctx, p.persistence.GetPool(), pgx.TxOptions{}, func(tx pgx.Tx) error {
+		now, err := p.persistence.Now(ctx, tx)
+		if err != nil {
+			return err
+		}
+		expired, err = p.persistence.ClaimExpired(ctx, dest, now.Add(-p.policy.Period(dest)), p.batchSize, tx)
+		if err != nil || len(expired) == 0 {
+			return err
+		}
+		if p.archiver != nil {
+			if err = p.archiver.Archive(dest, expired); err != nil {
+				return err
+			}
+		}
+		return p.persistence.DeleteNotifications(ctx, expired, tx)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(expired), nil
+}
@@ -0,0 +1,98 @@
+package notification_test
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"github.com/despondency/notifications-service/internal/notification"
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var _ = Describe("Retention", func() {
+
+	Context("Retention policy", func() {
+		It("should keep every destination for the default period unless it has its own", func() {
+			rp, err := notification.NewRetentionPolicy(30*24*time.Hour, map[string]time.Duration{"sms": 7 * 24 * time.Hour, "SLACK": 0},
+				24*time.Hour)
+			Expect(err).To(BeNil())
+			Expect(rp.Period(notification.SMS)).To(Equal(7 * 24 * time.Hour))
+			Expect(rp.Period(notification.Email)).To(Equal(30 * 24 * time.Hour))
+			Expect(rp.Period(notification.Slack)).To(BeZero())
+			Expect(rp.Enabled()).To(BeTrue())
+		})
+
+		It("should keep everything forever by default", func() {
+			rp, err := notification.NewRetentionPolicy(0, nil, 24*time.Hour)
+			Expect(err).To(BeNil())
+			Expect(rp.Enabled()).To(BeFalse())
+		})
+
+		It("should reject periods shorter than the dedup window and unknown destinations", func() {
+			_, err := notification.NewRetentionPolicy(time.Hour, nil, 24*time.Hour)
+			Expect(err).ToNot(BeNil())
+			_, err = notification.NewRetentionPolicy(0, map[string]time.Duration{"EMAIL": time.Hour}, 24*time.Hour)
+			Expect(err).ToNot(BeNil())
+			_, err = notification.NewRetentionPolicy(0, map[string]time.Duration{"FAX": 48 * time.Hour}, 24*time.Hour)
+			Expect(err).To(MatchError(notification.ErrNoSuchDestination))
+		})
+	})
+
+	Context("File archiver", func() {
+		It("should write the batch as gzipped JSONL", func() {
+			dir := GinkgoT().TempDir()
+			archiver, err := notification.NewFileArchiver(filepath.Join(dir, "archive"))
+			Expect(err).To(BeNil())
+			batch := []*notification.Notification{
+				{UUID: uuid.New(), NotificationTxt: "first", Dest: notification.SMS, State: notification.StateDelivered},
+				{UUID: uuid.New(), NotificationTxt: "second", Dest: notification.SMS, State: notification.StateFailed},
+			}
+			Expect(archiver.Archive(notification.SMS, batch)).To(Succeed())
+
+			files, err := os.ReadDir(filepath.Join(dir, "archive"))
+			Expect(err).To(BeNil())
+			Expect(files).To(HaveLen(1))
+			Expect(strings.HasPrefix(files[0].Name(), "notifications-SMS-")).To(BeTrue())
+			Expect(strings.HasSuffix(files[0].Name(), ".jsonl.gz")).To(BeTrue())
+
+			f, err := os.Open(filepath.Join(dir, "archive", files[0].Name()))
+			Expect(err).To(BeNil())
+			defer f.Close()
+			zr, err := gzip.NewReader(f)
+			Expect(err).To(BeNil())
+			scanner := bufio.NewScanner(zr)
+			lines := make([]*notification.StatusResponse, 0)
+			for scanner.Scan() {
+				line := &notification.StatusResponse{}
+				Expect(json.Unmarshal(scanner.Bytes(), line)).To(Succeed())
+				lines = append(lines, line)
+			}
+			Expect(scanner.Err()).To(BeNil())
+			Expect(lines).To(HaveLen(2))
+			Expect(lines[0].UUID).To(Equal(batch[0].UUID))
+			Expect(lines[1].State).To(Equal(notification.StateFailed))
+		})
+
+		It("should replace the file of a batch archived again", func() {
+			dir := GinkgoT().TempDir()
+			archiver, err := notification.NewFileArchiver(dir)
+			Expect(err).To(BeNil())
+			batch := []*notification.Notification{
+				{UUID: uuid.New(), NotificationTxt: "first", Dest: notification.SMS, State: notification.StateDelivered},
+				{UUID: uuid.New(), NotificationTxt: "second", Dest: notification.SMS, State: notification.StateDelivered},
+			}
+			Expect(archiver.Archive(notification.SMS, batch)).To(Succeed())
+			Expect(archiver.Archive(notification.SMS, batch)).To(Succeed())
+
+			files, err := os.ReadDir(dir)
+			Expect(err).To(BeNil())
+			Expect(files).To(HaveLen(1))
+			Expect(files[0].Name()).To(ContainSubstring(batch[0].UUID.String() + "-" + batch[1].UUID.String()))
+		})
+	})
+})
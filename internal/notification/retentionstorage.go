@@ -0,0 +1,47 @@
+package notification
+
+import (
+	"context"
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
+	"time"
+)
+
+// ClaimExpired locks the oldest final notifications of the destination received before the cutoff,
+// skipping the ones another purger has locked. Like ClaimDue it isn't scoped to a tenant
+func (crdbp *CRDBPersistence) ClaimExpired(ctx context.Context, dest Destination, cutoff time.Time, limit int,
+	tx pgx.Tx) ([]*Notification, error) {
+	final := make([]string, 0, len(States))
+	for _, s := range States {
+		if s.Final() {
+			final = append(final, string(s))
+		}
+	}
+	rows, err := tx.Query(ctx, "SELECT "+notificationColumns+" FROM notifications WHERE destination = $1 AND server_timestamp < $2 "+
+		"AND status = ANY($3::STRING[]) ORDER BY server_timestamp LIMIT $4 FOR UPDATE SKIP LOCKED",
+		pgtype.Int2{Int: int16(dest), Status: pgtype.Present},
+		toDBTimestamp(&cutoff),
+		final,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return scanNotifications(rows)
+}
+
+// DeleteNotifications deletes the given notifications, a uuid sent again afterwards is a new notification
+func (crdbp *CRDBPersistence) DeleteNotifications(ctx context.Context, notifications []*Notification, tx pgx.Tx) error {
+	tenantIDs := make([]string, len(notifications))
+	uuids := make([]string, len(notifications))
+	for i, n := range notifications {
+		tenantIDs[i] = tenantOrDefault(n.TenantID)
+		uuids[i] = n.UUID.String()
+	}
+	_, errExec := tx.Exec(ctx,
+		"DELETE FROM notifications WHERE (tenant_id, uuid) IN (SELECT unnest($1::STRING[]), unnest($2::UUID[]))",
+		tenantIDs,
+		uuids,
+	)
+	return errExec
+}
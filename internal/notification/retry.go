@@ -0,0 +1,306 @@
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/cockroachdb/cockroach-go/v2/crdb/crdbpgx"
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/despondency/notifications-service/internal/messaging"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/rs/zerolog/log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ProviderErrorKind is how a notificator refused a notification
+type ProviderErrorKind int
+
+const (
+	// Retryable may go through later, errors that aren't a *ProviderError are taken as retryable
+	Retryable ProviderErrorKind = iota
+	// RateLimited may go through once RetryAfter passed
+	RateLimited
+	// Permanent never goes through, like a recipient the provider doesn't know
+	Permanent
+)
+
+func (k ProviderErrorKind) String() string {
+	switch k {
+	case RateLimited:
+		return "rate limited"
+	case Permanent:
+		return "permanent"
+	default:
+		return "retryable"
+	}
+}
+
+// ProviderError is what Notificator.Send returns to say whether and when a notification is worth retrying
+type ProviderError struct {
+	Kind       ProviderErrorKind
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *ProviderError) Error() string {
+	if e.Kind == RateLimited && e.RetryAfter > 0 {
+		return fmt.Sprintf("%s, retry after %s: %v", e.Kind, e.RetryAfter, e.Err)
+	}
+	return fmt.Sprintf("%s: %v", e.Kind, e.Err)
+}
+
+func (e *ProviderError) Unwrap() error {
+	return e.Err
+}
+
+func NewRetryableError(err error) error {
+	return &ProviderError{Kind: Retryable, Err: err}
+}
+
+// NewRateLimitedError is retried in the first tier at least retryAfter long, 0 when the provider didn't say
+func NewRateLimitedError(err error, retryAfter time.Duration) error {
+	return &ProviderError{Kind: RateLimited, RetryAfter: retryAfter, Err: err}
+}
+
+func NewPermanentError(err error) error {
+	return &ProviderError{Kind: Permanent, Err: err}
+}
+
+func toProviderError(err error) *ProviderError {
+	var pe *ProviderError
+	if errors.As(err, &pe) {
+		return pe
+	}
+	if errors.Is(err, ErrNoRecipient) {
+		return &ProviderError{Kind: Permanent, Err: err}
+	}
+	return &ProviderError{Kind: Retryable, Err: err}
+}
+
+// RetryTier is a topic retries wait in for Delay before they are dispatched again
+type RetryTier struct {
+	Delay time.Duration
+	Topic string
+}
+
+// NewRetryTiers returns a tier per delay from the shortest, its topic is the outstanding topic suffixed with the delay
+func NewRetryTiers(outstandingTopic string, delays []time.Duration) ([]*RetryTier, error) {
+	if len(delays) == 0 {
+		return nil, fmt.Errorf("there must be at least one retry tier")
+	}
+	sorted := make([]time.Duration, len(delays))
+	copy(sorted, delays)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+	tiers := make([]*RetryTier, len(sorted))
+	for i, d := range sorted {
+		if d <= 0 || (i > 0 && d == sorted[i-1]) {
+			return nil, fmt.Errorf("retry tier delays must be positive and distinct, got %v", delays)
+		}
+		tiers[i] = &RetryTier{Delay: d, Topic: outstandingTopic + "-retry-" + tierName(d)}
+	}
+	return tiers, nil
+}
+
+// tierName is the delay without its zero units, like 10s, 1m or 1h30m
+func tierName(d time.Duration) string {
+	name := d.String()
+	if strings.HasSuffix(name, "m0s") {
+		name = strings.TrimSuffix(name, "0s")
+	}
+	if strings.HasSuffix(name, "h0m") {
+		name = strings.TrimSuffix(name, "0m")
+	}
+	return name
+}
+
+// RetryQueue holds the notifications refused for now, each is dispatched at most MaxAttempts times.
+// While every breaker of its destination is open it is parked up to MaxCircuitOpen times without using an attempt
+type RetryQueue struct {
+	Tiers          []*RetryTier
+	Producers      map[string]*messaging.KafkaProducer
+	MaxAttempts    int
+	MaxCircuitOpen int
+}
+
+// tier is where a notification waits after a failed attempt, a rate limited one waits at least as long as asked
+func (rq *RetryQueue) tier(attempt int, pe *ProviderError) *RetryTier {
+	i := attempt - 1
+	if i >= len(rq.Tiers) {
+		i = len(rq.Tiers) - 1
+	}
+	if pe.Kind == RateLimited {
+		for i < len(rq.Tiers)-1 && rq.Tiers[i].Delay < pe.RetryAfter {
+			i++
+		}
+	}
+	return rq.Tiers[i]
+}
+
+// RetryMessage is a notification waiting in a retry tier, Attempt is the next one.
+// CircuitOpen is how many times it was parked by open breakers
+type RetryMessage struct {
+	UUID        uuid.UUID `json:"uuid"`
+	TenantID    string    `json:"tenant_id"`
+	Destination string    `json:"destination,omitempty"`
+	Attempt     int       `json:"attempt"`
+	CircuitOpen int       `json:"circuit_open,omitempty"`
+	NotBefore   time.Time `json:"not_before"`
+}
+
+// retryConsumer pauses a partition until its next message is due, the ones behind it are due later anyway
+type retryConsumer struct {
+	tier     *RetryTier
+	consumer *kafka.Consumer
+	offsets  *offsetTracker
+	paused   map[int32]*pausedPartition
+	done     chan struct{}
+}
+
+type pausedPartition struct {
+	tp    kafka.TopicPartition
+	until time.Time
+}
+
+// pause rewinds the partition to the message that isn't due, it is read again once the partition is resumed
+func (rc *retryConsumer) pause(tp kafka.TopicPartition, until time.Time) {
+	tps := []kafka.TopicPartition{tp}
+	if err := rc.consumer.Pause(tps); err != nil {
+		log.Err(err).Str("topic", rc.tier.Topic).Msg("could not pause retry partition")
+		return
+	}
+	if err := rc.consumer.Seek(tp, 0); err != nil {
+		log.Err(err).Str("topic", rc.tier.Topic).Msg("could not rewind retry partition")
+	}
+	rc.paused[tp.Partition] = &pausedPartition{tp: tp, until: until}
+}
+
+func (rc *retryConsumer) resumeDue(now time.Time) {
+	for p, pp := range rc.paused {
+		if now.Before(pp.until) {
+			continue
+		}
+		// a revoked partition can't be resumed
+		if err := rc.consumer.Resume([]kafka.TopicPartition{pp.tp}); err != nil {
+			log.Err(err).Str("topic", rc.tier.Topic).Msg("could not resume retry partition")
+		}
+		delete(rc.paused, p)
+	}
+}
+
+func (ous *OutstandingService) consumeRetries(rc *retryConsumer) {
+	go func() {
+		defer close(rc.done)
+		for ous.stopped.Load() == false {
+			rc.resumeDue(time.Now())
+			switch e := rc.consumer.Poll(100).(type) {
+			case *kafka.Message:
+				if _, ok := rc.paused[e.TopicPartition.Partition]; ok {
+					// fetched before the partition was paused
+					continue
+				}
+				rm := &RetryMessage{}
+				// a malformed message is dead lettered by its handler
+				if json.Unmarshal(e.Value, rm) == nil && time.Now().Before(rm.NotBefore) {
+					rc.pause(e.TopicPartition, rm.NotBefore)
+					continue
+				}
+				ous.handleAsync(rc.offsets, e, ous.handleRetry, "topic", rc.tier.Topic)
+			case kafka.Error:
+				log.Err(e).Str("topic", rc.tier.Topic).Msg("kafka produced an error in retry consumer")
+			default:
+			}
+		}
+	}()
+}
+
+// handleRetry dispatches a notification again once its tier delay passed, unless it was cancelled or expired meanwhile.
+// One still dispatching was left by an instance that died, it is dispatched again like resume does
+func (ous *OutstandingService) handleRetry(ctx context.Context, msg *kafka.Message) error {
+	rm := &RetryMessage{}
+	if err := json.Unmarshal(msg.Value, rm); err != nil {
+		return fmt.Errorf("%w: %v", ErrMalformedMessage, err)
+	}
+	var err error
+	// messages queued before they had a destination are never parked
+	if dest, errDest := toServerNotificationDestination(rm.Destination); errDest == nil && rm.CircuitOpen < ous.retries.MaxCircuitOpen {
+		if wait, open := ous.notificator.OpenFor(tenantOrDefault(rm.TenantID), dest); open {
+			return ous.park(rm, wait)
+		}
+	}
+	var (
+		stored      *Notification
+		dispatching *DelegatingNotification
+	)
+	err = crdbpgx.ExecuteTx(ctx, ous.persistence.GetPool(), pgx.TxOptions{}, func(tx pgx.Tx) error {
+		var err error
+		dispatching = nil
+		stored, err = ous.persistence.Get(ctx, tenantOrDefault(rm.TenantID), rm.UUID, tx)
+		if err == pgx.ErrNoRows || (err == nil && stored.State != StateRetrying && stored.State != StateDispatching &&
+			stored.State != StateReceived) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		dispatching, err = ous.prepare(ctx, stored, tx)
+		return err
+	})
+	if err == nil && dispatching != nil {
+		err = ous.deliver(ctx, stored, dispatching, rm.Attempt, rm.CircuitOpen)
+	}
+	return err
+}
+
+// retry moves the notification to retrying and queues it in tier for attempt next.
+// The message is produced outside the transaction, so a retried transaction doesn't produce it twice
+func (ous *OutstandingService) retry(ctx context.Context, serverNotification *Notification, tier *RetryTier, next, circuitOpen int,
+	pe *ProviderError) error {
+	b, err := json.Marshal(&RetryMessage{
+		UUID:        serverNotification.UUID,
+		TenantID:    tenantOrDefault(serverNotification.TenantID),
+		Destination: serverNotification.Dest.String(),
+		Attempt:     next,
+		CircuitOpen: circuitOpen,
+		NotBefore:   time.Now().UTC().Add(retryDelay(tier, pe)),
+	})
+	if err != nil {
+		return err
+	}
+	log.Warn().Err(pe).Str("uuid", serverNotification.UUID.String()).Int("next_attempt", next).Str("tier", tier.Topic).
+		Msg("retrying notification")
+	err = ous.retries.Producers[tier.Topic].ProduceMessage(serverNotification.UUID[:], b, nil)
+	if err != nil {
+		return err
+	}
+	return crdbpgx.ExecuteTx(ctx, ous.persistence.GetPool(), pgx.TxOptions{}, func(tx pgx.Tx) error {
+		return ous.persistence.Transition(ctx, serverNotification, StateRetrying, TransitionOpts{Reason: pe.Error()}, tx)
+	})
+}
+
+// park queues the notification in the first tier until a breaker of its destination half-opens, keeping its state and attempt
+func (ous *OutstandingService) park(rm *RetryMessage, wait time.Duration) error {
+	parked := *rm
+	parked.CircuitOpen++
+	parked.NotBefore = time.Now().UTC().Add(wait)
+	b, err := json.Marshal(&parked)
+	if err != nil {
+		return err
+	}
+	log.Info().Str("uuid", rm.UUID.String()).Str("destination", rm.Destination).Int("circuit_open", parked.CircuitOpen).
+		Msg("parked notification while its providers are down")
+	return ous.retries.Producers[ous.retries.Tiers[0].Topic].ProduceMessage(rm.UUID[:], b, nil)
+}
+
+// retryDelay is how long a notification waits in tier, longer when its provider asked for more
+func retryDelay(tier *RetryTier, pe *ProviderError) time.Duration {
+	if pe.Kind == RateLimited && pe.RetryAfter > tier.Delay {
+		return pe.RetryAfter
+	}
+	return tier.Delay
+}
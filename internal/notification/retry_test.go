@@ -0,0 +1,83 @@
+package notification
+
+import (
+	"fmt"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"time"
+)
+
+var _ = Describe("Retries", func() {
+
+	Context("Provider errors", func() {
+		It("should keep the kind the notificator gave", func() {
+			err := fmt.Errorf("sending: %w", NewRateLimitedError(fmt.Errorf("429"), time.Minute))
+			pe := toProviderError(err)
+			Expect(pe.Kind).To(Equal(RateLimited))
+			Expect(pe.RetryAfter).To(Equal(time.Minute))
+			Expect(toProviderError(NewPermanentError(fmt.Errorf("unknown number"))).Kind).To(Equal(Permanent))
+		})
+
+		It("should retry untyped errors and never a missing recipient", func() {
+			Expect(toProviderError(fmt.Errorf("connection reset")).Kind).To(Equal(Retryable))
+			Expect(toProviderError(ErrNoRecipient).Kind).To(Equal(Permanent))
+		})
+
+		It("should be typed by the SMS and Slack notificators", func() {
+			err := (&SMSNotificator{}).Send(&DelegatingNotification{dest: SMS, recipient: &Recipient{Phone: "0888123456"}})
+			Expect(toProviderError(err).Kind).To(Equal(Permanent))
+			Expect((&SMSNotificator{}).Send(&DelegatingNotification{dest: SMS, recipient: &Recipient{Phone: "+359888123456"}})).To(Succeed())
+			err = (&SlackNotificator{}).Send(&DelegatingNotification{dest: Slack, recipient: &Recipient{Email: "jane@example.com"}})
+			Expect(toProviderError(err).Kind).To(Equal(Permanent))
+			Expect((&SlackNotificator{}).Send(&DelegatingNotification{dest: Slack, recipient: &Recipient{SlackChannel: "C0123456789"}})).To(Succeed())
+		})
+	})
+
+	Context("Tiers", func() {
+		var rq *RetryQueue
+
+		BeforeEach(func() {
+			tiers, err := NewRetryTiers("outstanding-notifications", []time.Duration{time.Hour, 10 * time.Second, 10 * time.Minute, time.Minute})
+			Expect(err).To(BeNil())
+			rq = &RetryQueue{Tiers: tiers, MaxAttempts: 5}
+		})
+
+		It("should be ordered from the shortest delay and named after it", func() {
+			topics := make([]string, len(rq.Tiers))
+			for i, t := range rq.Tiers {
+				topics[i] = t.Topic
+			}
+			Expect(topics).To(Equal([]string{"outstanding-notifications-retry-10s", "outstanding-notifications-retry-1m",
+				"outstanding-notifications-retry-10m", "outstanding-notifications-retry-1h"}))
+		})
+
+		It("should wait longer after every attempt", func() {
+			retryable := &ProviderError{Kind: Retryable}
+			Expect(rq.tier(1, retryable).Delay).To(Equal(10 * time.Second))
+			Expect(rq.tier(2, retryable).Delay).To(Equal(time.Minute))
+			Expect(rq.tier(4, retryable).Delay).To(Equal(time.Hour))
+			Expect(rq.tier(9, retryable).Delay).To(Equal(time.Hour))
+		})
+
+		It("should wait at least as long as a rate limited provider asked", func() {
+			Expect(rq.tier(1, &ProviderError{Kind: RateLimited, RetryAfter: 30 * time.Second}).Delay).To(Equal(time.Minute))
+			Expect(rq.tier(1, &ProviderError{Kind: RateLimited}).Delay).To(Equal(10 * time.Second))
+			Expect(rq.tier(1, &ProviderError{Kind: RateLimited, RetryAfter: 24 * time.Hour}).Delay).To(Equal(time.Hour))
+		})
+
+		It("should not be due before a rate limited provider asked, past the longest tier too", func() {
+			longer := &ProviderError{Kind: RateLimited, RetryAfter: 24 * time.Hour}
+			Expect(retryDelay(rq.tier(1, longer), longer)).To(Equal(24 * time.Hour))
+			shorter := &ProviderError{Kind: RateLimited, RetryAfter: 30 * time.Second}
+			Expect(retryDelay(rq.tier(1, shorter), shorter)).To(Equal(time.Minute))
+			Expect(retryDelay(rq.tier(4, &ProviderError{Kind: Retryable}), &ProviderError{Kind: Retryable})).To(Equal(time.Hour))
+		})
+
+		It("should refuse no tiers and duplicate delays", func() {
+			_, err := NewRetryTiers("outstanding-notifications", nil)
+			Expect(err).ToNot(BeNil())
+			_, err = NewRetryTiers("outstanding-notifications", []time.Duration{time.Minute, 60 * time.Second})
+			Expect(err).ToNot(BeNil())
+		})
+	})
+})
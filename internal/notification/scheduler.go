@@ -0,0 +1,118 @@
+package notification
+
+import (
+	"context"
+	"github.com/cockroachdb/cockroach-go/v2/crdb/crdbpgx"
+	"github.com/jackc/pgx/v4"
+	"github.com/rs/zerolog/log"
+	"go.uber.org/atomic"
+	"time"
+)
+
+type deliverer interface {
+	prepare(ctx context.Context, serverNotification *Notification, tx pgx.Tx) (*DelegatingNotification, error)
+	deliver(ctx context.Context, serverNotification *Notification, dn *DelegatingNotification, attempt, circuitOpen int) error
+	async(f func())
+}
+
+// Scheduler releases the notifications parked by the OutstandingService once due, every instance runs one
+type Scheduler struct {
+	persistence *CRDBPersistence
+	delivery    deliverer
+	interval    time.Duration
+	batchSize   int
+	// lease is how long a claimed notification is left to its scheduler before another one claims it again
+	lease   time.Duration
+	stopped *atomic.Bool
+	done    chan struct{}
+}
+
+func NewScheduler(persistence *CRDBPersistence, ous *OutstandingService, interval time.Duration, batchSize int,
+	lease time.Duration) *Scheduler {
+	s := &Scheduler{
+		persistence: persistence,
+		delivery:    ous,
+		interval:    interval,
+		batchSize:   batchSize,
+		lease:       lease,
+		stopped:     atomic.NewBool(false),
+		done:        make(chan struct{}),
+	}
+	s.releaseDueNotifications()
+	return s
+}
+
+func (s *Scheduler) Stop() {
+	s.stopped.Store(true)
+	<-s.done
+}
+
+func (s *Scheduler) releaseDueNotifications() {
+	go func() {
+		defer close(s.done)
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if s.stopped.Load() {
+				return
+			}
+			released, err := s.releaseBatch(context.Background())
+			if err != nil {
+				log.Err(err).Msg("could not release scheduled notifications")
+			}
+			if released > 0 {
+				log.Info().Int("released", released).Msg("released scheduled notifications")
+			}
+		}
+	}()
+}
+
+func (s *Scheduler) releaseBatch(ctx context.Context) (int, error) {
+	var (
+		claimed     []*Notification
+		dispatching []*DelegatingNotification
+	)
+	err := crdbpgx.ExecuteTx(ctx, s.persistence.GetPool(), pgx.TxOptions{}, func(tx pgx.Tx) error {
+		var err error
+		claimed, err = s.persistence.ClaimDue(ctx, s.batchSize, s.lease, tx)
+		if err != nil {
+			return err
+		}
+		dispatching = make([]*DelegatingNotification, len(claimed))
+		for i, n := range claimed {
+			// one that is past dispatching was released by a scheduler that died before unscheduling it
+			if n.State == StateScheduled || n.State == StateDispatching {
+				if dispatching[i], err = s.delivery.prepare(ctx, n, tx); err != nil {
+					return err
+				}
+			}
+			if dispatching[i] == nil {
+				if err = s.persistence.Unschedule(ctx, n, tx); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	for i := range claimed {
+		n, dn := claimed[i], dispatching[i]
+		if dn == nil {
+			continue
+		}
+		s.delivery.async(func() {
+			err := s.delivery.deliver(ctx, n, dn, 1, 0)
+			if err == nil {
+				err = crdbpgx.ExecuteTx(ctx, s.persistence.GetPool(), pgx.TxOptions{}, func(tx pgx.Tx) error {
+					return s.persistence.Unschedule(ctx, n, tx)
+				})
+			}
+			if err != nil {
+				log.Err(err).Str("uuid", n.UUID.String()).Msg("could not release scheduled notification")
+			}
+		})
+	}
+	return len(claimed), nil
+}
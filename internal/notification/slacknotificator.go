@@ -6,12 +6,19 @@ import (
 )
 
 type SlackNotificator struct {
-	// business stuff
+	Workspace string
+	// Token is the bot token of the workspace, never logged
+	Token string
 }
 
-func (sn *SlackNotificator) Send(txt string) error {
+func (sn *SlackNotificator) Send(notification *DelegatingNotification) error {
+	// no attempt gets a message to a recipient that is neither a channel nor a user through
+	if recipient := notification.Recipient(); recipient.SlackChannel == "" && recipient.SlackUser == "" {
+		return NewPermanentError(fmt.Errorf("%w: no slack channel or user", ErrNoRecipient))
+	}
 	// business logic regarding slack notifications
-	log.Info().Msg(fmt.Sprintf("Sent an Slack NotificationRequest with txt %s", txt))
+	log.Info().Str("tenant_id", notification.TenantID()).Str("workspace", sn.Workspace).
+		Msg(fmt.Sprintf("Sent an Slack NotificationRequest to %s with txt %s", notification.Recipient(), notification.Txt()))
 	return nil
 }
 
@@ -6,12 +6,18 @@ import (
 )
 
 type SMSNotificator struct {
-	// business stuff
+	// SenderID is who the SMS appears to come from, the provider's default when empty
+	SenderID string
 }
 
-func (smsn *SMSNotificator) Send(txt string) error {
+func (smsn *SMSNotificator) Send(notification *DelegatingNotification) error {
+	// no attempt gets a message to a number that isn't E.164 through
+	if phone := notification.Recipient().Phone; !e164Regex.MatchString(phone) {
+		return NewPermanentError(fmt.Errorf("%w: no E.164 phone number, got %q", ErrNoRecipient, phone))
+	}
 	// business logic regarding sms notifications
-	log.Info().Msg(fmt.Sprintf("Sent an SMS NotificationRequest with txt %s", txt))
+	log.Info().Str("tenant_id", notification.TenantID()).Str("sender_id", smsn.SenderID).
+		Msg(fmt.Sprintf("Sent an SMS NotificationRequest to %s with txt %s", notification.Recipient().Phone, notification.Txt()))
 	return nil
 }
 
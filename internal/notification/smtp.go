@@ -0,0 +1,273 @@
+package notification
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"sync"
+	"time"
+)
+
+type SMTPSecurity string
+
+const (
+	// SMTPStartTLS upgrades the connection before authenticating, a relay that can't is refused
+	SMTPStartTLS SMTPSecurity = "starttls"
+	// SMTPImplicitTLS connects with TLS, usually to port 465
+	SMTPImplicitTLS SMTPSecurity = "tls"
+	// SMTPNone is only meant for relays on localhost
+	SMTPNone SMTPSecurity = "none"
+)
+
+type SMTPAuthMechanism string
+
+const (
+	SMTPAuthPlain SMTPAuthMechanism = "plain"
+	SMTPAuthLogin SMTPAuthMechanism = "login"
+)
+
+// SMTPConfig is how to reach a relay, authenticated with Auth when there is a Username
+type SMTPConfig struct {
+	// Addr is the host:port of the relay
+	Addr        string
+	Security    SMTPSecurity
+	Auth        SMTPAuthMechanism
+	Username    string
+	Password    string
+	MaxConns    int
+	IdleTimeout time.Duration
+	// Timeout bounds connecting and every message sent
+	Timeout time.Duration
+	// TLSConfig verifies the relay against its host when nil
+	TLSConfig *tls.Config
+}
+
+// SMTPPool sends messages through a relay over at most MaxConns connections
+type SMTPPool struct {
+	config    *SMTPConfig
+	host      string
+	tlsConfig *tls.Config
+	auth      smtp.Auth
+	slots     chan struct{}
+
+	mu     sync.Mutex
+	idle   []*smtpConn
+	closed bool
+}
+
+type smtpConn struct {
+	conn      net.Conn
+	client    *smtp.Client
+	idleSince time.Time
+}
+
+func NewSMTPPool(config *SMTPConfig) (*SMTPPool, error) {
+	host, _, err := net.SplitHostPort(config.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("smtp relay %q: %w", config.Addr, err)
+	}
+	if config.Security != SMTPStartTLS && config.Security != SMTPImplicitTLS && config.Security != SMTPNone {
+		return nil, fmt.Errorf("smtp security must be %s, %s or %s, got %q", SMTPStartTLS, SMTPImplicitTLS, SMTPNone, config.Security)
+	}
+	if config.MaxConns < 1 || config.Timeout <= 0 {
+		return nil, fmt.Errorf("smtp max conns and timeout must be positive, got %d and %s", config.MaxConns, config.Timeout)
+	}
+	p := &SMTPPool{
+		config:    config,
+		host:      host,
+		tlsConfig: &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12},
+		slots:     make(chan struct{}, config.MaxConns),
+	}
+	if config.TLSConfig != nil {
+		p.tlsConfig = config.TLSConfig.Clone()
+		if p.tlsConfig.ServerName == "" {
+			p.tlsConfig.ServerName = host
+		}
+	}
+	if config.Username != "" {
+		switch config.Auth {
+		case SMTPAuthPlain:
+			p.auth = smtp.PlainAuth("", config.Username, config.Password, host)
+		case SMTPAuthLogin:
+			p.auth = &loginAuth{username: config.Username, password: config.Password, host: host}
+		default:
+			return nil, fmt.Errorf("smtp auth must be %s or %s, got %q", SMTPAuthPlain, SMTPAuthLogin, config.Auth)
+		}
+	}
+	return p, nil
+}
+
+// Send relays msg to the recipients, a 5xx reply refuses it for good.
+// A stale idle connection is replaced once, unless DATA was already sent
+func (p *SMTPPool) Send(from string, to []string, msg []byte) error {
+	p.slots <- struct{}{}
+	defer func() {
+		<-p.slots
+	}()
+	sc, reused, err := p.get()
+	if err != nil {
+		return NewRetryableError(err)
+	}
+	dataSent, err := sc.send(from, to, msg, p.config.Timeout)
+	var reply *textproto.Error
+	if err != nil && reused && !dataSent && !errors.As(err, &reply) {
+		_ = sc.client.Close()
+		if sc, err = p.dial(); err != nil {
+			return NewRetryableError(err)
+		}
+		_, err = sc.send(from, to, msg, p.config.Timeout)
+	}
+	if err != nil {
+		_ = sc.client.Close()
+		if errors.As(err, &reply) && reply.Code >= 500 {
+			return NewPermanentError(err)
+		}
+		return NewRetryableError(err)
+	}
+	p.put(sc)
+	return nil
+}
+
+// Close says goodbye on the idle connections, the ones in use are closed once their message went through
+func (p *SMTPPool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	for _, sc := range p.idle {
+		_ = sc.client.Quit()
+	}
+	p.idle = nil
+}
+
+// get returns the most recently used idle connection, or a new one
+func (p *SMTPPool) get() (*smtpConn, bool, error) {
+	p.mu.Lock()
+	for len(p.idle) > 0 {
+		sc := p.idle[len(p.idle)-1]
+		p.idle = p.idle[:len(p.idle)-1]
+		if p.config.IdleTimeout > 0 && time.Since(sc.idleSince) > p.config.IdleTimeout {
+			_ = sc.client.Close()
+			continue
+		}
+		p.mu.Unlock()
+		return sc, true, nil
+	}
+	p.mu.Unlock()
+	sc, err := p.dial()
+	return sc, false, err
+}
+
+func (p *SMTPPool) put(sc *smtpConn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		_ = sc.client.Quit()
+		return
+	}
+	sc.idleSince = time.Now()
+	p.idle = append(p.idle, sc)
+}
+
+func (p *SMTPPool) dial() (*smtpConn, error) {
+	dialer := &net.Dialer{Timeout: p.config.Timeout}
+	var (
+		conn net.Conn
+		err  error
+	)
+	if p.config.Security == SMTPImplicitTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", p.config.Addr, p.tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", p.config.Addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = conn.SetDeadline(time.Now().Add(p.config.Timeout)); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	client, err := smtp.NewClient(conn, p.host)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	if err = p.handshake(client); err != nil {
+		_ = client.Close()
+		return nil, err
+	}
+	return &smtpConn{conn: conn, client: client}, nil
+}
+
+func (p *SMTPPool) handshake(client *smtp.Client) error {
+	if p.config.Security == SMTPStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("smtp relay %s doesn't support STARTTLS", p.config.Addr)
+		}
+		if err := client.StartTLS(p.tlsConfig); err != nil {
+			return err
+		}
+	}
+	if p.auth == nil {
+		return nil
+	}
+	return client.Auth(p.auth)
+}
+
+// send tells if the relay took DATA before failing, from then on it may have the message
+func (sc *smtpConn) send(from string, to []string, msg []byte, timeout time.Duration) (bool, error) {
+	if err := sc.conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return false, err
+	}
+	if err := sc.client.Mail(from); err != nil {
+		return false, err
+	}
+	for _, rcpt := range to {
+		if err := sc.client.Rcpt(rcpt); err != nil {
+			return false, err
+		}
+	}
+	w, err := sc.client.Data()
+	if err != nil {
+		return false, err
+	}
+	if _, err = w.Write(msg); err != nil {
+		return true, err
+	}
+	return true, w.Close()
+}
+
+// loginAuth is the LOGIN mechanism, which net/smtp doesn't have
+type loginAuth struct {
+	username string
+	password string
+	host     string
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	isLocalhost := server.Name == "localhost" || server.Name == "127.0.0.1" || server.Name == "::1"
+	if !server.TLS && !isLocalhost {
+		return "", nil, fmt.Errorf("unencrypted connection")
+	}
+	if server.Name != a.host {
+		return "", nil, fmt.Errorf("wrong host name")
+	}
+	return "LOGIN", nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	switch strings.ToLower(strings.TrimSpace(string(fromServer))) {
+	case "username:":
+		return []byte(a.username), nil
+	case "password:":
+		return []byte(a.password), nil
+	default:
+		return nil, fmt.Errorf("unexpected LOGIN challenge %q", fromServer)
+	}
+}
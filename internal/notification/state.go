@@ -0,0 +1,108 @@
+package notification
+
+import (
+	"fmt"
+	"strings"
+)
+
+var ErrInvalidTransition = fmt.Errorf("invalid state transition")
+
+// State is where a notification is in its delivery, it only moves along stateTransitions:
+//
+//	received -> scheduled -> dispatching -> delivered | failed | suppressed
+//	received -> dispatching
+//	dispatching -> retrying -> dispatching
+//	received | scheduled | retrying -> cancelled | expired
+type State string
+
+const (
+	// StateReceived is stored but not dispatched yet
+	StateReceived State = "received"
+	// StateScheduled is waiting for the scheduler to release it at send_at
+	StateScheduled State = "scheduled"
+	// StateDispatching is being handed to its notificator, it stays there if the instance dies meanwhile
+	StateDispatching State = "dispatching"
+	// StateRetrying waits in a retry tier until it is dispatched again
+	StateRetrying State = "retrying"
+	// StateDelivered was accepted by its notificator
+	StateDelivered State = "delivered"
+	// StateFailed could not be rendered, was refused for good or ran out of attempts
+	StateFailed State = "failed"
+	// StateSuppressed was dropped instead of delivered, the suppressed reason says why
+	StateSuppressed State = "suppressed"
+	// StateCancelled was cancelled before it was dispatched
+	StateCancelled State = "cancelled"
+	// StateExpired was given up on before it was dispatched
+	StateExpired State = "expired"
+)
+
+var stateTransitions = map[State][]State{
+	StateReceived:    {StateScheduled, StateDispatching, StateCancelled, StateExpired},
+	StateScheduled:   {StateDispatching, StateCancelled, StateExpired},
+	StateDispatching: {StateDelivered, StateFailed, StateSuppressed, StateRetrying},
+	StateRetrying:    {StateDispatching, StateCancelled, StateExpired},
+}
+
+// stateColumn is when a notification entered the state, and why or by which provider
+type stateColumn struct {
+	at       string
+	reason   string
+	provider string
+}
+
+// TransitionOpts is why a notification entered a state, Reason for retrying, failed and suppressed, Provider for delivered
+type TransitionOpts struct {
+	Reason   string
+	Provider string
+}
+
+// received is stamped by the insert as the server timestamp
+var stateColumns = map[State]*stateColumn{
+	StateScheduled:   {at: "scheduled_at"},
+	StateDispatching: {at: "dispatched_at"},
+	StateRetrying:    {at: "retrying_at", reason: "retry_reason"},
+	StateDelivered:   {at: "delivered_at", provider: "provider"},
+	StateFailed:      {at: "failed_at", reason: "failure_reason"},
+	StateSuppressed:  {at: "suppressed_at", reason: "suppressed_reason"},
+	StateCancelled:   {at: "cancelled_at"},
+	StateExpired:     {at: "expired_at"},
+}
+
+// CanTransition tells if the state machine allows moving from one state to the other
+func CanTransition(from, to State) bool {
+	for _, next := range stateTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// predecessors are the states a notification can move to the given one from
+func predecessors(to State) []string {
+	from := make([]string, 0, len(stateTransitions))
+	for _, s := range States {
+		if CanTransition(s, to) {
+			from = append(from, string(s))
+		}
+	}
+	return from
+}
+
+// Final states never change again
+func (s State) Final() bool {
+	return len(stateTransitions[s]) == 0
+}
+
+// States are every state a notification can be in
+var States = []State{StateReceived, StateScheduled, StateDispatching, StateRetrying, StateDelivered, StateFailed,
+	StateSuppressed, StateCancelled, StateExpired}
+
+func toServerState(s string) (State, bool) {
+	for _, state := range States {
+		if string(state) == strings.ToLower(s) {
+			return state, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,53 @@
+package notification_test
+
+import (
+	"github.com/despondency/notifications-service/internal/notification"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("State machine", func() {
+
+	Context("Pending states", func() {
+		It("should only be dispatched, cancelled or expired", func() {
+			for _, from := range []notification.State{notification.StateReceived, notification.StateScheduled} {
+				Expect(notification.CanTransition(from, notification.StateDispatching)).To(BeTrue(), string(from))
+				Expect(notification.CanTransition(from, notification.StateCancelled)).To(BeTrue(), string(from))
+				Expect(notification.CanTransition(from, notification.StateExpired)).To(BeTrue(), string(from))
+				Expect(notification.CanTransition(from, notification.StateDelivered)).To(BeFalse(), string(from))
+				Expect(from.Final()).To(BeFalse())
+			}
+			Expect(notification.CanTransition(notification.StateReceived, notification.StateScheduled)).To(BeTrue())
+			Expect(notification.CanTransition(notification.StateScheduled, notification.StateReceived)).To(BeFalse())
+		})
+	})
+
+	Context("Dispatching", func() {
+		It("should end delivered, failed or suppressed", func() {
+			Expect(notification.CanTransition(notification.StateDispatching, notification.StateDelivered)).To(BeTrue())
+			Expect(notification.CanTransition(notification.StateDispatching, notification.StateFailed)).To(BeTrue())
+			Expect(notification.CanTransition(notification.StateDispatching, notification.StateSuppressed)).To(BeTrue())
+			Expect(notification.CanTransition(notification.StateDispatching, notification.StateCancelled)).To(BeFalse())
+		})
+	})
+
+	Context("Retrying", func() {
+		It("should only be dispatched again, cancelled or expired", func() {
+			Expect(notification.CanTransition(notification.StateDispatching, notification.StateRetrying)).To(BeTrue())
+			Expect(notification.CanTransition(notification.StateRetrying, notification.StateDispatching)).To(BeTrue())
+			Expect(notification.CanTransition(notification.StateRetrying, notification.StateCancelled)).To(BeTrue())
+			Expect(notification.CanTransition(notification.StateRetrying, notification.StateDelivered)).To(BeFalse())
+			Expect(notification.StateRetrying.Final()).To(BeFalse())
+		})
+	})
+
+	Context("Final states", func() {
+		It("should never change again", func() {
+			for _, s := range []notification.State{notification.StateDelivered, notification.StateFailed, notification.StateSuppressed,
+				notification.StateCancelled, notification.StateExpired} {
+				Expect(s.Final()).To(BeTrue(), string(s))
+				Expect(notification.CanTransition(s, notification.StateDispatching)).To(BeFalse(), string(s))
+			}
+		})
+	})
+})
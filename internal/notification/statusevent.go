@@ -0,0 +1,254 @@
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/cockroachdb/cockroach-go/v2/crdb/crdbpgx"
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/despondency/notifications-service/internal/messaging"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/rs/zerolog/log"
+	"go.uber.org/atomic"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const statusFeedTimeoutMs = 5000
+
+var ErrInvalidStatusCursor = fmt.Errorf("invalid status event cursor")
+
+// StatusEvent is a state a notification entered
+type StatusEvent struct {
+	UUID        uuid.UUID  `json:"uuid"`
+	ParentUUID  *uuid.UUID `json:"parent_uuid,omitempty"`
+	TenantID    string     `json:"tenant_id"`
+	Destination string     `json:"destination"`
+	State       State      `json:"state"`
+	Reason      string     `json:"reason,omitempty"`
+	// Provider is who delivered it, only for delivered
+	Provider string    `json:"provider,omitempty"`
+	At       time.Time `json:"at"`
+}
+
+// StatusCursor is the offset of the last event read from every partition of the status events topic
+type StatusCursor map[int32]int64
+
+// String is the SSE event id, like 0:41,1:17
+func (c StatusCursor) String() string {
+	partitions := make([]int, 0, len(c))
+	for p := range c {
+		partitions = append(partitions, int(p))
+	}
+	sort.Ints(partitions)
+	parts := make([]string, len(partitions))
+	for i, p := range partitions {
+		parts[i] = strconv.Itoa(p) + ":" + strconv.FormatInt(c[int32(p)], 10)
+	}
+	return strings.Join(parts, ",")
+}
+
+func ParseStatusCursor(s string) (StatusCursor, error) {
+	c := make(StatusCursor)
+	for _, part := range strings.Split(s, ",") {
+		p, o, ok := strings.Cut(part, ":")
+		partition, errP := strconv.ParseInt(p, 10, 32)
+		offset, errO := strconv.ParseInt(o, 10, 64)
+		if !ok || errP != nil || errO != nil || partition < 0 || offset < -1 {
+			return nil, fmt.Errorf("%w %q", ErrInvalidStatusCursor, s)
+		}
+		c[int32(partition)] = offset
+	}
+	return c, nil
+}
+
+func (c StatusCursor) copy() StatusCursor {
+	cp := make(StatusCursor, len(c))
+	for p, o := range c {
+		cp[p] = o
+	}
+	return cp
+}
+
+// StatusFeedEvent is an event and the cursor to resume right after it
+type StatusFeedEvent struct {
+	Event  *StatusEvent
+	Cursor StatusCursor
+}
+
+//go:generate mockgen -source statusevent.go -destination ./notificationmocks/statusfeed_mock.go -package notificationmocks
+type StatusFeed interface {
+	// Subscribe streams the events after the cursor, or the ones from now on when it is nil, until ctx is done
+	Subscribe(ctx context.Context, after StatusCursor) (<-chan *StatusFeedEvent, error)
+}
+
+// KafkaStatusFeed assigns every subscription every partition without joining a group, so each sees every event
+type KafkaStatusFeed struct {
+	bootstrapServers string
+	topic            string
+}
+
+func NewKafkaStatusFeed(bootstrapServers, topic string) *KafkaStatusFeed {
+	return &KafkaStatusFeed{
+		bootstrapServers: bootstrapServers,
+		topic:            topic,
+	}
+}
+
+func (f *KafkaStatusFeed) Subscribe(ctx context.Context, after StatusCursor) (<-chan *StatusFeedEvent, error) {
+	consumer, err := kafka.NewConsumer(&kafka.ConfigMap{
+		"bootstrap.servers":  f.bootstrapServers,
+		"group.id":           "notifications-status-feed-" + uuid.NewString(),
+		"auto.offset.reset":  "earliest",
+		"enable.auto.commit": "false"})
+	if err != nil {
+		return nil, err
+	}
+	cursor, assignments, err := f.assignments(consumer, after)
+	if err == nil {
+		err = consumer.Assign(assignments)
+	}
+	if err != nil {
+		_ = consumer.Close()
+		return nil, err
+	}
+	events := make(chan *StatusFeedEvent)
+	go func() {
+		defer close(events)
+		defer consumer.Close()
+		for ctx.Err() == nil {
+			switch e := consumer.Poll(100).(type) {
+			case *kafka.Message:
+				cursor[e.TopicPartition.Partition] = int64(e.TopicPartition.Offset)
+				event := &StatusEvent{}
+				if err := json.Unmarshal(e.Value, event); err != nil {
+					log.Err(err).Msg("skipped malformed status event")
+					continue
+				}
+				select {
+				case events <- &StatusFeedEvent{Event: event, Cursor: cursor.copy()}:
+				case <-ctx.Done():
+				}
+			case kafka.Error:
+				log.Err(e).Msg("kafka produced an error in status feed")
+			}
+		}
+	}()
+	return events, nil
+}
+
+// assignments starts every partition after its cursor offset, or after its last event
+func (f *KafkaStatusFeed) assignments(consumer *kafka.Consumer, after StatusCursor) (StatusCursor, []kafka.TopicPartition, error) {
+	md, err := consumer.GetMetadata(&f.topic, false, statusFeedTimeoutMs)
+	if err != nil {
+		return nil, nil, err
+	}
+	partitions := md.Topics[f.topic].Partitions
+	cursor := make(StatusCursor, len(partitions))
+	assignments := make([]kafka.TopicPartition, 0, len(partitions))
+	for _, p := range partitions {
+		offset, ok := after[p.ID]
+		if !ok {
+			_, high, err := consumer.QueryWatermarkOffsets(f.topic, p.ID, statusFeedTimeoutMs)
+			if err != nil {
+				return nil, nil, err
+			}
+			offset = high - 1
+		}
+		cursor[p.ID] = offset
+		assignments = append(assignments, kafka.TopicPartition{Topic: &f.topic, Partition: p.ID, Offset: kafka.Offset(offset + 1)})
+	}
+	return cursor, assignments, nil
+}
+
+// StatusRelay publishes the recorded status events keyed by notification, every instance runs one.
+// An event can be published twice when a relay dies or outlives its lease
+type StatusRelay struct {
+	persistence *CRDBPersistence
+	producer    *messaging.KafkaProducer
+	interval    time.Duration
+	batchSize   int
+	lease       time.Duration
+	stopped     *atomic.Bool
+	done        chan struct{}
+}
+
+func NewStatusRelay(persistence *CRDBPersistence, producer *messaging.KafkaProducer, interval time.Duration, batchSize int,
+	lease time.Duration) *StatusRelay {
+	sr := &StatusRelay{
+		persistence: persistence,
+		producer:    producer,
+		interval:    interval,
+		batchSize:   batchSize,
+		lease:       lease,
+		stopped:     atomic.NewBool(false),
+		done:        make(chan struct{}),
+	}
+	sr.relayStatusEvents()
+	return sr
+}
+
+func (sr *StatusRelay) Stop() {
+	sr.stopped.Store(true)
+	<-sr.done
+}
+
+func (sr *StatusRelay) relayStatusEvents() {
+	go func() {
+		defer close(sr.done)
+		ticker := time.NewTicker(sr.interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if sr.stopped.Load() {
+				return
+			}
+			// keep going while batches come back full
+			for !sr.stopped.Load() {
+				relayed, err := sr.relayBatch(context.Background())
+				if err != nil {
+					log.Err(err).Msg("could not relay status events")
+				}
+				if err != nil || relayed < sr.batchSize {
+					break
+				}
+			}
+		}
+	}()
+}
+
+func (sr *StatusRelay) relayBatch(ctx context.Context) (int, error) {
+	var (
+		ids    []int64
+		events []*StatusEvent
+	)
+	err := crdbpgx.ExecuteTx(ctx, sr.persistence.GetPool(), pgx.TxOptions{}, func(tx pgx.Tx) error {
+		var err error
+		ids, events, err = sr.persistence.ClaimStatusEvents(ctx, sr.batchSize, sr.lease, tx)
+		return err
+	})
+	if err != nil || len(events) == 0 {
+		return 0, err
+	}
+	keys := make([][]byte, len(events))
+	payloads := make([][]byte, len(events))
+	for i, e := range events {
+		keys[i] = []byte(e.UUID.String())
+		payloads[i], err = json.Marshal(e)
+		if err != nil {
+			return 0, err
+		}
+	}
+	// on err nothing is deleted and the whole batch is published again once its lease is over
+	for _, err = range sr.producer.ProduceKeyedBatch(keys, payloads) {
+		if err != nil {
+			return 0, err
+		}
+	}
+	err = crdbpgx.ExecuteTx(ctx, sr.persistence.GetPool(), pgx.TxOptions{}, func(tx pgx.Tx) error {
+		return sr.persistence.DeleteStatusEvents(ctx, ids, tx)
+	})
+	return len(events), err
+}
@@ -0,0 +1,188 @@
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+	"github.com/rs/zerolog/log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const statusEventsHeartbeat = 15 * time.Second
+
+// StatusEventsEndpoint caps the streams of the instance and of a tenant, each holds its own consumer, 0 is no cap
+type StatusEventsEndpoint struct {
+	feed             StatusFeed
+	maxStreams       int
+	maxTenantStreams int
+
+	mu            sync.Mutex
+	streams       int
+	tenantStreams map[string]int
+	stopping      chan struct{}
+	stopOnce      sync.Once
+}
+
+func NewStatusEventsEndpoint(feed StatusFeed, maxStreams, maxTenantStreams int) *StatusEventsEndpoint {
+	return &StatusEventsEndpoint{
+		feed:             feed,
+		maxStreams:       maxStreams,
+		maxTenantStreams: maxTenantStreams,
+		tenantStreams:    make(map[string]int),
+		stopping:         make(chan struct{}),
+	}
+}
+
+// Stop ends the open streams, http.Server.Shutdown waits for them otherwise
+func (se *StatusEventsEndpoint) Stop() {
+	se.stopOnce.Do(func() {
+		close(se.stopping)
+	})
+}
+
+// openStream counts a stream of the tenant, unless it is over a cap
+func (se *StatusEventsEndpoint) openStream(tenantID string) *RateLimitError {
+	se.mu.Lock()
+	defer se.mu.Unlock()
+	if se.maxStreams > 0 && se.streams >= se.maxStreams {
+		return &RateLimitError{Limit: "status stream", RetryAfter: statusEventsHeartbeat}
+	}
+	if se.maxTenantStreams > 0 && se.tenantStreams[tenantID] >= se.maxTenantStreams {
+		return &RateLimitError{Limit: "tenant status stream", RetryAfter: statusEventsHeartbeat}
+	}
+	se.streams++
+	se.tenantStreams[tenantID]++
+	return nil
+}
+
+func (se *StatusEventsEndpoint) closeStream(tenantID string) {
+	se.mu.Lock()
+	defer se.mu.Unlock()
+	se.streams--
+	if se.tenantStreams[tenantID]--; se.tenantStreams[tenantID] == 0 {
+		delete(se.tenantStreams, tenantID)
+	}
+}
+
+// statusEventFilter keeps the caller's events, a uuid matches a notification and the children of a fan-out
+type statusEventFilter struct {
+	tenantID     string
+	destinations map[string]struct{}
+	uuids        map[uuid.UUID]struct{}
+}
+
+func (f *statusEventFilter) matches(e *StatusEvent) bool {
+	if e.TenantID != f.tenantID {
+		return false
+	}
+	if _, ok := f.destinations[e.Destination]; len(f.destinations) > 0 && !ok {
+		return false
+	}
+	if len(f.uuids) == 0 {
+		return true
+	}
+	if _, ok := f.uuids[e.UUID]; ok {
+		return true
+	}
+	if e.ParentUUID != nil {
+		_, ok := f.uuids[*e.ParentUUID]
+		return ok
+	}
+	return false
+}
+
+// StreamStatusEvents streams status events as Server-Sent Events, a reconnecting client resumes after the Last-Event-ID it got
+func (se *StatusEventsEndpoint) StreamStatusEvents(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	filter := &statusEventFilter{
+		tenantID:     IdentityFromContext(r.Context()).TenantID,
+		destinations: make(map[string]struct{}),
+		uuids:        make(map[uuid.UUID]struct{}),
+	}
+	ve := &ValidationError{}
+	for _, d := range r.URL.Query()["destination"] {
+		dest, err := toServerNotificationDestination(d)
+		if err != nil {
+			ve.add("destination", "must be one of SMS, EMAIL, SLACK")
+			continue
+		}
+		filter.destinations[dest.String()] = struct{}{}
+	}
+	for _, id := range r.URL.Query()["uuid"] {
+		nUUID, err := uuid.Parse(id)
+		if err != nil {
+			ve.add("uuid", "must be a valid uuid")
+			continue
+		}
+		filter.uuids[nUUID] = struct{}{}
+	}
+	var after StatusCursor
+	if lastEventID := r.Header.Get("Last-Event-ID"); lastEventID != "" {
+		var err error
+		if after, err = ParseStatusCursor(lastEventID); err != nil {
+			ve.add("Last-Event-ID", "must be the id of an event of this stream")
+		}
+	}
+	if len(ve.Fields) > 0 {
+		writeProblem(w, r, validationProblem(ve))
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		log.Error().Msg("response writer can't stream status events")
+		writeProblem(w, r, internalProblem())
+		return
+	}
+	if rle := se.openStream(filter.tenantID); rle != nil {
+		writeRateLimited(w, r, rle)
+		return
+	}
+	defer se.closeStream(filter.tenantID)
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	events, err := se.feed.Subscribe(ctx, after)
+	if err != nil {
+		log.Err(err).Msg("could not subscribe to status events")
+		writeProblem(w, r, internalProblem())
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	heartbeat := time.NewTicker(statusEventsHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-se.stopping:
+			return
+		case <-heartbeat.C:
+			// keeps proxies from closing an idle stream
+			if _, err = fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		case fe, ok := <-events:
+			if !ok {
+				return
+			}
+			if !filter.matches(fe.Event) {
+				continue
+			}
+			b, errMarshal := json.Marshal(fe.Event)
+			if errMarshal != nil {
+				log.Err(errMarshal).Msg("could not marshal status event")
+				continue
+			}
+			if _, err = fmt.Fprintf(w, "id: %s\ndata: %s\n\n", fe.Cursor, b); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
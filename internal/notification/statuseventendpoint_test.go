@@ -0,0 +1,180 @@
+package notification_test
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/despondency/notifications-service/internal/notification"
+	"github.com/despondency/notifications-service/internal/notification/notificationmocks"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+)
+
+var _ = Describe("Status events endpoint", func() {
+
+	var (
+		mockedStatusFeed *notificationmocks.MockStatusFeed
+		ctrl             *gomock.Controller
+		router           *httprouter.Router
+		req              *http.Request
+		rr               *httptest.ResponseRecorder
+		parent           uuid.UUID
+		events           chan *notification.StatusFeedEvent
+	)
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		mockedStatusFeed = notificationmocks.NewMockStatusFeed(ctrl)
+		router = httprouter.New()
+		router.GET("/notifications/events", notification.NewStatusEventsEndpoint(mockedStatusFeed, 0, 0).StreamStatusEvents)
+		parent = uuid.New()
+		// the stream ends when the feed closes
+		events = make(chan *notification.StatusFeedEvent, 4)
+		events <- &notification.StatusFeedEvent{
+			Event:  &notification.StatusEvent{UUID: uuid.New(), TenantID: notification.DefaultTenant, Destination: "SMS", State: notification.StateReceived},
+			Cursor: notification.StatusCursor{0: 10, 1: 4},
+		}
+		events <- &notification.StatusFeedEvent{
+			Event: &notification.StatusEvent{UUID: uuid.New(), ParentUUID: &parent, TenantID: notification.DefaultTenant,
+				Destination: "EMAIL", State: notification.StateDelivered},
+			Cursor: notification.StatusCursor{0: 11, 1: 4},
+		}
+		events <- &notification.StatusFeedEvent{
+			Event:  &notification.StatusEvent{UUID: uuid.New(), TenantID: "payments", Destination: "EMAIL", State: notification.StateFailed},
+			Cursor: notification.StatusCursor{0: 11, 1: 5},
+		}
+		close(events)
+	})
+
+	JustBeforeEach(func() {
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+	})
+
+	// dataLines returns the events of the stream
+	dataLines := func() []*notification.StatusEvent {
+		streamed := make([]*notification.StatusEvent, 0)
+		for _, line := range strings.Split(rr.Body.String(), "\n") {
+			if data := strings.TrimPrefix(line, "data: "); data != line {
+				e := &notification.StatusEvent{}
+				Expect(json.Unmarshal([]byte(data), e)).To(Succeed())
+				streamed = append(streamed, e)
+			}
+		}
+		return streamed
+	}
+
+	Context("Every event of the tenant, 200", func() {
+		BeforeEach(func() {
+			mockedStatusFeed.EXPECT().Subscribe(gomock.Any(), gomock.Nil()).Return(events, nil).Times(1)
+			req, _ = http.NewRequest("GET", "/notifications/events", nil)
+		})
+
+		It("should stream them with their cursor as id", func() {
+			Expect(rr.Code).To(Equal(http.StatusOK))
+			Expect(rr.Header().Get("Content-Type")).To(Equal("text/event-stream"))
+			Expect(dataLines()).To(HaveLen(2))
+			Expect(rr.Body.String()).To(HavePrefix("id: 0:10,1:4\ndata: "))
+			Expect(rr.Body.String()).To(ContainSubstring("id: 0:11,1:4\n"))
+		})
+	})
+
+	Context("Filtered by destination and fan-out, resumed, 200", func() {
+		BeforeEach(func() {
+			mockedStatusFeed.EXPECT().Subscribe(gomock.Any(), notification.StatusCursor{0: 9, 1: 4}).Return(events, nil).Times(1)
+			req, _ = http.NewRequest("GET", "/notifications/events?destination=email&uuid="+parent.String(), nil)
+			req.Header.Set("Last-Event-ID", "0:9,1:4")
+		})
+
+		It("should only stream the matching events", func() {
+			Expect(rr.Code).To(Equal(http.StatusOK))
+			streamed := dataLines()
+			Expect(streamed).To(HaveLen(1))
+			Expect(*streamed[0].ParentUUID).To(Equal(parent))
+			Expect(streamed[0].State).To(Equal(notification.StateDelivered))
+		})
+	})
+
+	Context("Over the tenant's streams, 429 problem", func() {
+		var nested *httptest.ResponseRecorder
+
+		BeforeEach(func() {
+			router = httprouter.New()
+			router.GET("/notifications/events", notification.NewStatusEventsEndpoint(mockedStatusFeed, 10, 1).StreamStatusEvents)
+			req, _ = http.NewRequest("GET", "/notifications/events", nil)
+			mockedStatusFeed.EXPECT().Subscribe(gomock.Any(), gomock.Nil()).
+				DoAndReturn(func(context.Context, notification.StatusCursor) (<-chan *notification.StatusFeedEvent, error) {
+					// opened while the first stream is still open
+					nested = httptest.NewRecorder()
+					router.ServeHTTP(nested, req)
+					return events, nil
+				}).Times(1)
+		})
+
+		It("should refuse another stream until one closed", func() {
+			Expect(rr.Code).To(Equal(http.StatusOK))
+			Expect(nested.Code).To(Equal(http.StatusTooManyRequests))
+			Expect(nested.Header().Get("Retry-After")).ToNot(BeEmpty())
+
+			closed := make(chan *notification.StatusFeedEvent)
+			close(closed)
+			mockedStatusFeed.EXPECT().Subscribe(gomock.Any(), gomock.Nil()).Return(closed, nil).Times(1)
+			again := httptest.NewRecorder()
+			router.ServeHTTP(again, req)
+			Expect(again.Code).To(Equal(http.StatusOK))
+		})
+	})
+
+	Context("Stopped while streaming", func() {
+		BeforeEach(func() {
+			endpoint := notification.NewStatusEventsEndpoint(mockedStatusFeed, 0, 0)
+			router = httprouter.New()
+			router.GET("/notifications/events", endpoint.StreamStatusEvents)
+			req, _ = http.NewRequest("GET", "/notifications/events", nil)
+			mockedStatusFeed.EXPECT().Subscribe(gomock.Any(), gomock.Nil()).
+				DoAndReturn(func(context.Context, notification.StatusCursor) (<-chan *notification.StatusFeedEvent, error) {
+					endpoint.Stop()
+					// never closed, like a feed that is still consuming
+					return make(chan *notification.StatusFeedEvent), nil
+				}).Times(1)
+		})
+
+		It("should end the stream", func() {
+			Expect(rr.Code).To(Equal(http.StatusOK))
+			Expect(dataLines()).To(BeEmpty())
+		})
+	})
+
+	Context("Invalid filters, 422 problem", func() {
+		BeforeEach(func() {
+			mockedStatusFeed.EXPECT().Subscribe(gomock.Any(), gomock.Any()).Times(0)
+			req, _ = http.NewRequest("GET", "/notifications/events?destination=PIGEON&uuid=nope", nil)
+			req.Header.Set("Last-Event-ID", "yesterday")
+		})
+
+		It("should name every one", func() {
+			Expect(rr.Code).To(Equal(http.StatusUnprocessableEntity))
+			p := &notification.Problem{}
+			Expect(json.Unmarshal(rr.Body.Bytes(), p)).To(Succeed())
+			Expect(p.InvalidParams).To(HaveLen(3))
+		})
+	})
+})
+
+var _ = Describe("Status cursor", func() {
+	It("should round trip", func() {
+		c, err := notification.ParseStatusCursor("1:17,0:41")
+		Expect(err).To(BeNil())
+		Expect(c).To(Equal(notification.StatusCursor{0: 41, 1: 17}))
+		Expect(c.String()).To(Equal("0:41,1:17"))
+		for _, s := range []string{"", "0", "0:x", "-1:4", "0:4,"} {
+			_, err = notification.ParseStatusCursor(s)
+			Expect(err).ToNot(BeNil(), s)
+		}
+	})
+})
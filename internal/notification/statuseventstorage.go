@@ -0,0 +1,105 @@
+package notification
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
+	"sort"
+	"time"
+)
+
+// InsertStatusEvent records a state the notification entered, to be relayed to the status events topic
+func (crdbp *CRDBPersistence) InsertStatusEvent(ctx context.Context, event *StatusEvent, tx pgx.Tx) error {
+	dest, err := toServerNotificationDestination(event.Destination)
+	if err != nil {
+		return err
+	}
+	_, errExec := tx.Exec(ctx,
+		"INSERT into status_events(tenant_id, notification_uuid, parent_uuid, destination, state, reason, provider, created_at) "+
+			"VALUES ($1, $2, $3, $4, $5, $6, $7, now())",
+		event.TenantID,
+		event.UUID,
+		toDBUUID(event.ParentUUID),
+		pgtype.Int2{Int: int16(dest), Status: pgtype.Present},
+		event.State,
+		toDBVarchar(event.Reason),
+		toDBVarchar(event.Provider),
+	)
+	return errExec
+}
+
+// ClaimStatusEvents leases the oldest remaining event of each notification to the relay,
+// so its events are published in order
+func (crdbp *CRDBPersistence) ClaimStatusEvents(ctx context.Context, limit int, lease time.Duration, tx pgx.Tx) ([]int64, []*StatusEvent, error) {
+	rows, err := tx.Query(ctx,
+		"UPDATE status_events SET claimed_until = now()::TIMESTAMP + $2 * INTERVAL '1 second' "+
+			"WHERE id IN (SELECT id FROM status_events s "+
+			"WHERE (s.claimed_until IS NULL OR s.claimed_until <= now()::TIMESTAMP) "+
+			"AND NOT EXISTS (SELECT 1 FROM status_events e WHERE e.notification_uuid = s.notification_uuid AND e.id < s.id) "+
+			"ORDER BY s.id LIMIT $1 FOR UPDATE SKIP LOCKED) "+
+			"RETURNING id, tenant_id, notification_uuid, parent_uuid, destination, state, reason, provider, created_at",
+		limit,
+		lease.Seconds(),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	ids := make([]int64, 0, limit)
+	events := make([]*StatusEvent, 0, limit)
+	for rows.Next() {
+		var (
+			id         int64
+			event      = &StatusEvent{}
+			parentUUID pgtype.UUID
+			dest       pgtype.Int2
+			reason     pgtype.Varchar
+			provider   pgtype.Varchar
+			createdAt  pgtype.Timestamp
+		)
+		errScan := rows.Scan(&id, &event.TenantID, &event.UUID, &parentUUID, &dest, &event.State, &reason, &provider, &createdAt)
+		if errScan != nil {
+			return nil, nil, errScan
+		}
+		if parentUUID.Status == pgtype.Present {
+			parent := uuid.UUID(parentUUID.Bytes)
+			event.ParentUUID = &parent
+		}
+		event.Destination = Destination(dest.Int).String()
+		event.Reason = reason.String
+		event.Provider = provider.String
+		event.At = createdAt.Time
+		ids = append(ids, id)
+		events = append(events, event)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	// RETURNING has no order
+	sort.Sort(&statusEventsByID{ids: ids, events: events})
+	return ids, events, nil
+}
+
+type statusEventsByID struct {
+	ids    []int64
+	events []*StatusEvent
+}
+
+func (s *statusEventsByID) Len() int {
+	return len(s.ids)
+}
+
+func (s *statusEventsByID) Less(i, j int) bool {
+	return s.ids[i] < s.ids[j]
+}
+
+func (s *statusEventsByID) Swap(i, j int) {
+	s.ids[i], s.ids[j] = s.ids[j], s.ids[i]
+	s.events[i], s.events[j] = s.events[j], s.events[i]
+}
+
+func (crdbp *CRDBPersistence) DeleteStatusEvents(ctx context.Context, ids []int64, tx pgx.Tx) error {
+	_, errExec := tx.Exec(ctx, "DELETE FROM status_events WHERE id = ANY($1::INT8[])", ids)
+	return errExec
+}
@@ -2,18 +2,51 @@ package notification
 
 import (
 	"context"
+	"fmt"
 	"github.com/google/uuid"
 	"github.com/jackc/pgtype"
 	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
+	"strconv"
+	"time"
 )
 
+const notificationColumns = "uuid, txt, destination, server_timestamp, last_updated, conflict_count, last_conflict_at, send_at, recipient, parent_uuid, " +
+	"template_id, template_version, params, priority, tenant_id, status, scheduled_at, dispatched_at, delivered_at, failed_at, " +
+	"suppressed_at, cancelled_at, expired_at, suppressed_reason, failure_reason, retrying_at, retry_reason, provider"
+
 type storageModel struct {
-	UUID            uuid.UUID
-	Txt             string
-	Dest            pgtype.Int2
-	ServerTimestamp pgtype.Timestamp
-	LastUpdated     pgtype.Timestamp
+	UUID             uuid.UUID
+	Txt              string
+	Dest             pgtype.Int2
+	ServerTimestamp  pgtype.Timestamp
+	LastUpdated      pgtype.Timestamp
+	PayloadHash      []byte
+	ConflictCount    int64
+	LastConflictAt   pgtype.Timestamp
+	SendAt           pgtype.Timestamp
+	Recipient        pgtype.JSONB
+	ParentUUID       pgtype.UUID
+	TemplateID       pgtype.Varchar
+	TemplateVersion  pgtype.Int8
+	Params           pgtype.JSONB
+	Priority         pgtype.Varchar
+	TenantID         string
+	RecipientKey     pgtype.Varchar
+	Status           string
+	ScheduledAt      pgtype.Timestamp
+	DispatchedAt     pgtype.Timestamp
+	DeliveredAt      pgtype.Timestamp
+	FailedAt         pgtype.Timestamp
+	SuppressedAt     pgtype.Timestamp
+	CancelledAt      pgtype.Timestamp
+	ExpiredAt        pgtype.Timestamp
+	SuppressedReason pgtype.Varchar
+	FailureReason    pgtype.Varchar
+	RetryingAt       pgtype.Timestamp
+	RetryReason      pgtype.Varchar
+	Provider         pgtype.Varchar
+	CallbackURL      pgtype.Varchar
 }
 
 type CRDBPersistence struct {
@@ -33,36 +66,408 @@ func (crdbp *CRDBPersistence) GetPool() *pgxpool.Pool {
 func (crdbp *CRDBPersistence) InsertIfNotExists(ctx context.Context, notification *Notification, tx pgx.Tx) (int64, error) {
 	dbNotificationModel := toDBNotification(notification)
 	v, errExec := tx.Exec(ctx,
-		"INSERT into notifications(uuid, txt, destination, server_timestamp, last_updated) "+
-			"VALUES ($1, $2, $3, $4, $5) ON CONFLICT(uuid) DO NOTHING",
+		"INSERT into notifications(uuid, txt, destination, server_timestamp, last_updated, payload_hash, send_at, recipient, parent_uuid, "+
+			"template_id, template_version, params, priority, tenant_id, recipient_key, status, callback_url) "+
+			"VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17) ON CONFLICT(tenant_id, uuid) DO NOTHING",
 		dbNotificationModel.UUID,
 		dbNotificationModel.Txt,
 		dbNotificationModel.Dest,
 		dbNotificationModel.ServerTimestamp,
 		dbNotificationModel.LastUpdated,
+		dbNotificationModel.PayloadHash,
+		dbNotificationModel.SendAt,
+		dbNotificationModel.Recipient,
+		dbNotificationModel.ParentUUID,
+		dbNotificationModel.TemplateID,
+		dbNotificationModel.TemplateVersion,
+		dbNotificationModel.Params,
+		dbNotificationModel.Priority,
+		dbNotificationModel.TenantID,
+		dbNotificationModel.RecipientKey,
+		StateReceived,
+		dbNotificationModel.CallbackURL,
 	)
 	if errExec != nil {
 		return -1, errExec
 	}
+	if v.RowsAffected() == 1 {
+		errExec = crdbp.InsertStatusEvent(ctx, &StatusEvent{
+			UUID:        notification.UUID,
+			ParentUUID:  notification.ParentUUID,
+			TenantID:    dbNotificationModel.TenantID,
+			Destination: notification.Dest.String(),
+			State:       StateReceived,
+		}, tx)
+		if errExec != nil {
+			return -1, errExec
+		}
+	}
 	return v.RowsAffected(), nil
 }
 
-func (crdbp *CRDBPersistence) Get(ctx context.Context, notifUUID uuid.UUID, tx pgx.Tx) (*Notification, error) {
-	r := tx.QueryRow(ctx, "SELECT uuid, txt, destination, server_timestamp, last_updated FROM notifications WHERE uuid = $1", notifUUID)
+func (crdbp *CRDBPersistence) Schedule(ctx context.Context, notification *Notification, tx pgx.Tx) error {
+	_, errExec := tx.Exec(ctx,
+		"INSERT into scheduled_notifications(tenant_id, uuid, send_at) VALUES ($1, $2, $3) ON CONFLICT(tenant_id, uuid) DO NOTHING",
+		tenantOrDefault(notification.TenantID),
+		notification.UUID,
+		toDBTimestamp(notification.SendAt),
+	)
+	return errExec
+}
+
+// ClaimDue leases up to limit due notifications, skipping the ones another scheduler is claiming.
+// They stay scheduled until Unschedule. This is the only read that isn't scoped to a tenant
+func (crdbp *CRDBPersistence) ClaimDue(ctx context.Context, limit int, lease time.Duration, tx pgx.Tx) ([]*Notification, error) {
+	rows, err := tx.Query(ctx,
+		"UPDATE scheduled_notifications SET send_at = now()::TIMESTAMP + $2 * INTERVAL '1 second' "+
+			"WHERE (tenant_id, uuid) IN (SELECT tenant_id, uuid FROM scheduled_notifications WHERE send_at <= now()::TIMESTAMP "+
+			"ORDER BY send_at LIMIT $1 FOR UPDATE SKIP LOCKED) RETURNING tenant_id, uuid",
+		limit,
+		lease.Seconds(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	type key struct {
+		tenantID string
+		uuid     uuid.UUID
+	}
+	keys := make([]key, 0, limit)
+	for rows.Next() {
+		var k key
+		if err = rows.Scan(&k.tenantID, &k.uuid); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	claimed := make([]*Notification, 0, len(keys))
+	for _, k := range keys {
+		n, errGet := crdbp.Get(ctx, k.tenantID, k.uuid, tx)
+		if errGet == pgx.ErrNoRows {
+			// purged before it was due
+			errGet = crdbp.Unschedule(ctx, &Notification{TenantID: k.tenantID, UUID: k.uuid}, tx)
+			if errGet != nil {
+				return nil, errGet
+			}
+			continue
+		}
+		if errGet != nil {
+			return nil, errGet
+		}
+		claimed = append(claimed, n)
+	}
+	return claimed, nil
+}
+
+// RecordIfConflicting marks the stored notification when the given one reuses its uuid with a different payload,
+// rows stored without a payload hash never conflict
+func (crdbp *CRDBPersistence) RecordIfConflicting(ctx context.Context, notification *Notification, tx pgx.Tx) (bool, error) {
+	v, errExec := tx.Exec(ctx,
+		"UPDATE notifications SET conflict_count = conflict_count + 1, last_conflict_hash = $2, "+
+			"last_conflict_at = now(), last_updated = now() "+
+			"WHERE tenant_id = $3 AND uuid = $1 AND payload_hash IS NOT NULL AND payload_hash != $2",
+		notification.UUID,
+		notification.PayloadHash(),
+		tenantOrDefault(notification.TenantID),
+	)
+	if errExec != nil {
+		return false, errExec
+	}
+	return v.RowsAffected() == 1, nil
+}
+
+// Transition moves the stored notification to the given state if the state machine allows it, else ErrInvalidTransition.
+// It records a status event, and queues the callback when the state is final
+func (crdbp *CRDBPersistence) Transition(ctx context.Context, notification *Notification, to State, opts TransitionOpts, tx pgx.Tx) error {
+	column, ok := stateColumns[to]
+	from := predecessors(to)
+	if !ok || len(from) == 0 {
+		return fmt.Errorf("%w to %s", ErrInvalidTransition, to)
+	}
+	tenantID := tenantOrDefault(notification.TenantID)
+	query := "UPDATE notifications SET status = $3, " + column.at + " = now(), last_updated = now()"
+	args := []interface{}{tenantID, notification.UUID, to, from}
+	if column.reason != "" {
+		args = append(args, opts.Reason)
+		query += ", " + column.reason + " = $" + strconv.Itoa(len(args))
+	}
+	if column.provider != "" {
+		args = append(args, opts.Provider)
+		query += ", " + column.provider + " = $" + strconv.Itoa(len(args))
+	}
+	var (
+		callbackURL pgtype.Varchar
+		parentUUID  pgtype.UUID
+		dest        pgtype.Int2
+	)
+	errScan := tx.QueryRow(ctx, query+" WHERE tenant_id = $1 AND uuid = $2 AND status = ANY($4::STRING[]) "+
+		"RETURNING callback_url, parent_uuid, destination", args...).Scan(&callbackURL, &parentUUID, &dest)
+	if errScan == nil {
+		notification.State = to
+		event := &StatusEvent{
+			UUID:        notification.UUID,
+			TenantID:    tenantID,
+			Destination: Destination(dest.Int).String(),
+			State:       to,
+			Reason:      opts.Reason,
+			Provider:    opts.Provider,
+		}
+		if parentUUID.Status == pgtype.Present {
+			parent := uuid.UUID(parentUUID.Bytes)
+			event.ParentUUID = &parent
+		}
+		if errInsert := crdbp.InsertStatusEvent(ctx, event, tx); errInsert != nil {
+			return errInsert
+		}
+		if !to.Final() || callbackURL.Status != pgtype.Present {
+			return nil
+		}
+		return crdbp.InsertCallback(ctx, tenantID, notification.UUID, to, callbackURL.String, tx)
+	}
+	if errScan != pgx.ErrNoRows {
+		return errScan
+	}
+	var current State
+	errScan = tx.QueryRow(ctx, "SELECT status FROM notifications WHERE tenant_id = $1 AND uuid = $2",
+		tenantID, notification.UUID).Scan(&current)
+	if errScan != nil {
+		return errScan
+	}
+	return fmt.Errorf("%w from %s to %s", ErrInvalidTransition, current, to)
+}
+
+// InsertCancellation records a tombstone, a notification still in kafka is cancelled when it arrives
+func (crdbp *CRDBPersistence) InsertCancellation(ctx context.Context, tenantID string, notifUUID uuid.UUID, tx pgx.Tx) error {
+	_, errExec := tx.Exec(ctx,
+		"INSERT into cancellations(tenant_id, uuid, cancelled_at) VALUES ($1, $2, now()) ON CONFLICT(tenant_id, uuid) DO NOTHING",
+		tenantID,
+		notifUUID,
+	)
+	return errExec
+}
+
+// IsCancelled tells if there is a tombstone for the notification, or for the parent of its fan-out
+func (crdbp *CRDBPersistence) IsCancelled(ctx context.Context, notification *Notification, tx pgx.Tx) (bool, error) {
+	ids := []uuid.UUID{notification.UUID}
+	if notification.ParentUUID != nil {
+		ids = append(ids, *notification.ParentUUID)
+	}
+	var cancelled bool
+	errScan := tx.QueryRow(ctx,
+		"SELECT EXISTS(SELECT 1 FROM cancellations WHERE tenant_id = $1 AND uuid = ANY($2::UUID[]))",
+		tenantOrDefault(notification.TenantID),
+		toDBUUIDArray(ids),
+	).Scan(&cancelled)
+	return cancelled, errScan
+}
+
+// Unschedule removes the notification from the scheduler
+func (crdbp *CRDBPersistence) Unschedule(ctx context.Context, notification *Notification, tx pgx.Tx) error {
+	_, errExec := tx.Exec(ctx,
+		"DELETE FROM scheduled_notifications WHERE tenant_id = $1 AND uuid = $2",
+		tenantOrDefault(notification.TenantID),
+		notification.UUID,
+	)
+	return errExec
+}
+
+// CountDispatched counts the other notifications of the destination dispatched to the recipient since the given time
+func (crdbp *CRDBPersistence) CountDispatched(ctx context.Context, notification *Notification, since time.Time, tx pgx.Tx) (int64, error) {
+	var count int64
+	errScan := tx.QueryRow(ctx,
+		"SELECT count(*) FROM notifications WHERE tenant_id = $1 AND recipient_key = $2 AND destination = $3 AND dispatched_at > $4 "+
+			"AND status = ANY($5::STRING[]) AND uuid != $6",
+		tenantOrDefault(notification.TenantID),
+		recipientKey(notification.Recipient),
+		pgtype.Int2{Int: int16(notification.Dest), Status: pgtype.Present},
+		pgtype.Timestamp{Time: since, Status: pgtype.Present},
+		[]string{string(StateDispatching), string(StateDelivered)},
+		notification.UUID,
+	).Scan(&count)
+	return count, errScan
+}
+
+func (crdbp *CRDBPersistence) Get(ctx context.Context, tenantID string, notifUUID uuid.UUID, tx pgx.Tx) (*Notification, error) {
+	r := tx.QueryRow(ctx, "SELECT "+notificationColumns+" FROM notifications WHERE tenant_id = $1 AND uuid = $2",
+		tenantID, notifUUID)
+	return scanNotification(r)
+}
+
+func (crdbp *CRDBPersistence) GetMany(ctx context.Context, tenantID string, notifUUIDs []uuid.UUID, tx pgx.Tx) ([]*Notification, error) {
+	rows, err := tx.Query(ctx, "SELECT "+notificationColumns+" FROM notifications WHERE tenant_id = $1 AND uuid = ANY($2::UUID[])",
+		tenantID, toDBUUIDArray(notifUUIDs))
+	if err != nil {
+		return nil, err
+	}
+	return scanNotifications(rows)
+}
+
+// GetByParents returns the fan-out children of the given parents
+func (crdbp *CRDBPersistence) GetByParents(ctx context.Context, tenantID string, parentUUIDs []uuid.UUID, tx pgx.Tx) ([]*Notification, error) {
+	rows, err := tx.Query(ctx, "SELECT "+notificationColumns+" FROM notifications WHERE tenant_id = $1 AND parent_uuid = ANY($2::UUID[]) "+
+		"ORDER BY parent_uuid, destination, uuid", tenantID, toDBUUIDArray(parentUUIDs))
+	if err != nil {
+		return nil, err
+	}
+	return scanNotifications(rows)
+}
+
+// ListNotifications returns a page of the notifications the filter selects, newest first, keyed on (server_timestamp, uuid)
+func (crdbp *CRDBPersistence) ListNotifications(ctx context.Context, filter *ListFilter, tx pgx.Tx) ([]*Notification, error) {
+	query := "SELECT " + notificationColumns + " FROM notifications WHERE tenant_id = $1"
+	args := []interface{}{filter.TenantID}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+	if len(filter.Destinations) > 0 {
+		dests := make([]int16, len(filter.Destinations))
+		for i, d := range filter.Destinations {
+			dests[i] = int16(d)
+		}
+		query += " AND destination = ANY(" + arg(dests) + "::INT2[])"
+	}
+	if len(filter.States) > 0 {
+		states := make([]string, len(filter.States))
+		for i, s := range filter.States {
+			states[i] = string(s)
+		}
+		query += " AND status = ANY(" + arg(states) + "::STRING[])"
+	}
+	if filter.From != nil {
+		query += " AND server_timestamp >= " + arg(toDBTimestamp(filter.From))
+	}
+	if filter.To != nil {
+		query += " AND server_timestamp < " + arg(toDBTimestamp(filter.To))
+	}
+	if filter.After != nil {
+		query += " AND (server_timestamp, uuid) < (" + arg(toDBTimestamp(&filter.After.ServerTimestamp)) + ", " +
+			arg(filter.After.UUID) + ")"
+	}
+	query += " ORDER BY server_timestamp DESC, uuid DESC LIMIT " + arg(filter.Limit)
+	rows, err := tx.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanNotifications(rows)
+}
+
+// FollowerReads must be the first statement of the transaction
+func (crdbp *CRDBPersistence) FollowerReads(ctx context.Context, tx pgx.Tx) error {
+	_, errExec := tx.Exec(ctx, "SET TRANSACTION AS OF SYSTEM TIME follower_read_timestamp()")
+	return errExec
+}
+
+func scanNotifications(rows pgx.Rows) ([]*Notification, error) {
+	defer rows.Close()
+	notifications := make([]*Notification, 0)
+	for rows.Next() {
+		notification, errScan := scanNotification(rows)
+		if errScan != nil {
+			return nil, errScan
+		}
+		notifications = append(notifications, notification)
+	}
+	return notifications, rows.Err()
+}
+
+func scanNotification(r pgx.Row) (*Notification, error) {
 	notification := &storageModel{}
-	errScan := r.Scan(&notification.UUID, &notification.Txt, &notification.Dest, &notification.ServerTimestamp, &notification.LastUpdated)
+	errScan := r.Scan(&notification.UUID, &notification.Txt, &notification.Dest, &notification.ServerTimestamp,
+		&notification.LastUpdated, &notification.ConflictCount, &notification.LastConflictAt, &notification.SendAt,
+		&notification.Recipient, &notification.ParentUUID, &notification.TemplateID, &notification.TemplateVersion,
+		&notification.Params, &notification.Priority, &notification.TenantID, &notification.Status, &notification.ScheduledAt,
+		&notification.DispatchedAt, &notification.DeliveredAt, &notification.FailedAt, &notification.SuppressedAt,
+		&notification.CancelledAt, &notification.ExpiredAt, &notification.SuppressedReason, &notification.FailureReason,
+		&notification.RetryingAt, &notification.RetryReason, &notification.Provider)
 	if errScan != nil {
 		return nil, errScan
 	}
-	return &Notification{
+	return fromDBNotification(notification)
+}
+
+func fromDBNotification(notification *storageModel) (*Notification, error) {
+	n := &Notification{
 		UUID:                    notification.UUID,
 		ServerReceivedTimestamp: notification.ServerTimestamp.Time,
 		NotificationTxt:         notification.Txt,
 		Dest:                    Destination(notification.Dest.Int),
-	}, nil
+		LastUpdated:             notification.LastUpdated.Time,
+		ConflictCount:           notification.ConflictCount,
+		State:                   State(notification.Status),
+		Transitions:             map[State]time.Time{StateReceived: notification.ServerTimestamp.Time},
+		TemplateID:              notification.TemplateID.String,
+		TemplateVersion:         notification.TemplateVersion.Int,
+		Priority:                PriorityNormal,
+		TenantID:                notification.TenantID,
+		SuppressedReason:        notification.SuppressedReason.String,
+		FailureReason:           notification.FailureReason.String,
+		RetryReason:             notification.RetryReason.String,
+		Provider:                notification.Provider.String,
+	}
+	for s, at := range map[State]pgtype.Timestamp{
+		StateScheduled:   notification.ScheduledAt,
+		StateDispatching: notification.DispatchedAt,
+		StateRetrying:    notification.RetryingAt,
+		StateDelivered:   notification.DeliveredAt,
+		StateFailed:      notification.FailedAt,
+		StateSuppressed:  notification.SuppressedAt,
+		StateCancelled:   notification.CancelledAt,
+		StateExpired:     notification.ExpiredAt,
+	} {
+		if at.Status == pgtype.Present {
+			n.Transitions[s] = at.Time
+		}
+	}
+	if notification.Priority.Status == pgtype.Present {
+		n.Priority = Priority(notification.Priority.String)
+	}
+	if notification.LastConflictAt.Status == pgtype.Present {
+		n.LastConflictAt = &notification.LastConflictAt.Time
+	}
+	if notification.SendAt.Status == pgtype.Present {
+		n.SendAt = &notification.SendAt.Time
+	}
+	if notification.ParentUUID.Status == pgtype.Present {
+		parent := uuid.UUID(notification.ParentUUID.Bytes)
+		n.ParentUUID = &parent
+	}
+	if notification.Recipient.Status == pgtype.Present {
+		n.Recipient = &Recipient{}
+		err := notification.Recipient.AssignTo(n.Recipient)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if notification.Params.Status == pgtype.Present {
+		err := notification.Params.AssignTo(&n.Params)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return n, nil
 }
 
 func toDBNotification(n *Notification) *storageModel {
+	recipient := pgtype.JSONB{Status: pgtype.Null}
+	if n.Recipient != nil {
+		// a recipient is plain strings and always marshals
+		_ = recipient.Set(n.Recipient)
+	}
+	params := pgtype.JSONB{Status: pgtype.Null}
+	if n.Params != nil {
+		// params were unmarshalled from json, so they marshal back
+		_ = params.Set(n.Params)
+	}
+	templateVersion := pgtype.Int8{Status: pgtype.Null}
+	if n.TemplateVersion != 0 {
+		templateVersion = pgtype.Int8{Int: n.TemplateVersion, Status: pgtype.Present}
+	}
 	return &storageModel{
 		UUID: n.UUID,
 		Txt:  n.NotificationTxt,
@@ -78,5 +483,52 @@ func toDBNotification(n *Notification) *storageModel {
 			Time:   n.ServerReceivedTimestamp.UTC(),
 			Status: pgtype.Present,
 		},
+		PayloadHash:     n.PayloadHash(),
+		SendAt:          toDBTimestamp(n.SendAt),
+		Recipient:       recipient,
+		ParentUUID:      toDBUUID(n.ParentUUID),
+		TemplateID:      toDBVarchar(n.TemplateID),
+		TemplateVersion: templateVersion,
+		Params:          params,
+		Priority:        toDBVarchar(string(n.Priority)),
+		TenantID:        tenantOrDefault(n.TenantID),
+		RecipientKey:    toDBVarchar(recipientKey(n.Recipient)),
+		CallbackURL:     toDBVarchar(n.CallbackURL),
+	}
+}
+
+func tenantOrDefault(tenantID string) string {
+	if tenantID == "" {
+		// produced before tenants existed
+		return DefaultTenant
+	}
+	return tenantID
+}
+
+func toDBUUIDArray(ids []uuid.UUID) []string {
+	dbIDs := make([]string, len(ids))
+	for i, id := range ids {
+		dbIDs[i] = id.String()
+	}
+	return dbIDs
+}
+
+func toDBUUID(id *uuid.UUID) pgtype.UUID {
+	if id == nil {
+		return pgtype.UUID{Status: pgtype.Null}
+	}
+	return pgtype.UUID{
+		Bytes:  *id,
+		Status: pgtype.Present,
+	}
+}
+
+func toDBTimestamp(t *time.Time) pgtype.Timestamp {
+	if t == nil {
+		return pgtype.Timestamp{Status: pgtype.Null}
+	}
+	return pgtype.Timestamp{
+		Time:   t.UTC(),
+		Status: pgtype.Present,
 	}
 }
@@ -0,0 +1,168 @@
+package notification
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"regexp"
+	"strings"
+	texttemplate "text/template"
+	"time"
+	"unicode/utf8"
+)
+
+var templateNameRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]{0,127}$`)
+
+var (
+	ErrTemplateNotFound = fmt.Errorf("template not found")
+	ErrTemplateExists   = fmt.Errorf("template already exists")
+	ErrNoVariant        = fmt.Errorf("template has no variant for destination")
+	// ErrRender fails the notification, rendering it again would fail the same way
+	ErrRender = fmt.Errorf("cannot render notification")
+)
+
+// Template is a named, immutable version of per destination variants, every update creates the next version
+type Template struct {
+	Name      string             `json:"name"`
+	Version   int64              `json:"version"`
+	Variants  []*TemplateVariant `json:"variants"`
+	CreatedAt time.Time          `json:"created_at"`
+}
+
+// TemplateVariant is the template of a single destination, Subject and HTMLBody are only allowed for EMAIL
+type TemplateVariant struct {
+	Destination string `json:"destination"`
+	Subject     string `json:"subject,omitempty"`
+	Body        string `json:"body"`
+	HTMLBody    string `json:"html_body,omitempty"`
+}
+
+type TemplateRequest struct {
+	Name     string             `json:"name"`
+	Variants []*TemplateVariant `json:"variants"`
+}
+
+type RenderedContent struct {
+	Subject string
+	Txt     string
+	HTML    string
+}
+
+// Validate returns a *ValidationError listing every invalid field, or nil. Names are only checked when withName is set
+func (tr *TemplateRequest) Validate(withName bool) error {
+	ve := &ValidationError{}
+	if withName && !templateNameRegex.MatchString(tr.Name) {
+		ve.add("name", "must be lowercase letters, digits, '_', '-' or '.' and at most 128 characters")
+	}
+	if len(tr.Variants) == 0 {
+		ve.add("variants", "at least one variant is required")
+	}
+	seen := make(map[Destination]struct{}, len(tr.Variants))
+	for i, v := range tr.Variants {
+		field := fmt.Sprintf("variants[%d].", i)
+		if v == nil {
+			ve.add(strings.TrimSuffix(field, "."), "is required")
+			continue
+		}
+		dest, err := toServerNotificationDestination(v.Destination)
+		if err != nil {
+			ve.add(field+"destination", "must be one of SMS, EMAIL, SLACK")
+			continue
+		}
+		if _, ok := seen[dest]; ok {
+			ve.add(field+"destination", "is listed twice")
+		}
+		seen[dest] = struct{}{}
+		if strings.TrimSpace(v.Body) == "" {
+			ve.add(field+"body", "is required")
+		} else if _, err = parseTextTemplate(v.Body); err != nil {
+			ve.add(field+"body", err.Error())
+		}
+		if dest != Email {
+			if v.Subject != "" {
+				ve.add(field+"subject", "is only allowed for EMAIL")
+			}
+			if v.HTMLBody != "" {
+				ve.add(field+"html_body", "is only allowed for EMAIL")
+			}
+			continue
+		}
+		if strings.TrimSpace(v.Subject) == "" {
+			ve.add(field+"subject", "is required for EMAIL")
+		} else if _, err = parseTextTemplate(v.Subject); err != nil {
+			ve.add(field+"subject", err.Error())
+		}
+		if v.HTMLBody != "" {
+			if _, err = parseHTMLTemplate(v.HTMLBody); err != nil {
+				ve.add(field+"html_body", err.Error())
+			}
+		}
+	}
+	if len(ve.Fields) > 0 {
+		return ve
+	}
+	return nil
+}
+
+// Variant returns the variant of the destination, nil when the template has none
+func (t *Template) Variant(dest Destination) *TemplateVariant {
+	for _, v := range t.Variants {
+		if d, err := toServerNotificationDestination(v.Destination); err == nil && d == dest {
+			return v
+		}
+	}
+	return nil
+}
+
+// Render executes the variant strictly, a param missing from params fails instead of rendering "<no value>"
+func (v *TemplateVariant) Render(params map[string]interface{}) (*RenderedContent, error) {
+	if params == nil {
+		params = map[string]interface{}{}
+	}
+	rendered := &RenderedContent{}
+	var err error
+	if rendered.Txt, err = executeText(v.Body, params); err != nil {
+		return nil, err
+	}
+	if v.Subject != "" {
+		if rendered.Subject, err = executeText(v.Subject, params); err != nil {
+			return nil, err
+		}
+	}
+	if v.HTMLBody != "" {
+		t, errParse := parseHTMLTemplate(v.HTMLBody)
+		if errParse != nil {
+			return nil, errParse
+		}
+		buf := &bytes.Buffer{}
+		if err = t.Execute(buf, params); err != nil {
+			return nil, err
+		}
+		rendered.HTML = buf.String()
+	}
+	dest, _ := toServerNotificationDestination(v.Destination)
+	if max := maxTxtLength[dest]; utf8.RuneCountInString(rendered.Txt) > max {
+		return nil, fmt.Errorf("rendered txt is longer than %d characters for %s", max, dest)
+	}
+	return rendered, nil
+}
+
+func executeText(body string, params map[string]interface{}) (string, error) {
+	t, err := parseTextTemplate(body)
+	if err != nil {
+		return "", err
+	}
+	buf := &bytes.Buffer{}
+	if err = t.Execute(buf, params); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func parseTextTemplate(body string) (*texttemplate.Template, error) {
+	return texttemplate.New("").Option("missingkey=error").Parse(body)
+}
+
+func parseHTMLTemplate(body string) (*htmltemplate.Template, error) {
+	return htmltemplate.New("").Option("missingkey=error").Parse(body)
+}
@@ -0,0 +1,148 @@
+package notification_test
+
+import (
+	"github.com/despondency/notifications-service/internal/notification"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"strings"
+)
+
+var _ = Describe("Template validation", func() {
+
+	var (
+		req *notification.TemplateRequest
+		err error
+	)
+
+	BeforeEach(func() {
+		req = &notification.TemplateRequest{
+			Name: "welcome",
+			Variants: []*notification.TemplateVariant{
+				{Destination: "SMS", Body: "Hi {{.name}}"},
+				{Destination: "EMAIL", Subject: "Welcome {{.name}}", Body: "Hi {{.name}}", HTMLBody: "<p>Hi {{.name}}</p>"},
+				{Destination: "SLACK", Body: "*Hi* {{.name}}"},
+			},
+		}
+	})
+
+	JustBeforeEach(func() {
+		err = req.Validate(true)
+	})
+
+	Context("Valid template", func() {
+		It("should have no err", func() {
+			Expect(err).To(BeNil())
+		})
+	})
+
+	Context("Invalid name and no variants", func() {
+		BeforeEach(func() {
+			req.Name = "Welcome Mail"
+			req.Variants = nil
+		})
+
+		It("should reject both fields", func() {
+			ve, ok := err.(*notification.ValidationError)
+			Expect(ok).To(BeTrue())
+			Expect(ve.Fields).To(HaveLen(2))
+			Expect(ve.Fields[0].Name).To(Equal("name"))
+			Expect(ve.Fields[1].Name).To(Equal("variants"))
+		})
+	})
+
+	Context("Subject on SMS and a broken body", func() {
+		BeforeEach(func() {
+			req.Variants[0].Subject = "Hi"
+			req.Variants[2].Body = "Hi {{.name"
+		})
+
+		It("should name every invalid variant field", func() {
+			ve, ok := err.(*notification.ValidationError)
+			Expect(ok).To(BeTrue())
+			Expect(ve.Fields).To(HaveLen(2))
+			Expect(ve.Fields[0]).To(Equal(&notification.FieldError{Name: "variants[0].subject", Reason: "is only allowed for EMAIL"}))
+			Expect(ve.Fields[1].Name).To(Equal("variants[2].body"))
+		})
+	})
+
+	Context("Destination listed twice", func() {
+		BeforeEach(func() {
+			req.Variants[2].Destination = "sms"
+		})
+
+		It("should reject the duplicate", func() {
+			ve, ok := err.(*notification.ValidationError)
+			Expect(ok).To(BeTrue())
+			Expect(ve.Fields).To(ConsistOf(&notification.FieldError{Name: "variants[2].destination", Reason: "is listed twice"}))
+		})
+	})
+})
+
+var _ = Describe("Template rendering", func() {
+
+	var (
+		variant  *notification.TemplateVariant
+		params   map[string]interface{}
+		rendered *notification.RenderedContent
+		err      error
+	)
+
+	BeforeEach(func() {
+		variant = &notification.TemplateVariant{
+			Destination: "EMAIL",
+			Subject:     "Welcome {{.name}}",
+			Body:        "Hi {{.name}}, you are on {{.plan}}",
+			HTMLBody:    "<p>Hi {{.name}}</p>",
+		}
+		params = map[string]interface{}{"name": "Jane", "plan": "pro"}
+	})
+
+	JustBeforeEach(func() {
+		rendered, err = variant.Render(params)
+	})
+
+	Context("Every param given", func() {
+		It("should render every part", func() {
+			Expect(err).To(BeNil())
+			Expect(rendered).To(Equal(&notification.RenderedContent{
+				Subject: "Welcome Jane",
+				Txt:     "Hi Jane, you are on pro",
+				HTML:    "<p>Hi Jane</p>",
+			}))
+		})
+	})
+
+	Context("Missing param", func() {
+		BeforeEach(func() {
+			delete(params, "plan")
+		})
+
+		It("should fail instead of rendering no value", func() {
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("plan"))
+		})
+	})
+
+	Context("Param with markup", func() {
+		BeforeEach(func() {
+			params["name"] = "<b>Jane</b>"
+		})
+
+		It("should only escape the html body", func() {
+			Expect(err).To(BeNil())
+			Expect(rendered.Txt).To(HavePrefix("Hi <b>Jane</b>"))
+			Expect(rendered.HTML).To(Equal("<p>Hi &lt;b&gt;Jane&lt;/b&gt;</p>"))
+		})
+	})
+
+	Context("Rendered SMS too long", func() {
+		BeforeEach(func() {
+			variant = &notification.TemplateVariant{Destination: "SMS", Body: "{{.name}}"}
+			params["name"] = strings.Repeat("a", 1_601)
+		})
+
+		It("should fail", func() {
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
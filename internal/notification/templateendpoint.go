@@ -0,0 +1,128 @@
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/julienschmidt/httprouter"
+	"github.com/rs/zerolog/log"
+	"net/http"
+	"strconv"
+)
+
+//go:generate mockgen -source templateendpoint.go -destination ./notificationmocks/templateservice_mock.go -package notificationmocks
+type TemplateManager interface {
+	CreateTemplate(ctx context.Context, tenantID string, req *TemplateRequest) (*Template, error)
+	UpdateTemplate(ctx context.Context, tenantID string, name string, req *TemplateRequest) (*Template, error)
+	GetTemplate(ctx context.Context, tenantID string, name string, version int64) (*Template, error)
+	ListTemplates(ctx context.Context, tenantID string) ([]*Template, error)
+	DeleteTemplate(ctx context.Context, tenantID string, name string) error
+}
+
+type TemplateEndpoint struct {
+	svc TemplateManager
+}
+
+func NewTemplateEndpoint(svc TemplateManager) *TemplateEndpoint {
+	return &TemplateEndpoint{
+		svc: svc,
+	}
+}
+
+func (te *TemplateEndpoint) CreateTemplate(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	req, ok := decodeTemplateRequest(w, r)
+	if !ok {
+		return
+	}
+	err := req.Validate(true)
+	var t *Template
+	if err == nil {
+		t, err = te.svc.CreateTemplate(r.Context(), IdentityFromContext(r.Context()).TenantID, req)
+	}
+	te.writeTemplate(w, r, http.StatusCreated, t, err)
+}
+
+func (te *TemplateEndpoint) UpdateTemplate(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	req, ok := decodeTemplateRequest(w, r)
+	if !ok {
+		return
+	}
+	err := req.Validate(false)
+	var t *Template
+	if err == nil {
+		t, err = te.svc.UpdateTemplate(r.Context(), IdentityFromContext(r.Context()).TenantID, ps.ByName("name"), req)
+	}
+	te.writeTemplate(w, r, http.StatusOK, t, err)
+}
+
+func (te *TemplateEndpoint) GetTemplate(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var version int64
+	if v := r.URL.Query().Get("version"); v != "" {
+		var err error
+		version, err = strconv.ParseInt(v, 10, 64)
+		if err != nil || version < 1 {
+			writeProblem(w, r, &Problem{
+				Type:          ProblemTypeMalformedRequest,
+				Status:        http.StatusBadRequest,
+				InvalidParams: []*FieldError{{Name: "version", Reason: "must be a positive integer"}},
+			})
+			return
+		}
+	}
+	t, err := te.svc.GetTemplate(r.Context(), IdentityFromContext(r.Context()).TenantID, ps.ByName("name"), version)
+	te.writeTemplate(w, r, http.StatusOK, t, err)
+}
+
+func (te *TemplateEndpoint) ListTemplates(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	templates, err := te.svc.ListTemplates(r.Context(), IdentityFromContext(r.Context()).TenantID)
+	if err != nil {
+		log.Err(err).Msg("internal error")
+		writeProblem(w, r, internalProblem())
+		return
+	}
+	writeJSON(w, http.StatusOK, templates)
+}
+
+func (te *TemplateEndpoint) DeleteTemplate(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	err := te.svc.DeleteTemplate(r.Context(), IdentityFromContext(r.Context()).TenantID, ps.ByName("name"))
+	if err == ErrTemplateNotFound {
+		writeProblem(w, r, notFoundProblem(err))
+		return
+	}
+	if err != nil {
+		log.Err(err).Msg("internal error")
+		writeProblem(w, r, internalProblem())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (te *TemplateEndpoint) writeTemplate(w http.ResponseWriter, r *http.Request, status int, t *Template, err error) {
+	var ve *ValidationError
+	switch {
+	case errors.As(err, &ve):
+		writeProblem(w, r, validationProblem(ve))
+	case err == ErrTemplateNotFound:
+		writeProblem(w, r, notFoundProblem(err))
+	case err == ErrTemplateExists:
+		writeProblem(w, r, conflictProblem(err))
+	case err != nil:
+		log.Err(err).Msg("internal error")
+		writeProblem(w, r, internalProblem())
+	default:
+		writeJSON(w, status, t)
+	}
+}
+
+func decodeTemplateRequest(w http.ResponseWriter, r *http.Request) (*TemplateRequest, bool) {
+	req := &TemplateRequest{}
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(req)
+	if err != nil {
+		log.Err(err).Msg("error while unmarshalling")
+		writeProblem(w, r, malformedProblem(err))
+		return nil, false
+	}
+	return req, true
+}
@@ -0,0 +1,143 @@
+package notification_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/despondency/notifications-service/internal/notification"
+	"github.com/despondency/notifications-service/internal/notification/notificationmocks"
+	"github.com/golang/mock/gomock"
+	"github.com/julienschmidt/httprouter"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"io"
+	"net/http"
+	"net/http/httptest"
+)
+
+var _ = Describe("Template endpoint", func() {
+
+	var (
+		endpoint              *notification.TemplateEndpoint
+		mockedTemplateManager *notificationmocks.MockTemplateManager
+		ctrl                  *gomock.Controller
+		router                *httprouter.Router
+		method                string
+		path                  string
+		body                  io.Reader
+		rr                    *httptest.ResponseRecorder
+	)
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		mockedTemplateManager = notificationmocks.NewMockTemplateManager(ctrl)
+		endpoint = notification.NewTemplateEndpoint(mockedTemplateManager)
+
+		router = httprouter.New()
+		router.POST("/templates", endpoint.CreateTemplate)
+		router.GET("/templates/:name", endpoint.GetTemplate)
+		router.PUT("/templates/:name", endpoint.UpdateTemplate)
+		router.DELETE("/templates/:name", endpoint.DeleteTemplate)
+		body = nil
+	})
+
+	JustBeforeEach(func() {
+		req, _ := http.NewRequest(method, path, body)
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+	})
+
+	Context("Create a template, 201", func() {
+		BeforeEach(func() {
+			method, path = "POST", "/templates"
+			mockedTemplateManager.EXPECT().CreateTemplate(gomock.Any(), notification.DefaultTenant, gomock.Any()).
+				DoAndReturn(func(_ interface{}, _ string, req *notification.TemplateRequest) (*notification.Template, error) {
+					return &notification.Template{Name: req.Name, Version: 1, Variants: req.Variants}, nil
+				}).Times(1)
+			body = bytes.NewBufferString(`{"name": "welcome", "variants": [{"destination": "SMS", "body": "Hi {{.name}}"}]}`)
+		})
+
+		It("should return the first version", func() {
+			Expect(rr.Code).To(Equal(http.StatusCreated))
+			t := &notification.Template{}
+			Expect(json.Unmarshal(rr.Body.Bytes(), t)).To(Succeed())
+			Expect(t.Version).To(Equal(int64(1)))
+		})
+	})
+
+	Context("Create an existing template, 409 problem", func() {
+		BeforeEach(func() {
+			method, path = "POST", "/templates"
+			mockedTemplateManager.EXPECT().CreateTemplate(gomock.Any(), notification.DefaultTenant, gomock.Any()).
+				Return(nil, notification.ErrTemplateExists).Times(1)
+			body = bytes.NewBufferString(`{"name": "welcome", "variants": [{"destination": "SMS", "body": "Hi {{.name}}"}]}`)
+		})
+
+		It("should return a conflict problem", func() {
+			Expect(rr.Code).To(Equal(http.StatusConflict))
+			Expect(rr.Header().Get("Content-Type")).To(Equal("application/problem+json"))
+		})
+	})
+
+	Context("Create a template with a broken body, 422 problem", func() {
+		BeforeEach(func() {
+			method, path = "POST", "/templates"
+			mockedTemplateManager.EXPECT().CreateTemplate(gomock.Any(), notification.DefaultTenant, gomock.Any()).Times(0)
+			body = bytes.NewBufferString(`{"name": "welcome", "variants": [{"destination": "SMS", "body": "Hi {{.name"}]}`)
+		})
+
+		It("should name the body", func() {
+			Expect(rr.Code).To(Equal(http.StatusUnprocessableEntity))
+			p := &notification.Problem{}
+			Expect(json.Unmarshal(rr.Body.Bytes(), p)).To(Succeed())
+			Expect(p.InvalidParams).To(HaveLen(1))
+			Expect(p.InvalidParams[0].Name).To(Equal("variants[0].body"))
+		})
+	})
+
+	Context("Update an unknown template, 404 problem", func() {
+		BeforeEach(func() {
+			method, path = "PUT", "/templates/unknown"
+			mockedTemplateManager.EXPECT().UpdateTemplate(gomock.Any(), notification.DefaultTenant, "unknown", gomock.Any()).
+				Return(nil, notification.ErrTemplateNotFound).Times(1)
+			body = bytes.NewBufferString(`{"variants": [{"destination": "SLACK", "body": "*Hi*"}]}`)
+		})
+
+		It("should return 404", func() {
+			Expect(rr.Code).To(Equal(http.StatusNotFound))
+		})
+	})
+
+	Context("Get a pinned version, 200", func() {
+		BeforeEach(func() {
+			method, path = "GET", "/templates/welcome?version=3"
+			mockedTemplateManager.EXPECT().GetTemplate(gomock.Any(), notification.DefaultTenant, "welcome", int64(3)).
+				Return(&notification.Template{Name: "welcome", Version: 3}, nil).Times(1)
+		})
+
+		It("should return 200", func() {
+			Expect(rr.Code).To(Equal(http.StatusOK))
+		})
+	})
+
+	Context("Get an invalid version, 400 problem", func() {
+		BeforeEach(func() {
+			method, path = "GET", "/templates/welcome?version=latest"
+			mockedTemplateManager.EXPECT().GetTemplate(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+		})
+
+		It("should return 400", func() {
+			Expect(rr.Code).To(Equal(http.StatusBadRequest))
+		})
+	})
+
+	Context("Delete a template, 204", func() {
+		BeforeEach(func() {
+			method, path = "DELETE", "/templates/welcome"
+			mockedTemplateManager.EXPECT().DeleteTemplate(gomock.Any(), notification.DefaultTenant, "welcome").Return(nil).Times(1)
+		})
+
+		It("should return 204", func() {
+			Expect(rr.Code).To(Equal(http.StatusNoContent))
+		})
+	})
+})
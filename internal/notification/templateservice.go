@@ -0,0 +1,95 @@
+package notification
+
+import (
+	"context"
+	"github.com/cockroachdb/cockroach-go/v2/crdb/crdbpgx"
+	"github.com/jackc/pgx/v4"
+)
+
+type TemplateService struct {
+	persistence *CRDBPersistence
+}
+
+func NewTemplateService(persistence *CRDBPersistence) *TemplateService {
+	return &TemplateService{
+		persistence: persistence,
+	}
+}
+
+func (ts *TemplateService) CreateTemplate(ctx context.Context, tenantID string, req *TemplateRequest) (*Template, error) {
+	var created *Template
+	err := crdbpgx.ExecuteTx(ctx, ts.persistence.GetPool(), pgx.TxOptions{}, func(tx pgx.Tx) error {
+		_, errGet := ts.persistence.GetTemplate(ctx, tenantID, req.Name, 0, tx)
+		if errGet == nil {
+			return ErrTemplateExists
+		}
+		if errGet != ErrTemplateNotFound {
+			return errGet
+		}
+		var errInsert error
+		created, errInsert = ts.insertVersion(ctx, tenantID, req.Name, req.Variants, tx)
+		return errInsert
+	})
+	return created, err
+}
+
+// UpdateTemplate creates the next version, notifications pinned to an older version keep rendering it
+func (ts *TemplateService) UpdateTemplate(ctx context.Context, tenantID string, name string, req *TemplateRequest) (*Template, error) {
+	var updated *Template
+	err := crdbpgx.ExecuteTx(ctx, ts.persistence.GetPool(), pgx.TxOptions{}, func(tx pgx.Tx) error {
+		_, errGet := ts.persistence.GetTemplate(ctx, tenantID, name, 0, tx)
+		if errGet != nil {
+			return errGet
+		}
+		var errInsert error
+		updated, errInsert = ts.insertVersion(ctx, tenantID, name, req.Variants, tx)
+		return errInsert
+	})
+	return updated, err
+}
+
+func (ts *TemplateService) GetTemplate(ctx context.Context, tenantID string, name string, version int64) (*Template, error) {
+	var t *Template
+	err := crdbpgx.ExecuteTx(ctx, ts.persistence.GetPool(), pgx.TxOptions{AccessMode: pgx.ReadOnly}, func(tx pgx.Tx) error {
+		var errGet error
+		t, errGet = ts.persistence.GetTemplate(ctx, tenantID, name, version, tx)
+		return errGet
+	})
+	return t, err
+}
+
+func (ts *TemplateService) ListTemplates(ctx context.Context, tenantID string) ([]*Template, error) {
+	var templates []*Template
+	err := crdbpgx.ExecuteTx(ctx, ts.persistence.GetPool(), pgx.TxOptions{AccessMode: pgx.ReadOnly}, func(tx pgx.Tx) error {
+		var errList error
+		templates, errList = ts.persistence.ListTemplates(ctx, tenantID, tx)
+		return errList
+	})
+	return templates, err
+}
+
+// DeleteTemplate deletes every version, notifications still referencing it fail to render
+func (ts *TemplateService) DeleteTemplate(ctx context.Context, tenantID string, name string) error {
+	return crdbpgx.ExecuteTx(ctx, ts.persistence.GetPool(), pgx.TxOptions{}, func(tx pgx.Tx) error {
+		affected, err := ts.persistence.DeleteTemplate(ctx, tenantID, name, tx)
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			return ErrTemplateNotFound
+		}
+		return nil
+	})
+}
+
+func (ts *TemplateService) insertVersion(ctx context.Context, tenantID string, name string, variants []*TemplateVariant, tx pgx.Tx) (*Template, error) {
+	t := &Template{
+		Name:     name,
+		Variants: variants,
+	}
+	version, err := ts.persistence.InsertTemplateVersion(ctx, tenantID, t, tx)
+	if err != nil {
+		return nil, err
+	}
+	return ts.persistence.GetTemplate(ctx, tenantID, name, version, tx)
+}
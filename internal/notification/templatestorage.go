@@ -0,0 +1,133 @@
+package notification
+
+import (
+	"context"
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
+	"time"
+)
+
+const templateColumns = "tenant_id, name, version, destination, subject, body, html_body, created_at"
+
+type templateStorageModel struct {
+	TenantID  string
+	Name      string
+	Version   int64
+	Dest      pgtype.Int2
+	Subject   pgtype.Varchar
+	Body      string
+	HTMLBody  pgtype.Varchar
+	CreatedAt pgtype.Timestamp
+}
+
+// InsertTemplateVersion stores the variants as the next version of the template, starting at 1
+func (crdbp *CRDBPersistence) InsertTemplateVersion(ctx context.Context, tenantID string, t *Template, tx pgx.Tx) (int64, error) {
+	var version int64
+	errScan := tx.QueryRow(ctx, "SELECT COALESCE(max(version), 0) + 1 FROM templates WHERE tenant_id = $1 AND name = $2",
+		tenantID, t.Name).Scan(&version)
+	if errScan != nil {
+		return -1, errScan
+	}
+	createdAt := time.Now().UTC()
+	for _, v := range t.Variants {
+		dest, err := toServerNotificationDestination(v.Destination)
+		if err != nil {
+			return -1, err
+		}
+		_, errExec := tx.Exec(ctx,
+			"INSERT into templates("+templateColumns+") VALUES ($1, $2, $3, $4, $5, $6, $7, $8)",
+			tenantID,
+			t.Name,
+			version,
+			pgtype.Int2{Int: int16(dest), Status: pgtype.Present},
+			toDBVarchar(v.Subject),
+			v.Body,
+			toDBVarchar(v.HTMLBody),
+			pgtype.Timestamp{Time: createdAt, Status: pgtype.Present},
+		)
+		if errExec != nil {
+			return -1, errExec
+		}
+	}
+	return version, nil
+}
+
+// GetTemplate returns the given version of the template, the latest one when version is 0
+func (crdbp *CRDBPersistence) GetTemplate(ctx context.Context, tenantID string, name string, version int64, tx pgx.Tx) (*Template, error) {
+	if version == 0 {
+		errScan := tx.QueryRow(ctx, "SELECT COALESCE(max(version), 0) FROM templates WHERE tenant_id = $1 AND name = $2",
+			tenantID, name).Scan(&version)
+		if errScan != nil {
+			return nil, errScan
+		}
+	}
+	rows, err := tx.Query(ctx, "SELECT "+templateColumns+" FROM templates WHERE tenant_id = $1 AND name = $2 AND version = $3 "+
+		"ORDER BY destination", tenantID, name, version)
+	if err != nil {
+		return nil, err
+	}
+	templates, err := scanTemplates(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(templates) == 0 {
+		return nil, ErrTemplateNotFound
+	}
+	return templates[0], nil
+}
+
+// ListTemplates returns the latest version of every template of the tenant
+func (crdbp *CRDBPersistence) ListTemplates(ctx context.Context, tenantID string, tx pgx.Tx) ([]*Template, error) {
+	rows, err := tx.Query(ctx, "SELECT "+templateColumns+" FROM templates WHERE tenant_id = $1 AND (name, version) IN "+
+		"(SELECT name, max(version) FROM templates WHERE tenant_id = $1 GROUP BY name) ORDER BY name, destination", tenantID)
+	if err != nil {
+		return nil, err
+	}
+	return scanTemplates(rows)
+}
+
+// DeleteTemplate deletes every version of the template
+func (crdbp *CRDBPersistence) DeleteTemplate(ctx context.Context, tenantID string, name string, tx pgx.Tx) (int64, error) {
+	v, errExec := tx.Exec(ctx, "DELETE FROM templates WHERE tenant_id = $1 AND name = $2", tenantID, name)
+	if errExec != nil {
+		return -1, errExec
+	}
+	return v.RowsAffected(), nil
+}
+
+// scanTemplates groups the variant rows, which must be ordered by name and version, into templates
+func scanTemplates(rows pgx.Rows) ([]*Template, error) {
+	defer rows.Close()
+	templates := make([]*Template, 0)
+	var current *Template
+	for rows.Next() {
+		m := &templateStorageModel{}
+		errScan := rows.Scan(&m.TenantID, &m.Name, &m.Version, &m.Dest, &m.Subject, &m.Body, &m.HTMLBody, &m.CreatedAt)
+		if errScan != nil {
+			return nil, errScan
+		}
+		if current == nil || current.Name != m.Name || current.Version != m.Version {
+			current = &Template{
+				Name:      m.Name,
+				Version:   m.Version,
+				Variants:  make([]*TemplateVariant, 0),
+				CreatedAt: m.CreatedAt.Time,
+			}
+			templates = append(templates, current)
+		}
+		current.Variants = append(current.Variants, &TemplateVariant{
+			Destination: Destination(m.Dest.Int).String(),
+			Subject:     m.Subject.String,
+			Body:        m.Body,
+			HTMLBody:    m.HTMLBody.String,
+		})
+	}
+	return templates, rows.Err()
+}
+
+func toDBVarchar(s string) pgtype.Varchar {
+	if s == "" {
+		return pgtype.Varchar{Status: pgtype.Null}
+	}
+	return pgtype.Varchar{String: s, Status: pgtype.Present}
+}
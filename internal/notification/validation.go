@@ -0,0 +1,153 @@
+package notification
+
+import (
+	"fmt"
+	"github.com/google/uuid"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	maxScheduleHorizon = 365 * 24 * time.Hour
+	maxFanOut          = 10
+	maxCallbackURL     = 2048
+	callbackURLReason  = "must be an absolute http or https url of at most 2048 characters"
+)
+
+// max txt length in characters, SMS allows up to 10 concatenated segments
+var maxTxtLength = map[Destination]int{
+	SMS:   1_600,
+	Email: 100_000,
+	Slack: 40_000,
+}
+
+type FieldError struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+type ValidationError struct {
+	Fields []*FieldError
+}
+
+func (ve *ValidationError) Error() string {
+	reasons := make([]string, len(ve.Fields))
+	for i, f := range ve.Fields {
+		reasons[i] = fmt.Sprintf("%s: %s", f.Name, f.Reason)
+	}
+	return strings.Join(reasons, "; ")
+}
+
+func (ve *ValidationError) add(name, reason string) {
+	ve.Fields = append(ve.Fields, &FieldError{Name: name, Reason: reason})
+}
+
+type resolvedDestination struct {
+	dest      Destination
+	recipient *Recipient
+}
+
+// Validate returns a *ValidationError listing every invalid field, or nil
+func (r *Request) Validate() error {
+	_, err := r.resolve()
+	return err
+}
+
+// resolve validates the request and returns every destination it fans out to, with normalized recipients
+func (r *Request) resolve() ([]*resolvedDestination, error) {
+	ve := &ValidationError{}
+	if r.UUID == "" {
+		ve.add("uuid", "is required")
+	} else if nUUID, err := uuid.Parse(r.UUID); err != nil {
+		ve.add("uuid", "must be a valid uuid")
+	} else if nUUID == uuid.Nil {
+		ve.add("uuid", "must not be the nil uuid")
+	}
+	targets := r.Destinations
+	prefix := "destinations[%d]."
+	if targets == nil {
+		targets = []*DestinationRequest{{Destination: r.Destination, Recipient: r.Recipient}}
+		prefix = ""
+	} else if r.Destination != "" || r.Recipient != nil {
+		ve.add("destinations", "must not be combined with destination and recipient")
+	} else if len(targets) == 0 || len(targets) > maxFanOut {
+		ve.add("destinations", fmt.Sprintf("must list between 1 and %d destinations", maxFanOut))
+	}
+	resolved := make([]*resolvedDestination, 0, len(targets))
+	seen := make(map[Destination]struct{}, len(targets))
+	for i, t := range targets {
+		field := prefix
+		if prefix != "" {
+			field = fmt.Sprintf(prefix, i)
+		}
+		if t == nil {
+			ve.add(strings.TrimSuffix(field, "."), "is required")
+			continue
+		}
+		dest, errDest := toServerNotificationDestination(t.Destination)
+		if t.Destination == "" {
+			ve.add(field+"destination", "is required")
+			continue
+		} else if errDest != nil {
+			ve.add(field+"destination", "must be one of SMS, EMAIL, SLACK")
+			continue
+		}
+		if _, ok := seen[dest]; ok {
+			// a child is derived per destination
+			ve.add(field+"destination", "is listed twice")
+			continue
+		}
+		seen[dest] = struct{}{}
+		recipient, errs := normalizeRecipient(field+"recipient", dest, t.Recipient)
+		if len(errs) > 0 {
+			ve.Fields = append(ve.Fields, errs...)
+			continue
+		}
+		resolved = append(resolved, &resolvedDestination{dest: dest, recipient: recipient})
+	}
+	if r.TemplateID != "" {
+		if r.NotificationTxt != "" {
+			ve.add("txt", "must not be combined with template_id")
+		}
+		if !templateNameRegex.MatchString(r.TemplateID) {
+			ve.add("template_id", "must be the name of a template")
+		}
+		if r.TemplateVersion < 0 {
+			ve.add("template_version", "must be positive")
+		}
+	} else if r.TemplateVersion != 0 || r.Params != nil {
+		ve.add("template_id", "is required with template_version and params")
+	} else if strings.TrimSpace(r.NotificationTxt) == "" {
+		ve.add("txt", "is required")
+	} else {
+		for _, rd := range resolved {
+			if max := maxTxtLength[rd.dest]; utf8.RuneCountInString(r.NotificationTxt) > max {
+				ve.add("txt", fmt.Sprintf("must be at most %d characters for %s", max, rd.dest))
+				break
+			}
+		}
+	}
+	if _, err := toServerPriority(r.Priority); err != nil {
+		ve.add("priority", "must be one of critical, high, normal, bulk")
+	}
+	if r.SendAt != nil && time.Until(*r.SendAt) > maxScheduleHorizon {
+		ve.add("send_at", "must be at most a year in the future")
+	}
+	if r.CallbackURL != "" && !validCallbackURL(r.CallbackURL) {
+		ve.add("callback_url", callbackURLReason)
+	}
+	if len(ve.Fields) > 0 {
+		return nil, ve
+	}
+	return resolved, nil
+}
+
+func validCallbackURL(callbackURL string) bool {
+	if len(callbackURL) > maxCallbackURL {
+		return false
+	}
+	u, err := url.Parse(callbackURL)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
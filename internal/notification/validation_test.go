@@ -0,0 +1,268 @@
+package notification_test
+
+import (
+	"github.com/despondency/notifications-service/internal/notification"
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"strings"
+	"time"
+)
+
+var _ = Describe("Request validation", func() {
+
+	var (
+		req *notification.Request
+		err error
+	)
+
+	BeforeEach(func() {
+		req = &notification.Request{
+			UUID:            uuid.New().String(),
+			NotificationTxt: "TXT",
+			Destination:     "SMS",
+			Recipient:       &notification.Recipient{Phone: "+15551234567"},
+		}
+	})
+
+	JustBeforeEach(func() {
+		err = req.Validate()
+	})
+
+	Context("Valid request", func() {
+		It("should have no err", func() {
+			Expect(err).To(BeNil())
+		})
+	})
+
+	Context("Empty request", func() {
+		BeforeEach(func() {
+			req = &notification.Request{}
+		})
+
+		It("should list every required field", func() {
+			ve, ok := err.(*notification.ValidationError)
+			Expect(ok).To(BeTrue())
+			Expect(ve.Fields).To(ConsistOf(
+				&notification.FieldError{Name: "uuid", Reason: "is required"},
+				&notification.FieldError{Name: "destination", Reason: "is required"},
+				&notification.FieldError{Name: "txt", Reason: "is required"},
+			))
+		})
+	})
+
+	Context("Invalid uuid and unknown destination", func() {
+		BeforeEach(func() {
+			req.UUID = "not-a-uuid"
+			req.Destination = "PIGEON"
+		})
+
+		It("should reject both fields", func() {
+			ve, ok := err.(*notification.ValidationError)
+			Expect(ok).To(BeTrue())
+			Expect(ve.Fields).To(HaveLen(2))
+			Expect(ve.Fields[0].Name).To(Equal("uuid"))
+			Expect(ve.Fields[1].Name).To(Equal("destination"))
+		})
+	})
+
+	Context("SMS txt too long", func() {
+		BeforeEach(func() {
+			req.NotificationTxt = strings.Repeat("a", 1_601)
+		})
+
+		It("should reject the txt", func() {
+			ve, ok := err.(*notification.ValidationError)
+			Expect(ok).To(BeTrue())
+			Expect(ve.Fields).To(HaveLen(1))
+			Expect(ve.Fields[0].Name).To(Equal("txt"))
+		})
+	})
+
+	Context("Scheduled too far ahead", func() {
+		BeforeEach(func() {
+			sendAt := time.Now().Add(400 * 24 * time.Hour)
+			req.SendAt = &sendAt
+		})
+
+		It("should reject the send_at", func() {
+			ve, ok := err.(*notification.ValidationError)
+			Expect(ok).To(BeTrue())
+			Expect(ve.Fields).To(ConsistOf(&notification.FieldError{Name: "send_at", Reason: "must be at most a year in the future"}))
+		})
+	})
+
+	Context("Unknown priority", func() {
+		BeforeEach(func() {
+			req.Priority = "urgent"
+		})
+
+		It("should reject the priority", func() {
+			ve, ok := err.(*notification.ValidationError)
+			Expect(ok).To(BeTrue())
+			Expect(ve.Fields).To(ConsistOf(&notification.FieldError{Name: "priority", Reason: "must be one of critical, high, normal, bulk"}))
+		})
+	})
+
+	Context("Same txt for email", func() {
+		BeforeEach(func() {
+			req.NotificationTxt = strings.Repeat("a", 1_601)
+			req.Destination = "EMAIL"
+			req.Recipient = &notification.Recipient{Email: "jane@example.com"}
+		})
+
+		It("should have no err", func() {
+			Expect(err).To(BeNil())
+		})
+	})
+})
+
+var _ = Describe("Fan-out request validation", func() {
+
+	var (
+		req *notification.Request
+		err error
+	)
+
+	BeforeEach(func() {
+		req = &notification.Request{
+			UUID:            uuid.New().String(),
+			NotificationTxt: "TXT",
+			Destinations: []*notification.DestinationRequest{
+				{Destination: "EMAIL", Recipient: &notification.Recipient{Email: "jane@example.com"}},
+				{Destination: "SLACK", Recipient: &notification.Recipient{SlackChannel: "C0123456789"}},
+			},
+		}
+	})
+
+	JustBeforeEach(func() {
+		err = req.Validate()
+	})
+
+	Context("Valid fan-out", func() {
+		It("should have no err", func() {
+			Expect(err).To(BeNil())
+		})
+	})
+
+	Context("Fan-out combined with a single destination", func() {
+		BeforeEach(func() {
+			req.Destination = "SMS"
+		})
+
+		It("should reject the destinations", func() {
+			ve, ok := err.(*notification.ValidationError)
+			Expect(ok).To(BeTrue())
+			Expect(ve.Fields).To(ConsistOf(&notification.FieldError{Name: "destinations", Reason: "must not be combined with destination and recipient"}))
+		})
+	})
+
+	Context("Same destination listed twice", func() {
+		BeforeEach(func() {
+			req.Destinations = append(req.Destinations, &notification.DestinationRequest{
+				Destination: "EMAIL", Recipient: &notification.Recipient{Email: "john@example.com"},
+			})
+		})
+
+		It("should reject the duplicate", func() {
+			ve, ok := err.(*notification.ValidationError)
+			Expect(ok).To(BeTrue())
+			Expect(ve.Fields).To(ConsistOf(&notification.FieldError{Name: "destinations[2].destination", Reason: "is listed twice"}))
+		})
+	})
+
+	Context("Invalid recipient of one destination", func() {
+		BeforeEach(func() {
+			req.Destinations[1].Recipient = &notification.Recipient{SlackChannel: "general"}
+		})
+
+		It("should name the destination index", func() {
+			ve, ok := err.(*notification.ValidationError)
+			Expect(ok).To(BeTrue())
+			Expect(ve.Fields).To(ConsistOf(&notification.FieldError{Name: "destinations[1].recipient.slack_channel", Reason: "must be a Slack channel ID"}))
+		})
+	})
+
+	Context("Txt too long for one of the destinations", func() {
+		BeforeEach(func() {
+			req.NotificationTxt = strings.Repeat("a", 1_601)
+			req.Destinations = append(req.Destinations, &notification.DestinationRequest{
+				Destination: "SMS", Recipient: &notification.Recipient{Phone: "+15551234567"},
+			})
+		})
+
+		It("should reject the txt", func() {
+			ve, ok := err.(*notification.ValidationError)
+			Expect(ok).To(BeTrue())
+			Expect(ve.Fields).To(ConsistOf(&notification.FieldError{Name: "txt", Reason: "must be at most 1600 characters for SMS"}))
+		})
+	})
+
+	Context("Callback url", func() {
+		It("should only accept absolute http and https urls", func() {
+			for _, u := range []string{"https://example.com/hooks", "http://10.0.0.1:8080/status?source=notifications"} {
+				req.CallbackURL = u
+				Expect(req.Validate()).To(BeNil(), u)
+			}
+			for _, u := range []string{"example.com/hooks", "ftp://example.com", "https://", "/hooks", "https://example.com/" + strings.Repeat("a", 2048)} {
+				req.CallbackURL = u
+				ve, ok := req.Validate().(*notification.ValidationError)
+				Expect(ok).To(BeTrue(), u)
+				Expect(ve.Fields[0].Name).To(Equal("callback_url"))
+			}
+		})
+	})
+})
+
+var _ = Describe("Templated request validation", func() {
+
+	var (
+		req *notification.Request
+		err error
+	)
+
+	BeforeEach(func() {
+		req = &notification.Request{
+			UUID:        uuid.New().String(),
+			Destination: "SMS",
+			Recipient:   &notification.Recipient{Phone: "+15551234567"},
+			TemplateID:  "welcome",
+			Params:      map[string]interface{}{"name": "Jane"},
+		}
+	})
+
+	JustBeforeEach(func() {
+		err = req.Validate()
+	})
+
+	Context("Valid templated request", func() {
+		It("should have no err", func() {
+			Expect(err).To(BeNil())
+		})
+	})
+
+	Context("Template combined with txt", func() {
+		BeforeEach(func() {
+			req.NotificationTxt = "TXT"
+		})
+
+		It("should reject the txt", func() {
+			ve, ok := err.(*notification.ValidationError)
+			Expect(ok).To(BeTrue())
+			Expect(ve.Fields).To(ConsistOf(&notification.FieldError{Name: "txt", Reason: "must not be combined with template_id"}))
+		})
+	})
+
+	Context("Params without a template", func() {
+		BeforeEach(func() {
+			req.TemplateID = ""
+			req.NotificationTxt = "TXT"
+		})
+
+		It("should require the template_id", func() {
+			ve, ok := err.(*notification.ValidationError)
+			Expect(ok).To(BeTrue())
+			Expect(ve.Fields).To(ConsistOf(&notification.FieldError{Name: "template_id", Reason: "is required with template_version and params"}))
+		})
+	})
+})
@@ -0,0 +1,4 @@
+// Package notificationpb holds the generated gRPC API, regenerate it after changing proto/notification/v1
+package notificationpb
+
+//go:generate go run github.com/bufbuild/buf/cmd/buf@v1.26.1 generate --template ../../buf.gen.yaml --output ../.. ../../proto
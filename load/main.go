@@ -50,6 +50,7 @@ func sendNotification(idx int) {
 		UUID:            uuid.New().String(),
 		NotificationTxt: fmt.Sprintf("txt-%d", idx),
 		Destination:     "EMAIL",
+		Recipient:       &notification.Recipient{Email: "jane@example.com"},
 	}
 	b, err := json.Marshal(n)
 	if err != nil {
@@ -0,0 +1,5 @@
+ALTER TABLE notifications
+    DROP COLUMN IF EXISTS payload_hash,
+    DROP COLUMN IF EXISTS conflict_count,
+    DROP COLUMN IF EXISTS last_conflict_hash,
+    DROP COLUMN IF EXISTS last_conflict_at;
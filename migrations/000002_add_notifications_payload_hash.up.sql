@@ -0,0 +1,5 @@
+ALTER TABLE notifications
+    ADD COLUMN payload_hash bytes NULL,
+    ADD COLUMN conflict_count int8 NOT NULL DEFAULT 0,
+    ADD COLUMN last_conflict_hash bytes NULL,
+    ADD COLUMN last_conflict_at timestamp NULL;
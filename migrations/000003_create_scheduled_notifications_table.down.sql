@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS scheduled_notifications;
+
+ALTER TABLE notifications DROP COLUMN IF EXISTS send_at;
@@ -0,0 +1,13 @@
+ALTER TABLE notifications ADD COLUMN send_at timestamp NULL;
+
+CREATE TABLE scheduled_notifications (
+                                      uuid uuid NOT NULL,
+                                      send_at timestamp NOT NULL,
+                                      CONSTRAINT scheduled_notifications_pk PRIMARY KEY (uuid),
+                                      INDEX scheduled_notifications_send_at_idx (send_at)
+);
+
+-- Column comments
+
+COMMENT ON COLUMN scheduled_notifications.uuid IS 'UUID of the scheduled notification';
+COMMENT ON COLUMN scheduled_notifications.send_at IS 'When the scheduler should release the notification for delivery';
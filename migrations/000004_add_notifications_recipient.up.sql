@@ -0,0 +1 @@
+ALTER TABLE notifications ADD COLUMN recipient jsonb NULL;
@@ -0,0 +1 @@
+ALTER TABLE notifications ADD COLUMN parent_uuid uuid NULL;
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS notifications@notifications_parent_uuid_idx;
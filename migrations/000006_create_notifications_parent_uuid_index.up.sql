@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS notifications_parent_uuid_idx ON notifications (parent_uuid);
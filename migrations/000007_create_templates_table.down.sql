@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS templates;
+
+ALTER TABLE notifications DROP COLUMN IF EXISTS params;
+ALTER TABLE notifications DROP COLUMN IF EXISTS template_version;
+ALTER TABLE notifications DROP COLUMN IF EXISTS template_id;
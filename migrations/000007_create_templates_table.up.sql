@@ -0,0 +1,24 @@
+ALTER TABLE notifications ADD COLUMN template_id varchar NULL;
+ALTER TABLE notifications ADD COLUMN template_version int8 NULL;
+ALTER TABLE notifications ADD COLUMN params jsonb NULL;
+
+CREATE TABLE templates (
+                                      name varchar NOT NULL,
+                                      version int8 NOT NULL,
+                                      "destination" int2 NOT NULL,
+                                      subject varchar NULL,
+                                      body varchar NOT NULL,
+                                      html_body varchar NULL,
+                                      created_at timestamp NOT NULL,
+                                      CONSTRAINT templates_pk PRIMARY KEY (name, version, "destination")
+);
+
+-- Column comments
+
+COMMENT ON COLUMN templates.name IS 'Name of the template, referenced by notifications as template_id';
+COMMENT ON COLUMN templates.version IS 'Version of the template, every update creates the next one';
+COMMENT ON COLUMN templates."destination" IS 'Destination of the variant';
+COMMENT ON COLUMN templates.subject IS 'Subject template, email only';
+COMMENT ON COLUMN templates.body IS 'Text template, the SMS text, the plain text email body or the Slack mrkdwn';
+COMMENT ON COLUMN templates.html_body IS 'HTML template of the email body, email only';
+COMMENT ON COLUMN templates.created_at IS 'When the version was created';
@@ -0,0 +1 @@
+ALTER TABLE notifications ADD COLUMN priority varchar NULL;
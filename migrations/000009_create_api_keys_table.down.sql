@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS api_keys;
+
+ALTER TABLE notifications DROP COLUMN IF EXISTS tenant_id;
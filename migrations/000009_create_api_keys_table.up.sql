@@ -0,0 +1,26 @@
+ALTER TABLE notifications ADD COLUMN tenant_id varchar NOT NULL DEFAULT 'default';
+
+CREATE TABLE api_keys (
+                                      id uuid NOT NULL,
+                                      tenant_id varchar NOT NULL,
+                                      name varchar NULL,
+                                      prefix varchar NOT NULL,
+                                      key_hash bytes NOT NULL,
+                                      created_at timestamp NOT NULL,
+                                      expires_at timestamp NULL,
+                                      revoked_at timestamp NULL,
+                                      CONSTRAINT api_keys_pk PRIMARY KEY (id),
+                                      UNIQUE INDEX api_keys_key_hash_idx (key_hash),
+                                      INDEX api_keys_tenant_id_idx (tenant_id)
+);
+
+-- Column comments
+
+COMMENT ON COLUMN api_keys.id IS 'ID of the api key';
+COMMENT ON COLUMN api_keys.tenant_id IS 'Tenant every request authenticated with the key acts as';
+COMMENT ON COLUMN api_keys.name IS 'Name given to the key at creation';
+COMMENT ON COLUMN api_keys.prefix IS 'First characters of the key, to tell keys apart without storing them';
+COMMENT ON COLUMN api_keys.key_hash IS 'SHA-256 of the key, the key itself is only returned once';
+COMMENT ON COLUMN api_keys.created_at IS 'When the key was created';
+COMMENT ON COLUMN api_keys.expires_at IS 'When a rotated key stops working';
+COMMENT ON COLUMN api_keys.revoked_at IS 'When the key was revoked';
@@ -0,0 +1,9 @@
+ALTER TABLE templates DROP CONSTRAINT templates_pk, ADD CONSTRAINT templates_pk PRIMARY KEY (name, version, "destination");
+ALTER TABLE templates DROP COLUMN IF EXISTS tenant_id;
+
+ALTER TABLE scheduled_notifications DROP CONSTRAINT scheduled_notifications_pk, ADD CONSTRAINT scheduled_notifications_pk PRIMARY KEY (uuid);
+ALTER TABLE scheduled_notifications DROP COLUMN IF EXISTS tenant_id;
+
+DROP INDEX IF EXISTS notifications@notifications_tenant_id_parent_uuid_idx;
+CREATE INDEX IF NOT EXISTS notifications_parent_uuid_idx ON notifications (parent_uuid);
+ALTER TABLE notifications DROP CONSTRAINT notifications_pk, ADD CONSTRAINT notifications_pk PRIMARY KEY (uuid);
@@ -0,0 +1,15 @@
+ALTER TABLE notifications DROP CONSTRAINT notifications_pk, ADD CONSTRAINT notifications_pk PRIMARY KEY (tenant_id, uuid);
+DROP INDEX IF EXISTS notifications@notifications_parent_uuid_idx;
+CREATE INDEX IF NOT EXISTS notifications_tenant_id_parent_uuid_idx ON notifications (tenant_id, parent_uuid);
+
+ALTER TABLE scheduled_notifications ADD COLUMN tenant_id varchar NOT NULL DEFAULT 'default';
+ALTER TABLE scheduled_notifications DROP CONSTRAINT scheduled_notifications_pk, ADD CONSTRAINT scheduled_notifications_pk PRIMARY KEY (tenant_id, uuid);
+
+ALTER TABLE templates ADD COLUMN tenant_id varchar NOT NULL DEFAULT 'default';
+ALTER TABLE templates DROP CONSTRAINT templates_pk, ADD CONSTRAINT templates_pk PRIMARY KEY (tenant_id, name, version, "destination");
+
+-- Column comments
+
+COMMENT ON COLUMN notifications.tenant_id IS 'Tenant owning the notification, uuids are unique per tenant';
+COMMENT ON COLUMN scheduled_notifications.tenant_id IS 'Tenant owning the scheduled notification';
+COMMENT ON COLUMN templates.tenant_id IS 'Tenant owning the template, names are unique per tenant';
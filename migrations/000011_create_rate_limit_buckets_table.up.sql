@@ -0,0 +1,12 @@
+CREATE TABLE rate_limit_buckets (
+                                      bucket_key varchar NOT NULL,
+                                      tokens float8 NOT NULL,
+                                      updated_at timestamp NOT NULL,
+                                      CONSTRAINT rate_limit_buckets_pk PRIMARY KEY (bucket_key)
+);
+
+-- Column comments
+
+COMMENT ON COLUMN rate_limit_buckets.bucket_key IS 'The limited caller or destination';
+COMMENT ON COLUMN rate_limit_buckets.tokens IS 'Tokens left as of updated_at, negative after a take larger than the burst';
+COMMENT ON COLUMN rate_limit_buckets.updated_at IS 'When tokens were last taken';
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS notifications@notifications_recipient_key_delivered_at_idx;
+
+ALTER TABLE notifications
+    DROP COLUMN IF EXISTS suppressed_reason,
+    DROP COLUMN IF EXISTS suppressed_at,
+    DROP COLUMN IF EXISTS delivered_at,
+    DROP COLUMN IF EXISTS recipient_key;
@@ -0,0 +1,13 @@
+ALTER TABLE notifications
+    ADD COLUMN recipient_key varchar NULL,
+    ADD COLUMN delivered_at timestamp NULL,
+    ADD COLUMN suppressed_at timestamp NULL,
+    ADD COLUMN suppressed_reason varchar NULL;
+CREATE INDEX IF NOT EXISTS notifications_recipient_key_delivered_at_idx ON notifications (tenant_id, recipient_key, "destination", delivered_at);
+
+-- Column comments
+
+COMMENT ON COLUMN notifications.recipient_key IS 'Normalized address of the recipient, frequency caps count per key and destination';
+COMMENT ON COLUMN notifications.delivered_at IS 'When the notification was delegated to its notificator';
+COMMENT ON COLUMN notifications.suppressed_at IS 'When the notification was suppressed instead of delivered';
+COMMENT ON COLUMN notifications.suppressed_reason IS 'Why the notification was suppressed';
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS cancellations;
+
+ALTER TABLE notifications DROP COLUMN IF EXISTS cancelled_at;
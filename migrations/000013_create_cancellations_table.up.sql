@@ -0,0 +1,15 @@
+ALTER TABLE notifications ADD COLUMN cancelled_at timestamp NULL;
+
+CREATE TABLE cancellations (
+                                      tenant_id varchar NOT NULL,
+                                      uuid uuid NOT NULL,
+                                      cancelled_at timestamp NOT NULL,
+                                      CONSTRAINT cancellations_pk PRIMARY KEY (tenant_id, uuid)
+);
+
+-- Column comments
+
+COMMENT ON COLUMN notifications.cancelled_at IS 'When the notification was cancelled before it was delivered';
+COMMENT ON COLUMN cancellations.tenant_id IS 'Tenant that cancelled the notification';
+COMMENT ON COLUMN cancellations.uuid IS 'UUID of the cancelled notification, or of the parent of a cancelled fan-out';
+COMMENT ON COLUMN cancellations.cancelled_at IS 'When the cancellation was requested';
@@ -0,0 +1,10 @@
+DROP INDEX IF EXISTS notifications@notifications_recipient_key_dispatched_at_idx;
+CREATE INDEX IF NOT EXISTS notifications_recipient_key_delivered_at_idx ON notifications (tenant_id, recipient_key, "destination", delivered_at);
+
+ALTER TABLE notifications
+    DROP COLUMN IF EXISTS expired_at,
+    DROP COLUMN IF EXISTS failure_reason,
+    DROP COLUMN IF EXISTS failed_at,
+    DROP COLUMN IF EXISTS dispatched_at,
+    DROP COLUMN IF EXISTS scheduled_at,
+    DROP COLUMN IF EXISTS status;
@@ -0,0 +1,18 @@
+ALTER TABLE notifications
+    ADD COLUMN status varchar NOT NULL DEFAULT 'delivered',
+    ADD COLUMN scheduled_at timestamp NULL,
+    ADD COLUMN dispatched_at timestamp NULL,
+    ADD COLUMN failed_at timestamp NULL,
+    ADD COLUMN failure_reason varchar NULL,
+    ADD COLUMN expired_at timestamp NULL;
+DROP INDEX IF EXISTS notifications@notifications_recipient_key_delivered_at_idx;
+CREATE INDEX IF NOT EXISTS notifications_recipient_key_dispatched_at_idx ON notifications (tenant_id, recipient_key, "destination", dispatched_at);
+
+-- Column comments
+
+COMMENT ON COLUMN notifications.status IS 'State of the notification, it only moves along the delivery state machine';
+COMMENT ON COLUMN notifications.scheduled_at IS 'When the notification was parked for the scheduler';
+COMMENT ON COLUMN notifications.dispatched_at IS 'When the notification was handed to its notificator, frequency caps count from it';
+COMMENT ON COLUMN notifications.failed_at IS 'When the notification failed';
+COMMENT ON COLUMN notifications.failure_reason IS 'Why the notification failed';
+COMMENT ON COLUMN notifications.expired_at IS 'When the notification was given up on';
@@ -0,0 +1 @@
+ALTER TABLE notifications ALTER COLUMN status SET DEFAULT 'delivered';
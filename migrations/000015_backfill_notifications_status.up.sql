@@ -0,0 +1,8 @@
+-- rows stored before the state machine were delivered unless something says otherwise
+UPDATE notifications SET status = 'scheduled'
+WHERE EXISTS(SELECT 1 FROM scheduled_notifications s WHERE s.tenant_id = notifications.tenant_id AND s.uuid = notifications.uuid);
+UPDATE notifications SET status = 'suppressed' WHERE suppressed_reason IS NOT NULL;
+UPDATE notifications SET status = 'cancelled' WHERE cancelled_at IS NOT NULL;
+UPDATE notifications SET dispatched_at = delivered_at WHERE delivered_at IS NOT NULL;
+
+ALTER TABLE notifications ALTER COLUMN status SET DEFAULT 'received';
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS callback_dead_letters;
+DROP TABLE IF EXISTS callbacks;
+
+ALTER TABLE api_keys DROP COLUMN IF EXISTS callback_url;
+ALTER TABLE notifications DROP COLUMN IF EXISTS callback_url;
@@ -0,0 +1,46 @@
+ALTER TABLE notifications ADD COLUMN callback_url varchar NULL;
+ALTER TABLE api_keys ADD COLUMN callback_url varchar NULL;
+
+CREATE TABLE callbacks (
+                                      id uuid NOT NULL DEFAULT gen_random_uuid(),
+                                      tenant_id varchar NOT NULL,
+                                      notification_uuid uuid NOT NULL,
+                                      state varchar NOT NULL,
+                                      url varchar NOT NULL,
+                                      attempts int8 NOT NULL DEFAULT 0,
+                                      next_attempt_at timestamp NOT NULL,
+                                      last_error varchar NULL,
+                                      created_at timestamp NOT NULL,
+                                      CONSTRAINT callbacks_pk PRIMARY KEY (id),
+                                      INDEX callbacks_next_attempt_at_idx (next_attempt_at)
+);
+
+CREATE TABLE callback_dead_letters (
+                                      id uuid NOT NULL,
+                                      tenant_id varchar NOT NULL,
+                                      notification_uuid uuid NOT NULL,
+                                      state varchar NOT NULL,
+                                      url varchar NOT NULL,
+                                      attempts int8 NOT NULL,
+                                      last_error varchar NOT NULL,
+                                      created_at timestamp NOT NULL,
+                                      dead_at timestamp NOT NULL,
+                                      CONSTRAINT callback_dead_letters_pk PRIMARY KEY (id),
+                                      INDEX callback_dead_letters_tenant_id_idx (tenant_id, notification_uuid)
+);
+
+-- Column comments
+
+COMMENT ON COLUMN notifications.callback_url IS 'Where the status event of the notification is posted once it reaches a final state';
+COMMENT ON COLUMN api_keys.callback_url IS 'Callback url of requests sent with the key that name none';
+COMMENT ON COLUMN callbacks.id IS 'ID of the status event, sent to the callback so it can dedupe retries';
+COMMENT ON COLUMN callbacks.tenant_id IS 'Tenant of the notification';
+COMMENT ON COLUMN callbacks.notification_uuid IS 'UUID of the notification the event reports';
+COMMENT ON COLUMN callbacks.state IS 'Final state the notification reached';
+COMMENT ON COLUMN callbacks.url IS 'Callback url the event is posted to';
+COMMENT ON COLUMN callbacks.attempts IS 'How many times posting the event failed';
+COMMENT ON COLUMN callbacks.next_attempt_at IS 'When the event is posted next, pushed forward while an attempt is in flight';
+COMMENT ON COLUMN callbacks.last_error IS 'Why the last attempt failed';
+COMMENT ON COLUMN callbacks.created_at IS 'When the notification reached its final state';
+COMMENT ON COLUMN callback_dead_letters.last_error IS 'Why the last attempt failed before the event was given up on';
+COMMENT ON COLUMN callback_dead_letters.dead_at IS 'When the event was given up on';
@@ -0,0 +1,22 @@
+CREATE TABLE status_events (
+                                      id int8 NOT NULL DEFAULT unique_rowid(),
+                                      tenant_id varchar NOT NULL,
+                                      notification_uuid uuid NOT NULL,
+                                      parent_uuid uuid NULL,
+                                      "destination" int2 NOT NULL,
+                                      state varchar NOT NULL,
+                                      reason varchar NULL,
+                                      created_at timestamp NOT NULL,
+                                      CONSTRAINT status_events_pk PRIMARY KEY (id)
+);
+
+-- Column comments
+
+COMMENT ON COLUMN status_events.id IS 'Roughly the order events were recorded in, they are relayed to the status events topic in it';
+COMMENT ON COLUMN status_events.tenant_id IS 'Tenant of the notification';
+COMMENT ON COLUMN status_events.notification_uuid IS 'UUID of the notification that changed state';
+COMMENT ON COLUMN status_events.parent_uuid IS 'UUID of the fan-out the notification is a child of';
+COMMENT ON COLUMN status_events."destination" IS 'Destination of the notification';
+COMMENT ON COLUMN status_events.state IS 'State the notification entered';
+COMMENT ON COLUMN status_events.reason IS 'Why it failed or was suppressed';
+COMMENT ON COLUMN status_events.created_at IS 'When the notification entered the state';
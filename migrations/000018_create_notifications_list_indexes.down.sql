@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS notifications@notifications_tenant_id_status_server_timestamp_idx;
+DROP INDEX IF EXISTS notifications@notifications_tenant_id_destination_server_timestamp_idx;
+DROP INDEX IF EXISTS notifications@notifications_tenant_id_server_timestamp_idx;
@@ -0,0 +1,3 @@
+CREATE INDEX IF NOT EXISTS notifications_tenant_id_server_timestamp_idx ON notifications (tenant_id, server_timestamp DESC, uuid DESC);
+CREATE INDEX IF NOT EXISTS notifications_tenant_id_destination_server_timestamp_idx ON notifications (tenant_id, "destination", server_timestamp DESC, uuid DESC);
+CREATE INDEX IF NOT EXISTS notifications_tenant_id_status_server_timestamp_idx ON notifications (tenant_id, status, server_timestamp DESC, uuid DESC);
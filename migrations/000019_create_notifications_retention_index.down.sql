@@ -0,0 +1 @@
+DROP INDEX IF EXISTS notifications@notifications_destination_server_timestamp_idx;
@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS notifications_destination_server_timestamp_idx ON notifications ("destination", server_timestamp);
@@ -0,0 +1,3 @@
+ALTER TABLE notifications
+    DROP COLUMN IF EXISTS retry_reason,
+    DROP COLUMN IF EXISTS retrying_at;
@@ -0,0 +1,8 @@
+ALTER TABLE notifications
+    ADD COLUMN retrying_at timestamp NULL,
+    ADD COLUMN retry_reason varchar NULL;
+
+-- Column comments
+
+COMMENT ON COLUMN notifications.retrying_at IS 'When the notification last went to a retry tier';
+COMMENT ON COLUMN notifications.retry_reason IS 'Why the last attempt to deliver the notification was refused';
@@ -0,0 +1,5 @@
+ALTER TABLE status_events
+    DROP COLUMN IF EXISTS provider;
+
+ALTER TABLE notifications
+    DROP COLUMN IF EXISTS provider;
@@ -0,0 +1,10 @@
+ALTER TABLE notifications
+    ADD COLUMN provider varchar NULL;
+
+ALTER TABLE status_events
+    ADD COLUMN provider varchar NULL;
+
+-- Column comments
+
+COMMENT ON COLUMN notifications.provider IS 'The provider of its destination that delivered the notification';
+COMMENT ON COLUMN status_events.provider IS 'The provider that delivered it, when it was delivered';
@@ -0,0 +1,6 @@
+ALTER TABLE status_events
+    ADD COLUMN claimed_until timestamp NULL;
+
+-- Column comments
+
+COMMENT ON COLUMN status_events.claimed_until IS 'Until when a relay publishing the event holds it, no other relay claims events meanwhile';
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS status_events@status_events_notification_uuid_id_idx;
+DROP INDEX IF EXISTS status_events@status_events_claimed_until_idx;
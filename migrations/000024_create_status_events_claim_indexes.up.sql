@@ -0,0 +1,2 @@
+CREATE INDEX IF NOT EXISTS status_events_notification_uuid_id_idx ON status_events (notification_uuid, id);
+CREATE INDEX IF NOT EXISTS status_events_claimed_until_idx ON status_events (claimed_until);
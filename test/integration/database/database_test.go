@@ -2,12 +2,14 @@ package database_test
 
 import (
 	"context"
+	"errors"
 	"github.com/cockroachdb/cockroach-go/v2/crdb/crdbpgx"
 	"github.com/despondency/notifications-service/internal/notification"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v4"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"time"
 )
 
 var _ = Describe("Database", func() {
@@ -20,11 +22,11 @@ var _ = Describe("Database", func() {
 			toInsert *notification.Notification
 		)
 
-		var uuid = uuid.New()
+		var notifUUID = uuid.New()
 
 		BeforeEach(func() {
 			toInsert = &notification.Notification{
-				UUID:            uuid,
+				UUID:            notifUUID,
 				NotificationTxt: "txt",
 				Dest:            notification.Email,
 			}
@@ -55,16 +57,632 @@ var _ = Describe("Database", func() {
 					BeforeEach(func() {
 						err = crdbpgx.ExecuteTx(context.Background(), connPool, pgx.TxOptions{}, func(tx pgx.Tx) error {
 							var errGet error
-							notificationInserted, errGet = store.Get(context.Background(), toInsert.UUID, tx)
+							notificationInserted, errGet = store.Get(context.Background(), notification.DefaultTenant, toInsert.UUID, tx)
 							return errGet
 						})
 					})
 					It("should get the notification", func() {
 						Expect(err).To(BeNil())
 						Expect(notificationInserted).To(Not(BeNil()))
+						Expect(notificationInserted.TenantID).To(Equal(notification.DefaultTenant))
 					})
 				})
+				Context("Check the same notification for conflicts", func() {
+					var (
+						conflicting bool
+					)
+					BeforeEach(func() {
+						err = crdbpgx.ExecuteTx(context.Background(), connPool, pgx.TxOptions{}, func(tx pgx.Tx) error {
+							var errConflict error
+							conflicting, errConflict = store.RecordIfConflicting(context.Background(), toInsert, tx)
+							return errConflict
+						})
+					})
+					It("should not be conflicting", func() {
+						Expect(err).To(BeNil())
+						Expect(conflicting).To(BeFalse())
+					})
+				})
+				Context("Reuse the uuid with a different payload", func() {
+					var (
+						conflicting          bool
+						notificationInserted *notification.Notification
+					)
+					BeforeEach(func() {
+						err = crdbpgx.ExecuteTx(context.Background(), connPool, pgx.TxOptions{}, func(tx pgx.Tx) error {
+							var errConflict error
+							conflicting, errConflict = store.RecordIfConflicting(context.Background(), &notification.Notification{
+								UUID:            toInsert.UUID,
+								NotificationTxt: "different txt",
+								Dest:            notification.Email,
+							}, tx)
+							if errConflict != nil {
+								return errConflict
+							}
+							var errGet error
+							notificationInserted, errGet = store.Get(context.Background(), notification.DefaultTenant, toInsert.UUID, tx)
+							return errGet
+						})
+					})
+					It("should record the conflict on the stored row", func() {
+						Expect(err).To(BeNil())
+						Expect(conflicting).To(BeTrue())
+						Expect(notificationInserted.NotificationTxt).To(Equal("txt"))
+						Expect(notificationInserted.ConflictCount).To(BeNumerically(">=", 1))
+						Expect(notificationInserted.LastConflictAt).To(Not(BeNil()))
+					})
+				})
+				Context("Get many notifications", func() {
+					var (
+						notificationsFound []*notification.Notification
+					)
+					BeforeEach(func() {
+						err = crdbpgx.ExecuteTx(context.Background(), connPool, pgx.TxOptions{}, func(tx pgx.Tx) error {
+							var errGet error
+							notificationsFound, errGet = store.GetMany(context.Background(), notification.DefaultTenant, []uuid.UUID{toInsert.UUID, uuid.New()}, tx)
+							return errGet
+						})
+					})
+					It("should get only the existing notification", func() {
+						Expect(err).To(BeNil())
+						Expect(notificationsFound).To(HaveLen(1))
+						Expect(notificationsFound[0].UUID).To(Equal(toInsert.UUID))
+					})
+				})
+			})
+		})
+	})
+
+	Context("Test templates", func() {
+
+		var (
+			err         error
+			name        string
+			version     int64
+			newVersion  int64
+			latest      *notification.Template
+			firstPinned *notification.Template
+		)
+
+		BeforeEach(func() {
+			name = "welcome-" + uuid.New().String()
+			err = crdbpgx.ExecuteTx(context.Background(), connPool, pgx.TxOptions{}, func(tx pgx.Tx) error {
+				var errInsert error
+				version, errInsert = store.InsertTemplateVersion(context.Background(), notification.DefaultTenant, &notification.Template{
+					Name:     name,
+					Variants: []*notification.TemplateVariant{{Destination: "SMS", Body: "Hi {{.name}}"}},
+				}, tx)
+				if errInsert != nil {
+					return errInsert
+				}
+				newVersion, errInsert = store.InsertTemplateVersion(context.Background(), notification.DefaultTenant, &notification.Template{
+					Name: name,
+					Variants: []*notification.TemplateVariant{
+						{Destination: "SMS", Body: "Hello {{.name}}"},
+						{Destination: "EMAIL", Subject: "Hello {{.name}}", Body: "Hello {{.name}}"},
+					},
+				}, tx)
+				return errInsert
+			})
+			Expect(err).To(BeNil())
+		})
+
+		JustBeforeEach(func() {
+			err = crdbpgx.ExecuteTx(context.Background(), connPool, pgx.TxOptions{}, func(tx pgx.Tx) error {
+				var errGet error
+				latest, errGet = store.GetTemplate(context.Background(), notification.DefaultTenant, name, 0, tx)
+				if errGet != nil {
+					return errGet
+				}
+				firstPinned, errGet = store.GetTemplate(context.Background(), notification.DefaultTenant, name, version, tx)
+				return errGet
+			})
+		})
+
+		It("should version every update", func() {
+			Expect(err).To(BeNil())
+			Expect(version).To(Equal(int64(1)))
+			Expect(newVersion).To(Equal(int64(2)))
+			Expect(latest.Version).To(Equal(newVersion))
+			Expect(latest.Variants).To(HaveLen(2))
+			Expect(firstPinned.Variants).To(HaveLen(1))
+			Expect(firstPinned.Variants[0].Body).To(Equal("Hi {{.name}}"))
+		})
+	})
+
+	Context("Test tenants", func() {
+
+		var (
+			err       error
+			affected  int64
+			notifUUID uuid.UUID
+			ofOther   *notification.Notification
+		)
+
+		BeforeEach(func() {
+			notifUUID = uuid.New()
+			err = crdbpgx.ExecuteTx(context.Background(), connPool, pgx.TxOptions{}, func(tx pgx.Tx) error {
+				_, errInsert := store.InsertIfNotExists(context.Background(), &notification.Notification{
+					UUID:            notifUUID,
+					NotificationTxt: "txt",
+					Dest:            notification.Email,
+				}, tx)
+				if errInsert != nil {
+					return errInsert
+				}
+				affected, errInsert = store.InsertIfNotExists(context.Background(), &notification.Notification{
+					UUID:            notifUUID,
+					NotificationTxt: "other txt",
+					Dest:            notification.SMS,
+					TenantID:        "other",
+				}, tx)
+				return errInsert
+			})
+			Expect(err).To(BeNil())
+		})
+
+		JustBeforeEach(func() {
+			err = crdbpgx.ExecuteTx(context.Background(), connPool, pgx.TxOptions{}, func(tx pgx.Tx) error {
+				var errGet error
+				ofOther, errGet = store.Get(context.Background(), "other", notifUUID, tx)
+				return errGet
+			})
+		})
+
+		It("should only scope uuids to their tenant", func() {
+			Expect(err).To(BeNil())
+			Expect(affected).To(Equal(int64(1)))
+			Expect(ofOther.TenantID).To(Equal("other"))
+			Expect(ofOther.NotificationTxt).To(Equal("other txt"))
+		})
+	})
+
+	Context("Test frequency caps", func() {
+
+		var (
+			err        error
+			recipient  *notification.Recipient
+			delivered  *notification.Notification
+			suppressed *notification.Notification
+			count      int64
+		)
+
+		BeforeEach(func() {
+			recipient = &notification.Recipient{Email: uuid.New().String() + "@example.com"}
+			delivered = &notification.Notification{UUID: uuid.New(), NotificationTxt: "txt", Dest: notification.Email, Recipient: recipient}
+			suppressed = &notification.Notification{UUID: uuid.New(), NotificationTxt: "txt", Dest: notification.Email, Recipient: recipient}
+			err = crdbpgx.ExecuteTx(context.Background(), connPool, pgx.TxOptions{}, func(tx pgx.Tx) error {
+				for _, n := range []*notification.Notification{delivered, suppressed} {
+					if _, errInsert := store.InsertIfNotExists(context.Background(), n, tx); errInsert != nil {
+						return errInsert
+					}
+				}
+				for _, n := range []*notification.Notification{delivered, suppressed} {
+					if errMark := store.Transition(context.Background(), n, notification.StateDispatching, notification.TransitionOpts{}, tx); errMark != nil {
+						return errMark
+					}
+				}
+				if errMark := store.Transition(context.Background(), delivered, notification.StateDelivered, notification.TransitionOpts{}, tx); errMark != nil {
+					return errMark
+				}
+				return store.Transition(context.Background(), suppressed, notification.StateSuppressed, notification.TransitionOpts{Reason: "frequency cap EMAIL:1/1h reached"}, tx)
+			})
+			Expect(err).To(BeNil())
+		})
+
+		JustBeforeEach(func() {
+			err = crdbpgx.ExecuteTx(context.Background(), connPool, pgx.TxOptions{}, func(tx pgx.Tx) error {
+				var errGet error
+				next := &notification.Notification{UUID: uuid.New(), Dest: notification.Email, Recipient: recipient}
+				count, errGet = store.CountDispatched(context.Background(), next, time.Now().UTC().Add(-time.Hour), tx)
+				if errGet != nil {
+					return errGet
+				}
+				suppressed, errGet = store.Get(context.Background(), notification.DefaultTenant, suppressed.UUID, tx)
+				return errGet
+			})
+		})
+
+		It("should only count the delivered notification", func() {
+			Expect(err).To(BeNil())
+			Expect(count).To(Equal(int64(1)))
+			Expect(suppressed.SuppressedReason).To(Equal("frequency cap EMAIL:1/1h reached"))
+			Expect(suppressed.State).To(Equal(notification.StateSuppressed))
+			Expect(suppressed.Transitions).ToNot(HaveKey(notification.StateDelivered))
+		})
+	})
+
+	Context("Test callbacks", func() {
+
+		var (
+			err     error
+			n       *notification.Notification
+			claimed *notification.Callback
+		)
+
+		BeforeEach(func() {
+			n = &notification.Notification{UUID: uuid.New(), NotificationTxt: "txt", Dest: notification.SMS,
+				CallbackURL: "https://example.com/hooks"}
+			err = crdbpgx.ExecuteTx(context.Background(), connPool, pgx.TxOptions{}, func(tx pgx.Tx) error {
+				if _, errInsert := store.InsertIfNotExists(context.Background(), n, tx); errInsert != nil {
+					return errInsert
+				}
+				if errTransition := store.Transition(context.Background(), n, notification.StateDispatching, notification.TransitionOpts{}, tx); errTransition != nil {
+					return errTransition
+				}
+				return store.Transition(context.Background(), n, notification.StateDelivered, notification.TransitionOpts{Provider: "vendor-a"}, tx)
+			})
+		})
+
+		JustBeforeEach(func() {
+			Expect(err).To(BeNil())
+			err = crdbpgx.ExecuteTx(context.Background(), connPool, pgx.TxOptions{}, func(tx pgx.Tx) error {
+				claimed = nil
+				batch, errClaim := store.ClaimCallbacks(context.Background(), 100, time.Minute, tx)
+				if errClaim != nil {
+					return errClaim
+				}
+				for _, cb := range batch {
+					if cb.NotificationUUID == n.UUID {
+						claimed = cb
+					}
+					if errDelete := store.DeleteCallback(context.Background(), cb.ID, tx); errDelete != nil {
+						return errDelete
+					}
+				}
+				return nil
+			})
+		})
+
+		It("should queue the callback when the notification reaches a final state", func() {
+			Expect(err).To(BeNil())
+			Expect(claimed).ToNot(BeNil())
+			Expect(claimed.NotificationUUID).To(Equal(n.UUID))
+			Expect(claimed.State).To(Equal(notification.StateDelivered))
+			Expect(claimed.URL).To(Equal("https://example.com/hooks"))
+		})
+
+		It("should record the provider that delivered it", func() {
+			Expect(err).To(BeNil())
+			var stored *notification.Notification
+			err = crdbpgx.ExecuteTx(context.Background(), connPool, pgx.TxOptions{}, func(tx pgx.Tx) error {
+				var errGet error
+				stored, errGet = store.Get(context.Background(), notification.DefaultTenant, n.UUID, tx)
+				return errGet
+			})
+			Expect(err).To(BeNil())
+			Expect(stored.Provider).To(Equal("vendor-a"))
+		})
+	})
+
+	Context("Test list notifications", func() {
+
+		var (
+			err      error
+			tenantID string
+			inserted []*notification.Notification
+			page     []*notification.Notification
+			filter   *notification.ListFilter
+		)
+
+		BeforeEach(func() {
+			tenantID = "list-" + uuid.NewString()
+			received := time.Now().UTC().Truncate(time.Microsecond)
+			inserted = nil
+			for i, dest := range []notification.Destination{notification.Slack, notification.Email, notification.Slack, notification.Slack} {
+				inserted = append(inserted, &notification.Notification{UUID: uuid.New(), NotificationTxt: "txt", Dest: dest,
+					TenantID: tenantID, ServerReceivedTimestamp: received.Add(time.Duration(i) * time.Second)})
+			}
+			err = crdbpgx.ExecuteTx(context.Background(), connPool, pgx.TxOptions{}, func(tx pgx.Tx) error {
+				for _, n := range inserted {
+					if _, errInsert := store.InsertIfNotExists(context.Background(), n, tx); errInsert != nil {
+						return errInsert
+					}
+				}
+				return nil
+			})
+			Expect(err).To(BeNil())
+			filter = &notification.ListFilter{TenantID: tenantID, Destinations: []notification.Destination{notification.Slack},
+				States: []notification.State{notification.StateReceived}, Limit: 2}
+		})
+
+		JustBeforeEach(func() {
+			err = crdbpgx.ExecuteTx(context.Background(), connPool, pgx.TxOptions{AccessMode: pgx.ReadOnly}, func(tx pgx.Tx) error {
+				var errList error
+				page, errList = store.ListNotifications(context.Background(), filter, tx)
+				return errList
+			})
+		})
+
+		It("should list the first page newest first", func() {
+			Expect(err).To(BeNil())
+			Expect(page).To(HaveLen(2))
+			Expect(page[0].UUID).To(Equal(inserted[3].UUID))
+			Expect(page[1].UUID).To(Equal(inserted[2].UUID))
+		})
+
+		Context("After the cursor of the first page", func() {
+			BeforeEach(func() {
+				filter.After = &notification.ListCursor{ServerTimestamp: inserted[2].ServerReceivedTimestamp, UUID: inserted[2].UUID}
+			})
+
+			It("should list the rest", func() {
+				Expect(err).To(BeNil())
+				Expect(page).To(HaveLen(1))
+				Expect(page[0].UUID).To(Equal(inserted[0].UUID))
+			})
+		})
+
+		Context("Within a time range", func() {
+			BeforeEach(func() {
+				from, to := inserted[1].ServerReceivedTimestamp, inserted[3].ServerReceivedTimestamp
+				filter.Destinations = nil
+				filter.From, filter.To = &from, &to
+			})
+
+			It("should only list what was received in it", func() {
+				Expect(err).To(BeNil())
+				Expect(page).To(HaveLen(2))
+				Expect(page[0].UUID).To(Equal(inserted[2].UUID))
+				Expect(page[1].UUID).To(Equal(inserted[1].UUID))
+			})
+		})
+	})
+
+	Context("Test purge expired notifications", func() {
+
+		var (
+			err              error
+			delivered, stuck *notification.Notification
+			claimed          map[uuid.UUID]struct{}
+		)
+
+		BeforeEach(func() {
+			received := time.Now().UTC().Add(-40 * 24 * time.Hour)
+			delivered = &notification.Notification{UUID: uuid.New(), NotificationTxt: "txt", Dest: notification.SMS,
+				ServerReceivedTimestamp: received}
+			stuck = &notification.Notification{UUID: uuid.New(), NotificationTxt: "txt", Dest: notification.SMS,
+				ServerReceivedTimestamp: received}
+			err = crdbpgx.ExecuteTx(context.Background(), connPool, pgx.TxOptions{}, func(tx pgx.Tx) error {
+				for _, n := range []*notification.Notification{delivered, stuck} {
+					if _, errInsert := store.InsertIfNotExists(context.Background(), n, tx); errInsert != nil {
+						return errInsert
+					}
+				}
+				if errTransition := store.Transition(context.Background(), delivered, notification.StateDispatching, notification.TransitionOpts{}, tx); errTransition != nil {
+					return errTransition
+				}
+				return store.Transition(context.Background(), delivered, notification.StateDelivered, notification.TransitionOpts{}, tx)
+			})
+			Expect(err).To(BeNil())
+		})
+
+		JustBeforeEach(func() {
+			err = crdbpgx.ExecuteTx(context.Background(), connPool, pgx.TxOptions{}, func(tx pgx.Tx) error {
+				claimed = make(map[uuid.UUID]struct{})
+				expired, errClaim := store.ClaimExpired(context.Background(), notification.SMS, time.Now().UTC().Add(-30*24*time.Hour),
+					100_000, tx)
+				if errClaim != nil {
+					return errClaim
+				}
+				ours := make([]*notification.Notification, 0, 1)
+				for _, n := range expired {
+					claimed[n.UUID] = struct{}{}
+					if n.UUID == delivered.UUID || n.UUID == stuck.UUID {
+						ours = append(ours, n)
+					}
+				}
+				return store.DeleteNotifications(context.Background(), ours, tx)
 			})
 		})
+
+		It("should only purge the notifications that reached a final state", func() {
+			Expect(err).To(BeNil())
+			Expect(claimed).To(HaveKey(delivered.UUID))
+			Expect(claimed).ToNot(HaveKey(stuck.UUID))
+			err = crdbpgx.ExecuteTx(context.Background(), connPool, pgx.TxOptions{}, func(tx pgx.Tx) error {
+				_, errGet := store.Get(context.Background(), notification.DefaultTenant, delivered.UUID, tx)
+				Expect(errGet).To(Equal(pgx.ErrNoRows))
+				_, errGet = store.Get(context.Background(), notification.DefaultTenant, stuck.UUID, tx)
+				return errGet
+			})
+			Expect(err).To(BeNil())
+		})
+	})
+
+	Context("Test status events", func() {
+
+		var (
+			err    error
+			n      *notification.Notification
+			states []notification.State
+		)
+
+		BeforeEach(func() {
+			n = &notification.Notification{UUID: uuid.New(), NotificationTxt: "txt", Dest: notification.Email,
+				Recipient: &notification.Recipient{Email: "jane@example.com"}}
+			err = crdbpgx.ExecuteTx(context.Background(), connPool, pgx.TxOptions{}, func(tx pgx.Tx) error {
+				if _, errInsert := store.InsertIfNotExists(context.Background(), n, tx); errInsert != nil {
+					return errInsert
+				}
+				if errTransition := store.Transition(context.Background(), n, notification.StateDispatching, notification.TransitionOpts{}, tx); errTransition != nil {
+					return errTransition
+				}
+				return store.Transition(context.Background(), n, notification.StateFailed, notification.TransitionOpts{Reason: "provider refused"}, tx)
+			})
+		})
+
+		JustBeforeEach(func() {
+			Expect(err).To(BeNil())
+			states = nil
+			err = crdbpgx.ExecuteTx(context.Background(), connPool, pgx.TxOptions{}, func(tx pgx.Tx) error {
+				states = nil
+				// nothing relays the events of this suite, so they pile up
+				for {
+					ids, events, errClaim := store.ClaimStatusEvents(context.Background(), 100_000, time.Minute, tx)
+					if errClaim != nil {
+						return errClaim
+					}
+					if len(events) == 0 {
+						return nil
+					}
+					// the later events of a notification wait for the claimed one to be deleted
+					_, held, errClaim := store.ClaimStatusEvents(context.Background(), 100_000, time.Minute, tx)
+					if errClaim != nil {
+						return errClaim
+					}
+					Expect(held).To(BeEmpty())
+					for _, e := range events {
+						if e.UUID == n.UUID {
+							Expect(e.Destination).To(Equal("EMAIL"))
+							states = append(states, e.State)
+						}
+					}
+					if errDelete := store.DeleteStatusEvents(context.Background(), ids, tx); errDelete != nil {
+						return errDelete
+					}
+				}
+			})
+		})
+
+		It("should record every state the notification entered in order", func() {
+			Expect(err).To(BeNil())
+			Expect(states).To(Equal([]notification.State{notification.StateReceived, notification.StateDispatching, notification.StateFailed}))
+		})
+	})
+
+	Context("Test state transitions", func() {
+
+		var (
+			err          error
+			errDelivered error
+			n            *notification.Notification
+		)
+
+		BeforeEach(func() {
+			n = &notification.Notification{UUID: uuid.New(), NotificationTxt: "txt", Dest: notification.SMS}
+			err = crdbpgx.ExecuteTx(context.Background(), connPool, pgx.TxOptions{}, func(tx pgx.Tx) error {
+				if _, errInsert := store.InsertIfNotExists(context.Background(), n, tx); errInsert != nil {
+					return errInsert
+				}
+				errDelivered = store.Transition(context.Background(), n, notification.StateDelivered, notification.TransitionOpts{}, tx)
+				for _, to := range []notification.State{notification.StateDispatching, notification.StateRetrying, notification.StateDispatching} {
+					if errTransition := store.Transition(context.Background(), n, to, notification.TransitionOpts{Reason: "provider timed out"}, tx); errTransition != nil {
+						return errTransition
+					}
+				}
+				return store.Transition(context.Background(), n, notification.StateFailed, notification.TransitionOpts{Reason: "provider refused"}, tx)
+			})
+		})
+
+		JustBeforeEach(func() {
+			Expect(err).To(BeNil())
+			err = crdbpgx.ExecuteTx(context.Background(), connPool, pgx.TxOptions{}, func(tx pgx.Tx) error {
+				var errGet error
+				n, errGet = store.Get(context.Background(), notification.DefaultTenant, n.UUID, tx)
+				return errGet
+			})
+		})
+
+		It("should only move along the state machine", func() {
+			Expect(err).To(BeNil())
+			Expect(errors.Is(errDelivered, notification.ErrInvalidTransition)).To(BeTrue())
+			Expect(n.State).To(Equal(notification.StateFailed))
+			Expect(n.FailureReason).To(Equal("provider refused"))
+			Expect(n.RetryReason).To(Equal("provider timed out"))
+			Expect(n.Transitions).To(HaveKey(notification.StateReceived))
+			Expect(n.Transitions).To(HaveKey(notification.StateRetrying))
+			Expect(n.Transitions).To(HaveKey(notification.StateDispatching))
+			Expect(n.Transitions).To(HaveKey(notification.StateFailed))
+			Expect(n.Transitions).ToNot(HaveKey(notification.StateDelivered))
+		})
+	})
+
+	Context("Test cancellations", func() {
+
+		var (
+			err       error
+			parent    uuid.UUID
+			child     *notification.Notification
+			cancelled bool
+		)
+
+		BeforeEach(func() {
+			parent = uuid.New()
+			child = &notification.Notification{UUID: uuid.New(), NotificationTxt: "txt", Dest: notification.SMS, ParentUUID: &parent}
+			err = crdbpgx.ExecuteTx(context.Background(), connPool, pgx.TxOptions{}, func(tx pgx.Tx) error {
+				return store.InsertCancellation(context.Background(), notification.DefaultTenant, parent, tx)
+			})
+			Expect(err).To(BeNil())
+		})
+
+		JustBeforeEach(func() {
+			err = crdbpgx.ExecuteTx(context.Background(), connPool, pgx.TxOptions{}, func(tx pgx.Tx) error {
+				var errGet error
+				cancelled, errGet = store.IsCancelled(context.Background(), child, tx)
+				return errGet
+			})
+		})
+
+		It("should cancel the children of a cancelled fan-out", func() {
+			Expect(err).To(BeNil())
+			Expect(cancelled).To(BeTrue())
+		})
+
+		Context("Another tenant", func() {
+			BeforeEach(func() {
+				child.TenantID = "other"
+			})
+
+			It("should not be cancelled", func() {
+				Expect(err).To(BeNil())
+				Expect(cancelled).To(BeFalse())
+			})
+		})
+	})
+
+	Context("Test scheduled notifications", func() {
+
+		var (
+			err     error
+			n       *notification.Notification
+			claimed []*notification.Notification
+			again   []*notification.Notification
+		)
+
+		BeforeEach(func() {
+			sendAt := time.Now().Add(-time.Minute)
+			n = &notification.Notification{UUID: uuid.New(), NotificationTxt: "txt", Dest: notification.SMS, SendAt: &sendAt,
+				Recipient: &notification.Recipient{Phone: "+15551234567"}}
+			err = crdbpgx.ExecuteTx(context.Background(), connPool, pgx.TxOptions{}, func(tx pgx.Tx) error {
+				if _, errInsert := store.InsertIfNotExists(context.Background(), n, tx); errInsert != nil {
+					return errInsert
+				}
+				return store.Schedule(context.Background(), n, tx)
+			})
+			Expect(err).To(BeNil())
+		})
+
+		JustBeforeEach(func() {
+			err = crdbpgx.ExecuteTx(context.Background(), connPool, pgx.TxOptions{}, func(tx pgx.Tx) error {
+				var errClaim error
+				claimed, errClaim = store.ClaimDue(context.Background(), 100, time.Minute, tx)
+				if errClaim != nil {
+					return errClaim
+				}
+				// leased, another scheduler gets nothing until the lease is over
+				again, errClaim = store.ClaimDue(context.Background(), 100, time.Minute, tx)
+				if errClaim != nil {
+					return errClaim
+				}
+				return store.Unschedule(context.Background(), n, tx)
+			})
+		})
+
+		It("should claim a due notification once", func() {
+			Expect(err).To(BeNil())
+			Expect(claimed).To(ContainElement(HaveField("UUID", n.UUID)))
+			Expect(again).ToNot(ContainElement(HaveField("UUID", n.UUID)))
+		})
 	})
 })
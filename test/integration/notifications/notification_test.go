@@ -14,6 +14,7 @@ import (
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"net/http"
+	"time"
 )
 
 var (
@@ -35,6 +36,7 @@ var _ = Describe("Notifications", func() {
 				UUID:            uuid.New().String(),
 				NotificationTxt: fmt.Sprintf("%s-%s", "TEST", uuid.New().String()),
 				Destination:     "EMAIL",
+				Recipient:       &notification.Recipient{Email: "jane@example.com"},
 			})
 		})
 
@@ -50,6 +52,7 @@ var _ = Describe("Notifications", func() {
 				UUID:            uuid.New().String(),
 				NotificationTxt: fmt.Sprintf("%s-%s", "TEST", uuid.New().String()),
 				Destination:     "SMS",
+				Recipient:       &notification.Recipient{Phone: "+15551234567"},
 			})
 		})
 
@@ -65,6 +68,7 @@ var _ = Describe("Notifications", func() {
 				UUID:            uuid.New().String(),
 				NotificationTxt: fmt.Sprintf("%s-%s", "TEST", uuid.New().String()),
 				Destination:     "SLACK",
+				Recipient:       &notification.Recipient{SlackChannel: "C0123456789"},
 			})
 		})
 
@@ -73,6 +77,43 @@ var _ = Describe("Notifications", func() {
 		})
 	})
 
+	Context("Create scheduled NotificationRequest and push it", func() {
+		BeforeEach(func() {
+			sendAt := time.Now().Add(5 * time.Second)
+			notifications = make([]*notification.Request, 0)
+			notifications = append(notifications, &notification.Request{
+				UUID:            uuid.New().String(),
+				NotificationTxt: fmt.Sprintf("%s-%s", "TEST", uuid.New().String()),
+				Destination:     "EMAIL",
+				Recipient:       &notification.Recipient{Email: "jane@example.com"},
+				SendAt:          &sendAt,
+			})
+		})
+
+		It("should be released by the scheduler", func() {
+			Eventually(CheckNotifications).Should(Equal(true))
+			Eventually(CheckNotificationsReleased).Should(Equal(true))
+		})
+	})
+
+	Context("Create fan-out NotificationRequest and push it", func() {
+		BeforeEach(func() {
+			notifications = make([]*notification.Request, 0)
+			notifications = append(notifications, &notification.Request{
+				UUID:            uuid.New().String(),
+				NotificationTxt: fmt.Sprintf("%s-%s", "TEST", uuid.New().String()),
+				Destinations: []*notification.DestinationRequest{
+					{Destination: "EMAIL", Recipient: &notification.Recipient{Email: "jane@example.com"}},
+					{Destination: "SLACK", Recipient: &notification.Recipient{SlackChannel: "C0123456789"}},
+				},
+			})
+		})
+
+		It("should push a child per destination", func() {
+			Eventually(CheckFanOutNotifications).Should(Equal(true))
+		})
+	})
+
 	Context("Create 100 notification and push them", func() {
 		BeforeEach(func() {
 			notifications = make([]*notification.Request, 100)
@@ -81,6 +122,7 @@ var _ = Describe("Notifications", func() {
 					UUID:            uuid.New().String(),
 					NotificationTxt: fmt.Sprintf("%s-%s", "TEST", uuid.New().String()),
 					Destination:     "EMAIL",
+					Recipient:       &notification.Recipient{Email: "jane@example.com"},
 				}
 			}
 		})
@@ -98,7 +140,7 @@ func CheckNotifications() bool {
 		var storedNotification *notification.Notification
 		err := crdbpgx.ExecuteTx(ctx, connPool, pgx.TxOptions{}, func(tx pgx.Tx) error {
 			var errGet error
-			storedNotification, errGet = store.Get(ctx, uuid.MustParse(n.UUID), tx)
+			storedNotification, errGet = store.Get(ctx, notification.DefaultTenant, uuid.MustParse(n.UUID), tx)
 			return errGet
 		})
 		if err != nil && err.Error() == "no rows in result set" {
@@ -115,6 +157,44 @@ func CheckNotifications() bool {
 	return false
 }
 
+func CheckFanOutNotifications() bool {
+	for _, n := range notifications {
+		ctx := context.Background()
+		var children []*notification.Notification
+		err := crdbpgx.ExecuteTx(ctx, connPool, pgx.TxOptions{}, func(tx pgx.Tx) error {
+			var errGet error
+			children, errGet = store.GetByParents(ctx, notification.DefaultTenant, []uuid.UUID{uuid.MustParse(n.UUID)}, tx)
+			return errGet
+		})
+		if err != nil {
+			panic(err)
+		}
+		if len(children) != len(n.Destinations) {
+			return false
+		}
+	}
+	return true
+}
+
+func CheckNotificationsReleased() bool {
+	for _, n := range notifications {
+		ctx := context.Background()
+		var storedNotification *notification.Notification
+		err := crdbpgx.ExecuteTx(ctx, connPool, pgx.TxOptions{}, func(tx pgx.Tx) error {
+			var errGet error
+			storedNotification, errGet = store.Get(ctx, notification.DefaultTenant, uuid.MustParse(n.UUID), tx)
+			return errGet
+		})
+		if err != nil {
+			panic(err)
+		}
+		if storedNotification.State != notification.StateDelivered {
+			return false
+		}
+	}
+	return true
+}
+
 func sendNotification(n *notification.Request) {
 	b, err := json.Marshal(n)
 	if err != nil {